@@ -0,0 +1,118 @@
+// Command alertsink is a local stand-in for the services alerts are sent
+// to: an HTTP endpoint that accepts webhook POSTs and a minimal SMTP server
+// that accepts mail, both logging what they receive. Everything received is
+// listed at GET /received, so saved-search alerts can be checked end to end
+// without a real mail server or webhook consumer. With -webhook-secret set,
+// webhook requests must carry a valid signature or get a 401.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/webhooks"
+)
+
+// received is one webhook request or email.
+type received struct {
+	Kind       string            `json:"kind"`
+	At         time.Time         `json:"at"`
+	Path       string            `json:"path,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	From       string            `json:"from,omitempty"`
+	To         []string          `json:"to,omitempty"`
+	Body       json.RawMessage   `json:"body,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	StatusCode int               `json:"status_code,omitempty"`
+}
+
+type inbox struct {
+	mu    sync.Mutex
+	items []received
+	max   int
+}
+
+func (b *inbox) add(r received) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.items = append(b.items, r)
+	if len(b.items) > b.max {
+		b.items = b.items[len(b.items)-b.max:]
+	}
+}
+
+func (b *inbox) list() []received {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]received{}, b.items...)
+}
+
+func main() {
+	httpAddr := flag.String("http", ":8091", "webhook listen address")
+	smtpAddr := flag.String("smtp", ":2525", "SMTP listen address; empty disables it")
+	failRate := flag.Float64("fail-rate", 0, "fraction of webhook requests answered with a 503")
+	keep := flag.Int("keep", 1000, "how many received items to keep for GET /received")
+	secret := flag.String("webhook-secret", "", "signing secret to verify webhook signatures against")
+	flag.Parse()
+
+	box := &inbox{max: *keep}
+
+	if *smtpAddr != "" {
+		go func() {
+			if err := serveSMTP(*smtpAddr, box); err != nil {
+				log.Fatalf("SMTP server failed: %v", err)
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /received", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(box.list())
+	})
+	mux.HandleFunc("DELETE /received", func(w http.ResponseWriter, r *http.Request) {
+		box.mu.Lock()
+		box.items = nil
+		box.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		status := http.StatusOK
+		if *secret != "" && !webhooks.Verify(*secret, r.Header.Get(webhooks.HeaderSignature),
+			r.Header.Get(webhooks.HeaderTimestamp), body, 5*time.Minute) {
+			status = http.StatusUnauthorized
+		} else if *failRate > 0 && rand.Float64() < *failRate {
+			status = http.StatusServiceUnavailable
+		}
+
+		headers := make(map[string]string)
+		for k := range r.Header {
+			headers[k] = r.Header.Get(k)
+		}
+		item := received{Kind: "webhook", At: time.Now().UTC(), Path: r.URL.Path, Headers: headers, StatusCode: status}
+		if json.Valid(body) {
+			item.Body = body
+		} else {
+			item.Message = string(body)
+		}
+		box.add(item)
+		log.Printf("webhook %s (%d bytes) -> %d: %s", r.URL.Path, len(body), status, body)
+
+		w.WriteHeader(status)
+	})
+
+	log.Printf("alertsink: webhooks on %s, SMTP on %s", *httpAddr, *smtpAddr)
+	log.Fatal(http.ListenAndServe(*httpAddr, mux))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// serveSMTP accepts mail with just enough of RFC 5321 for net/smtp.SendMail:
+// no TLS and no auth are advertised, and every message is accepted.
+func serveSMTP(addr string, box *inbox) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go handleSMTP(conn, box)
+	}
+}
+
+func handleSMTP(conn net.Conn, box *inbox) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	rd := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	var from string
+	var to []string
+	reply("220 alertsink ESMTP ready")
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(verb, "EHLO"):
+			reply("250-alertsink")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(verb, "HELO"):
+			reply("250 alertsink")
+		case strings.HasPrefix(verb, "MAIL FROM:"):
+			from = strings.Trim(strings.TrimSpace(line[len("MAIL FROM:"):]), "<>")
+			to = nil
+			reply("250 OK")
+		case strings.HasPrefix(verb, "RCPT TO:"):
+			to = append(to, strings.Trim(strings.TrimSpace(line[len("RCPT TO:"):]), "<>"))
+			reply("250 OK")
+		case verb == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var msg strings.Builder
+			for {
+				l, err := rd.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if strings.TrimRight(l, "\r\n") == "." {
+					break
+				}
+				// Undo dot-stuffing.
+				msg.WriteString(strings.TrimPrefix(l, "."))
+			}
+			box.add(received{Kind: "email", At: time.Now().UTC(), From: from, To: to, Message: msg.String()})
+			log.Printf("email from %s to %v:\n%s", from, to, msg.String())
+			reply("250 OK: queued")
+		case verb == "RSET":
+			from, to = "", nil
+			reply("250 OK")
+		case verb == "NOOP":
+			reply("250 OK")
+		case verb == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
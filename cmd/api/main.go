@@ -1,33 +1,47 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"unicode"
 
+	"github.com/omerahmer/motor_metrics/internal/analytics"
 	"github.com/omerahmer/motor_metrics/internal/cache"
 	"github.com/omerahmer/motor_metrics/internal/config"
+	"github.com/omerahmer/motor_metrics/internal/feed"
+	"github.com/omerahmer/motor_metrics/internal/kafka"
 	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/netguard"
+	"github.com/omerahmer/motor_metrics/internal/nhtsa"
+	"github.com/omerahmer/motor_metrics/internal/quota"
 	"github.com/omerahmer/motor_metrics/internal/ratelimit"
 	"github.com/omerahmer/motor_metrics/internal/repository"
+	"github.com/omerahmer/motor_metrics/internal/safety"
+	"github.com/omerahmer/motor_metrics/internal/savedsearch"
+	"github.com/omerahmer/motor_metrics/internal/valuation"
+	"github.com/omerahmer/motor_metrics/internal/vin"
+	"github.com/omerahmer/motor_metrics/internal/vindecode"
+	"github.com/omerahmer/motor_metrics/internal/webhooks"
 )
 
 type SearchRequest struct {
-	Make   string `json:"make"`
-	Model  string `json:"model"`
-	Zip    string `json:"zip"`
-	Radius int    `json:"radius"`
-	Rows   int    `json:"rows"`
+	marketcheck.SearchParams
+	Rows int `json:"rows"`
 }
 
 type SearchResponse struct {
 	Listings []EnrichedListingResponse `json:"listings"`
 	Count    int                       `json:"count"`
+	Degraded bool                      `json:"degraded,omitempty"`
 }
 
 type EnrichedListingResponse struct {
@@ -35,6 +49,188 @@ type EnrichedListingResponse struct {
 	Build        marketcheck.Build        `json:"build"`
 	PriceHistory []marketcheck.PricePoint `json:"price_history"`
 	Valuation    marketcheck.Valuation    `json:"valuation"`
+	Safety       *marketcheck.Safety      `json:"safety,omitempty"`
+}
+
+type DepreciationCurveResponse struct {
+	analytics.Curve
+	AnnualDepreciation  float64 `json:"annual_depreciation"`
+	MileageDepreciation float64 `json:"mileage_depreciation_per_10k"`
+}
+
+type DepreciationPoint struct {
+	AgeYears int `json:"age_years"`
+	Miles    int `json:"miles"`
+	Price    int `json:"price"`
+}
+
+type DepreciationProjection struct {
+	Trim         string                 `json:"trim"`
+	Year         int                    `json:"year"`
+	AgeYears     float64                `json:"age_years"`
+	Miles        int                    `json:"miles"`
+	AnnualMiles  int                    `json:"annual_miles"`
+	CurrentValue int                    `json:"current_value"`
+	Projections  []analytics.Projection `json:"projections"`
+}
+
+func queryInt(q url.Values, key string) int {
+	if v := q.Get(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+func parseSearchQuery(q url.Values) SearchRequest {
+	return SearchRequest{
+		SearchParams: marketcheck.SearchParams{
+			Make:       q.Get("make"),
+			Model:      q.Get("model"),
+			Trim:       q.Get("trim"),
+			Zip:        q.Get("zip"),
+			Radius:     queryInt(q, "radius"),
+			YearMin:    queryInt(q, "year_min"),
+			YearMax:    queryInt(q, "year_max"),
+			PriceMin:   queryInt(q, "price_min"),
+			PriceMax:   queryInt(q, "price_max"),
+			MilesMin:   queryInt(q, "miles_min"),
+			MilesMax:   queryInt(q, "miles_max"),
+			BodyType:   q.Get("body_type"),
+			Drivetrain: q.Get("drivetrain"),
+			FuelType:   q.Get("fuel_type"),
+			SellerType: q.Get("seller_type"),
+			CarType:    q.Get("car_type"),
+			SortBy:     q.Get("sort_by"),
+			SortOrder:  q.Get("sort_order"),
+		},
+		Rows: queryInt(q, "rows"),
+	}
+}
+
+// checkSubscriptionURL rejects webhook subscription URLs that resolve to
+// non-public addresses, unless allowPrivate is set, so that the producer
+// can't be made to POST to internal services.
+func checkSubscriptionURL(ctx context.Context, rawURL string, allowPrivate bool) error {
+	if allowPrivate {
+		return nil
+	}
+	return netguard.CheckURL(ctx, rawURL)
+}
+
+// prepareSavedSearch normalizes and validates a saved search and resolves
+// the center of a zip/radius search from stored listings. Unless
+// allowPrivate is set, the webhook URL must resolve to public addresses.
+func prepareSavedSearch(ctx context.Context, repo *repository.PostgresRepository, s *savedsearch.SavedSearch, allowPrivate bool) error {
+	*s = s.Normalize()
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if s.WebhookURL != "" && !allowPrivate {
+		if err := savedsearch.CheckWebhookHost(ctx, s.WebhookURL); err != nil {
+			return err
+		}
+	}
+	s.Latitude, s.Longitude = 0, 0
+	if s.Search.Zip != "" && s.Search.Radius > 0 {
+		lat, lon, ok, err := repo.LocateZip(ctx, s.Search.Zip)
+		if err != nil {
+			log.Printf("Error locating zip %s: %v", s.Search.Zip, err)
+		} else if ok {
+			s.Latitude, s.Longitude = lat, lon
+		}
+	}
+	return nil
+}
+
+const (
+	baselinePageSize = 500
+	baselineTimeout  = 5 * time.Minute
+)
+
+// baselineSavedSearch records stored listings that already match s, so they
+// don't raise new-match alerts. A broad search can match much of the
+// table, so it pages through listings and is run off the request path.
+func baselineSavedSearch(repo *repository.PostgresRepository, s savedsearch.SavedSearch) {
+	ctx, cancel := context.WithTimeout(context.Background(), baselineTimeout)
+	defer cancel()
+
+	total := 0
+	for offset := 0; ; offset += baselinePageSize {
+		page, err := repo.GetListings(ctx, repository.ListingFilters{
+			Make:       s.Search.Make,
+			Model:      s.Search.Model,
+			ActiveOnly: true,
+			Limit:      baselinePageSize,
+			Offset:     offset,
+		})
+		if err != nil {
+			log.Printf("Error fetching listings to baseline saved search %d: %v", s.ID, err)
+			return
+		}
+		n, err := savedsearch.Baseline(ctx, repo, s, page)
+		total += n
+		if err != nil {
+			log.Printf("Error baselining saved search %d: %v", s.ID, err)
+			return
+		}
+		if len(page) < baselinePageSize {
+			break
+		}
+	}
+	log.Printf("Saved search %d has %d existing matches", s.ID, total)
+}
+
+// upstreamStatus maps a MarketCheck client error onto the status the API
+// should return to its own callers.
+func upstreamStatus(err error) int {
+	switch {
+	case errors.Is(err, marketcheck.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, marketcheck.ErrInvalidRequest):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, marketcheck.ErrRateLimited), errors.Is(err, quota.ErrQuotaExceeded):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, marketcheck.ErrUnauthorized),
+		errors.Is(err, marketcheck.ErrUpstream),
+		errors.Is(err, marketcheck.ErrDecode):
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func writeUpstreamError(w http.ResponseWriter, err error, msg string) {
+	var statusErr *marketcheck.StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(statusErr.RetryAfter.Seconds())))
+	}
+	http.Error(w, msg, upstreamStatus(err))
+}
+
+// attachSafety attaches the recalls and complaints already held for each
+// model year in the result set to every matching listing. It never waits on
+// NHTSA: model years with no data yet are left unset and fetched in the
+// background for later searches.
+func attachSafety(ctx context.Context, svc *safety.Service, listings []EnrichedListingResponse) {
+	type modelYear struct {
+		make, model string
+		year        int
+	}
+	results := make(map[modelYear]*marketcheck.Safety)
+	for _, l := range listings {
+		k := modelYear{strings.ToLower(l.Build.Make), strings.ToLower(l.Build.Model), l.Build.Year}
+		if _, ok := results[k]; !ok {
+			results[k] = svc.Cached(ctx, k.make, k.model, k.year)
+		}
+	}
+
+	for i := range listings {
+		b := listings[i].Build
+		listings[i].Safety = results[modelYear{strings.ToLower(b.Make), strings.ToLower(b.Model), b.Year}]
+	}
 }
 
 func normalizeSearchTerm(s string) string {
@@ -75,11 +271,22 @@ func matchesSearch(searchTerm, listingValue string) bool {
 func main() {
 	cfg := config.Load()
 
-	if cfg.MarketCheckKey == "" {
+	if cfg.MarketCheckKey == "" && cfg.RequiresMarketCheckKey() {
 		log.Fatal("MARKETCHECK_API_KEY environment variable is required")
 	}
 
 	mcClient := marketcheck.NewClientWithURL(cfg.MarketCheckKey, cfg.MarketCheckURL)
+	retryPolicy := marketcheck.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = cfg.MarketCheckRetry
+	mcClient.SetRetryPolicy(retryPolicy)
+	transport, err := marketcheck.NewFixtureTransport(cfg.MarketCheckMode, cfg.FixturesDir)
+	if err != nil {
+		log.Fatalf("Failed to set up MarketCheck %s mode: %v", cfg.MarketCheckMode, err)
+	}
+	if transport != nil {
+		mcClient.SetTransport(transport)
+		log.Printf("MarketCheck client in %s mode using fixtures in %s", cfg.MarketCheckMode, cfg.FixturesDir)
+	}
 
 	if cfg.DatabaseURL == "" {
 		log.Fatal("DATABASE_URL environment variable is required")
@@ -94,6 +301,48 @@ func main() {
 
 	listingRepo := repo
 
+	quotaManager := quota.NewManager(repo, quota.Limits{
+		Daily:   quota.Budget{Soft: cfg.QuotaDailySoft, Hard: cfg.QuotaDailyHard},
+		Monthly: quota.Budget{Soft: cfg.QuotaMonthlySoft, Hard: cfg.QuotaMonthlyHard},
+	})
+	if cfg.MarketCheckMode != marketcheck.ModeReplay {
+		mcClient.SetQuota(quotaManager)
+	}
+
+	var listingSource marketcheck.ListingSource = mcClient
+	if cfg.ListingSource == "feed" {
+		feedSource, err := feed.NewSource(cfg.FeedPath)
+		if err != nil {
+			log.Fatalf("Failed to load dealer feeds from %s: %v", cfg.FeedPath, err)
+		}
+		listingSource = feedSource
+		log.Printf("Using dealer feed listing source at %s", cfg.FeedPath)
+	}
+
+	if cfg.VINDecoderMode != vindecode.ModeOff {
+		decoder, err := vindecode.Load(cfg.VPICSnapshotPath)
+		if err != nil {
+			log.Fatalf("Failed to load vPIC snapshot: %v", err)
+		}
+		listingSource = vindecode.NewSource(listingSource, decoder, cfg.VINDecoderMode)
+		log.Printf("Using local VIN decoder (%s mode, snapshot %s)", cfg.VINDecoderMode, decoder.Version())
+	}
+
+	var safetyService *safety.Service
+	if cfg.SafetyTTLHours > 0 {
+		nhtsaClient := nhtsa.NewClient(cfg.NHTSAURL)
+		nhtsaClient.SetSafetyURL(cfg.NHTSASafetyURL)
+		if transport != nil {
+			nhtsaClient.SetTransport(transport)
+		}
+		safetyService = safety.NewService(nhtsaClient, repo, time.Duration(cfg.SafetyTTLHours)*time.Hour)
+	}
+
+	valuationOpts := valuation.DefaultOptions()
+	valuationOpts.MinComparables = cfg.ValuationMinComp
+	valuationOpts.RadiusMiles = float64(cfg.ValuationRadius)
+	valuationEngine := valuation.NewEngine(repo, valuationOpts)
+
 	buildCache := cache.NewCache(1 * time.Hour)
 
 	rateLimiter := ratelimit.NewRateLimiter(10.0, 20)
@@ -130,24 +379,10 @@ func main() {
 				return
 			}
 		} else {
-			req.Make = strings.TrimSpace(r.URL.Query().Get("make"))
-			req.Model = strings.TrimSpace(r.URL.Query().Get("model"))
-			req.Zip = strings.TrimSpace(r.URL.Query().Get("zip"))
-			if radiusStr := r.URL.Query().Get("radius"); radiusStr != "" {
-				if radius, err := strconv.Atoi(radiusStr); err == nil {
-					req.Radius = radius
-				}
-			}
-			if rowsStr := r.URL.Query().Get("rows"); rowsStr != "" {
-				if rows, err := strconv.Atoi(rowsStr); err == nil {
-					req.Rows = rows
-				}
-			}
+			req = parseSearchQuery(r.URL.Query())
 		}
 
-		req.Make = strings.TrimSpace(req.Make)
-		req.Model = strings.TrimSpace(req.Model)
-		req.Zip = strings.TrimSpace(req.Zip)
+		req.SearchParams = req.SearchParams.Normalize()
 
 		if req.Make == "" {
 			req.Make = cfg.Make
@@ -156,7 +391,7 @@ func main() {
 			req.Model = cfg.Model
 		}
 		if req.Zip == "" {
-			req.Zip = strconv.Itoa(cfg.Zip)
+			req.Zip = cfg.Zip
 		}
 		if req.Radius == 0 {
 			req.Radius = cfg.Radius
@@ -164,16 +399,69 @@ func main() {
 		if req.Rows == 0 {
 			req.Rows = 50
 		}
+		if req.Rows < 0 {
+			http.Error(w, "rows must be positive", http.StatusBadRequest)
+			return
+		}
+		// Each row can cost MarketCheck pages and a build lookup, so a
+		// search is capped at one page's worth, as before pagination.
+		if req.Rows > marketcheck.MaxPageSize {
+			http.Error(w, "rows must be at most "+strconv.Itoa(marketcheck.MaxPageSize), http.StatusBadRequest)
+			return
+		}
+
+		if err := req.SearchParams.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		listings, err := mcClient.FetchActiveListingsWithFilters(r.Context(), req.Rows*2, req.Make, req.Model, req.Zip, req.Radius)
+		listings, err := marketcheck.CollectListings(r.Context(), listingSource, req.Rows*2, req.SearchParams)
+		if errors.Is(err, quota.ErrQuotaExceeded) {
+			log.Printf("MarketCheck quota exhausted, serving stored listings: %v", err)
+			stored, err := listingRepo.GetListings(r.Context(), repository.ListingFilters{
+				Make:       req.Make,
+				Model:      req.Model,
+				Limit:      req.Rows,
+				ActiveOnly: true,
+			})
+			if err != nil {
+				log.Printf("Error fetching stored listings: %v", err)
+				http.Error(w, "Failed to fetch listings", http.StatusInternalServerError)
+				return
+			}
+			response := SearchResponse{
+				Listings: make([]EnrichedListingResponse, 0, len(stored)),
+				Degraded: true,
+			}
+			for _, listing := range stored {
+				response.Listings = append(response.Listings, EnrichedListingResponse(*listing))
+			}
+			if safetyService != nil {
+				attachSafety(r.Context(), safetyService, response.Listings)
+			}
+			response.Count = len(response.Listings)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
 		if err != nil {
 			log.Printf("Error fetching listings: %v", err)
-			http.Error(w, "Failed to fetch listings", http.StatusInternalServerError)
+			writeUpstreamError(w, err, "Failed to fetch listings")
 			return
 		}
 
 		var filteredListings []marketcheck.Listing
 		for _, listing := range listings {
+			parsed, err := vin.Parse(listing.VIN)
+			if err != nil {
+				log.Printf("Skipping listing %s with invalid VIN %q: %v", listing.ID, listing.VIN, err)
+				if err := repo.QuarantineVIN(r.Context(), listing.VIN, "api_search", err.Error(), nil); err != nil {
+					log.Printf("Error quarantining VIN %q: %v", listing.VIN, err)
+				}
+				continue
+			}
+			listing.VIN = parsed.Value
+
 			makeMatch := req.Make == "" || matchesSearch(req.Make, listing.Build.Make)
 			modelMatch := req.Model == "" || matchesSearch(req.Model, listing.Build.Model)
 
@@ -195,16 +483,25 @@ func main() {
 		}
 		buildResults := make([]buildResult, len(filteredListings))
 
+		// Past the soft budget, skip per-VIN decode calls whenever the search
+		// result already carries a usable build.
+		degraded := quotaManager.Level(r.Context()) >= quota.LevelSoft
+
 		for i, listing := range filteredListings {
 			if cachedBuild, found := buildCache.GetBuild(listing.VIN); found {
 				buildResults[i] = buildResult{index: i, build: cachedBuild, err: nil}
 				continue
 			}
+			if degraded && listing.Build.Make != "" {
+				listingBuild := listing.Build
+				buildResults[i] = buildResult{index: i, build: &listingBuild, err: nil}
+				continue
+			}
 
 			wg.Add(1)
 			go func(idx int, vin string, listingBuild marketcheck.Build) {
 				defer wg.Done()
-				build, err := mcClient.FetchBuild(r.Context(), vin)
+				build, err := listingSource.FetchBuild(r.Context(), vin)
 				if err != nil {
 					log.Printf("Error fetching build for VIN %s: %v", vin, err)
 					if listingBuild.Make == "" {
@@ -235,37 +532,46 @@ func main() {
 				},
 			}
 
-			valuation := marketcheck.Valuation{
-				IsGoodValue: listing.Price < listing.MSRP && listing.MSRP > 0,
-				Score:       0.0,
-			}
-			if listing.MSRP > 0 {
-				valuation.Score = float64(listing.MSRP-listing.Price) / float64(listing.MSRP)
+			build := *result.build
+			listingValuation, err := valuationEngine.Value(r.Context(), listing, build, priceHistory)
+			if err != nil {
+				log.Printf("Error valuing VIN %s: %v", listing.VIN, err)
 			}
 
 			enriched = append(enriched, EnrichedListingResponse{
 				Listing:      listing,
-				Build:        *result.build,
+				Build:        build,
 				PriceHistory: priceHistory,
-				Valuation:    valuation,
+				Valuation:    listingValuation,
 			})
 		}
 
+		if safetyService != nil {
+			attachSafety(r.Context(), safetyService, enriched)
+		}
+
+		// Listings are queued in the outbox with their upserts, so the relay
+		// feeds them to the consumer like the producer's. The relay runs in
+		// the producer, not here: without a producer the rows wait.
+		saves := make([]*marketcheck.EnrichedListing, 0, len(enriched))
 		for _, listing := range enriched {
-			enrichedListing := &marketcheck.EnrichedListing{
+			saves = append(saves, &marketcheck.EnrichedListing{
 				Listing:      listing.Listing,
 				Build:        listing.Build,
 				PriceHistory: listing.PriceHistory,
 				Valuation:    listing.Valuation,
-			}
-			if err := listingRepo.SaveListing(r.Context(), enrichedListing); err != nil {
-				log.Printf("Error saving listing to database: %v", err)
+			})
+		}
+		if len(saves) > 0 {
+			if err := listingRepo.SaveListingsWithOutbox(r.Context(), saves, "api_search", kafka.NewID()); err != nil {
+				log.Printf("Error saving listings to database: %v", err)
 			}
 		}
 
 		response := SearchResponse{
 			Listings: enriched,
 			Count:    len(enriched),
+			Degraded: degraded,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -295,25 +601,19 @@ func main() {
 			return
 		}
 
-		models, err := listingRepo.GetModelsForMake(r.Context(), make)
+		models, err := listingRepo.GetCatalogModels(r.Context(), make)
 		if err != nil {
-			log.Printf("Error fetching models for make %s from database: %v", make, err)
+			log.Printf("Error fetching catalog models for make %s: %v", make, err)
 		}
 
 		if len(models) == 0 {
-			log.Printf("No models found in database for make %s, fetching from MarketCheck API", make)
-			marketcheckModels, err := mcClient.FetchModelsForMake(r.Context(), make)
+			models, err = listingRepo.GetModelsForMake(r.Context(), make)
 			if err != nil {
-				log.Printf("Error fetching models for make %s from MarketCheck: %v", make, err)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusOK)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"make":   make,
-					"models": []string{},
-				})
-				return
+				log.Printf("Error fetching models for make %s from listings: %v", make, err)
 			}
-			models = marketcheckModels
+		}
+		if models == nil {
+			models = []string{}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -325,6 +625,877 @@ func main() {
 
 	http.Handle("/api/models", modelsHandler)
 
+	http.HandleFunc("/api/makes", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		vehicleType := strings.TrimSpace(r.URL.Query().Get("vehicle_type"))
+		makes, err := listingRepo.GetCatalogMakes(r.Context(), vehicleType)
+		if err != nil {
+			log.Printf("Error fetching catalog makes: %v", err)
+		}
+
+		// Before the first catalog sync, offer the makes we have listings for.
+		if len(makes) == 0 && vehicleType == "" {
+			makes, err = listingRepo.GetListingMakes(r.Context())
+			if err != nil {
+				log.Printf("Error fetching makes from listings: %v", err)
+			}
+		}
+		if makes == nil {
+			makes = []string{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"makes": makes,
+		})
+	})
+
+	http.HandleFunc("/api/listings/{vin}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parsed, err := vin.Parse(r.PathValue("vin"))
+		if err != nil {
+			if err := repo.QuarantineVIN(r.Context(), r.PathValue("vin"), "api", err.Error(), nil); err != nil {
+				log.Printf("Error quarantining VIN %q: %v", r.PathValue("vin"), err)
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		listing, err := listingRepo.GetListingByVIN(r.Context(), parsed.Value)
+		if err != nil {
+			log.Printf("Error fetching listing %s: %v", parsed.Value, err)
+			http.Error(w, "Failed to fetch listing", http.StatusInternalServerError)
+			return
+		}
+		if listing == nil {
+			http.Error(w, "Listing not found", http.StatusNotFound)
+			return
+		}
+
+		history, err := repo.GetHistory(r.Context(), parsed.Value)
+		if err != nil {
+			log.Printf("Error fetching price history for %s: %v", parsed.Value, err)
+		} else if len(history) > 0 {
+			listing.PriceHistory = history
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EnrichedListingResponse(*listing))
+	})
+
+	http.HandleFunc("/api/listings/{vin}/recalls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if safetyService == nil {
+			http.Error(w, "Safety enrichment is disabled", http.StatusNotFound)
+			return
+		}
+
+		parsed, err := vin.Parse(r.PathValue("vin"))
+		if err != nil {
+			if err := repo.QuarantineVIN(r.Context(), r.PathValue("vin"), "api", err.Error(), nil); err != nil {
+				log.Printf("Error quarantining VIN %q: %v", r.PathValue("vin"), err)
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Prefer the stored build; otherwise decode the VIN.
+		var build *marketcheck.Build
+		listing, err := listingRepo.GetListingByVIN(r.Context(), parsed.Value)
+		if err != nil {
+			log.Printf("Error fetching listing %s: %v", parsed.Value, err)
+		}
+		if listing != nil && listing.Build.Make != "" {
+			build = &listing.Build
+		} else {
+			build, err = listingSource.FetchBuild(r.Context(), parsed.Value)
+			if err != nil {
+				writeUpstreamError(w, err, "Failed to decode VIN")
+				return
+			}
+		}
+
+		info, err := safetyService.ForBuild(r.Context(), *build)
+		if errors.Is(err, nhtsa.ErrInvalidRequest) {
+			http.Error(w, "Build is missing make, model or year", http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, safety.ErrUnavailable) {
+			http.Error(w, "Recall data is temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching safety data for %s: %v", parsed.Value, err)
+			http.Error(w, "Failed to fetch recalls", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"vin":    parsed.Value,
+			"year":   build.Year,
+			"make":   build.Make,
+			"model":  build.Model,
+			"safety": info,
+		})
+	})
+
+	http.HandleFunc("/api/listings/{vin}/price-events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parsed, err := vin.Parse(r.PathValue("vin"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		events, err := repo.GetPriceEvents(r.Context(), repository.PriceEventFilters{
+			VIN:   parsed.Value,
+			Limit: 100,
+		})
+		if err != nil {
+			log.Printf("Error fetching price events for %s: %v", parsed.Value, err)
+			http.Error(w, "Failed to fetch price events", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"vin":    parsed.Value,
+			"events": events,
+		})
+	})
+
+	http.HandleFunc("/api/price-events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		filters := repository.PriceEventFilters{
+			Kind:  q.Get("kind"),
+			Make:  q.Get("make"),
+			Model: q.Get("model"),
+			Limit: queryInt(q, "limit"),
+		}
+		if filters.Limit <= 0 || filters.Limit > 500 {
+			filters.Limit = 100
+		}
+		if days := queryInt(q, "days"); days > 0 {
+			filters.Since = time.Now().AddDate(0, 0, -days)
+		}
+
+		events, err := repo.GetPriceEvents(r.Context(), filters)
+		if err != nil {
+			log.Printf("Error fetching price events: %v", err)
+			http.Error(w, "Failed to fetch price events", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"events": events,
+			"count":  len(events),
+		})
+	})
+
+	http.HandleFunc("/api/saved-searches", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		switch r.Method {
+		case "OPTIONS":
+			w.WriteHeader(http.StatusOK)
+
+		case "GET":
+			searches, err := repo.ListSavedSearches(r.Context())
+			if err != nil {
+				log.Printf("Error listing saved searches: %v", err)
+				http.Error(w, "Failed to list saved searches", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"saved_searches": searches,
+			})
+
+		case "POST":
+			var s savedsearch.SavedSearch
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if err := prepareSavedSearch(r.Context(), repo, &s, cfg.AlertAllowPrivate); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := repo.CreateSavedSearch(r.Context(), &s); err != nil {
+				log.Printf("Error creating saved search: %v", err)
+				http.Error(w, "Failed to create saved search", http.StatusInternalServerError)
+				return
+			}
+			go baselineSavedSearch(repo, s)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(s)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/saved-searches/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid saved search id", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			s, err := repo.GetSavedSearch(r.Context(), id)
+			if err != nil {
+				log.Printf("Error fetching saved search %d: %v", id, err)
+				http.Error(w, "Failed to fetch saved search", http.StatusInternalServerError)
+				return
+			}
+			if s == nil {
+				http.Error(w, "Saved search not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(s)
+
+		case "PUT":
+			var s savedsearch.SavedSearch
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			s.ID = id
+			if err := prepareSavedSearch(r.Context(), repo, &s, cfg.AlertAllowPrivate); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			found, err := repo.UpdateSavedSearch(r.Context(), &s)
+			if err != nil {
+				log.Printf("Error updating saved search %d: %v", id, err)
+				http.Error(w, "Failed to update saved search", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Saved search not found", http.StatusNotFound)
+				return
+			}
+			go baselineSavedSearch(repo, s)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(s)
+
+		case "DELETE":
+			found, err := repo.DeleteSavedSearch(r.Context(), id)
+			if err != nil {
+				log.Printf("Error deleting saved search %d: %v", id, err)
+				http.Error(w, "Failed to delete saved search", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Saved search not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/listings/sold", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		filters := repository.SoldFilters{
+			Make:     q.Get("make"),
+			Model:    q.Get("model"),
+			DealerID: queryInt(q, "dealer_id"),
+			Limit:    queryInt(q, "limit"),
+		}
+		if filters.Limit <= 0 || filters.Limit > 500 {
+			filters.Limit = 100
+		}
+		if days := queryInt(q, "days"); days > 0 {
+			filters.Since = time.Now().AddDate(0, 0, -days)
+		}
+
+		sold, err := repo.GetSoldListings(r.Context(), filters)
+		if err != nil {
+			log.Printf("Error fetching sold listings: %v", err)
+			http.Error(w, "Failed to fetch sold listings", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sold":  sold,
+			"count": len(sold),
+		})
+	})
+
+	http.HandleFunc("/api/analytics/time-to-sale", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		filters := repository.SoldFilters{
+			Make:     q.Get("make"),
+			Model:    q.Get("model"),
+			DealerID: queryInt(q, "dealer_id"),
+			GroupBy:  q.Get("group_by"),
+			Limit:    queryInt(q, "limit"),
+		}
+		if filters.GroupBy == "" {
+			filters.GroupBy = "model"
+		}
+		if filters.GroupBy != "model" && filters.GroupBy != "dealer" {
+			http.Error(w, "group_by must be model or dealer", http.StatusBadRequest)
+			return
+		}
+		if filters.Limit <= 0 || filters.Limit > 500 {
+			filters.Limit = 100
+		}
+		if days := queryInt(q, "days"); days > 0 {
+			filters.Since = time.Now().AddDate(0, 0, -days)
+		}
+
+		stats, err := repo.GetTimeToSale(r.Context(), filters)
+		if err != nil {
+			log.Printf("Error fetching time-to-sale stats: %v", err)
+			http.Error(w, "Failed to fetch time-to-sale stats", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"group_by": filters.GroupBy,
+			"stats":    stats,
+		})
+	})
+
+	// Without ?market=, returns the latest sweep of every market.
+	http.HandleFunc("/api/markets/sweeps", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		market := q.Get("market")
+		limit := queryInt(q, "limit")
+		if limit <= 0 || limit > 500 {
+			limit = 100
+		}
+
+		sweeps, err := repo.GetMarketSweeps(r.Context(), market, limit)
+		if err != nil {
+			log.Printf("Error fetching market sweeps: %v", err)
+			http.Error(w, "Failed to fetch market sweeps", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sweeps": sweeps,
+			"count":  len(sweeps),
+		})
+	})
+
+	http.HandleFunc("/api/jobs/runs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		filters := repository.JobRunFilters{
+			Job:    q.Get("job"),
+			Status: q.Get("status"),
+			Limit:  queryInt(q, "limit"),
+		}
+		if filters.Limit <= 0 || filters.Limit > 500 {
+			filters.Limit = 100
+		}
+
+		runs, err := repo.GetJobRuns(r.Context(), filters)
+		if err != nil {
+			log.Printf("Error fetching job runs: %v", err)
+			http.Error(w, "Failed to fetch job runs", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"runs":  runs,
+			"count": len(runs),
+		})
+	})
+
+	http.HandleFunc("/api/webhooks/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		switch r.Method {
+		case "OPTIONS":
+			w.WriteHeader(http.StatusOK)
+
+		case "GET":
+			subs, err := repo.ListWebhookSubscriptions(r.Context())
+			if err != nil {
+				log.Printf("Error listing webhook subscriptions: %v", err)
+				http.Error(w, "Failed to list webhook subscriptions", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"subscriptions": subs,
+				"event_types":   webhooks.EventTypes,
+			})
+
+		case "POST":
+			s := webhooks.Subscription{Active: true}
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if err := s.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := checkSubscriptionURL(r.Context(), s.URL, cfg.AlertAllowPrivate); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if s.Secret == "" {
+				secret, err := webhooks.NewSecret()
+				if err != nil {
+					log.Printf("Error generating webhook secret: %v", err)
+					http.Error(w, "Failed to create webhook subscription", http.StatusInternalServerError)
+					return
+				}
+				s.Secret = secret
+			}
+			if s.EventTypes == nil {
+				s.EventTypes = []string{}
+			}
+			if err := repo.CreateWebhookSubscription(r.Context(), &s); err != nil {
+				log.Printf("Error creating webhook subscription: %v", err)
+				http.Error(w, "Failed to create webhook subscription", http.StatusInternalServerError)
+				return
+			}
+
+			// The secret is only ever returned here.
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(s)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/webhooks/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid webhook subscription id", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			s, err := repo.GetWebhookSubscription(r.Context(), id)
+			if err != nil {
+				log.Printf("Error fetching webhook subscription %d: %v", id, err)
+				http.Error(w, "Failed to fetch webhook subscription", http.StatusInternalServerError)
+				return
+			}
+			if s == nil {
+				http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(s)
+
+		case "PUT":
+			s := webhooks.Subscription{Active: true}
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			s.ID, s.Secret = id, ""
+			if err := s.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := checkSubscriptionURL(r.Context(), s.URL, cfg.AlertAllowPrivate); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if s.EventTypes == nil {
+				s.EventTypes = []string{}
+			}
+			found, err := repo.UpdateWebhookSubscription(r.Context(), &s)
+			if err != nil {
+				log.Printf("Error updating webhook subscription %d: %v", id, err)
+				http.Error(w, "Failed to update webhook subscription", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(s)
+
+		case "DELETE":
+			found, err := repo.DeleteWebhookSubscription(r.Context(), id)
+			if err != nil {
+				log.Printf("Error deleting webhook subscription %d: %v", id, err)
+				http.Error(w, "Failed to delete webhook subscription", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Replays a subscription's dead deliveries, or those with ?status=.
+	http.HandleFunc("/api/webhooks/subscriptions/{id}/replay", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid webhook subscription id", http.StatusBadRequest)
+			return
+		}
+		s, err := repo.GetWebhookSubscription(r.Context(), id)
+		if err != nil {
+			log.Printf("Error fetching webhook subscription %d: %v", id, err)
+			http.Error(w, "Failed to replay deliveries", http.StatusInternalServerError)
+			return
+		}
+		if s == nil {
+			http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+			return
+		}
+
+		q := r.URL.Query()
+		filters := repository.WebhookDeliveryFilters{
+			SubscriptionID: id,
+			Status:         q.Get("status"),
+			EventType:      q.Get("event_type"),
+		}
+		if filters.Status == "" {
+			filters.Status = webhooks.StatusDead
+		}
+		n, err := repo.ReplayWebhookDeliveries(r.Context(), filters)
+		if err != nil {
+			log.Printf("Error replaying deliveries for webhook subscription %d: %v", id, err)
+			http.Error(w, "Failed to replay deliveries", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"replayed": n,
+		})
+	})
+
+	http.HandleFunc("/api/webhooks/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		filters := repository.WebhookDeliveryFilters{
+			SubscriptionID: int64(queryInt(q, "subscription_id")),
+			Status:         q.Get("status"),
+			EventType:      q.Get("event_type"),
+			Limit:          queryInt(q, "limit"),
+		}
+		if filters.Limit <= 0 || filters.Limit > 500 {
+			filters.Limit = 100
+		}
+
+		deliveries, err := repo.GetWebhookDeliveries(r.Context(), filters)
+		if err != nil {
+			log.Printf("Error fetching webhook deliveries: %v", err)
+			http.Error(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"deliveries": deliveries,
+			"count":      len(deliveries),
+		})
+	})
+
+	http.HandleFunc("/api/webhooks/deliveries/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid delivery id", http.StatusBadRequest)
+			return
+		}
+		d, err := repo.GetWebhookDelivery(r.Context(), id)
+		if err != nil {
+			log.Printf("Error fetching webhook delivery %d: %v", id, err)
+			http.Error(w, "Failed to fetch webhook delivery", http.StatusInternalServerError)
+			return
+		}
+		if d == nil {
+			http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
+	})
+
+	http.HandleFunc("/api/webhooks/deliveries/{id}/replay", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid delivery id", http.StatusBadRequest)
+			return
+		}
+		n, err := repo.ReplayWebhookDeliveries(r.Context(), repository.WebhookDeliveryFilters{}, id)
+		if err != nil {
+			log.Printf("Error replaying webhook delivery %d: %v", id, err)
+			http.Error(w, "Failed to replay webhook delivery", http.StatusInternalServerError)
+			return
+		}
+		if n == 0 {
+			http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	http.HandleFunc("/api/analytics/depreciation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		makeName, model := strings.TrimSpace(q.Get("make")), strings.TrimSpace(q.Get("model"))
+		if makeName == "" || model == "" {
+			http.Error(w, "make and model are required", http.StatusBadRequest)
+			return
+		}
+
+		curves, err := repo.GetDepreciationCurves(r.Context(), makeName, model)
+		if err != nil {
+			log.Printf("Error fetching depreciation curves for %s %s: %v", makeName, model, err)
+			http.Error(w, "Failed to fetch depreciation curves", http.StatusInternalServerError)
+			return
+		}
+		if len(curves) == 0 {
+			http.Error(w, "Not enough data for a depreciation curve", http.StatusNotFound)
+			return
+		}
+
+		// Use the trim's own curve when there is one, else the all-trims curve.
+		selected := curves[0]
+		for _, c := range curves {
+			if c.Trim == "" {
+				selected = c
+			}
+		}
+		if trim := strings.TrimSpace(q.Get("trim")); trim != "" {
+			for _, c := range curves {
+				if strings.EqualFold(c.Trim, trim) {
+					selected = c
+				}
+			}
+		}
+
+		annualMiles := queryInt(q, "annual_miles")
+		if annualMiles <= 0 {
+			annualMiles = analytics.DefaultAnnualMiles
+		}
+
+		resp := make([]DepreciationCurveResponse, 0, len(curves))
+		for _, c := range curves {
+			resp = append(resp, DepreciationCurveResponse{
+				Curve:               c,
+				AnnualDepreciation:  c.AnnualDepreciation(),
+				MileageDepreciation: c.MileageDepreciation(),
+			})
+		}
+
+		maxAge := int(math.Max(10, math.Ceil(selected.MaxAge)))
+		points := make([]DepreciationPoint, 0, maxAge+1)
+		for age := 0; age <= maxAge; age++ {
+			miles := age * annualMiles
+			points = append(points, DepreciationPoint{
+				AgeYears: age,
+				Miles:    miles,
+				Price:    int(math.Round(selected.Price(float64(age), miles))),
+			})
+		}
+
+		body := map[string]interface{}{
+			"make":   selected.Make,
+			"model":  selected.Model,
+			"trim":   selected.Trim,
+			"curves": resp,
+			"points": points,
+		}
+
+		if year := queryInt(q, "year"); year > 0 {
+			age := analytics.AgeAt(year, time.Now())
+			miles := queryInt(q, "miles")
+			if miles <= 0 {
+				miles = int(age * float64(annualMiles))
+			}
+			current := float64(queryInt(q, "price"))
+			if current <= 0 {
+				current = selected.Price(age, miles)
+			}
+			body["projection"] = DepreciationProjection{
+				Trim:         selected.Trim,
+				Year:         year,
+				AgeYears:     math.Round(age*100) / 100,
+				Miles:        miles,
+				AnnualMiles:  annualMiles,
+				CurrentValue: int(math.Round(current)),
+				Projections:  selected.Projections(current, age, miles, annualMiles),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+
+	http.HandleFunc("/api/quota", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		usage, err := quotaManager.Usage(r.Context())
+		if err != nil {
+			log.Printf("Error fetching quota usage: %v", err)
+			http.Error(w, "Failed to fetch quota usage", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": usage.Level.String(),
+			"day":    usage.Day,
+			"month":  usage.Month,
+		})
+	})
+
 	port := ":8080"
 	log.Printf("API server starting on http://localhost%s", port)
 	log.Fatal(http.ListenAndServe(port, nil))
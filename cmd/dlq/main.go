@@ -0,0 +1,329 @@
+// Command dlq inspects and re-drives messages on the consumer's dead-letter
+// topic.
+//
+//	dlq list [-limit N] [-error substr]
+//	dlq redrive -message 0:42,1:7 [-to topic] [-dry-run]
+//	dlq redrive -all [-to topic] [-dry-run]
+//
+// list reads the topic without committing anything. redrive -message
+// re-publishes the given partition:offset messages; redrive -all re-publishes
+// everything not yet re-driven, tracked by the dlq-redrive consumer group.
+// Messages go back to the topic they failed on unless -to is given.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/config"
+	"github.com/omerahmer/motor_metrics/internal/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const redriveGroup = "dlq-redrive"
+
+func main() {
+	cfg := config.Load()
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	flags := flag.NewFlagSet(cmd, flag.ExitOnError)
+	brokerList := flags.String("brokers", cfg.KafkaBrokers, "comma-separated Kafka brokers")
+	topic := flags.String("topic", cfg.DLQTopic, "dead-letter topic")
+
+	ctx := context.Background()
+	switch cmd {
+	case "list":
+		limit := flags.Int("limit", 100, "maximum messages to print; 0 prints all")
+		errorFilter := flags.String("error", "", "only show messages whose error contains this")
+		flags.Parse(args)
+		if err := list(ctx, splitList(*brokerList), *topic, *limit, *errorFilter); err != nil {
+			log.Fatal(err)
+		}
+	case "redrive":
+		messages := flags.String("message", "", "comma-separated partition:offset messages to re-drive")
+		all := flags.Bool("all", false, "re-drive every message not yet re-driven")
+		to := flags.String("to", "", "topic to re-drive to instead of the original")
+		dryRun := flags.Bool("dry-run", false, "print what would be re-driven without publishing")
+		flags.Parse(args)
+
+		r := &redriver{brokers: splitList(*brokerList), topic: *topic, to: *to, dryRun: *dryRun}
+		var err error
+		switch {
+		case *all && *messages != "":
+			log.Fatal("use either -all or -message")
+		case *all:
+			err = r.all(ctx)
+		case *messages != "":
+			err = r.messages(ctx, *messages)
+		default:
+			log.Fatal("redrive needs -all or -message")
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlq list [-limit N] [-error substr]")
+	fmt.Fprintln(os.Stderr, "       dlq redrive (-all | -message partition:offset,...) [-to topic] [-dry-run]")
+	os.Exit(2)
+}
+
+// list prints the messages on every partition of the topic, oldest first.
+func list(ctx context.Context, brokers []string, topic string, limit int, errorFilter string) error {
+	partitions, err := partitions(brokers, topic)
+	if err != nil {
+		return err
+	}
+
+	shown := 0
+	for _, p := range partitions {
+		first, last, err := offsets(ctx, brokers[0], topic, p)
+		if err != nil {
+			return err
+		}
+		if first >= last {
+			continue
+		}
+
+		reader := partitionReader(brokers, topic, p, first)
+		for offset := first; offset < last; {
+			m, err := reader.ReadMessage(ctx)
+			if err != nil {
+				reader.Close()
+				return fmt.Errorf("failed to read partition %d: %w", p, err)
+			}
+			offset = m.Offset + 1
+			if errorFilter != "" && !strings.Contains(kafka.Header(m, kafka.HeaderDLQError), errorFilter) {
+				continue
+			}
+			printMessage(m)
+			shown++
+			if limit > 0 && shown >= limit {
+				reader.Close()
+				return nil
+			}
+		}
+		reader.Close()
+	}
+	if shown == 0 {
+		fmt.Println("no messages")
+	}
+	return nil
+}
+
+func printMessage(m kafkago.Message) {
+	fmt.Printf("%d:%d key=%s\n", m.Partition, m.Offset, m.Key)
+	fmt.Printf("  failed:  %s on %s %s:%s (%s, %s attempts, group %s)\n",
+		kafka.Header(m, kafka.HeaderDLQFailedAt),
+		kafka.Header(m, kafka.HeaderDLQOriginalTopic),
+		kafka.Header(m, kafka.HeaderDLQOriginalPartition),
+		kafka.Header(m, kafka.HeaderDLQOriginalOffset),
+		kafka.Header(m, kafka.HeaderDLQReason),
+		kafka.Header(m, kafka.HeaderDLQAttempts),
+		kafka.Header(m, kafka.HeaderDLQConsumerGroup))
+	fmt.Printf("  error:   %s\n", kafka.Header(m, kafka.HeaderDLQError))
+	fmt.Printf("  schema:  v%s %s (trace %s, run %s)\n",
+		orDefault(kafka.Header(m, kafka.HeaderSchemaVersion), "1"),
+		orDefault(kafka.Header(m, kafka.HeaderContentType), kafka.ContentTypeJSON),
+		orDefault(kafka.Header(m, kafka.HeaderTraceID), "-"),
+		orDefault(kafka.Header(m, kafka.HeaderRunID), "-"))
+	value := string(m.Value)
+	if _, doc, err := kafka.DefaultRegistry.Document(m, kafka.EventListingObserved); err == nil {
+		value = string(doc)
+	}
+	if len(value) > 200 {
+		value = value[:200] + "..."
+	}
+	fmt.Printf("  value:   %s\n", value)
+}
+
+type redriver struct {
+	brokers []string
+	topic   string
+	to      string
+	dryRun  bool
+	writer  *kafkago.Writer
+}
+
+// messages re-drives specific partition:offset messages.
+func (r *redriver) messages(ctx context.Context, spec string) error {
+	for _, item := range splitList(spec) {
+		partition, offset, err := parsePosition(item)
+		if err != nil {
+			return err
+		}
+		reader := partitionReader(r.brokers, r.topic, partition, offset)
+		readCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		m, err := reader.ReadMessage(readCtx)
+		cancel()
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", item, err)
+		}
+		if m.Offset != offset {
+			return fmt.Errorf("message %s not found (next offset is %d)", item, m.Offset)
+		}
+		if err := r.redrive(ctx, m); err != nil {
+			return err
+		}
+	}
+	return r.close()
+}
+
+// all re-drives messages in the redrive consumer group until the topic has
+// been idle for a few seconds, committing each once it is re-published.
+func (r *redriver) all(ctx context.Context) error {
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:     r.brokers,
+		GroupID:     redriveGroup,
+		Topic:       r.topic,
+		StartOffset: kafkago.FirstOffset,
+	})
+	defer reader.Close()
+
+	n := 0
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		m, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch: %w", err)
+		}
+		if err := r.redrive(ctx, m); err != nil {
+			return err
+		}
+		n++
+		if r.dryRun {
+			continue
+		}
+		if err := reader.CommitMessages(ctx, m); err != nil {
+			return fmt.Errorf("failed to commit %d:%d: %w", m.Partition, m.Offset, err)
+		}
+	}
+	log.Printf("re-drove %d messages", n)
+	return r.close()
+}
+
+func (r *redriver) redrive(ctx context.Context, m kafkago.Message) error {
+	target := r.to
+	if target == "" {
+		target = kafka.Header(m, kafka.HeaderDLQOriginalTopic)
+	}
+	if target == "" {
+		return fmt.Errorf("message %d:%d has no %s header; use -to", m.Partition, m.Offset, kafka.HeaderDLQOriginalTopic)
+	}
+
+	if r.dryRun {
+		log.Printf("would re-drive %d:%d (key %s) to %s", m.Partition, m.Offset, m.Key, target)
+		return nil
+	}
+
+	if r.writer == nil {
+		r.writer = &kafkago.Writer{
+			Addr:     kafkago.TCP(r.brokers...),
+			Balancer: &kafkago.Hash{},
+		}
+	}
+	out := kafka.Redrive(m)
+	out.Topic = target
+	if err := r.writer.WriteMessages(ctx, out); err != nil {
+		return fmt.Errorf("failed to re-drive %d:%d: %w", m.Partition, m.Offset, err)
+	}
+	log.Printf("re-drove %d:%d (key %s) to %s", m.Partition, m.Offset, m.Key, target)
+	return nil
+}
+
+func (r *redriver) close() error {
+	if r.writer == nil {
+		return nil
+	}
+	return r.writer.Close()
+}
+
+func partitions(brokers []string, topic string) ([]int, error) {
+	conn, err := kafkago.Dial("tcp", brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", brokers[0], err)
+	}
+	defer conn.Close()
+
+	parts, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partitions of %s: %w", topic, err)
+	}
+	ids := make([]int, len(parts))
+	for i, p := range parts {
+		ids[i] = p.ID
+	}
+	return ids, nil
+}
+
+func offsets(ctx context.Context, broker, topic string, partition int) (int64, int64, error) {
+	conn, err := kafkago.DialLeader(ctx, "tcp", broker, topic, partition)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to connect to leader of partition %d: %w", partition, err)
+	}
+	defer conn.Close()
+	return conn.ReadOffsets()
+}
+
+func partitionReader(brokers []string, topic string, partition int, offset int64) *kafkago.Reader {
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     topic,
+		Partition: partition,
+	})
+	reader.SetOffset(offset)
+	return reader
+}
+
+func parsePosition(s string) (int, int64, error) {
+	p, o, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid message %q, want partition:offset", s)
+	}
+	partition, err := strconv.Atoi(p)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid partition in %q: %w", s, err)
+	}
+	offset, err := strconv.ParseInt(o, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid offset in %q: %w", s, err)
+	}
+	return partition, offset, nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package main
+
+// vehicleModel is one make/model the mock sells. The WMIs line up with
+// data/vpic.json so the local VIN decoder recognises mock VINs.
+type vehicleModel struct {
+	WMI         string
+	Make        string
+	Model       string
+	BodyType    string
+	VehicleType string
+	FuelType    string
+	Doors       int
+	MadeIn      string
+	Trims       []string
+	Drivetrains []string
+	BaseMSRP    int
+	TrimStep    int
+	CityMPG     int
+	HighwayMPG  int
+}
+
+var catalog = []vehicleModel{
+	{WMI: "1FT", Make: "Ford", Model: "F-150", BodyType: "Pickup", VehicleType: "Truck", FuelType: "Gasoline", Doors: 4, MadeIn: "USA",
+		Trims: []string{"XL", "XLT", "Lariat", "Platinum"}, Drivetrains: []string{"4WD", "RWD"}, BaseMSRP: 36000, TrimStep: 9000, CityMPG: 19, HighwayMPG: 25},
+	{WMI: "1FA", Make: "Ford", Model: "Mustang", BodyType: "Coupe", VehicleType: "Car", FuelType: "Gasoline", Doors: 2, MadeIn: "USA",
+		Trims: []string{"EcoBoost", "GT", "Mach 1"}, Drivetrains: []string{"RWD"}, BaseMSRP: 31000, TrimStep: 11000, CityMPG: 20, HighwayMPG: 30},
+	{WMI: "1FM", Make: "Ford", Model: "Explorer", BodyType: "SUV", VehicleType: "Truck", FuelType: "Gasoline", Doors: 4, MadeIn: "USA",
+		Trims: []string{"Base", "XLT", "Limited", "ST"}, Drivetrains: []string{"4WD", "RWD"}, BaseMSRP: 37000, TrimStep: 7000, CityMPG: 20, HighwayMPG: 27},
+	{WMI: "1GC", Make: "Chevrolet", Model: "Silverado 1500", BodyType: "Pickup", VehicleType: "Truck", FuelType: "Gasoline", Doors: 4, MadeIn: "USA",
+		Trims: []string{"WT", "LT", "RST", "High Country"}, Drivetrains: []string{"4WD", "RWD"}, BaseMSRP: 37000, TrimStep: 9500, CityMPG: 17, HighwayMPG: 23},
+	{WMI: "1G1", Make: "Chevrolet", Model: "Malibu", BodyType: "Sedan", VehicleType: "Car", FuelType: "Gasoline", Doors: 4, MadeIn: "USA",
+		Trims: []string{"LS", "RS", "LT", "Premier"}, Drivetrains: []string{"FWD"}, BaseMSRP: 25000, TrimStep: 3000, CityMPG: 29, HighwayMPG: 36},
+	{WMI: "1HG", Make: "Honda", Model: "Accord", BodyType: "Sedan", VehicleType: "Car", FuelType: "Gasoline", Doors: 4, MadeIn: "USA",
+		Trims: []string{"LX", "EX", "Sport", "Touring"}, Drivetrains: []string{"FWD"}, BaseMSRP: 27000, TrimStep: 3500, CityMPG: 30, HighwayMPG: 38},
+	{WMI: "JHM", Make: "Honda", Model: "Fit", BodyType: "Hatchback", VehicleType: "Car", FuelType: "Gasoline", Doors: 4, MadeIn: "Japan",
+		Trims: []string{"LX", "Sport", "EX"}, Drivetrains: []string{"FWD"}, BaseMSRP: 17000, TrimStep: 1800, CityMPG: 33, HighwayMPG: 40},
+	{WMI: "4T1", Make: "Toyota", Model: "Camry", BodyType: "Sedan", VehicleType: "Car", FuelType: "Gasoline", Doors: 4, MadeIn: "USA",
+		Trims: []string{"LE", "SE", "XLE", "XSE"}, Drivetrains: []string{"FWD", "AWD"}, BaseMSRP: 26000, TrimStep: 3500, CityMPG: 28, HighwayMPG: 39},
+	{WMI: "2T1", Make: "Toyota", Model: "Corolla", BodyType: "Sedan", VehicleType: "Car", FuelType: "Gasoline", Doors: 4, MadeIn: "Canada",
+		Trims: []string{"L", "LE", "SE", "XSE"}, Drivetrains: []string{"FWD"}, BaseMSRP: 21000, TrimStep: 2500, CityMPG: 31, HighwayMPG: 40},
+	{WMI: "5YJ", Make: "Tesla", Model: "Model 3", BodyType: "Sedan", VehicleType: "Car", FuelType: "Electric", Doors: 4, MadeIn: "USA",
+		Trims: []string{"Standard Range", "Long Range", "Performance"}, Drivetrains: []string{"RWD", "AWD"}, BaseMSRP: 40000, TrimStep: 8000},
+	{WMI: "3VW", Make: "Volkswagen", Model: "Jetta", BodyType: "Sedan", VehicleType: "Car", FuelType: "Gasoline", Doors: 4, MadeIn: "Mexico",
+		Trims: []string{"S", "SE", "SEL"}, Drivetrains: []string{"FWD"}, BaseMSRP: 21000, TrimStep: 3500, CityMPG: 29, HighwayMPG: 40},
+	{WMI: "WBA", Make: "BMW", Model: "3 Series", BodyType: "Sedan", VehicleType: "Car", FuelType: "Gasoline", Doors: 4, MadeIn: "Germany",
+		Trims: []string{"330i", "330i xDrive", "M340i"}, Drivetrains: []string{"RWD", "AWD"}, BaseMSRP: 44000, TrimStep: 6000, CityMPG: 26, HighwayMPG: 35},
+	{WMI: "KNA", Make: "Kia", Model: "Forte", BodyType: "Sedan", VehicleType: "Car", FuelType: "Gasoline", Doors: 4, MadeIn: "South Korea",
+		Trims: []string{"FE", "LXS", "GT-Line", "GT"}, Drivetrains: []string{"FWD"}, BaseMSRP: 19000, TrimStep: 2500, CityMPG: 31, HighwayMPG: 41},
+}
+
+type dealer struct {
+	ID        int
+	Name      string
+	Street    string
+	City      string
+	State     string
+	Zip       string
+	Latitude  float64
+	Longitude float64
+	Phone     string
+}
+
+var dealers = []dealer{
+	{ID: 1001, Name: "Irvine Auto Center", Street: "1 Auto Center Dr", City: "Irvine", State: "CA", Zip: "92618", Latitude: 33.6505, Longitude: -117.7370, Phone: "(949) 555-0101"},
+	{ID: 1002, Name: "Tustin Motors", Street: "100 Auto Center Dr", City: "Tustin", State: "CA", Zip: "92782", Latitude: 33.7309, Longitude: -117.8144, Phone: "(714) 555-0102"},
+	{ID: 1003, Name: "Costa Mesa Cars", Street: "2500 Harbor Blvd", City: "Costa Mesa", State: "CA", Zip: "92626", Latitude: 33.6846, Longitude: -117.9186, Phone: "(714) 555-0103"},
+	{ID: 1004, Name: "Santa Ana Trucks", Street: "1800 E 17th St", City: "Santa Ana", State: "CA", Zip: "92705", Latitude: 33.7588, Longitude: -117.8388, Phone: "(714) 555-0104"},
+	{ID: 1005, Name: "Riverside Auto Mall", Street: "8000 Auto Dr", City: "Riverside", State: "CA", Zip: "92504", Latitude: 33.9095, Longitude: -117.4590, Phone: "(951) 555-0105"},
+	{ID: 1006, Name: "San Diego Motors", Street: "5500 Kearny Mesa Rd", City: "San Diego", State: "CA", Zip: "92111", Latitude: 32.8153, Longitude: -117.1542, Phone: "(858) 555-0106"},
+	{ID: 1007, Name: "Downtown LA Autos", Street: "1900 S Figueroa St", City: "Los Angeles", State: "CA", Zip: "90007", Latitude: 34.0286, Longitude: -118.2742, Phone: "(213) 555-0107"},
+	{ID: 1008, Name: "Phoenix Auto Plaza", Street: "4000 E Camelback Rd", City: "Phoenix", State: "AZ", Zip: "85018", Latitude: 33.5092, Longitude: -111.9939, Phone: "(602) 555-0108"},
+}
+
+// zipCoords resolves search zips for radius filtering. Unknown zips skip the
+// radius filter.
+var zipCoords = map[string][2]float64{
+	"92617": {33.6430, -117.8412},
+	"92618": {33.6505, -117.7370},
+	"92782": {33.7309, -117.8144},
+	"92626": {33.6846, -117.9186},
+	"92705": {33.7588, -117.8388},
+	"92504": {33.9095, -117.4590},
+	"92111": {32.8153, -117.1542},
+	"90007": {34.0286, -118.2742},
+	"85018": {33.5092, -111.9939},
+}
+
+var colors = []string{"Oxford White", "Agate Black", "Iconic Silver", "Rapid Red", "Carbonized Gray", "Atlas Blue", "Summit White", "Lunar Silver"}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/vin"
+)
+
+// vinAlphabet is the ISO 3779 character set; indexes into it encode the
+// catalog entry, trim and drivetrain in the VDS so decode needs no state.
+const vinAlphabet = "0123456789ABCDEFGHJKLMNPRSTUVWXYZ"
+const vinLetters = "ABCDEFGHJKLMNPRSTUVWXYZ"
+
+// inventory is a deterministic market: a fixed number of lot slots, each
+// holding a succession of cars that are listed for a while, drop in price,
+// sell, and leave the slot empty for a few ticks before the next car
+// arrives. Everything is derived from (seed, slot, generation, tick), so
+// two servers with the same seed and epoch agree at every instant.
+type inventory struct {
+	seed  uint64
+	slots int
+	epoch time.Time
+	tick  time.Duration
+
+	mu       sync.Mutex
+	cachedAt int64
+	listings []marketcheck.Listing
+	byID     map[string]int
+}
+
+func newInventory(seed uint64, slots int, epoch time.Time, tick time.Duration) *inventory {
+	return &inventory{
+		seed:     seed,
+		slots:    slots,
+		epoch:    epoch,
+		tick:     tick,
+		cachedAt: math.MinInt64,
+	}
+}
+
+func (inv *inventory) tickAt(t time.Time) int64 {
+	return int64(math.Floor(float64(t.Sub(inv.epoch)) / float64(inv.tick)))
+}
+
+func (inv *inventory) timeAt(tick int64) time.Time {
+	return inv.epoch.Add(time.Duration(tick) * inv.tick)
+}
+
+// snapshot returns the active listings at now, regenerating at most once
+// per tick.
+func (inv *inventory) snapshot(now time.Time) ([]marketcheck.Listing, map[string]int) {
+	tick := inv.tickAt(now)
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if tick == inv.cachedAt {
+		return inv.listings, inv.byID
+	}
+
+	listings := make([]marketcheck.Listing, 0, inv.slots)
+	byID := make(map[string]int, inv.slots)
+	for slot := 0; slot < inv.slots; slot++ {
+		gen, start, ok := inv.generationAt(slot, tick)
+		if !ok {
+			continue
+		}
+		l := inv.listing(slot, gen, start, tick)
+		byID[l.ID] = len(listings)
+		listings = append(listings, l)
+	}
+	inv.cachedAt = tick
+	inv.listings = listings
+	inv.byID = byID
+	return listings, byID
+}
+
+func (inv *inventory) rng(slot int, gen uint64, stream uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(inv.seed^stream, uint64(slot)<<24|gen))
+}
+
+// generationAt walks a slot's timeline to find which car, if any, is
+// listed at tick.
+func (inv *inventory) generationAt(slot int, tick int64) (uint64, int64, bool) {
+	start := -int64(inv.rng(slot, 0, 0xA11CE).IntN(60))
+	for gen := uint64(0); ; gen++ {
+		r := inv.rng(slot, gen, 0x5107)
+		life := int64(7 + r.IntN(60))
+		gap := int64(r.IntN(5))
+		if tick < start {
+			return 0, 0, false
+		}
+		if tick < start+life {
+			return gen, start, true
+		}
+		if tick < start+life+gap {
+			return 0, 0, false
+		}
+		start += life + gap
+	}
+}
+
+func (inv *inventory) listing(slot int, gen uint64, start, tick int64) marketcheck.Listing {
+	r := inv.rng(slot, gen, 0xCA2)
+	listedAt := inv.timeAt(start)
+	now := inv.timeAt(tick)
+
+	modelIdx := r.IntN(len(catalog))
+	m := catalog[modelIdx]
+	trimIdx := r.IntN(len(m.Trims))
+	dtIdx := r.IntN(len(m.Drivetrains))
+	year := listedAt.Year() - r.IntN(9)
+	if r.IntN(10) == 0 {
+		year = listedAt.Year() + 1
+	}
+	d := dealers[r.IntN(len(dealers))]
+
+	ageYears := max(float64(listedAt.Year()-year)+0.5, 0)
+	miles := int(ageYears*12000*(0.6+0.8*r.Float64())) + r.IntN(50)
+	msrp := roundTo(m.BaseMSRP+trimIdx*m.TrimStep+r.IntN(2500), 100)
+	basePrice := float64(msrp) * 0.9 * math.Pow(0.87, ageYears)
+
+	// Roughly two thirds of cars take periodic price cuts while listed.
+	age := int(tick - start)
+	dropEvery := 5 + r.IntN(11)
+	dropPct := 0.01 + 0.04*r.Float64()
+	if r.IntN(3) == 0 {
+		dropPct = 0
+	}
+	price := roundTo(int(basePrice*math.Pow(1-dropPct, float64(age/dropEvery))), 100)
+
+	v := buildVIN(r, m.WMI, modelIdx, trimIdx, dtIdx, year)
+	id := fmt.Sprintf("mock-%d-%d", slot, gen)
+
+	return marketcheck.Listing{
+		ID:                 id,
+		VIN:                v,
+		Heading:            fmt.Sprintf("%d %s %s %s", year, m.Make, m.Model, m.Trims[trimIdx]),
+		Price:              price,
+		PriceChangePercent: -dropPct * 100 * float64(min(age/dropEvery, 1)),
+		MSRP:               msrp,
+		RefPrice:           roundTo(int(basePrice), 100),
+		RefPriceDate:       listedAt.Unix(),
+		Miles:              miles,
+		CarfaxOneOwner:     r.IntN(2) == 0,
+		CarfaxCleanTitle:   r.IntN(10) != 0,
+		ExteriorColor:      colors[r.IntN(len(colors))],
+		InteriorColor:      "Black",
+		DOM:                age,
+		DOM180:             min(age, 180),
+		DOMActive:          age,
+		DataSource:         "mock",
+		Source:             strings.ToLower(strings.ReplaceAll(d.Name, " ", "")) + ".example.com",
+		VDPURL:             fmt.Sprintf("https://%s.example.com/inventory/%s", strings.ToLower(strings.ReplaceAll(d.Name, " ", "")), v),
+		SellerType:         "dealer",
+		InventoryType:      "used",
+		StockNo:            fmt.Sprintf("S%05d", slot),
+		LastSeenAt:         now.Unix(),
+		LastSeenAtDate:     now.Format(time.RFC3339),
+		ScrapedAt:          now.Unix(),
+		ScrapedAtDate:      now.Format(time.RFC3339),
+		FirstSeenAt:        listedAt.Unix(),
+		FirstSeenAtDate:    listedAt.Format(time.RFC3339),
+		CarLocation: marketcheck.CarLocation{
+			SellerName: d.Name,
+			Street:     d.Street,
+			City:       d.City,
+			State:      d.State,
+			Zip:        d.Zip,
+			Latitude:   fmt.Sprintf("%.4f", d.Latitude),
+			Longitude:  fmt.Sprintf("%.4f", d.Longitude),
+		},
+		Dealer: marketcheck.Dealer{
+			ID:         d.ID,
+			Name:       d.Name,
+			DealerType: "franchise",
+			Street:     d.Street,
+			City:       d.City,
+			State:      d.State,
+			Country:    "US",
+			Zip:        d.Zip,
+			Latitude:   fmt.Sprintf("%.4f", d.Latitude),
+			Longitude:  fmt.Sprintf("%.4f", d.Longitude),
+			Phone:      d.Phone,
+		},
+		Build: buildFor(m, trimIdx, dtIdx, year),
+	}
+}
+
+func buildFor(m vehicleModel, trimIdx, dtIdx, year int) marketcheck.Build {
+	return marketcheck.Build{
+		Year:        year,
+		Make:        m.Make,
+		Model:       m.Model,
+		Trim:        m.Trims[trimIdx],
+		BodyType:    m.BodyType,
+		VehicleType: m.VehicleType,
+		Drivetrain:  m.Drivetrains[dtIdx],
+		FuelType:    m.FuelType,
+		Doors:       m.Doors,
+		MadeIn:      m.MadeIn,
+		HighwayMPG:  m.HighwayMPG,
+		CityMPG:     m.CityMPG,
+	}
+}
+
+func buildVIN(r *rand.Rand, wmi string, modelIdx, trimIdx, dtIdx, year int) string {
+	yearCode, _ := vin.YearCode(year)
+	b := []byte(wmi)
+	b = append(b,
+		vinAlphabet[modelIdx],
+		vinAlphabet[trimIdx],
+		vinAlphabet[dtIdx],
+		vinLetters[r.IntN(len(vinLetters))],
+		vinAlphabet[r.IntN(len(vinAlphabet))],
+		'0',
+		yearCode,
+		vinLetters[r.IntN(len(vinLetters))],
+	)
+	b = append(b, fmt.Sprintf("%06d", r.IntN(1000000))...)
+	check, _ := vin.CheckDigit(string(b))
+	b[8] = check
+	return string(b)
+}
+
+// decodeVIN recovers the build from the VDS indexes written by buildVIN.
+func decodeVIN(v *vin.VIN) (marketcheck.Build, bool) {
+	modelIdx := strings.IndexByte(vinAlphabet, v.VDS[0])
+	if modelIdx < 0 || modelIdx >= len(catalog) || catalog[modelIdx].WMI != v.WMI {
+		return marketcheck.Build{}, false
+	}
+	m := catalog[modelIdx]
+	trimIdx := strings.IndexByte(vinAlphabet, v.VDS[1])
+	dtIdx := strings.IndexByte(vinAlphabet, v.VDS[2])
+	if trimIdx < 0 || trimIdx >= len(m.Trims) || dtIdx < 0 || dtIdx >= len(m.Drivetrains) {
+		return marketcheck.Build{}, false
+	}
+	return buildFor(m, trimIdx, dtIdx, v.ModelYear), true
+}
+
+func roundTo(n, step int) int {
+	return (n + step/2) / step * step
+}
+
+func distanceMiles(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 3958.8
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
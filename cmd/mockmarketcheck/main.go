@@ -0,0 +1,185 @@
+// Command mockmarketcheck serves the subset of the MarketCheck API the client
+// uses, backed by a synthetic inventory. Point MARKETCHECK_BASE_URL at it to
+// run the producer, consumer and API end to end without spending quota.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/vin"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	seed := flag.Uint64("seed", 1, "inventory seed; the same seed and epoch always produce the same market")
+	size := flag.Int("size", 2000, "number of lot slots; roughly 90% are occupied at any time")
+	tick := flag.Duration("tick", 24*time.Hour, "simulated day length; listings age, drop in price and sell once per tick")
+	epochFlag := flag.String("epoch", "2025-01-01T00:00:00Z", "RFC 3339 start of the simulated timeline")
+	apiKey := flag.String("api-key", "", "if set, reject requests whose api_key doesn't match")
+	errorRate := flag.Float64("error-rate", 0, "fraction of requests answered with a 429 or 503")
+	latency := flag.Duration("latency", 0, "added to every response")
+	flag.Parse()
+
+	epoch, err := time.Parse(time.RFC3339, *epochFlag)
+	if err != nil {
+		log.Fatalf("Invalid -epoch: %v", err)
+	}
+	if *tick <= 0 || *size <= 0 {
+		log.Fatal("-tick and -size must be positive")
+	}
+
+	inv := newInventory(*seed, *size, epoch, *tick)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"status": "healthy"})
+	})
+
+	mux.HandleFunc("GET /search/car/active", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		params, err := marketcheck.DecodeSearchParams(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := params.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		start := queryInt(q, "start", 0)
+		rows := queryInt(q, "rows", 10)
+		if start < 0 || rows < 0 || rows > marketcheck.MaxPageSize {
+			http.Error(w, "rows must be between 0 and 50", http.StatusBadRequest)
+			return
+		}
+
+		all, _ := inv.snapshot(time.Now())
+		matched := search(all, params)
+
+		page := []marketcheck.Listing{}
+		if start < len(matched) {
+			page = matched[start:min(start+rows, len(matched))]
+		}
+		writeJSON(w, marketcheck.SearchPage{Listings: page, NumFound: len(matched)})
+	})
+
+	mux.HandleFunc("GET /listing/car/{id}", func(w http.ResponseWriter, r *http.Request) {
+		all, byID := inv.snapshot(time.Now())
+		i, ok := byID[r.PathValue("id")]
+		if !ok {
+			http.Error(w, "listing not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, all[i])
+	})
+
+	mux.HandleFunc("GET /decode/car/{vin}/specs", func(w http.ResponseWriter, r *http.Request) {
+		parsed, err := vin.Parse(r.PathValue("vin"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		build, ok := decodeVIN(parsed)
+		if !ok {
+			http.Error(w, "vin not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, build)
+	})
+
+	handler := faults(mux, *apiKey, *errorRate, *latency)
+
+	log.Printf("Mock MarketCheck listening on %s (seed %d, %d slots, tick %s)", *addr, *seed, *size, *tick)
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+// search filters and sorts a snapshot. Radius is applied only for zips in
+// zipCoords; sort_by=dist falls back to the snapshot order otherwise.
+func search(all []marketcheck.Listing, params marketcheck.SearchParams) []marketcheck.Listing {
+	origin, haveOrigin := zipCoords[params.Zip]
+	distance := func(l marketcheck.Listing) float64 {
+		lat, _ := strconv.ParseFloat(l.Dealer.Latitude, 64)
+		lon, _ := strconv.ParseFloat(l.Dealer.Longitude, 64)
+		return distanceMiles(origin[0], origin[1], lat, lon)
+	}
+
+	var matched []marketcheck.Listing
+	for _, l := range all {
+		if !params.Matches(l) {
+			continue
+		}
+		if haveOrigin && params.Radius > 0 && distance(l) > float64(params.Radius) {
+			continue
+		}
+		matched = append(matched, l)
+	}
+
+	if params.SortBy == "dist" && haveOrigin {
+		desc := params.SortOrder == "desc"
+		sort.SliceStable(matched, func(i, j int) bool {
+			if desc {
+				return distance(matched[i]) > distance(matched[j])
+			}
+			return distance(matched[i]) < distance(matched[j])
+		})
+	} else {
+		params.Sort(matched)
+	}
+	return matched
+}
+
+// faults wraps h with the api_key check, injected latency and injected
+// upstream errors, so client retries and quota handling can be exercised.
+func faults(h http.Handler, apiKey string, errorRate float64, latency time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if latency > 0 {
+			time.Sleep(latency)
+		}
+		if r.URL.Path == "/health" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if apiKey != "" && r.URL.Query().Get("api_key") != apiKey {
+			http.Error(w, "invalid api_key", http.StatusUnauthorized)
+			return
+		}
+		if errorRate > 0 && rand.Float64() < errorRate {
+			if rand.IntN(2) == 0 {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			} else {
+				http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+			}
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func queryInt(q url.Values, key string, def int) int {
+	if v := q.Get(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		return -1
+	}
+	return def
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -7,12 +7,29 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/omerahmer/motor_metrics/internal/analytics"
+	"github.com/omerahmer/motor_metrics/internal/catalog"
 	"github.com/omerahmer/motor_metrics/internal/config"
+	"github.com/omerahmer/motor_metrics/internal/feed"
 	"github.com/omerahmer/motor_metrics/internal/kafka"
+	"github.com/omerahmer/motor_metrics/internal/lifecycle"
 	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/markets"
+	"github.com/omerahmer/motor_metrics/internal/nhtsa"
+	"github.com/omerahmer/motor_metrics/internal/outbox"
+	"github.com/omerahmer/motor_metrics/internal/pricewatch"
 	"github.com/omerahmer/motor_metrics/internal/producer"
+	"github.com/omerahmer/motor_metrics/internal/quota"
 	"github.com/omerahmer/motor_metrics/internal/repository"
+	"github.com/omerahmer/motor_metrics/internal/safety"
+	"github.com/omerahmer/motor_metrics/internal/savedsearch"
+	"github.com/omerahmer/motor_metrics/internal/scheduler"
+	"github.com/omerahmer/motor_metrics/internal/store"
+	"github.com/omerahmer/motor_metrics/internal/valuation"
+	"github.com/omerahmer/motor_metrics/internal/vindecode"
+	"github.com/omerahmer/motor_metrics/internal/webhooks"
 )
 
 func main() {
@@ -21,47 +38,218 @@ func main() {
 
 	cfg := config.Load()
 
-	if cfg.MarketCheckKey == "" {
-		log.Printf("DEBUG: MARKETCHECK_API_KEY env var value: %q", os.Getenv("MARKETCHECK_API_KEY"))
+	if cfg.MarketCheckKey == "" && cfg.RequiresMarketCheckKey() {
 		log.Fatal("MARKETCHECK_API_KEY environment variable is required")
 	}
-	log.Printf("DEBUG: API key loaded successfully (length: %d)", len(cfg.MarketCheckKey))
+
+	if cfg.CatalogSyncHours > 0 && len(splitList(cfg.CatalogMakes)) == 0 {
+		log.Fatalf("CATALOG_MAKES must list the makes to sync, or be %q for every make, while CATALOG_SYNC_INTERVAL_HOURS is set", config.AllCatalogMakes)
+	}
 
 	brokers := strings.Split(cfg.KafkaBrokers, ",")
 	for i := range brokers {
 		brokers[i] = strings.TrimSpace(brokers[i])
 	}
 
-	if cfg.DatabaseURL == "" {
-		log.Fatal("DATABASE_URL environment variable is required")
+	// Features that need the database are off without it.
+	var repo *repository.PostgresRepository
+	var priceRepo kafka.PriceStore
+	var listingRepo kafka.ListingRepository
+	switch cfg.Storage {
+	case "postgres":
+		if cfg.DatabaseURL == "" {
+			log.Fatal("DATABASE_URL environment variable is required")
+		}
+		var err error
+		repo, err = repository.NewPostgresRepository(cfg.DatabaseURL)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer repo.Close()
+		log.Println("Connected to PostgreSQL database")
+		priceRepo, listingRepo = repo, repo
+	case "memory":
+		memStore := store.NewMemoryStore()
+		priceRepo, listingRepo = memStore, memStore
+		log.Println("Using in-memory storage; nothing is kept after exit")
+	default:
+		log.Fatalf("Unknown STORAGE %q", cfg.Storage)
 	}
 
-	repo, err := repository.NewPostgresRepository(cfg.DatabaseURL)
+	mcClient := marketcheck.NewClientWithURL(cfg.MarketCheckKey, cfg.MarketCheckURL)
+	retryPolicy := marketcheck.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = cfg.MarketCheckRetry
+	mcClient.SetRetryPolicy(retryPolicy)
+	transport, err := marketcheck.NewFixtureTransport(cfg.MarketCheckMode, cfg.FixturesDir)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to set up MarketCheck %s mode: %v", cfg.MarketCheckMode, err)
+	}
+	if transport != nil {
+		mcClient.SetTransport(transport)
+		log.Printf("MarketCheck client in %s mode using fixtures in %s", cfg.MarketCheckMode, cfg.FixturesDir)
+	}
+	if cfg.MarketCheckMode != marketcheck.ModeReplay && repo != nil {
+		mcClient.SetQuota(quota.NewManager(repo, quota.Limits{
+			Daily:   quota.Budget{Soft: cfg.QuotaDailySoft, Hard: cfg.QuotaDailyHard},
+			Monthly: quota.Budget{Soft: cfg.QuotaMonthlySoft, Hard: cfg.QuotaMonthlyHard},
+		}))
 	}
-	defer repo.Close()
-	log.Println("Connected to PostgreSQL database")
 
-	priceRepo := repo
-	listingRepo := repo
+	var source marketcheck.ListingSource = mcClient
+	if cfg.ListingSource == "feed" {
+		feedSource, err := feed.NewSource(cfg.FeedPath)
+		if err != nil {
+			log.Fatalf("Failed to load dealer feeds from %s: %v", cfg.FeedPath, err)
+		}
+		source = feedSource
+		log.Printf("Using dealer feed listing source at %s", cfg.FeedPath)
+	}
 
-	mcClient := marketcheck.NewClientWithURL(cfg.MarketCheckKey, cfg.MarketCheckURL)
+	if cfg.VINDecoderMode != vindecode.ModeOff {
+		decoder, err := vindecode.Load(cfg.VPICSnapshotPath)
+		if err != nil {
+			log.Fatalf("Failed to load vPIC snapshot: %v", err)
+		}
+		source = vindecode.NewSource(source, decoder, cfg.VINDecoderMode)
+		log.Printf("Using local VIN decoder (%s mode, snapshot %s)", cfg.VINDecoderMode, decoder.Version())
+	}
+
+	// With the in-memory bus, Kafka-only features (the dead-letter topic, the
+	// event topics and the webhooks they feed) are off.
+	var bus *kafka.MemoryBus
+	var writer kafka.Writer
+	var outboxPublisher outbox.Publisher
+	switch cfg.MessageBus {
+	case "kafka":
+		kafkaWriter := kafka.NewKafkaWriter(brokers, "listings-raw")
+		defer kafkaWriter.Close()
+		if err := kafkaWriter.SetCodec(cfg.KafkaCodec); err != nil {
+			log.Fatalf("Invalid KAFKA_CODEC: %v", err)
+		}
+		kafkaWriter.SetSource(cfg.ListingSource)
+		writer, outboxPublisher = kafkaWriter, kafkaWriter
+	case "memory":
+		bus = kafka.NewMemoryBus("listings-raw", cfg.MemoryBusBuffer)
+		if err := bus.SetCodec(cfg.KafkaCodec); err != nil {
+			log.Fatalf("Invalid KAFKA_CODEC: %v", err)
+		}
+		bus.SetSource(cfg.ListingSource)
+		writer, outboxPublisher = bus, bus
+		log.Printf("Using in-memory message bus (buffer %d)", cfg.MemoryBusBuffer)
+	default:
+		log.Fatalf("Unknown MESSAGE_BUS %q", cfg.MessageBus)
+	}
 
-	writer := kafka.NewKafkaWriter(brokers, "listings-raw")
-	defer writer.Close()
+	prod := producer.New(&cfg, source, writer)
+	var schedStore scheduler.Store
+	if repo != nil {
+		prod.SetSweepRecorder(repo)
+		schedStore = repo
+	}
+	schedOpts := scheduler.DefaultOptions()
+	schedOpts.RunOnStart = cfg.RunOnStart
+	schedOpts.CatchUp = cfg.CatchUp
+	schedOpts.Jitter = time.Duration(cfg.SchedulerJitter) * time.Second
+	schedOpts.LeaseTTL = time.Duration(cfg.SchedulerLease) * time.Second
+	schedOpts.Concurrency = cfg.SchedulerWorkers
+	prod.SetScheduler(scheduler.New(schedStore, schedOpts), time.Duration(max(cfg.MarketsReload, 1))*time.Second)
+	switch cfg.MarketsSource {
+	case markets.SourceConfig:
+		if err := producer.DefaultMarket(&cfg).Validate(); err != nil {
+			log.Fatalf("Invalid SEARCH_* market: %v", err)
+		}
+	case markets.SourceFile:
+		file := markets.NewFile(cfg.MarketsFile)
+		list, err := file.Markets(ctx)
+		if err != nil {
+			log.Fatalf("Failed to load markets: %v", err)
+		}
+		prod.SetMarkets(file)
+		log.Printf("Sweeping %d markets from %s", len(list), cfg.MarketsFile)
+	case markets.SourceTable:
+		if repo == nil {
+			log.Fatal("MARKETS_SOURCE=table needs STORAGE=postgres")
+		}
+		prod.SetMarkets(markets.NewTable(repo))
+		log.Println("Sweeping markets from tracked_markets")
+	default:
+		log.Fatalf("Unknown MARKETS_SOURCE %q", cfg.MarketsSource)
+	}
 
-	prod := producer.New(&cfg, mcClient, writer)
+	nhtsaClient := nhtsa.NewClient(cfg.NHTSAURL)
+	nhtsaClient.SetSafetyURL(cfg.NHTSASafetyURL)
+	if transport != nil {
+		nhtsaClient.SetTransport(transport)
+	}
+	if cfg.SafetyTTLHours > 0 && repo != nil {
+		prod.SetSafety(safety.NewService(nhtsaClient, repo, time.Duration(cfg.SafetyTTLHours)*time.Hour))
+	}
 
 	// Setup consumer
-	consumer := kafka.NewConsumer(
-		brokers,
-		"marketcheck-consumer",
-		"listings-raw",
-		priceRepo,
-		listingRepo,
-	)
+	var consumer *kafka.Consumer
+	if bus != nil {
+		consumer = kafka.NewConsumerFrom(bus.Subscribe(), priceRepo, listingRepo)
+	} else {
+		consumer = kafka.NewConsumer(
+			brokers,
+			"marketcheck-consumer",
+			"listings-raw",
+			priceRepo,
+			listingRepo,
+		)
+	}
 	defer consumer.Close()
+	consumerRetry := kafka.DefaultRetryPolicy()
+	consumerRetry.MaxAttempts = cfg.ConsumerAttempts
+	consumerRetry.MaxDelay = time.Duration(max(cfg.ConsumerRetryMax, 1)) * time.Second
+	consumer.SetRetryPolicy(consumerRetry)
+	if cfg.ConsumerWorkers > 0 && repo != nil {
+		poolOpts := kafka.DefaultPoolOptions()
+		poolOpts.Workers = cfg.ConsumerWorkers
+		poolOpts.BatchSize = cfg.ConsumerBatch
+		poolOpts.BatchWait = time.Duration(cfg.ConsumerBatchWait) * time.Millisecond
+		consumer.SetWorkerPool(repo, poolOpts)
+	}
+	if cfg.DLQTopic != "" && bus == nil {
+		dlqWriter := kafka.NewDLQWriter(brokers, cfg.DLQTopic, "marketcheck-consumer")
+		defer dlqWriter.Close()
+		consumer.SetDeadLetter(dlqWriter)
+	}
+	var soldEvents lifecycle.Publisher
+	if repo != nil {
+		consumer.SetQuarantine(repo)
+		valuationOpts := valuation.DefaultOptions()
+		valuationOpts.MinComparables = cfg.ValuationMinComp
+		valuationOpts.RadiusMiles = float64(cfg.ValuationRadius)
+		consumer.SetValuer(valuation.NewEngine(repo, valuationOpts))
+
+		var priceEvents pricewatch.Publisher
+		if cfg.PriceEventsTopic != "" && bus == nil {
+			eventWriter := kafka.NewPriceEventWriter(brokers, cfg.PriceEventsTopic)
+			defer eventWriter.Close()
+			priceEvents = eventWriter
+		}
+		priceWatcher := pricewatch.NewWatcher(repo, priceEvents, pricewatch.Thresholds{
+			MinAmount:   cfg.PriceChangeMinAmt,
+			MinPercent:  float64(cfg.PriceChangeMinPct),
+			RelistAfter: time.Duration(cfg.RelistAfterDays) * 24 * time.Hour,
+		})
+		consumer.SetPriceWatcher(priceWatcher)
+		if priceEvents != nil {
+			go func() {
+				if err := priceWatcher.Run(ctx, time.Minute); err != nil && ctx.Err() == nil {
+					log.Printf("price event publisher stopped with error: %v", err)
+				}
+			}()
+		}
+
+		if cfg.ListingEventsTopic != "" && bus == nil {
+			listingEvents := kafka.NewListingEventWriter(brokers, cfg.ListingEventsTopic)
+			defer listingEvents.Close()
+			consumer.SetListingEvents(repo, listingEvents)
+			soldEvents = listingEvents
+		}
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -75,10 +263,112 @@ func main() {
 		}
 	}()
 
-	// Start consumer in goroutine
+	if cfg.CatalogSyncHours > 0 && repo != nil {
+		syncer := catalog.NewSyncer(nhtsaClient, repo, splitList(cfg.CatalogTypes))
+		if strings.TrimSpace(cfg.CatalogMakes) != config.AllCatalogMakes {
+			syncer.SetMakes(splitList(cfg.CatalogMakes))
+		}
+		go func() {
+			log.Println("catalog sync started...")
+			if err := syncer.Run(ctx, time.Duration(cfg.CatalogSyncHours)*time.Hour); err != nil && ctx.Err() == nil {
+				log.Printf("catalog sync stopped with error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.DepreciationHours > 0 && repo != nil {
+		job := analytics.NewJob(repo, cfg.DepreciationMinObs)
+		go func() {
+			log.Println("depreciation fitting started...")
+			if err := job.Run(ctx, time.Duration(cfg.DepreciationHours)*time.Hour); err != nil && ctx.Err() == nil {
+				log.Printf("depreciation fitting stopped with error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.LifecycleHours > 0 && repo != nil {
+		tracker := lifecycle.NewTracker(repo, soldEvents, time.Duration(cfg.DelistAfterHours)*time.Hour)
+		go func() {
+			log.Println("listing lifecycle tracking started...")
+			if err := tracker.Run(ctx, time.Duration(cfg.LifecycleHours)*time.Hour); err != nil && ctx.Err() == nil {
+				log.Printf("listing lifecycle tracking stopped with error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.SavedSearchRefresh > 0 && repo != nil {
+		matcher := savedsearch.NewMatcher(repo, time.Duration(cfg.SavedSearchRefresh)*time.Second)
+		alertTimeout := time.Duration(cfg.AlertWebhookTimeout) * time.Second
+		matcher.AddNotifier(savedsearch.NewWebhookNotifier(alertTimeout, cfg.AlertAllowPrivate))
+		if cfg.AlertSMTPAddr != "" {
+			matcher.AddNotifier(savedsearch.NewSMTPNotifier(cfg.AlertSMTPAddr, cfg.AlertSMTPFrom, cfg.AlertSMTPUser, cfg.AlertSMTPPassword, alertTimeout))
+		}
+		var searchReader *kafka.ListingReader
+		if bus != nil {
+			searchReader = kafka.NewListingReaderFrom(bus.Subscribe(), matcher)
+		} else {
+			searchReader = kafka.NewListingReader(brokers, "saved-search-matcher", "listings-raw", matcher)
+		}
+		defer searchReader.Close()
+		go func() {
+			log.Println("saved search matcher started...")
+			if err := searchReader.Run(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("saved search matcher stopped with error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.WebhookPollSeconds > 0 && repo != nil && bus == nil {
+		webhookOpts := webhooks.DefaultOptions()
+		webhookOpts.MaxAttempts = cfg.WebhookMaxAttempts
+		webhookOpts.Timeout = time.Duration(cfg.WebhookTimeout) * time.Second
+		webhookOpts.AllowPrivate = cfg.AlertAllowPrivate
+		dispatcher, err := webhooks.NewDispatcher(repo, webhookOpts)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOK_MAX_ATTEMPTS: %v", err)
+		}
+		for _, topic := range []string{cfg.ListingEventsTopic, cfg.PriceEventsTopic} {
+			if topic == "" {
+				continue
+			}
+			eventReader := kafka.NewEventReader(brokers, "webhook-dispatcher", topic, dispatcher)
+			defer eventReader.Close()
+			go func() {
+				if err := eventReader.Run(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("webhook event reader for %s stopped with error: %v", topic, err)
+				}
+			}()
+		}
+		go func() {
+			log.Println("webhook dispatcher started...")
+			if err := dispatcher.Run(ctx, time.Duration(cfg.WebhookPollSeconds)*time.Second); err != nil && ctx.Err() == nil {
+				log.Printf("webhook dispatcher stopped with error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.OutboxPollSeconds > 0 && repo != nil {
+		outboxOpts := outbox.DefaultOptions()
+		outboxOpts.Holder = scheduler.DefaultHolder()
+		outboxOpts.Retention = time.Duration(cfg.OutboxRetention) * time.Hour
+		relay := outbox.NewRelay(repo, outboxPublisher, outboxOpts)
+		go func() {
+			log.Println("outbox relay started...")
+			if err := relay.Run(ctx, time.Duration(cfg.OutboxPollSeconds)*time.Second); err != nil && ctx.Err() == nil {
+				log.Printf("outbox relay stopped with error: %v", err)
+			}
+		}()
+	}
+
+	// Start consumer in goroutine. It stops after the producer, so that it
+	// can drain the in-memory bus.
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	defer stopConsumer()
+	consumerDone := make(chan struct{})
 	go func() {
+		defer close(consumerDone)
 		log.Println("consumer started...")
-		if err := consumer.Run(ctx); err != nil {
+		if err := consumer.Run(consumerCtx); err != nil && consumerCtx.Err() == nil {
 			log.Printf("consumer stopped with error: %v", err)
 		}
 	}()
@@ -87,4 +377,25 @@ func main() {
 	<-sigChan
 	log.Println("shutting down...")
 	cancel()
+	if bus != nil {
+		bus.Close()
+		select {
+		case <-consumerDone:
+			log.Println("drained the message bus")
+		case <-time.After(time.Duration(cfg.BusDrainSeconds) * time.Second):
+			log.Printf("stopping the consumer with %d messages left on the bus", bus.Pending())
+		}
+	}
+	stopConsumer()
+	<-consumerDone
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
 }
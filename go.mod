@@ -3,9 +3,16 @@ module github.com/omerahmer/motor_metrics
 go 1.25.4
 
 require (
+	github.com/lib/pq v1.10.9
+	github.com/linkedin/goavro/v2 v2.9.8
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/segmentio/kafka-go v0.4.49
+	golang.org/x/time v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/golang/snappy v0.0.1 // indirect
 	github.com/klauspost/compress v1.15.9 // indirect
-	github.com/lib/pq v1.10.9 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
-	github.com/segmentio/kafka-go v0.4.49 // indirect
-	golang.org/x/time v0.14.0 // indirect
 )
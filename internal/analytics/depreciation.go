@@ -0,0 +1,252 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/stats"
+)
+
+// DefaultAnnualMiles is assumed for projections when the caller doesn't say.
+const DefaultAnnualMiles = 12000
+
+// Observation is one observed asking price joined with the listing's build.
+type Observation struct {
+	Make  string
+	Model string
+	Trim  string
+	Year  int
+	Miles int
+	Price int
+	Date  time.Time
+}
+
+// Curve is an exponential depreciation model for a make/model/trim:
+//
+//	ln(price) = Intercept + AgeCoef*ageYears + MilesCoef*(miles/10000)
+//
+// Trim is empty for the curve fitted across all trims. Make, Model and Trim
+// are lower-cased.
+type Curve struct {
+	Make         string    `json:"make"`
+	Model        string    `json:"model"`
+	Trim         string    `json:"trim"`
+	Intercept    float64   `json:"intercept"`
+	AgeCoef      float64   `json:"age_coef"`
+	MilesCoef    float64   `json:"miles_coef"`
+	Sigma        float64   `json:"sigma"`
+	R2           float64   `json:"r_squared"`
+	Observations int       `json:"observations"`
+	MinAge       float64   `json:"min_age"`
+	MaxAge       float64   `json:"max_age"`
+	FittedAt     time.Time `json:"fitted_at"`
+}
+
+// AnnualDepreciation is the fraction of value lost per year of age at
+// constant mileage.
+func (c Curve) AnnualDepreciation() float64 {
+	return 1 - math.Exp(c.AgeCoef)
+}
+
+// MileageDepreciation is the fraction of value lost per 10,000 miles at
+// constant age.
+func (c Curve) MileageDepreciation() float64 {
+	return 1 - math.Exp(c.MilesCoef)
+}
+
+// Price is the curve's estimate for a vehicle of the given age and mileage.
+func (c Curve) Price(ageYears float64, miles int) float64 {
+	return math.Exp(c.Intercept + c.AgeCoef*ageYears + c.MilesCoef*float64(miles)/10000)
+}
+
+// Project estimates value months from now, assuming annualMiles are driven.
+// With a currentPrice the curve's relative change is applied to it, so a
+// car priced above or below the curve keeps that premium or discount;
+// otherwise the curve's own estimate is used.
+func (c Curve) Project(currentPrice float64, ageYears float64, miles, annualMiles, months int) float64 {
+	years := float64(months) / 12
+	future := c.Price(ageYears+years, miles+int(float64(annualMiles)*years))
+	if currentPrice <= 0 {
+		return future
+	}
+	return currentPrice * future / c.Price(ageYears, miles)
+}
+
+// AgeAt is a vehicle's age in years at t. Model year N goes on sale around
+// October of N-1, which is taken as age zero.
+func AgeAt(modelYear int, t time.Time) float64 {
+	onSale := time.Date(modelYear-1, time.October, 1, 0, 0, 0, 0, time.UTC)
+	age := t.Sub(onSale).Hours() / (24 * 365.25)
+	return math.Max(age, 0)
+}
+
+// FitCurves fits one curve per make/model/trim and one per make/model
+// across trims, skipping groups with fewer than minObservations prices or
+// less than half a year of age spread.
+func FitCurves(obs []Observation, minObservations int, now time.Time) []Curve {
+	groups := make(map[[3]string][]Observation)
+	for _, o := range obs {
+		if o.Price <= 0 || o.Year == 0 || o.Make == "" || o.Model == "" {
+			continue
+		}
+		mk, md, tr := strings.ToLower(o.Make), strings.ToLower(o.Model), strings.ToLower(strings.TrimSpace(o.Trim))
+		groups[[3]string{mk, md, ""}] = append(groups[[3]string{mk, md, ""}], o)
+		if tr != "" {
+			groups[[3]string{mk, md, tr}] = append(groups[[3]string{mk, md, tr}], o)
+		}
+	}
+
+	var curves []Curve
+	for key, group := range groups {
+		if len(group) < minObservations {
+			continue
+		}
+		c, err := fitCurve(group)
+		if err != nil {
+			continue
+		}
+		c.Make, c.Model, c.Trim = key[0], key[1], key[2]
+		c.FittedAt = now
+		curves = append(curves, c)
+	}
+	sort.Slice(curves, func(i, j int) bool {
+		a, b := curves[i], curves[j]
+		if a.Make != b.Make {
+			return a.Make < b.Make
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		return a.Trim < b.Trim
+	})
+	return curves
+}
+
+var errNoAgeSpread = errors.New("not enough age spread to fit a curve")
+
+func fitCurve(group []Observation) (Curve, error) {
+	ages := make([]float64, len(group))
+	minAge, maxAge := math.Inf(1), math.Inf(-1)
+	milesVary := false
+	for i, o := range group {
+		ages[i] = AgeAt(o.Year, o.Date)
+		minAge = math.Min(minAge, ages[i])
+		maxAge = math.Max(maxAge, ages[i])
+		milesVary = milesVary || o.Miles != group[0].Miles
+	}
+	if maxAge-minAge < 0.5 {
+		return Curve{}, errNoAgeSpread
+	}
+
+	ys := make([]float64, len(group))
+	withMiles := make([][]float64, len(group))
+	ageOnly := make([][]float64, len(group))
+	for i, o := range group {
+		ys[i] = math.Log(float64(o.Price))
+		withMiles[i] = []float64{1, ages[i], float64(o.Miles) / 10000}
+		ageOnly[i] = []float64{1, ages[i]}
+	}
+
+	c := Curve{Observations: len(group), MinAge: minAge, MaxAge: maxAge}
+	// Age and mileage are strongly correlated; fall back to age alone when
+	// mileage adds nothing the solver can separate.
+	if milesVary {
+		if f, err := stats.OLS(withMiles, ys); err == nil {
+			c.Intercept, c.AgeCoef, c.MilesCoef = f.Coef[0], f.Coef[1], f.Coef[2]
+			c.Sigma, c.R2 = f.Sigma, f.R2
+			return c, nil
+		}
+	}
+	f, err := stats.OLS(ageOnly, ys)
+	if err != nil {
+		return Curve{}, err
+	}
+	c.Intercept, c.AgeCoef = f.Coef[0], f.Coef[1]
+	c.Sigma, c.R2 = f.Sigma, f.R2
+	return c, nil
+}
+
+// Store supplies observed prices and persists fitted curves, replacing the
+// previous fit: curves for segments that no longer have enough observations
+// are removed rather than kept stale.
+type Store interface {
+	DepreciationObservations(ctx context.Context) ([]Observation, error)
+	SaveDepreciationCurves(ctx context.Context, curves []Curve) error
+}
+
+// Job refits every curve from stored listings and price history.
+type Job struct {
+	store           Store
+	minObservations int
+}
+
+func NewJob(store Store, minObservations int) *Job {
+	return &Job{store: store, minObservations: minObservations}
+}
+
+func (j *Job) RunOnce(ctx context.Context) (int, error) {
+	obs, err := j.store.DepreciationObservations(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load observations: %w", err)
+	}
+	curves := FitCurves(obs, j.minObservations, time.Now().UTC())
+	if err := j.store.SaveDepreciationCurves(ctx, curves); err != nil {
+		return 0, fmt.Errorf("failed to save curves: %w", err)
+	}
+	return len(curves), nil
+}
+
+// Run refits immediately and then every interval until ctx is done.
+func (j *Job) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := j.RunOnce(ctx)
+		if err != nil {
+			log.Printf("depreciation fit failed: %v", err)
+		} else {
+			log.Printf("depreciation fit: %d curves", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProjectionMonths are the horizons values are projected over.
+var ProjectionMonths = []int{12, 24, 36}
+
+type Projection struct {
+	Months int `json:"months"`
+	Value  int `json:"value"`
+	// Change is the fractional change from the current value.
+	Change float64 `json:"change"`
+}
+
+// Projections projects a vehicle's value over ProjectionMonths; see Project.
+func (c Curve) Projections(currentPrice float64, ageYears float64, miles, annualMiles int) []Projection {
+	base := currentPrice
+	if base <= 0 {
+		base = c.Price(ageYears, miles)
+	}
+	out := make([]Projection, 0, len(ProjectionMonths))
+	for _, m := range ProjectionMonths {
+		v := c.Project(base, ageYears, miles, annualMiles, m)
+		out = append(out, Projection{
+			Months: m,
+			Value:  int(math.Round(v)),
+			Change: math.Round((v/base-1)*1000) / 1000,
+		})
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var fitDate = time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+// synthetic returns observations priced exactly on the given curve.
+func synthetic(mk, model, trim string, intercept, ageCoef, milesCoef float64, years []int, miles []int) []Observation {
+	var obs []Observation
+	for _, y := range years {
+		for _, m := range miles {
+			age := AgeAt(y, fitDate)
+			price := math.Exp(intercept + ageCoef*age + milesCoef*float64(m)/10000)
+			obs = append(obs, Observation{
+				Make: mk, Model: model, Trim: trim,
+				Year: y, Miles: m, Price: int(math.Round(price)), Date: fitDate,
+			})
+		}
+	}
+	return obs
+}
+
+func near(got, want, tol float64) bool {
+	return math.Abs(got-want) <= tol
+}
+
+func TestFitCurvesRecoversCoefficients(t *testing.T) {
+	obs := synthetic("Honda", "Accord", "EX", 10.5, -0.12, -0.04, []int{2016, 2018, 2020, 2022, 2024}, []int{5000, 30000, 70000})
+	curves := FitCurves(obs, 5, fitDate)
+	if len(curves) != 2 {
+		t.Fatalf("got %d curves, want the all-trims and EX curves", len(curves))
+	}
+	if curves[0].Trim != "" || curves[1].Trim != "ex" || curves[0].Make != "honda" || curves[0].Model != "accord" {
+		t.Fatalf("curves keyed %q/%q/%q and %q", curves[0].Make, curves[0].Model, curves[0].Trim, curves[1].Trim)
+	}
+
+	c := curves[0]
+	if !near(c.Intercept, 10.5, 1e-3) || !near(c.AgeCoef, -0.12, 1e-3) || !near(c.MilesCoef, -0.04, 1e-3) {
+		t.Fatalf("coefficients = %.4f %.4f %.4f, want 10.5 -0.12 -0.04", c.Intercept, c.AgeCoef, c.MilesCoef)
+	}
+	if c.R2 < 0.999 || c.Observations != len(obs) || !c.FittedAt.Equal(fitDate) {
+		t.Fatalf("curve = %+v", c)
+	}
+	if !near(c.AnnualDepreciation(), 1-math.Exp(-0.12), 1e-3) || !near(c.MileageDepreciation(), 1-math.Exp(-0.04), 1e-3) {
+		t.Fatalf("depreciation rates = %.4f per year, %.4f per 10k miles", c.AnnualDepreciation(), c.MileageDepreciation())
+	}
+}
+
+func TestFitCurvesSkips(t *testing.T) {
+	spread := []int{2018, 2020, 2022}
+	tests := []struct {
+		name string
+		obs  []Observation
+		min  int
+	}{
+		{"too few observations", synthetic("Honda", "Civic", "", 10, -0.1, -0.05, spread, []int{10000, 50000}), 7},
+		{"age spread under half a year", synthetic("Honda", "Civic", "", 10, -0.1, -0.05, []int{2021}, []int{10000, 30000, 50000, 70000}), 3},
+		{"unusable rows", []Observation{
+			{Make: "Honda", Model: "Civic", Year: 2018, Price: 0, Date: fitDate},
+			{Make: "Honda", Model: "Civic", Year: 0, Price: 15000, Date: fitDate},
+			{Make: "", Model: "Civic", Year: 2020, Price: 18000, Date: fitDate},
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if curves := FitCurves(tt.obs, tt.min, fitDate); len(curves) != 0 {
+				t.Fatalf("fitted %+v", curves)
+			}
+		})
+	}
+}
+
+func TestFitCurvesAgeOnlyWhenMilesConstant(t *testing.T) {
+	obs := synthetic("Toyota", "Camry", "", 10.2, -0.09, 0, []int{2015, 2017, 2019, 2021, 2023}, []int{40000})
+	curves := FitCurves(obs, 5, fitDate)
+	if len(curves) != 1 {
+		t.Fatalf("got %d curves, want 1", len(curves))
+	}
+	c := curves[0]
+	if c.MilesCoef != 0 || !near(c.AgeCoef, -0.09, 1e-3) || !near(c.Intercept, 10.2, 1e-3) {
+		t.Fatalf("coefficients = %.4f %.4f %.4f, want an age-only fit", c.Intercept, c.AgeCoef, c.MilesCoef)
+	}
+}
+
+func TestProjectKeepsPremium(t *testing.T) {
+	c := Curve{Intercept: 10, AgeCoef: -0.1, MilesCoef: -0.05}
+	onCurve := c.Project(0, 3, 36000, 12000, 12)
+	if want := c.Price(4, 48000); !near(onCurve, want, 1e-6) {
+		t.Fatalf("curve projection = %.2f, want %.2f", onCurve, want)
+	}
+
+	current := c.Price(3, 36000)
+	for _, factor := range []float64{1.1, 0.85} {
+		got := c.Project(current*factor, 3, 36000, 12000, 12)
+		if !near(got/onCurve, factor, 1e-9) {
+			t.Fatalf("price at %.2fx the curve projected to %.3fx", factor, got/onCurve)
+		}
+	}
+}
+
+func TestProjections(t *testing.T) {
+	c := Curve{Intercept: 10, AgeCoef: -0.1, MilesCoef: -0.05}
+
+	got := c.Projections(20000, 2, 24000, 10000)
+	if len(got) != len(ProjectionMonths) {
+		t.Fatalf("got %d projections", len(got))
+	}
+	for i, p := range got {
+		years := float64(ProjectionMonths[i]) / 12
+		rate := math.Exp(-0.1*years - 0.05*years)
+		if p.Months != ProjectionMonths[i] || p.Value != int(math.Round(20000*rate)) || !near(p.Change, rate-1, 5e-4) {
+			t.Fatalf("projection %d = %+v, want value %.0f change %.3f", i, p, 20000*rate, rate-1)
+		}
+		if i > 0 && p.Value >= got[i-1].Value {
+			t.Fatalf("projections not decreasing: %+v", got)
+		}
+	}
+
+	base := c.Projections(0, 2, 24000, 10000)
+	if want := c.Project(0, 2, 24000, 10000, 36); base[2].Value != int(math.Round(want)) {
+		t.Fatalf("projection without a price = %d, want the curve's %.0f", base[2].Value, want)
+	}
+}
+
+func TestAgeAt(t *testing.T) {
+	if age := AgeAt(2025, time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC)); age != 0 {
+		t.Fatalf("age on sale date = %f", age)
+	}
+	if age := AgeAt(2026, fitDate); age != 0 {
+		t.Fatalf("age before sale = %f, want clamped to 0", age)
+	}
+	if age := AgeAt(2020, time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)); !near(age, 1, 0.01) {
+		t.Fatalf("age a year after sale = %f", age)
+	}
+}
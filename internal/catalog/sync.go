@@ -0,0 +1,175 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/nhtsa"
+)
+
+// Source is the part of the vPIC client the sync needs.
+type Source interface {
+	GetMakesForVehicleType(ctx context.Context, vehicleType string) ([]nhtsa.Make, error)
+	GetModelsForMakeYear(ctx context.Context, makeName string, year int, vehicleType string) ([]nhtsa.Model, error)
+}
+
+type Store interface {
+	UpsertMakes(ctx context.Context, makes []MakeRecord) error
+	UpsertModels(ctx context.Context, models []nhtsa.Model) error
+}
+
+// MakeRecord is a make with every vehicle type it was listed under.
+type MakeRecord struct {
+	ID           int
+	Name         string
+	VehicleTypes []string
+}
+
+type Stats struct {
+	Makes  int
+	Models int
+	Failed int
+}
+
+// Syncer copies the vPIC make/model catalog for a set of vehicle types into
+// the store. Models are fetched per make and vehicle type; a make that fails
+// is logged and counted, and picked up again on the next sync.
+type Syncer struct {
+	source       Source
+	store        Store
+	vehicleTypes []string
+	makes        map[string]bool
+}
+
+func NewSyncer(source Source, store Store, vehicleTypes []string) *Syncer {
+	return &Syncer{
+		source:       source,
+		store:        store,
+		vehicleTypes: vehicleTypes,
+	}
+}
+
+// SetMakes restricts the sync to the named makes. Empty syncs every make
+// vPIC lists for the configured vehicle types.
+func (s *Syncer) SetMakes(names []string) {
+	s.makes = nil
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			if s.makes == nil {
+				s.makes = make(map[string]bool)
+			}
+			s.makes[strings.ToLower(n)] = true
+		}
+	}
+}
+
+func (s *Syncer) Sync(ctx context.Context) (Stats, error) {
+	var stats Stats
+
+	byID := make(map[int]*MakeRecord)
+	for _, vt := range s.vehicleTypes {
+		makes, err := s.source.GetMakesForVehicleType(ctx, vt)
+		if err != nil {
+			return stats, fmt.Errorf("failed to fetch makes for %s: %w", vt, err)
+		}
+		for _, m := range makes {
+			if m.Name == "" || (s.makes != nil && !s.makes[strings.ToLower(m.Name)]) {
+				continue
+			}
+			rec, ok := byID[m.ID]
+			if !ok {
+				rec = &MakeRecord{ID: m.ID, Name: m.Name}
+				byID[m.ID] = rec
+			}
+			if m.VehicleType != "" && !contains(rec.VehicleTypes, m.VehicleType) {
+				rec.VehicleTypes = append(rec.VehicleTypes, m.VehicleType)
+			}
+		}
+	}
+
+	records := make([]MakeRecord, 0, len(byID))
+	for _, rec := range byID {
+		records = append(records, *rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+
+	if err := s.store.UpsertMakes(ctx, records); err != nil {
+		return stats, fmt.Errorf("failed to store makes: %w", err)
+	}
+	stats.Makes = len(records)
+
+	for _, rec := range records {
+		n, err := s.syncModels(ctx, rec)
+		if err != nil {
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
+			log.Printf("catalog: failed to sync models for %s: %v", rec.Name, err)
+			stats.Failed++
+			continue
+		}
+		stats.Models += n
+	}
+	return stats, nil
+}
+
+func (s *Syncer) syncModels(ctx context.Context, rec MakeRecord) (int, error) {
+	var models []nhtsa.Model
+	for _, vt := range rec.VehicleTypes {
+		batch, err := s.source.GetModelsForMakeYear(ctx, rec.Name, 0, vt)
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range batch {
+			// vPIC matches makes by name, so similarly named makes can
+			// leak into the results.
+			if m.MakeID != 0 && m.MakeID != rec.ID {
+				continue
+			}
+			m.MakeID = rec.ID
+			models = append(models, m)
+		}
+	}
+	if len(models) == 0 {
+		return 0, nil
+	}
+	if err := s.store.UpsertModels(ctx, models); err != nil {
+		return 0, err
+	}
+	return len(models), nil
+}
+
+// Run syncs immediately and then every interval until ctx is done.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		stats, err := s.Sync(ctx)
+		if err != nil {
+			log.Printf("catalog sync failed: %v", err)
+		} else {
+			log.Printf("catalog sync: %d makes, %d models, %d failed in %s", stats.Makes, stats.Models, stats.Failed, time.Since(start).Round(time.Second))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
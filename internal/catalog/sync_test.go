@@ -0,0 +1,129 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/omerahmer/motor_metrics/internal/nhtsa"
+)
+
+type fakeSource struct {
+	makes  map[string][]nhtsa.Make
+	models map[string][]nhtsa.Model
+	failed map[string]bool
+}
+
+func (s *fakeSource) GetMakesForVehicleType(ctx context.Context, vehicleType string) ([]nhtsa.Make, error) {
+	return s.makes[vehicleType], nil
+}
+
+func (s *fakeSource) GetModelsForMakeYear(ctx context.Context, makeName string, year int, vehicleType string) ([]nhtsa.Model, error) {
+	if s.failed[makeName] {
+		return nil, errors.New("vpic unavailable")
+	}
+	return s.models[makeName+"/"+vehicleType], nil
+}
+
+type fakeStore struct {
+	makes  []MakeRecord
+	models []nhtsa.Model
+}
+
+func (s *fakeStore) UpsertMakes(ctx context.Context, makes []MakeRecord) error {
+	s.makes = append(s.makes, makes...)
+	return nil
+}
+
+func (s *fakeStore) UpsertModels(ctx context.Context, models []nhtsa.Model) error {
+	s.models = append(s.models, models...)
+	return nil
+}
+
+func testSource() *fakeSource {
+	return &fakeSource{
+		makes: map[string][]nhtsa.Make{
+			"car": {
+				{ID: 474, Name: "HONDA", VehicleType: "Passenger Car"},
+				{ID: 448, Name: "TOYOTA", VehicleType: "Passenger Car"},
+				{ID: 0, Name: ""},
+			},
+			"truck": {
+				{ID: 474, Name: "HONDA", VehicleType: "Truck"},
+			},
+		},
+		models: map[string][]nhtsa.Model{
+			"HONDA/Passenger Car": {
+				{ID: 1861, MakeID: 474, Name: "Accord"},
+				{ID: 5000, MakeID: 999, Name: "Honda-ish"},
+			},
+			"HONDA/Truck":          {{ID: 1864, Name: "Ridgeline"}},
+			"TOYOTA/Passenger Car": {{ID: 2469, MakeID: 448, Name: "Camry"}},
+		},
+	}
+}
+
+func TestSyncMergesVehicleTypes(t *testing.T) {
+	store := &fakeStore{}
+	stats, err := NewSyncer(testSource(), store, []string{"car", "truck"}).Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Makes: 2, Models: 3}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	if len(store.makes) != 2 || store.makes[0].Name != "HONDA" || store.makes[1].Name != "TOYOTA" {
+		t.Fatalf("makes = %+v, want HONDA and TOYOTA sorted by name", store.makes)
+	}
+	if vt := store.makes[0].VehicleTypes; len(vt) != 2 || vt[0] != "Passenger Car" || vt[1] != "Truck" {
+		t.Fatalf("HONDA vehicle types = %v", vt)
+	}
+
+	ids := map[int]int{}
+	for _, m := range store.models {
+		ids[m.ID] = m.MakeID
+	}
+	if _, ok := ids[5000]; ok {
+		t.Fatal("model from another make was stored")
+	}
+	if ids[1864] != 474 {
+		t.Fatalf("model without a make id stored under %d, want 474", ids[1864])
+	}
+}
+
+func TestSyncRestrictedMakes(t *testing.T) {
+	store := &fakeStore{}
+	s := NewSyncer(testSource(), store, []string{"car"})
+	s.SetMakes([]string{" toyota ", ""})
+
+	stats, err := s.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Makes != 1 || len(store.makes) != 1 || store.makes[0].Name != "TOYOTA" {
+		t.Fatalf("stats = %+v, makes = %+v", stats, store.makes)
+	}
+
+	s.SetMakes(nil)
+	if stats, _ := s.Sync(context.Background()); stats.Makes != 2 {
+		t.Fatalf("clearing the make filter synced %d makes", stats.Makes)
+	}
+}
+
+func TestSyncCountsFailedMakes(t *testing.T) {
+	source := testSource()
+	source.failed = map[string]bool{"HONDA": true}
+	store := &fakeStore{}
+
+	stats, err := NewSyncer(source, store, []string{"car", "truck"}).Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Makes: 2, Models: 1, Failed: 1}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if len(store.models) != 1 || store.models[0].Name != "Camry" {
+		t.Fatalf("models = %+v", store.models)
+	}
+}
@@ -9,11 +9,81 @@ import (
 type Config struct {
 	MarketCheckKey   string
 	MarketCheckURL   string
+	MarketCheckRetry int
+	MarketCheckMode  string
+	FixturesDir      string
+	QuotaDailySoft   int
+	QuotaDailyHard   int
+	QuotaMonthlySoft int
+	QuotaMonthlyHard int
+	ListingSource    string
+	FeedPath         string
+	VINDecoderMode   string
+	VPICSnapshotPath string
+	NHTSAURL         string
+	CatalogSyncHours int
+	CatalogTypes     string
+	CatalogMakes     string
+	NHTSASafetyURL   string
+	SafetyTTLHours   int
+	ValuationMinComp int
+	ValuationRadius  int
+
+	DepreciationHours  int
+	DepreciationMinObs int
+
+	PriceEventsTopic  string
+	PriceChangeMinAmt int
+	PriceChangeMinPct int
+	RelistAfterDays   int
+
+	SavedSearchRefresh  int
+	AlertWebhookTimeout int
+	AlertAllowPrivate   bool
+	AlertSMTPAddr       string
+	AlertSMTPFrom       string
+	AlertSMTPUser       string
+	AlertSMTPPassword   string
+
+	ListingEventsTopic string
+	WebhookPollSeconds int
+	WebhookMaxAttempts int
+	WebhookTimeout     int
+
+	DelistAfterHours int
+	LifecycleHours   int
+
+	DLQTopic          string
+	ConsumerAttempts  int
+	ConsumerRetryMax  int
+	ConsumerWorkers   int
+	ConsumerBatch     int
+	ConsumerBatchWait int
+
+	OutboxPollSeconds int
+	OutboxRetention   int
+
 	KafkaBrokers     string
+	KafkaCodec       string
+	MessageBus       string
+	MemoryBusBuffer  int
+	BusDrainSeconds  int
+	Storage          string
 	Make             string
 	Model            string
-	Zip              int
+	Zip              string
 	Radius           int
+	SearchPageSize   int
+	SearchMaxPages   int
+	MarketsSource    string
+	MarketsFile      string
+	MarketsReload    int
+	IngestSchedule   string
+	RunOnStart       bool
+	CatchUp          bool
+	SchedulerJitter  int
+	SchedulerLease   int
+	SchedulerWorkers int
 	DatabaseURL      string
 	DatabaseHost     string
 	DatabasePort     int
@@ -23,15 +93,93 @@ type Config struct {
 	DatabaseSSLMode  string
 }
 
+// DefaultCatalogMakes are the makes the catalog sync covers unless
+// CATALOG_MAKES says otherwise: the mainstream US makes, rather than the
+// thousands of small manufacturers vPIC also lists.
+const DefaultCatalogMakes = "acura,audi,bmw,buick,cadillac,chevrolet,chrysler,dodge,ford,genesis,gmc,honda,hyundai,infiniti,jeep,kia,land rover,lexus,lincoln,mazda,mercedes-benz,mini,mitsubishi,nissan,porsche,ram,subaru,tesla,toyota,volkswagen,volvo"
+
+// AllCatalogMakes as CATALOG_MAKES syncs every make vPIC lists.
+const AllCatalogMakes = "*"
+
 func Load() Config {
 	cfg := Config{
 		MarketCheckKey:   GetString("MARKETCHECK_API_KEY", ""),
 		MarketCheckURL:   GetString("MARKETCHECK_BASE_URL", "https://marketcheck-prod.apigee.net/v1"),
+		MarketCheckRetry: GetInt("MARKETCHECK_MAX_ATTEMPTS", 4),
+		MarketCheckMode:  GetString("MARKETCHECK_MODE", "live"),
+		FixturesDir:      GetString("MARKETCHECK_FIXTURES_DIR", "./fixtures/marketcheck"),
+		QuotaDailySoft:   GetInt("MARKETCHECK_DAILY_SOFT_LIMIT", 0),
+		QuotaDailyHard:   GetInt("MARKETCHECK_DAILY_HARD_LIMIT", 0),
+		QuotaMonthlySoft: GetInt("MARKETCHECK_MONTHLY_SOFT_LIMIT", 0),
+		QuotaMonthlyHard: GetInt("MARKETCHECK_MONTHLY_HARD_LIMIT", 0),
+		ListingSource:    GetString("LISTING_SOURCE", "marketcheck"),
+		FeedPath:         GetString("FEED_PATH", "./feeds"),
+		VINDecoderMode:   GetString("VIN_DECODER_MODE", "off"),
+		VPICSnapshotPath: GetString("VPIC_SNAPSHOT_PATH", "./data/vpic.json"),
+		NHTSAURL:         GetString("NHTSA_BASE_URL", "https://vpic.nhtsa.dot.gov/api"),
+		CatalogSyncHours: GetInt("CATALOG_SYNC_INTERVAL_HOURS", 24),
+		CatalogTypes:     GetString("CATALOG_VEHICLE_TYPES", "car,mpv,truck"),
+		CatalogMakes:     GetString("CATALOG_MAKES", DefaultCatalogMakes),
+		NHTSASafetyURL:   GetString("NHTSA_SAFETY_BASE_URL", "https://api.nhtsa.gov"),
+		SafetyTTLHours:   GetInt("SAFETY_TTL_HOURS", 168),
+		ValuationMinComp: GetInt("VALUATION_MIN_COMPARABLES", 5),
+		ValuationRadius:  GetInt("VALUATION_RADIUS", 250),
+
+		DepreciationHours:  GetInt("DEPRECIATION_INTERVAL_HOURS", 24),
+		DepreciationMinObs: GetInt("DEPRECIATION_MIN_OBSERVATIONS", 20),
+
+		PriceEventsTopic:  GetString("PRICE_EVENTS_TOPIC", "price-events"),
+		PriceChangeMinAmt: GetInt("PRICE_CHANGE_MIN_AMOUNT", 250),
+		PriceChangeMinPct: GetInt("PRICE_CHANGE_MIN_PERCENT", 1),
+		RelistAfterDays:   GetInt("RELIST_AFTER_DAYS", 7),
+
+		SavedSearchRefresh:  GetInt("SAVED_SEARCH_REFRESH_SECONDS", 60),
+		AlertWebhookTimeout: GetInt("ALERT_WEBHOOK_TIMEOUT_SECONDS", 10),
+		AlertAllowPrivate:   GetBool("ALERT_WEBHOOK_ALLOW_PRIVATE", false),
+		AlertSMTPAddr:       GetString("ALERT_SMTP_ADDR", ""),
+		AlertSMTPFrom:       GetString("ALERT_SMTP_FROM", "alerts@motor-metrics.local"),
+		AlertSMTPUser:       GetString("ALERT_SMTP_USERNAME", ""),
+		AlertSMTPPassword:   GetString("ALERT_SMTP_PASSWORD", ""),
+
+		ListingEventsTopic: GetString("LISTING_EVENTS_TOPIC", "listing-events"),
+		WebhookPollSeconds: GetInt("WEBHOOK_POLL_SECONDS", 5),
+		WebhookMaxAttempts: GetInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookTimeout:     GetInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+
+		DelistAfterHours: GetInt("DELIST_AFTER_HOURS", 72),
+		LifecycleHours:   GetInt("LIFECYCLE_INTERVAL_HOURS", 6),
+
+		DLQTopic:          GetString("DLQ_TOPIC", "listings-dlq"),
+		ConsumerAttempts:  GetInt("CONSUMER_MAX_ATTEMPTS", 10),
+		ConsumerRetryMax:  GetInt("CONSUMER_RETRY_MAX_SECONDS", 30),
+		ConsumerWorkers:   GetInt("CONSUMER_WORKERS", 8),
+		ConsumerBatch:     GetInt("CONSUMER_BATCH_SIZE", 100),
+		ConsumerBatchWait: GetInt("CONSUMER_BATCH_WAIT_MS", 50),
+
+		OutboxPollSeconds: GetInt("OUTBOX_POLL_SECONDS", 1),
+		OutboxRetention:   GetInt("OUTBOX_RETENTION_HOURS", 168),
+
 		KafkaBrokers:     GetString("KAFKA_BROKERS", "localhost:9092"),
+		KafkaCodec:       GetString("KAFKA_CODEC", "json"),
+		MessageBus:       GetString("MESSAGE_BUS", "kafka"),
+		MemoryBusBuffer:  GetInt("MEMORY_BUS_BUFFER", 1000),
+		BusDrainSeconds:  GetInt("BUS_DRAIN_SECONDS", 30),
+		Storage:          GetString("STORAGE", "postgres"),
 		Make:             GetString("SEARCH_MAKE", "ford"),
 		Model:            GetString("SEARCH_MODEL", "f-150"),
-		Zip:              GetInt("SEARCH_ZIP", 92617),
+		Zip:              GetString("SEARCH_ZIP", "92617"),
 		Radius:           GetInt("SEARCH_RADIUS", 50),
+		SearchPageSize:   GetInt("SEARCH_PAGE_SIZE", 50),
+		SearchMaxPages:   GetInt("SEARCH_MAX_PAGES", 0),
+		MarketsSource:    GetString("MARKETS_SOURCE", "config"),
+		MarketsFile:      GetString("MARKETS_FILE", "./data/markets.yaml"),
+		MarketsReload:    GetInt("MARKETS_RELOAD_SECONDS", 60),
+		IngestSchedule:   GetString("INGEST_SCHEDULE", "@daily"),
+		RunOnStart:       GetBool("SCHEDULER_RUN_ON_START", false),
+		CatchUp:          GetBool("SCHEDULER_CATCH_UP", true),
+		SchedulerJitter:  GetInt("SCHEDULER_JITTER_SECONDS", 60),
+		SchedulerLease:   GetInt("SCHEDULER_LEASE_SECONDS", 600),
+		SchedulerWorkers: GetInt("SCHEDULER_CONCURRENCY", 1),
 		DatabaseURL:      GetString("DATABASE_URL", ""),
 		DatabaseHost:     GetString("DATABASE_HOST", "localhost"),
 		DatabasePort:     GetInt("DATABASE_PORT", 5432),
@@ -49,6 +197,12 @@ func Load() Config {
 	return cfg
 }
 
+// RequiresMarketCheckKey is false when listings come from dealer feeds or
+// recorded fixtures.
+func (c Config) RequiresMarketCheckKey() bool {
+	return c.ListingSource != "feed" && c.MarketCheckMode != "replay"
+}
+
 func GetString(key, fallback string) string {
 	val, ok := os.LookupEnv(key)
 	if !ok {
@@ -68,3 +222,15 @@ func GetInt(key string, fallback int) int {
 	}
 	return valAsInt
 }
+
+func GetBool(key string, fallback bool) bool {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	valAsBool, err := strconv.ParseBool(val)
+	if err != nil {
+		return fallback
+	}
+	return valAsBool
+}
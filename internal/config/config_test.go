@@ -0,0 +1,20 @@
+package config
+
+import "testing"
+
+func TestLoadKeepsZipLeadingZeros(t *testing.T) {
+	t.Setenv("SEARCH_ZIP", "02134")
+	if got := Load().Zip; got != "02134" {
+		t.Fatalf("Zip = %q, want %q", got, "02134")
+	}
+}
+
+func TestLoadDefaultsCatalogMakes(t *testing.T) {
+	if got := Load().CatalogMakes; got != DefaultCatalogMakes {
+		t.Fatalf("CatalogMakes = %q, want the default list", got)
+	}
+	t.Setenv("CATALOG_MAKES", AllCatalogMakes)
+	if got := Load().CatalogMakes; got != AllCatalogMakes {
+		t.Fatalf("CatalogMakes = %q, want %q", got, AllCatalogMakes)
+	}
+}
@@ -0,0 +1,127 @@
+package feed
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+// Dealer export column headers (lower-cased, with spaces and dashes folded
+// to underscores) mapped onto listing fields. Unknown columns are ignored.
+var csvStringFields = map[string]func(l *marketcheck.Listing) *string{
+	"id":             func(l *marketcheck.Listing) *string { return &l.ID },
+	"vin":            func(l *marketcheck.Listing) *string { return &l.VIN },
+	"heading":        func(l *marketcheck.Listing) *string { return &l.Heading },
+	"exterior_color": func(l *marketcheck.Listing) *string { return &l.ExteriorColor },
+	"interior_color": func(l *marketcheck.Listing) *string { return &l.InteriorColor },
+	"vdp_url":        func(l *marketcheck.Listing) *string { return &l.VDPURL },
+	"seller_type":    func(l *marketcheck.Listing) *string { return &l.SellerType },
+	"inventory_type": func(l *marketcheck.Listing) *string { return &l.InventoryType },
+	"stock_no":       func(l *marketcheck.Listing) *string { return &l.StockNo },
+	"dealer_name":    func(l *marketcheck.Listing) *string { return &l.Dealer.Name },
+	"street":         func(l *marketcheck.Listing) *string { return &l.Dealer.Street },
+	"city":           func(l *marketcheck.Listing) *string { return &l.Dealer.City },
+	"state":          func(l *marketcheck.Listing) *string { return &l.Dealer.State },
+	"zip":            func(l *marketcheck.Listing) *string { return &l.Dealer.Zip },
+	"phone":          func(l *marketcheck.Listing) *string { return &l.Dealer.Phone },
+	"make":           func(l *marketcheck.Listing) *string { return &l.Build.Make },
+	"model":          func(l *marketcheck.Listing) *string { return &l.Build.Model },
+	"trim":           func(l *marketcheck.Listing) *string { return &l.Build.Trim },
+	"body_type":      func(l *marketcheck.Listing) *string { return &l.Build.BodyType },
+	"drivetrain":     func(l *marketcheck.Listing) *string { return &l.Build.Drivetrain },
+	"fuel_type":      func(l *marketcheck.Listing) *string { return &l.Build.FuelType },
+	"transmission":   func(l *marketcheck.Listing) *string { return &l.Build.Transmission },
+}
+
+var csvIntFields = map[string]func(l *marketcheck.Listing) *int{
+	"price":     func(l *marketcheck.Listing) *int { return &l.Price },
+	"msrp":      func(l *marketcheck.Listing) *int { return &l.MSRP },
+	"miles":     func(l *marketcheck.Listing) *int { return &l.Miles },
+	"mileage":   func(l *marketcheck.Listing) *int { return &l.Miles },
+	"dom":       func(l *marketcheck.Listing) *int { return &l.DOM },
+	"dealer_id": func(l *marketcheck.Listing) *int { return &l.Dealer.ID },
+	"year":      func(l *marketcheck.Listing) *int { return &l.Build.Year },
+	"doors":     func(l *marketcheck.Listing) *int { return &l.Build.Doors },
+}
+
+var numberCleaner = strings.NewReplacer(",", "", "$", "")
+
+func setCSVField(l *marketcheck.Listing, column, value string) error {
+	if field, ok := csvStringFields[column]; ok {
+		*field(l) = value
+		return nil
+	}
+	if field, ok := csvIntFields[column]; ok {
+		n, err := strconv.Atoi(numberCleaner.Replace(value))
+		if err != nil {
+			return err
+		}
+		*field(l) = n
+		return nil
+	}
+	if column == "photo_url" {
+		l.Media.PhotoLinks = append(l.Media.PhotoLinks, value)
+	}
+	return nil
+}
+
+func parseCSV(r io.Reader) ([]marketcheck.Listing, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		header[i] = strings.NewReplacer(" ", "_", "-", "_").Replace(h)
+	}
+
+	var listings []marketcheck.Listing
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, err
+		}
+
+		var listing marketcheck.Listing
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if err := setCSVField(&listing, header[i], value); err != nil {
+				return nil, fmt.Errorf("line %d column %s: %w", line, header[i], err)
+			}
+		}
+		if listing.VIN == "" && listing.ID == "" {
+			continue
+		}
+		listing.CarLocation = marketcheck.CarLocation{
+			SellerName: listing.Dealer.Name,
+			Street:     listing.Dealer.Street,
+			City:       listing.Dealer.City,
+			State:      listing.Dealer.State,
+			Zip:        listing.Dealer.Zip,
+		}
+		listings = append(listings, listing)
+	}
+	return listings, nil
+}
@@ -0,0 +1,204 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/vin"
+)
+
+const DataSource = "dealer_feed"
+
+// Source serves listings from CSV and JSON dealer inventory exports in a
+// directory (or a single file). Files are re-read at the start of every
+// search sweep so dropping a new export in place is enough to pick it up.
+//
+// Zip and radius filters are ignored: feeds don't carry coordinates we can
+// compare against a zip.
+type Source struct {
+	path string
+
+	mu       sync.RWMutex
+	listings []marketcheck.Listing
+	byKey    map[string]int
+}
+
+func NewSource(path string) (*Source, error) {
+	s := &Source{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Source) Reload() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	var listings []marketcheck.Listing
+	for _, file := range files {
+		loaded, err := loadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to load feed %s: %w", file, err)
+		}
+		for i := range loaded {
+			normalize(&loaded[i], filepath.Base(file))
+		}
+		listings = append(listings, loaded...)
+	}
+
+	byKey := make(map[string]int, len(listings)*2)
+	for i, l := range listings {
+		byKey[l.ID] = i
+		if l.VIN != "" {
+			byKey[l.VIN] = i
+		}
+	}
+
+	s.mu.Lock()
+	s.listings = listings
+	s.byKey = byKey
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Source) files() ([]string, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{s.path}, nil
+	}
+
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".csv", ".json":
+			files = append(files, filepath.Join(s.path, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func loadFile(path string) ([]marketcheck.Listing, error) {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseCSV(f)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSON(data)
+}
+
+// parseJSON accepts either a bare array of listings or a MarketCheck-style
+// {"listings": [...]} search response.
+func parseJSON(data []byte) ([]marketcheck.Listing, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		var listings []marketcheck.Listing
+		if err := json.Unmarshal(data, &listings); err != nil {
+			return nil, err
+		}
+		return listings, nil
+	}
+
+	var wrapped struct {
+		Listings []marketcheck.Listing `json:"listings"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, err
+	}
+	return wrapped.Listings, nil
+}
+
+func normalize(l *marketcheck.Listing, file string) {
+	l.VIN = vin.Normalize(l.VIN)
+	if l.ID == "" {
+		l.ID = "feed-" + l.VIN
+	}
+	if l.DataSource == "" {
+		l.DataSource = DataSource
+	}
+	if l.Source == "" {
+		l.Source = file
+	}
+}
+
+func (s *Source) FetchActiveListingsPage(ctx context.Context, start, rows int, params marketcheck.SearchParams) (*marketcheck.SearchPage, error) {
+	params = params.Normalize()
+	if err := params.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", marketcheck.ErrInvalidRequest, err)
+	}
+	if start == 0 {
+		if err := s.Reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.RLock()
+	var matches []marketcheck.Listing
+	for _, l := range s.listings {
+		if params.Matches(l) {
+			matches = append(matches, l)
+		}
+	}
+	s.mu.RUnlock()
+
+	params.Sort(matches)
+
+	page := &marketcheck.SearchPage{NumFound: len(matches), Start: start}
+	if start < len(matches) {
+		end := min(start+rows, len(matches))
+		page.Listings = matches[start:end]
+	}
+	return page, nil
+}
+
+func (s *Source) FetchListingByID(ctx context.Context, id string) (*marketcheck.Listing, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.byKey[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: listing %s", marketcheck.ErrNotFound, id)
+	}
+	listing := s.listings[i]
+	return &listing, nil
+}
+
+func (s *Source) FetchBuild(ctx context.Context, v string) (*marketcheck.Build, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.byKey[vin.Normalize(v)]
+	if !ok || s.listings[i].Build.Make == "" {
+		return nil, fmt.Errorf("%w: build for %s", marketcheck.ErrNotFound, v)
+	}
+	build := s.listings[i].Build
+	return &build, nil
+}
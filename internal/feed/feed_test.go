@@ -0,0 +1,263 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+const testCSV = `VIN,Make,Model,Year,Price,Mileage,Dealer Name,City,State,Photo-URL,Unknown
+1hgcm82633a004352,Honda,Accord,2020,"$21,500","34,000",Main St Motors,Austin,TX,https://example.com/1.jpg,x
+,,,,,,,,,,
+2HGFC2F59JH000001,Honda,Civic,2018,15000,61000,Main St Motors,Austin,TX,,
+`
+
+const testJSON = `{"listings": [
+	{"vin": "5YJ3E1EA7KF000001", "price": 32000, "miles": 12000, "build": {"year": 2019, "make": "Tesla", "model": "Model 3"}},
+	{"id": "no-vin", "price": 9000}
+]}`
+
+func TestParseCSVMapsColumns(t *testing.T) {
+	listings, err := parseCSV(strings.NewReader(testCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listings) != 2 {
+		t.Fatalf("got %d listings, want 2 (blank row skipped)", len(listings))
+	}
+
+	l := listings[0]
+	if l.VIN != "1hgcm82633a004352" || l.Build.Make != "Honda" || l.Build.Model != "Accord" || l.Build.Year != 2020 {
+		t.Fatalf("build fields = %q %+v", l.VIN, l.Build)
+	}
+	if l.Price != 21500 || l.Miles != 34000 {
+		t.Fatalf("price, miles = %d, %d, want 21500, 34000", l.Price, l.Miles)
+	}
+	if l.Dealer.Name != "Main St Motors" || l.CarLocation.City != "Austin" || l.CarLocation.State != "TX" {
+		t.Fatalf("dealer = %+v, location = %+v", l.Dealer, l.CarLocation)
+	}
+	if len(l.Media.PhotoLinks) != 1 || l.Media.PhotoLinks[0] != "https://example.com/1.jpg" {
+		t.Fatalf("photo links = %v", l.Media.PhotoLinks)
+	}
+	if len(listings[1].Media.PhotoLinks) != 0 {
+		t.Fatalf("empty photo_url added a link: %v", listings[1].Media.PhotoLinks)
+	}
+}
+
+func TestParseCSVMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want string
+	}{
+		{"bad price", "vin,price\nA,12k\n", "line 2 column price"},
+		{"bad year on later row", "vin,year\nA,2020\nB,twenty\n", "line 3 column year"},
+		{"unterminated quote", "vin,price\n\"A,1\n", "quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCSV(strings.NewReader(tt.csv))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSVEmptyAndShortRows(t *testing.T) {
+	listings, err := parseCSV(strings.NewReader(""))
+	if err != nil || listings != nil {
+		t.Fatalf("empty input = %v, %v", listings, err)
+	}
+
+	listings, err = parseCSV(strings.NewReader("vin,price,miles\nA\nB,100,200,extra\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listings) != 2 || listings[0].Price != 0 || listings[1].Miles != 200 {
+		t.Fatalf("listings = %+v", listings)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+	}{
+		{"wrapped", testJSON, 2},
+		{"bare array", `[{"vin": "A"}, {"vin": "B"}, {"vin": "C"}]`, 3},
+		{"empty array", `  []`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listings, err := parseJSON([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(listings) != tt.want {
+				t.Fatalf("got %d listings, want %d", len(listings), tt.want)
+			}
+		})
+	}
+
+	if _, err := parseJSON([]byte(`{"listings": [`)); err == nil {
+		t.Fatal("truncated JSON accepted")
+	}
+}
+
+func newTestSource(t *testing.T) (*Source, string) {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"austin.csv": testCSV,
+		"tesla.json": testJSON,
+		"readme.txt": "not a feed",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := NewSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func TestNewSourceNormalizes(t *testing.T) {
+	s, _ := newTestSource(t)
+
+	l, err := s.FetchListingByID(context.Background(), "1HGCM82633A004352")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.ID != "feed-1HGCM82633A004352" || l.DataSource != DataSource || l.Source != "austin.csv" {
+		t.Fatalf("normalized listing = id %q data source %q source %q", l.ID, l.DataSource, l.Source)
+	}
+	if _, err := s.FetchListingByID(context.Background(), l.ID); err != nil {
+		t.Fatalf("lookup by id: %v", err)
+	}
+	if _, err := s.FetchListingByID(context.Background(), "no-vin"); err != nil {
+		t.Fatalf("lookup of listing without a VIN: %v", err)
+	}
+}
+
+func TestNewSourceRejectsMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.csv")
+	if err := os.WriteFile(path, []byte("vin,miles\nA,lots\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewSource(path)
+	if err == nil || !strings.Contains(err.Error(), "bad.csv") {
+		t.Fatalf("err = %v, want it to name the file", err)
+	}
+}
+
+func TestFetchActiveListingsPage(t *testing.T) {
+	s, _ := newTestSource(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		params marketcheck.SearchParams
+		want   []string
+	}{
+		{"all by price", marketcheck.SearchParams{SortBy: "price", SortOrder: "asc"}, []string{"no-vin", "feed-2HGFC2F59JH000001", "feed-1HGCM82633A004352", "feed-5YJ3E1EA7KF000001"}},
+		{"make is case insensitive", marketcheck.SearchParams{Make: " honda ", SortBy: "year", SortOrder: "desc"}, []string{"feed-1HGCM82633A004352", "feed-2HGFC2F59JH000001"}},
+		{"make and model", marketcheck.SearchParams{Make: "Honda", Model: "Civic"}, []string{"feed-2HGFC2F59JH000001"}},
+		{"price range", marketcheck.SearchParams{PriceMin: 15000, PriceMax: 25000, SortBy: "price", SortOrder: "asc"}, []string{"feed-2HGFC2F59JH000001", "feed-1HGCM82633A004352"}},
+		{"miles ceiling", marketcheck.SearchParams{Make: "Honda", MilesMax: 50000}, []string{"feed-1HGCM82633A004352"}},
+		{"no match", marketcheck.SearchParams{Make: "Ford"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.FetchActiveListingsPage(ctx, 0, 10, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.NumFound != len(tt.want) || len(page.Listings) != len(tt.want) {
+				t.Fatalf("found %d, page has %d, want %d", page.NumFound, len(page.Listings), len(tt.want))
+			}
+			for i, l := range page.Listings {
+				if l.ID != tt.want[i] {
+					t.Fatalf("listing %d = %s, want %s", i, l.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFetchActiveListingsPagePaging(t *testing.T) {
+	s, _ := newTestSource(t)
+	ctx := context.Background()
+	params := marketcheck.SearchParams{SortBy: "price", SortOrder: "asc"}
+
+	page, err := s.FetchActiveListingsPage(ctx, 1, 2, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.NumFound != 4 || page.Start != 1 || len(page.Listings) != 2 || page.Listings[0].Price != 15000 {
+		t.Fatalf("page = %+v", page)
+	}
+
+	page, err = s.FetchActiveListingsPage(ctx, 4, 2, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.NumFound != 4 || len(page.Listings) != 0 {
+		t.Fatalf("past the end = %+v", page)
+	}
+}
+
+func TestFetchActiveListingsPageReloads(t *testing.T) {
+	s, dir := newTestSource(t)
+	ctx := context.Background()
+
+	extra := `[{"vin": "3FA6P0H73HR000001", "price": 11000, "build": {"make": "Ford", "model": "Fusion"}}]`
+	if err := os.WriteFile(filepath.Join(dir, "ford.json"), []byte(extra), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	params := marketcheck.SearchParams{Make: "Ford"}
+	if page, err := s.FetchActiveListingsPage(ctx, 1, 10, params); err != nil || page.NumFound != 0 {
+		t.Fatalf("mid-sweep page = %+v, %v, want no reload", page, err)
+	}
+	if page, err := s.FetchActiveListingsPage(ctx, 0, 10, params); err != nil || page.NumFound != 1 {
+		t.Fatalf("first page = %+v, %v, want the new export", page, err)
+	}
+}
+
+func TestFetchActiveListingsPageInvalidParams(t *testing.T) {
+	s, _ := newTestSource(t)
+	_, err := s.FetchActiveListingsPage(context.Background(), 0, 10, marketcheck.SearchParams{PriceMin: 20000, PriceMax: 10000})
+	if !errors.Is(err, marketcheck.ErrInvalidRequest) {
+		t.Fatalf("err = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestFetchNotFound(t *testing.T) {
+	s, _ := newTestSource(t)
+	ctx := context.Background()
+
+	if _, err := s.FetchListingByID(ctx, "missing"); !errors.Is(err, marketcheck.ErrNotFound) {
+		t.Fatalf("FetchListingByID err = %v", err)
+	}
+	if _, err := s.FetchBuild(ctx, "no-vin"); !errors.Is(err, marketcheck.ErrNotFound) {
+		t.Fatalf("FetchBuild without a make err = %v", err)
+	}
+
+	build, err := s.FetchBuild(ctx, "1hgcm8-2633a004352")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build.Make != "Honda" || build.Model != "Accord" {
+		t.Fatalf("build = %+v", build)
+	}
+}
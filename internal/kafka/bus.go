@@ -0,0 +1,228 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/outbox"
+	"github.com/segmentio/kafka-go"
+)
+
+// MessageReader is where a Consumer or ListingReader gets messages: a
+// consumer group's kafka.Reader or a MemoryBus subscription. FetchMessage
+// returns io.EOF once the reader is closed and has nothing left.
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// ErrBusClosed is returned by writes to a closed MemoryBus.
+var ErrBusClosed = errors.New("bus closed")
+
+// MemoryBus stands in for a Kafka topic within one process. Each
+// subscription, like a consumer group of its own, gets every message
+// written after it subscribed, in order, on a single partition. A
+// subscription holds at most the bus's buffer of unread messages; writes
+// block while any subscription is full, so a slow consumer slows the
+// producer instead of piling up messages in memory. Messages are lost if
+// the process exits before they are read; Close drains them.
+type MemoryBus struct {
+	topic       string
+	buffer      int
+	contentType string
+	source      string
+
+	mu     sync.Mutex
+	subs   []*BusSubscription
+	closed bool
+	offset int64
+	// sending is held while a write hands its messages to subscriptions,
+	// so that every subscription sees writes in offset order.
+	sending sync.Mutex
+}
+
+func NewMemoryBus(topic string, buffer int) *MemoryBus {
+	return &MemoryBus{
+		topic:       topic,
+		buffer:      max(buffer, 1),
+		contentType: ContentTypeJSON,
+	}
+}
+
+// SetCodec picks the payload format by codec name, "json" or "avro", like
+// KafkaWriter.SetCodec.
+func (b *MemoryBus) SetCodec(name string) error {
+	codec, ok := DefaultRegistry.Codec(name)
+	if !ok {
+		return fmt.Errorf("unknown codec %q", name)
+	}
+	b.contentType = codec.ContentType()
+	return nil
+}
+
+// SetSource sets the source header, such as the listing source.
+func (b *MemoryBus) SetSource(source string) {
+	b.source = source
+}
+
+// Subscribe adds a reader. Subscribe before writing, or the reader misses
+// what was written before it.
+func (b *MemoryBus) Subscribe() *BusSubscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &BusSubscription{
+		bus:      b,
+		messages: make(chan kafka.Message, b.buffer),
+		done:     make(chan struct{}),
+	}
+	if b.closed {
+		close(s.messages)
+	} else {
+		b.subs = append(b.subs, s)
+	}
+	return s
+}
+
+// Write publishes a listing like KafkaWriter.Write.
+func (b *MemoryBus) Write(ctx context.Context, listing marketcheck.EnrichedListing) error {
+	m, err := listingMessage(ctx, b.contentType, b.source, listing)
+	if err != nil {
+		return err
+	}
+	return b.WriteMessages(ctx, m)
+}
+
+// PublishOutbox publishes outbox messages like KafkaWriter.PublishOutbox.
+func (b *MemoryBus) PublishOutbox(ctx context.Context, msgs []outbox.Message) error {
+	out, err := outboxMessages(b.contentType, msgs)
+	if err != nil {
+		return err
+	}
+	return b.WriteMessages(ctx, out...)
+}
+
+// WriteMessages hands msgs to every subscription, waiting for room in full
+// ones until ctx is done. Messages already handed over when ctx is done
+// stay delivered, and a message's offset is taken before it is handed
+// over, so it is never reused even if only some subscriptions got it.
+func (b *MemoryBus) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	b.sending.Lock()
+	defer b.sending.Unlock()
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBusClosed
+	}
+	subs := append([]*BusSubscription(nil), b.subs...)
+	b.mu.Unlock()
+
+	for _, m := range msgs {
+		m.Topic = b.topic
+		m.Partition = 0
+		m.Offset = b.offset
+		b.offset++
+		if m.Time.IsZero() {
+			m.Time = time.Now()
+		}
+		for _, s := range subs {
+			select {
+			case s.messages <- m:
+			case <-s.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// Close stops writes and lets subscriptions read what is left, after which
+// their FetchMessage returns io.EOF. It waits for a write in progress, so
+// its context must be done or its messages read for Close to return.
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	b.sending.Lock()
+	defer b.sending.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.subs {
+		close(s.messages)
+	}
+	b.subs = nil
+	return nil
+}
+
+// Pending is how many messages subscriptions have yet to read, summed.
+func (b *MemoryBus) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, s := range b.subs {
+		n += len(s.messages)
+	}
+	return n
+}
+
+func (b *MemoryBus) unsubscribe(s *BusSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, sub := range b.subs {
+		if sub == s {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// BusSubscription is a MessageReader on a MemoryBus.
+type BusSubscription struct {
+	bus      *MemoryBus
+	messages chan kafka.Message
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (s *BusSubscription) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m, ok := <-s.messages:
+		if !ok {
+			return kafka.Message{}, io.EOF
+		}
+		return m, nil
+	case <-s.done:
+		return kafka.Message{}, io.EOF
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+// CommitMessages does nothing: a subscription never redelivers a message,
+// so there are no offsets to keep.
+func (s *BusSubscription) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	return nil
+}
+
+// Close unsubscribes, dropping unread messages, so that writes no longer
+// wait for it.
+func (s *BusSubscription) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		s.bus.unsubscribe(s)
+	})
+	return nil
+}
@@ -0,0 +1,103 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func fetch(t *testing.T, s *BusSubscription) kafka.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := s.FetchMessage(ctx)
+	if err != nil {
+		t.Fatalf("FetchMessage: %v", err)
+	}
+	return m
+}
+
+func TestMemoryBusFullSubscriptionBlocksWrites(t *testing.T) {
+	bus := NewMemoryBus("listings-raw", 1)
+	fast, slow := bus.Subscribe(), bus.Subscribe()
+	if err := bus.WriteMessages(context.Background(), kafka.Message{Value: []byte("0")}); err != nil {
+		t.Fatalf("WriteMessages: %v", err)
+	}
+	fetch(t, fast)
+
+	// fast has room for the next message but slow is full.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := bus.WriteMessages(ctx, kafka.Message{Value: []byte("1")}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WriteMessages to a full subscription = %v, want DeadlineExceeded", err)
+	}
+
+	written := make(chan error, 1)
+	go func() { written <- bus.WriteMessages(context.Background(), kafka.Message{Value: []byte("2")}) }()
+	select {
+	case err := <-written:
+		t.Fatalf("WriteMessages returned %v with slow still full", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if m := fetch(t, slow); m.Offset != 0 {
+		t.Errorf("slow read offset %d, want 0", m.Offset)
+	}
+	if m := fetch(t, fast); string(m.Value) != "1" || m.Offset != 1 {
+		t.Errorf("fast read %q at offset %d, want %q at 1", m.Value, m.Offset, "1")
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("WriteMessages: %v", err)
+	}
+
+	// The cancelled write's offset isn't reused.
+	for _, s := range []*BusSubscription{fast, slow} {
+		if m := fetch(t, s); string(m.Value) != "2" || m.Offset != 2 {
+			t.Errorf("read %q at offset %d, want %q at 2", m.Value, m.Offset, "2")
+		}
+	}
+}
+
+func TestMemoryBusCloseDrains(t *testing.T) {
+	bus := NewMemoryBus("listings-raw", 2)
+	sub := bus.Subscribe()
+	for _, v := range []string{"0", "1"} {
+		if err := bus.WriteMessages(context.Background(), kafka.Message{Value: []byte(v)}); err != nil {
+			t.Fatalf("WriteMessages: %v", err)
+		}
+	}
+	// A write blocked on the full subscription finishes before Close does.
+	written := make(chan error, 1)
+	go func() { written <- bus.WriteMessages(context.Background(), kafka.Message{Value: []byte("2")}) }()
+	for bus.sending.TryLock() {
+		bus.sending.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	closed := make(chan error, 1)
+	go func() { closed <- bus.Close() }()
+
+	for _, want := range []string{"0", "1", "2"} {
+		if m := fetch(t, sub); string(m.Value) != want {
+			t.Errorf("read %q, want %q", m.Value, want)
+		}
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("WriteMessages before Close: %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := sub.FetchMessage(context.Background()); err != io.EOF {
+		t.Errorf("FetchMessage after drain = %v, want io.EOF", err)
+	}
+	if err := bus.WriteMessages(context.Background(), kafka.Message{}); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("WriteMessages after Close = %v, want ErrBusClosed", err)
+	}
+	if n := bus.Pending(); n != 0 {
+		t.Errorf("Pending = %d after Close, want 0", n)
+	}
+}
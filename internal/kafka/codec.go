@@ -0,0 +1,348 @@
+package kafka
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Payload content types.
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeAvro = "avro/binary"
+)
+
+// Schema identifies a payload schema: an event type at a version.
+type Schema struct {
+	EventType string
+	Version   int
+}
+
+func (s Schema) String() string {
+	return fmt.Sprintf("%s v%d", s.EventType, s.Version)
+}
+
+// Codec converts payloads between its wire format and JSON documents, so
+// that every format shares the JSON tags of the payload structs and the
+// same upcasters.
+type Codec interface {
+	Name() string
+	ContentType() string
+	FromJSON(s Schema, doc []byte) ([]byte, error)
+	ToJSON(s Schema, data []byte) ([]byte, error)
+}
+
+// JSONCodec sends documents as they are.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string        { return "json" }
+func (JSONCodec) ContentType() string { return ContentTypeJSON }
+
+func (JSONCodec) FromJSON(s Schema, doc []byte) ([]byte, error) {
+	return doc, nil
+}
+
+func (JSONCodec) ToJSON(s Schema, data []byte) ([]byte, error) {
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("invalid JSON %s payload", s)
+	}
+	return data, nil
+}
+
+//go:embed schemas/*.avsc
+var schemaFiles embed.FS
+
+// AvroCodec encodes documents as Avro binary, using schema files named
+// <event type>.v<version>.avsc. Fields missing from a document take their
+// schema defaults, and a document with a field not in the schema is
+// rejected rather than losing it.
+type AvroCodec struct {
+	schemas map[Schema]*avroSchema
+}
+
+type avroSchema struct {
+	codec *goavro.Codec
+	root  any
+	// named holds the schema's named types by short and full name.
+	named map[string]any
+}
+
+// NewAvroCodec loads the .avsc files in fsys.
+func NewAvroCodec(fsys fs.FS) (*AvroCodec, error) {
+	files, err := fs.Glob(fsys, "*.avsc")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &AvroCodec{schemas: make(map[Schema]*avroSchema)}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".avsc")
+		eventType, version, ok := strings.Cut(name, ".v")
+		n, err := strconv.Atoi(version)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("schema file %s is not named <event type>.v<version>.avsc", file)
+		}
+
+		text, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		codec, err := goavro.NewCodec(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema %s: %w", file, err)
+		}
+		var root any
+		if err := json.Unmarshal(text, &root); err != nil {
+			return nil, fmt.Errorf("invalid schema %s: %w", file, err)
+		}
+		s := &avroSchema{codec: codec, root: root, named: make(map[string]any)}
+		s.index(root, "")
+		c.schemas[Schema{EventType: eventType, Version: n}] = s
+	}
+	return c, nil
+}
+
+func (c *AvroCodec) Name() string        { return "avro" }
+func (c *AvroCodec) ContentType() string { return ContentTypeAvro }
+
+func (c *AvroCodec) FromJSON(s Schema, doc []byte) ([]byte, error) {
+	schema, ok := c.schemas[s]
+	if !ok {
+		return nil, fmt.Errorf("no Avro schema for %s", s)
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	native, err := schema.toNative(schema.root, "", v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s, err)
+	}
+	return schema.codec.BinaryFromNative(nil, native)
+}
+
+func (c *AvroCodec) ToJSON(s Schema, data []byte) ([]byte, error) {
+	schema, ok := c.schemas[s]
+	if !ok {
+		return nil, fmt.Errorf("no Avro schema for %s", s)
+	}
+	native, _, err := schema.codec.NativeFromBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(schema.fromNative(schema.root, "", native))
+}
+
+// index records named types so references to them can be followed.
+func (s *avroSchema) index(schema any, namespace string) {
+	switch t := schema.(type) {
+	case []any:
+		for _, member := range t {
+			s.index(member, namespace)
+		}
+	case map[string]any:
+		switch t["type"] {
+		case "record":
+			name, full, ns := names(t, namespace)
+			s.named[name], s.named[full] = t, t
+			for _, f := range t["fields"].([]any) {
+				s.index(f.(map[string]any)["type"], ns)
+			}
+		case "array":
+			s.index(t["items"], namespace)
+		}
+	}
+}
+
+// names returns a named type's short name, full name and the namespace of
+// its fields.
+func names(t map[string]any, namespace string) (string, string, string) {
+	name, _ := t["name"].(string)
+	if ns, ok := t["namespace"].(string); ok {
+		namespace = ns
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i+1:], name, name[:i]
+	}
+	if namespace == "" {
+		return name, name, namespace
+	}
+	return name, namespace + "." + name, namespace
+}
+
+// resolve follows a reference to a named type.
+func (s *avroSchema) resolve(schema any) any {
+	if name, ok := schema.(string); ok {
+		if named, ok := s.named[name]; ok {
+			return named
+		}
+	}
+	return schema
+}
+
+// toNative converts a JSON value to the form goavro encodes: numbers as
+// int64 or float64, missing arrays as empty ones and union values wrapped in
+// their member's name.
+func (s *avroSchema) toNative(schema any, namespace string, v any) (any, error) {
+	schema = s.resolve(schema)
+	switch t := schema.(type) {
+	case string:
+		return primitive(t, v)
+	case []any:
+		if v == nil {
+			return nil, nil
+		}
+		for _, member := range t {
+			if member == "null" {
+				continue
+			}
+			native, err := s.toNative(member, namespace, v)
+			if err != nil {
+				return nil, err
+			}
+			return goavro.Union(s.memberName(member, namespace), native), nil
+		}
+		return nil, fmt.Errorf("no non-null member in union %v", t)
+	case map[string]any:
+		switch t["type"] {
+		case "record":
+			doc, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("expected an object for record %v, got %T", t["name"], v)
+			}
+			_, _, ns := names(t, namespace)
+			out := make(map[string]any, len(doc))
+			for _, f := range t["fields"].([]any) {
+				field := f.(map[string]any)
+				name := field["name"].(string)
+				value, ok := doc[name]
+				if !ok {
+					continue
+				}
+				native, err := s.toNative(field["type"], ns, value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				out[name] = native
+			}
+			if len(out) < len(doc) {
+				for name := range doc {
+					if _, ok := out[name]; !ok {
+						return nil, fmt.Errorf("field %q is not in record %v", name, t["name"])
+					}
+				}
+			}
+			return out, nil
+		case "array":
+			items, _ := v.([]any)
+			out := make([]any, len(items))
+			for i, item := range items {
+				native, err := s.toNative(t["items"], namespace, item)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = native
+			}
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported schema %v", schema)
+}
+
+func primitive(typ string, v any) (any, error) {
+	switch typ {
+	case "null":
+		return nil, nil
+	case "string":
+		if v == nil {
+			return "", nil
+		}
+	case "boolean":
+		if v == nil {
+			return false, nil
+		}
+	case "int", "long", "float", "double":
+		n, ok := v.(json.Number)
+		if !ok {
+			if v == nil {
+				return int64(0), nil
+			}
+			return v, nil
+		}
+		if typ == "int" || typ == "long" {
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		}
+		return n.Float64()
+	}
+	return v, nil
+}
+
+// memberName is the name goavro gives a union member.
+func (s *avroSchema) memberName(member any, namespace string) string {
+	switch t := member.(type) {
+	case string:
+		if named, ok := s.named[t].(map[string]any); ok {
+			_, full, _ := names(named, namespace)
+			return full
+		}
+		return t
+	case map[string]any:
+		if t["type"] == "record" {
+			_, full, _ := names(t, namespace)
+			return full
+		}
+		return t["type"].(string)
+	}
+	return ""
+}
+
+// fromNative undoes toNative's union wrapping on a decoded value.
+func (s *avroSchema) fromNative(schema any, namespace string, v any) any {
+	schema = s.resolve(schema)
+	switch t := schema.(type) {
+	case []any:
+		wrapped, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+		for _, member := range t {
+			if value, ok := wrapped[s.memberName(member, namespace)]; ok {
+				return s.fromNative(member, namespace, value)
+			}
+		}
+		return v
+	case map[string]any:
+		switch t["type"] {
+		case "record":
+			record, ok := v.(map[string]any)
+			if !ok {
+				return v
+			}
+			_, _, ns := names(t, namespace)
+			for _, f := range t["fields"].([]any) {
+				field := f.(map[string]any)
+				name := field["name"].(string)
+				record[name] = s.fromNative(field["type"], ns, record[name])
+			}
+			return record
+		case "array":
+			items, _ := v.([]any)
+			for i, item := range items {
+				items[i] = s.fromNative(t["items"], namespace, item)
+			}
+			return items
+		}
+	}
+	return v
+}
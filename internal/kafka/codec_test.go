@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/segmentio/kafka-go"
+)
+
+// fill sets every field reachable from v to a distinct non-zero value, so
+// a field the Avro schema doesn't carry shows up as a difference.
+func fill(v reflect.Value, n *int) {
+	*n++
+	switch v.Kind() {
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem(), n)
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2024, 3, 1, 10, 0, *n, 0, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			// Fields tagged json:"-" are never sent.
+			if f := v.Type().Field(i); f.IsExported() && f.Tag.Get("json") != "-" {
+				fill(v.Field(i), n)
+			}
+		}
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), 2, 2)
+		for i := 0; i < s.Len(); i++ {
+			fill(s.Index(i), n)
+		}
+		v.Set(s)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(key, n)
+		fill(value, n)
+		m.SetMapIndex(key, value)
+		v.Set(m)
+	case reflect.String:
+		v.SetString("s" + strings.Repeat("x", *n%7) + string(rune('a'+*n%26)))
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(*n))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(*n) + 0.5)
+	}
+}
+
+func TestListingRoundTripsThroughBothCodecs(t *testing.T) {
+	var want marketcheck.EnrichedListing
+	n := 0
+	fill(reflect.ValueOf(&want).Elem(), &n)
+	want.Listing.VIN = testVIN
+
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeAvro} {
+		t.Run(contentType, func(t *testing.T) {
+			m, err := DefaultRegistry.Encode(Envelope{EventType: EventListingObserved, ContentType: contentType}, want)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			var got marketcheck.EnrichedListing
+			if _, err := DefaultRegistry.Decode(m, EventListingObserved, &got); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				wantJSON, _ := json.Marshal(want)
+				gotJSON, _ := json.Marshal(got)
+				t.Fatalf("round trip changed the listing\nwant %s\ngot  %s", wantJSON, gotJSON)
+			}
+		})
+	}
+}
+
+func TestAvroRejectsFieldsNotInSchema(t *testing.T) {
+	codec, ok := DefaultRegistry.Codec("avro")
+	if !ok {
+		t.Fatal("no avro codec")
+	}
+	doc := []byte(`{"listing":{"vin":"` + testVIN + `","surprise":1},"build":{}}`)
+	_, err := codec.FromJSON(Schema{EventType: EventListingObserved, Version: ListingSchemaVersion}, doc)
+	if err == nil || !strings.Contains(err.Error(), "surprise") {
+		t.Fatalf("FromJSON = %v, want an error naming the unknown field", err)
+	}
+}
+
+func TestDecodeV1WithoutHeaders(t *testing.T) {
+	m := kafka.Message{Value: []byte(`{"listing":{"vin":"` + testVIN + `","price":18500}}`)}
+	var got marketcheck.EnrichedListing
+	env, err := DefaultRegistry.Decode(m, EventListingObserved, &got)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if env.SchemaVersion != 1 || env.ContentType != ContentTypeJSON {
+		t.Fatalf("envelope = v%d %s, want v1 %s", env.SchemaVersion, env.ContentType, ContentTypeJSON)
+	}
+	if got.Listing.VIN != testVIN || got.Listing.Price != 18500 {
+		t.Fatalf("decoded %+v", got.Listing)
+	}
+}
+
+func TestUpcasterChain(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterCodec(JSONCodec{})
+	r.RegisterEventType("Thing", 3)
+	r.RegisterUpcaster("Thing", 1, func(doc map[string]any) error {
+		doc["name"] = doc["title"]
+		delete(doc, "title")
+		return nil
+	})
+	r.RegisterUpcaster("Thing", 2, func(doc map[string]any) error {
+		doc["name"] = strings.ToUpper(doc["name"].(string))
+		doc["version"] = 3
+		return nil
+	})
+
+	var got struct {
+		Name    string `json:"name"`
+		Version int    `json:"version"`
+	}
+	m := kafka.Message{Value: []byte(`{"title":"civic"}`)}
+	if _, err := r.Decode(m, "Thing", &got); err != nil {
+		t.Fatalf("Decode v1: %v", err)
+	}
+	if got.Name != "CIVIC" || got.Version != 3 {
+		t.Fatalf("v1 upcast to %+v, want both upcasters applied in order", got)
+	}
+
+	v2 := kafka.Message{Value: []byte(`{"name":"accord"}`), Headers: Envelope{EventType: "Thing", SchemaVersion: 2, ContentType: ContentTypeJSON}.Headers()}
+	if _, err := r.Decode(v2, "Thing", &got); err != nil {
+		t.Fatalf("Decode v2: %v", err)
+	}
+	if got.Name != "ACCORD" {
+		t.Fatalf("v2 upcast to %+v, want only the v2 upcaster applied", got)
+	}
+
+	v4 := kafka.Message{Value: []byte(`{}`), Headers: Envelope{EventType: "Thing", SchemaVersion: 4, ContentType: ContentTypeJSON}.Headers()}
+	if _, err := r.Decode(v4, "Thing", &got); !IsPoison(err) {
+		t.Fatalf("Decode of a newer version = %v, want poison", err)
+	}
+
+	r.RegisterEventType("Gap", 3)
+	r.RegisterUpcaster("Gap", 1, func(doc map[string]any) error { return nil })
+	if _, err := r.Decode(kafka.Message{Value: []byte(`{}`)}, "Gap", &got); !IsPoison(err) {
+		t.Fatalf("Decode with a missing upcaster = %v, want poison", err)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	a, b := NewID(), NewID()
+	if len(a) != 32 || a == b {
+		t.Fatalf("NewID() = %q, %q", a, b)
+	}
+}
@@ -2,11 +2,15 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"time"
 
 	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/pricewatch"
+	"github.com/omerahmer/motor_metrics/internal/vin"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -19,75 +23,357 @@ type ListingRepository interface {
 	SaveListing(ctx context.Context, listing *marketcheck.EnrichedListing) error
 }
 
+type VINQuarantine interface {
+	QuarantineVIN(ctx context.Context, rawVIN, source, reason string, payload []byte) error
+}
+
+// Valuer prices a listing against the market; see internal/valuation.
+type Valuer interface {
+	Value(ctx context.Context, l marketcheck.Listing, b marketcheck.Build, history []marketcheck.PricePoint) (marketcheck.Valuation, error)
+}
+
+// PriceWatcher looks for noteworthy price changes once a price is stored;
+// see internal/pricewatch.
+type PriceWatcher interface {
+	Observe(ctx context.Context, l marketcheck.EnrichedListing, history []marketcheck.PricePoint) (*pricewatch.PriceChanged, error)
+}
+
+// ListingLookup returns the stored listing for a VIN, or nil.
+type ListingLookup interface {
+	GetListingByVIN(ctx context.Context, vin string) (*marketcheck.EnrichedListing, error)
+}
+
+type ListingEventPublisher interface {
+	PublishListingEvent(ctx context.Context, ev ListingEvent) error
+}
+
 type Consumer struct {
-	reader      *kafka.Reader
+	reader      MessageReader
 	store       PriceStore
 	listingRepo ListingRepository
+	quarantine  VINQuarantine
+	valuer      Valuer
+	priceWatch  PriceWatcher
+	lookup      ListingLookup
+	events      ListingEventPublisher
+	deadLetter  DeadLetterPublisher
+	retry       RetryPolicy
+	batchStore  BatchStore
+	pool        PoolOptions
 }
 
 func NewConsumer(brokers []string, groupId string, topic string, store PriceStore, listingRepo ListingRepository) *Consumer {
+	return NewConsumerFrom(kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		GroupID: groupId,
+		Topic:   topic,
+	}), store, listingRepo)
+}
+
+// NewConsumerFrom consumes from reader, such as a MemoryBus subscription.
+func NewConsumerFrom(reader MessageReader, store PriceStore, listingRepo ListingRepository) *Consumer {
 	return &Consumer{
-		reader: kafka.NewReader(kafka.ReaderConfig{
-			Brokers: brokers,
-			GroupID: groupId,
-			Topic:   topic,
-		}),
+		reader:      reader,
 		store:       store,
 		listingRepo: listingRepo,
+		retry:       DefaultRetryPolicy(),
 	}
 }
 
+func (c *Consumer) SetQuarantine(q VINQuarantine) {
+	c.quarantine = q
+}
+
+func (c *Consumer) SetValuer(v Valuer) {
+	c.valuer = v
+}
+
+func (c *Consumer) SetPriceWatcher(w PriceWatcher) {
+	c.priceWatch = w
+}
+
+// SetListingEvents publishes ListingCreated when a VIN is first saved and
+// ListingGoodValue when a stored listing's valuation turns good, comparing
+// against the listing found by lookup before each save.
+func (c *Consumer) SetListingEvents(lookup ListingLookup, events ListingEventPublisher) {
+	c.lookup = lookup
+	c.events = events
+}
+
+// SetDeadLetter sends messages that can't be processed to d instead of
+// dropping them.
+func (c *Consumer) SetDeadLetter(d DeadLetterPublisher) {
+	c.deadLetter = d
+}
+
+func (c *Consumer) SetRetryPolicy(p RetryPolicy) {
+	c.retry = p
+}
+
+// SetWorkerPool processes messages concurrently in opts.Workers workers,
+// writing each worker's batch of listings through store in transactions.
+// Without it messages are processed one at a time.
+func (c *Consumer) SetWorkerPool(store BatchStore, opts PoolOptions) {
+	c.batchStore = store
+	c.pool = opts
+}
+
 func (c *Consumer) Run(ctx context.Context) error {
+	if c.batchStore != nil && c.pool.Workers > 0 {
+		return c.runPool(ctx)
+	}
+	return c.fetch(ctx, func(m kafka.Message) error {
+		if err := c.settle(ctx, m); err != nil {
+			return err
+		}
+		if err := c.reader.CommitMessages(ctx, m); err != nil {
+			log.Println("commit error: ", err)
+		}
+		return nil
+	})
+}
+
+// fetch hands messages to handle until ctx is done, handle fails or the
+// reader is closed and drained, backing off while the reader can't fetch.
+func (c *Consumer) fetch(ctx context.Context, handle func(kafka.Message) error) error {
+	fetchBackoff := time.Second
 	for {
 		m, err := c.reader.FetchMessage(ctx)
 		if err != nil {
-			log.Println("fetch message error: ", err)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			log.Printf("fetch message error (retrying in %s): %v", fetchBackoff, err)
+			if !sleepCtx(ctx, fetchBackoff) {
+				return ctx.Err()
+			}
+			fetchBackoff = min(fetchBackoff*2, 30*time.Second)
 			continue
 		}
-		var listing marketcheck.EnrichedListing
-		if err := json.Unmarshal(m.Value, &listing); err != nil {
-			log.Println("json unmarshal error: ", err)
-			continue
+		fetchBackoff = time.Second
+
+		if err := handle(m); err != nil {
+			return err
 		}
+	}
+}
 
-		vin := listing.Listing.VIN
-		var newPoint marketcheck.PricePoint
-		if len(listing.PriceHistory) > 0 {
-			newPoint = marketcheck.PricePoint{
-				Price: listing.Listing.Price,
-				Date:  listing.PriceHistory[0].Date,
-			}
-		} else {
-			newPoint = marketcheck.PricePoint{
-				Price: listing.Listing.Price,
-				Date:  time.Now(),
-			}
+// settle processes a message, retrying retryable failures with backoff,
+// until it is processed or dead-lettered. It only returns an error when ctx
+// is done, in which case the message must not be committed.
+func (c *Consumer) settle(ctx context.Context, m kafka.Message) error {
+	for attempt := 1; ; attempt++ {
+		err := c.processMessage(ctx, m)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 
-		if err := c.store.AddPrice(ctx, vin, newPoint); err != nil {
-			log.Printf("error adding price for VIN %s: %v", vin, err)
+		reason := ""
+		switch {
+		case IsPoison(err):
+			reason = ReasonPoison
+		case c.retry.MaxAttempts > 0 && attempt >= c.retry.MaxAttempts:
+			reason = ReasonRetriesExhausted
 		}
-		fullHistory, err := c.store.GetHistory(ctx, vin)
-		if err != nil {
-			log.Printf("error getting history for VIN %s: %v", vin, err)
+		if reason == "" {
+			delay := c.retry.delay(attempt)
+			log.Printf("error processing message %d/%d (attempt %d, retrying in %s): %v", m.Partition, m.Offset, attempt, delay, err)
+			if !sleepCtx(ctx, delay) {
+				return ctx.Err()
+			}
 			continue
 		}
 
-		listing.Valuation = marketcheck.ComputeValuation(fullHistory, listing.Listing.Price)
+		return c.publishDeadLetter(ctx, m, err, reason, attempt)
+	}
+}
+
+// publishDeadLetter hands a failed message to the dead-letter publisher,
+// retrying until it is accepted so that the message is never committed
+// without a copy. Without a publisher the message is dropped.
+func (c *Consumer) publishDeadLetter(ctx context.Context, m kafka.Message, cause error, reason string, attempts int) error {
+	if c.deadLetter == nil {
+		log.Printf("dropping message %d/%d (%s after %d attempts): %v", m.Partition, m.Offset, reason, attempts, cause)
+		return nil
+	}
+
+	delay := c.retry.BaseDelay
+	for {
+		err := c.deadLetter.PublishDeadLetter(ctx, m, cause, reason, attempts)
+		if err == nil {
+			log.Printf("dead-lettered message %d/%d (%s after %d attempts): %v", m.Partition, m.Offset, reason, attempts, cause)
+			return nil
+		}
+		log.Printf("error dead-lettering message %d/%d (retrying in %s): %v", m.Partition, m.Offset, delay, err)
+		if !sleepCtx(ctx, delay) {
+			return ctx.Err()
+		}
+		delay = min(max(delay*2, time.Second), c.retry.MaxDelay)
+	}
+}
+
+// processMessage stores a listing and its price. Errors that retrying won't
+// fix are wrapped with Poison or classified by IsPoison; failures of the
+// optional valuation, price watch and event steps are only logged.
+func (c *Consumer) processMessage(ctx context.Context, m kafka.Message) error {
+	listing, ok, err := c.decode(ctx, m)
+	if err != nil || !ok {
+		return err
+	}
+
+	vin := listing.Listing.VIN
+	if err := c.store.AddPrice(ctx, vin, pricePoint(listing, observedAt(m))); err != nil {
+		return fmt.Errorf("error adding price for VIN %s: %w", vin, err)
+	}
+	fullHistory, err := c.store.GetHistory(ctx, vin)
+	if err != nil {
+		return fmt.Errorf("error getting history for VIN %s: %w", vin, err)
+	}
+
+	previous := c.evaluate(ctx, &listing, fullHistory)
+
+	if c.listingRepo != nil {
+		if err := c.listingRepo.SaveListing(ctx, &listing); err != nil {
+			return fmt.Errorf("error saving listing for VIN %s: %w", vin, err)
+		}
+		if c.events != nil {
+			c.publishListingEvents(ctx, previous, listing)
+		}
+	}
+
+	logValuation(listing)
+	return nil
+}
 
-		if c.listingRepo != nil {
-			if err := c.listingRepo.SaveListing(ctx, &listing); err != nil {
-				log.Printf("error saving listing to database: %v", err)
+// decode reads the listing in a message, upcasting older schema versions,
+// and normalizes its VIN. A listing
+// with an invalid VIN is quarantined and reported with ok false.
+func (c *Consumer) decode(ctx context.Context, m kafka.Message) (marketcheck.EnrichedListing, bool, error) {
+	var listing marketcheck.EnrichedListing
+	if _, err := DefaultRegistry.Decode(m, EventListingObserved, &listing); err != nil {
+		return listing, false, err
+	}
+
+	parsed, err := vin.Parse(listing.Listing.VIN)
+	if err != nil {
+		log.Printf("quarantining listing with invalid VIN %q: %v", listing.Listing.VIN, err)
+		if c.quarantine != nil {
+			if err := c.quarantine.QuarantineVIN(ctx, listing.Listing.VIN, "kafka", err.Error(), m.Value); err != nil {
+				return listing, false, fmt.Errorf("error quarantining VIN %q: %w", listing.Listing.VIN, err)
 			}
 		}
+		return listing, false, nil
+	}
+	listing.Listing.VIN = parsed.Value
+	return listing, true, nil
+}
 
-		log.Printf("VIN %s: updated valuation score=%.3f good_value=%v\n",
-			vin, listing.Valuation.Score, listing.Valuation.IsGoodValue)
+// pricePoint is the listing's current price and mileage, dated by its latest
+// price history entry if it has one and otherwise by when it was observed.
+func pricePoint(listing marketcheck.EnrichedListing, observed time.Time) marketcheck.PricePoint {
+	if len(listing.PriceHistory) > 0 {
+		return marketcheck.PricePoint{
+			Price: listing.Listing.Price,
+			Date:  listing.PriceHistory[0].Date,
+			Miles: listing.Listing.Miles,
+		}
+	}
+	return marketcheck.PricePoint{
+		Price: listing.Listing.Price,
+		Date:  observed,
+		Miles: listing.Listing.Miles,
+	}
+}
 
-		if err := c.reader.CommitMessages(ctx, m); err != nil {
-			log.Println("commit error: ", err)
+// observedAt is when a message's listing was observed: its produced-at
+// header, or the message time for messages from before envelopes. It is
+// fixed per message, so retrying or redelivering a message stores the same
+// price point instead of adding another.
+func observedAt(m kafka.Message) time.Time {
+	env, err := EnvelopeOf(m, EventListingObserved)
+	if err == nil && !env.ProducedAt.IsZero() {
+		return env.ProducedAt
+	}
+	if !m.Time.IsZero() {
+		return m.Time
+	}
+	return time.Now()
+}
+
+// evaluate checks a listing's price history for price changes and values
+// it, returning the listing as stored before this message when listing
+// events are on.
+func (c *Consumer) evaluate(ctx context.Context, listing *marketcheck.EnrichedListing, fullHistory []marketcheck.PricePoint) *marketcheck.EnrichedListing {
+	vin := listing.Listing.VIN
+	if c.priceWatch != nil {
+		ev, err := c.priceWatch.Observe(ctx, *listing, fullHistory)
+		if err != nil {
+			log.Printf("error handling price change for VIN %s: %v", vin, err)
+		}
+		if ev != nil {
+			log.Printf("VIN %s: price %s %d -> %d (%+.2f%%, %d consecutive drops)",
+				vin, ev.Kind, ev.OldPrice, ev.NewPrice, ev.ChangePercent, ev.ConsecutiveDrops)
 		}
 	}
+
+	if c.valuer != nil {
+		var err error
+		listing.Valuation, err = c.valuer.Value(ctx, listing.Listing, listing.Build, fullHistory)
+		if err != nil {
+			log.Printf("error valuing VIN %s against comparables: %v", vin, err)
+		}
+	} else {
+		listing.Valuation = marketcheck.ComputeValuation(fullHistory, listing.Listing.Price)
+	}
+
+	if c.events == nil {
+		return nil
+	}
+	previous, err := c.lookup.GetListingByVIN(ctx, vin)
+	if err != nil {
+		log.Printf("error looking up stored listing for VIN %s: %v", vin, err)
+	}
+	return previous
+}
+
+func logValuation(listing marketcheck.EnrichedListing) {
+	log.Printf("VIN %s: updated valuation score=%.3f good_value=%v rating=%s method=%s comparables=%d\n",
+		listing.Listing.VIN, listing.Valuation.Score, listing.Valuation.IsGoodValue, listing.Valuation.DealRating,
+		listing.Valuation.Method, listing.Valuation.Comparables)
+}
+
+func (c *Consumer) publishListingEvents(ctx context.Context, previous *marketcheck.EnrichedListing, listing marketcheck.EnrichedListing) {
+	var ev *ListingEvent
+	switch {
+	case previous == nil:
+		ev = &ListingEvent{Type: EventListingCreated}
+	case listing.Valuation.IsGoodValue && !previous.Valuation.IsGoodValue:
+		ev = &ListingEvent{Type: EventListingGoodValue, PreviousValuation: &previous.Valuation}
+	default:
+		return
+	}
+	ev.VIN = listing.Listing.VIN
+	ev.OccurredAt = time.Now().UTC()
+	ev.Listing = listing
+
+	if err := c.events.PublishListingEvent(ctx, *ev); err != nil {
+		log.Printf("error publishing %s for VIN %s: %v", ev.Type, ev.VIN, err)
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
 }
 
 func (c *Consumer) Close() error {
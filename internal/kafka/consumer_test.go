@@ -0,0 +1,150 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/outbox"
+	"github.com/segmentio/kafka-go"
+)
+
+const testVIN = "1HGCM82633A004352"
+
+// fakePriceStore keys points by VIN and date like price_history's unique
+// constraint.
+type fakePriceStore struct {
+	mu     sync.Mutex
+	points map[string]map[time.Time]int
+}
+
+func newFakePriceStore() *fakePriceStore {
+	return &fakePriceStore{points: make(map[string]map[time.Time]int)}
+}
+
+func (s *fakePriceStore) AddPrice(ctx context.Context, vin string, p marketcheck.PricePoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.points[vin] == nil {
+		s.points[vin] = make(map[time.Time]int)
+	}
+	s.points[vin][p.Date.UTC()] = p.Price
+	return nil
+}
+
+func (s *fakePriceStore) GetHistory(ctx context.Context, vin string) ([]marketcheck.PricePoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var history []marketcheck.PricePoint
+	for date, price := range s.points[vin] {
+		history = append(history, marketcheck.PricePoint{Price: price, Date: date})
+	}
+	return history, nil
+}
+
+func (s *fakePriceStore) count(vin string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.points[vin])
+}
+
+// flakyListingRepo fails the first failures saves.
+type flakyListingRepo struct {
+	failures int
+	saves    int
+}
+
+func (r *flakyListingRepo) SaveListing(ctx context.Context, listing *marketcheck.EnrichedListing) error {
+	r.saves++
+	if r.saves <= r.failures {
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+func testListingMessage(t *testing.T, price int) kafka.Message {
+	t.Helper()
+	listing := marketcheck.EnrichedListing{Listing: marketcheck.Listing{VIN: testVIN, Price: price}}
+	m, err := listingMessage(context.Background(), ContentTypeJSON, "test", listing)
+	if err != nil {
+		t.Fatalf("listingMessage: %v", err)
+	}
+	return m
+}
+
+func TestSettleRetriesStoreOnePricePoint(t *testing.T) {
+	store := newFakePriceStore()
+	repo := &flakyListingRepo{failures: 2}
+	c := NewConsumerFrom(nil, store, repo)
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	m := testListingMessage(t, 20000)
+	if err := c.settle(context.Background(), m); err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	if repo.saves != 3 {
+		t.Fatalf("saves = %d, want 3", repo.saves)
+	}
+	if n := store.count(testVIN); n != 1 {
+		t.Fatalf("price points = %d after retries, want 1", n)
+	}
+
+	// A redelivery of the same message is dated the same way.
+	if err := c.settle(context.Background(), m); err != nil {
+		t.Fatalf("settle redelivery: %v", err)
+	}
+	if n := store.count(testVIN); n != 1 {
+		t.Fatalf("price points = %d after redelivery, want 1", n)
+	}
+}
+
+func TestObservedAt(t *testing.T) {
+	produced := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	msgTime := time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)
+
+	enveloped := kafka.Message{Time: msgTime, Headers: Envelope{
+		EventType:     EventListingObserved,
+		SchemaVersion: ListingSchemaVersion,
+		ContentType:   ContentTypeJSON,
+		ProducedAt:    produced,
+	}.Headers()}
+	if got := observedAt(enveloped); !got.Equal(produced) {
+		t.Fatalf("enveloped message observed at %v, want produced-at %v", got, produced)
+	}
+
+	legacy := kafka.Message{Time: msgTime, Value: []byte(`{}`)}
+	if got := observedAt(legacy); !got.Equal(msgTime) {
+		t.Fatalf("v1 message observed at %v, want message time %v", got, msgTime)
+	}
+}
+
+func TestOutboxDuplicatesStoreOnePricePoint(t *testing.T) {
+	store := newFakePriceStore()
+	c := NewConsumerFrom(nil, store, &flakyListingRepo{})
+
+	msg := outbox.Message{
+		ID:        42,
+		VIN:       testVIN,
+		Payload:   []byte(`{"listing":{"vin":"` + testVIN + `","price":18500}}`),
+		Source:    "api",
+		CreatedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+	for relay := 0; relay < 2; relay++ {
+		out, err := outboxMessages(ContentTypeJSON, []outbox.Message{msg})
+		if err != nil {
+			t.Fatalf("outboxMessages: %v", err)
+		}
+		if got := Header(out[0], HeaderOutboxID); got != "42" {
+			t.Fatalf("outbox-id = %q, want 42", got)
+		}
+		if err := c.settle(context.Background(), out[0]); err != nil {
+			t.Fatalf("settle relay %d: %v", relay, err)
+		}
+	}
+	if n := store.count(testVIN); n != 1 {
+		t.Fatalf("price points = %d after duplicate relay, want 1", n)
+	}
+}
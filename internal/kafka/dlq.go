@@ -0,0 +1,184 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers added to messages published to the dead-letter topic, alongside
+// the message's own headers.
+const (
+	HeaderDLQError             = "dlq-error"
+	HeaderDLQReason            = "dlq-reason"
+	HeaderDLQAttempts          = "dlq-attempts"
+	HeaderDLQFailedAt          = "dlq-failed-at"
+	HeaderDLQConsumerGroup     = "dlq-consumer-group"
+	HeaderDLQOriginalTopic     = "dlq-original-topic"
+	HeaderDLQOriginalPartition = "dlq-original-partition"
+	HeaderDLQOriginalOffset    = "dlq-original-offset"
+	// HeaderDLQRedriven is set on messages re-driven from the dead-letter
+	// topic, to the partition:offset they were re-driven from.
+	HeaderDLQRedriven = "dlq-redriven-from"
+)
+
+// Dead-letter reasons.
+const (
+	ReasonPoison           = "poison"
+	ReasonRetriesExhausted = "retries_exhausted"
+)
+
+// PoisonError marks a message that will fail however often it is retried.
+type PoisonError struct {
+	Err error
+}
+
+func (e *PoisonError) Error() string { return e.Err.Error() }
+func (e *PoisonError) Unwrap() error { return e.Err }
+
+func Poison(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PoisonError{Err: err}
+}
+
+// IsPoison reports whether retrying err is pointless: the message is not
+// valid JSON or doesn't fit the listing schema, the error is marked with
+// Poison, or Postgres rejected the data itself (data exceptions and
+// constraint violations). Anything else, such as a lost connection or a
+// timeout, is worth retrying.
+func IsPoison(err error) bool {
+	var poison *PoisonError
+	if errors.As(err, &poison) {
+		return true
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "22", "23":
+			return true
+		}
+	}
+	return false
+}
+
+// RetryPolicy is how the consumer retries a message that failed with a
+// retryable error. Once MaxAttempts is reached the message is dead-lettered;
+// zero retries forever.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+	}
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// DeadLetterPublisher takes messages the consumer gives up on.
+type DeadLetterPublisher interface {
+	PublishDeadLetter(ctx context.Context, m kafka.Message, cause error, reason string, attempts int) error
+}
+
+// DLQWriter publishes failed messages to a dead-letter topic with their
+// key, value and headers unchanged, plus headers describing the failure.
+type DLQWriter struct {
+	writer *kafka.Writer
+	group  string
+}
+
+func NewDLQWriter(brokers []string, topic string, group string) *DLQWriter {
+	return &DLQWriter{
+		writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers:  brokers,
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+			Async:    false,
+		}),
+		group: group,
+	}
+}
+
+func (w *DLQWriter) PublishDeadLetter(ctx context.Context, m kafka.Message, cause error, reason string, attempts int) error {
+	headers := append([]kafka.Header{}, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQReason, Value: []byte(reason)},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+		kafka.Header{Key: HeaderDLQConsumerGroup, Value: []byte(w.group)},
+		kafka.Header{Key: HeaderDLQOriginalTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderDLQOriginalPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderDLQOriginalOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+	)
+
+	return w.writer.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Time:    time.Now(),
+		Headers: headers,
+	})
+}
+
+func (w *DLQWriter) Close() error {
+	return w.writer.Close()
+}
+
+// Header returns the value of a message header, or "".
+func Header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Redrive returns a dead-lettered message ready to publish again: the
+// dead-letter headers are dropped and HeaderDLQRedriven records where it
+// came from.
+func Redrive(m kafka.Message) kafka.Message {
+	var headers []kafka.Header
+	for _, h := range m.Headers {
+		if !strings.HasPrefix(h.Key, "dlq-") {
+			headers = append(headers, h)
+		}
+	}
+	headers = append(headers, kafka.Header{
+		Key:   HeaderDLQRedriven,
+		Value: []byte(fmt.Sprintf("%d:%d", m.Partition, m.Offset)),
+	})
+	return kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Time:    time.Now(),
+		Headers: headers,
+	}
+}
@@ -0,0 +1,282 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Envelope headers, set alongside EventTypeHeader.
+const (
+	HeaderSchemaVersion = "schema-version"
+	HeaderContentType   = "content-type"
+	HeaderSource        = "source"
+	HeaderRunID         = "ingest-run-id"
+	HeaderProducedAt    = "produced-at"
+	HeaderTraceID       = "trace-id"
+	// HeaderOutboxID is set on messages relayed from the listing outbox.
+	HeaderOutboxID = "outbox-id"
+)
+
+// EventListingObserved is a listing swept by the producer, published to
+// listings-raw.
+const EventListingObserved = "ListingObserved"
+
+// ListingSchemaVersion is the ListingObserved version the producer writes.
+// Version 1 is the bare EnrichedListing JSON written before envelopes.
+const ListingSchemaVersion = 2
+
+// Envelope is the metadata carried in a message's headers.
+type Envelope struct {
+	EventType     string
+	SchemaVersion int
+	ContentType   string
+	// Source is where the payload came from, such as the listing source.
+	Source string
+	// RunID identifies the producer run, such as a market sweep, that
+	// published the message.
+	RunID      string
+	ProducedAt time.Time
+	TraceID    string
+}
+
+func (e Envelope) Headers() []kafka.Header {
+	headers := []kafka.Header{
+		{Key: EventTypeHeader, Value: []byte(e.EventType)},
+		{Key: HeaderSchemaVersion, Value: []byte(strconv.Itoa(e.SchemaVersion))},
+		{Key: HeaderContentType, Value: []byte(e.ContentType)},
+		{Key: HeaderProducedAt, Value: []byte(e.ProducedAt.UTC().Format(time.RFC3339Nano))},
+	}
+	for _, h := range []kafka.Header{
+		{Key: HeaderSource, Value: []byte(e.Source)},
+		{Key: HeaderRunID, Value: []byte(e.RunID)},
+		{Key: HeaderTraceID, Value: []byte(e.TraceID)},
+	} {
+		if len(h.Value) > 0 {
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
+
+// EnvelopeOf reads a message's envelope. A message without a schema version
+// predates envelopes: it is version 1 JSON of the expected event type.
+func EnvelopeOf(m kafka.Message, eventType string) (Envelope, error) {
+	env := Envelope{
+		EventType:   Header(m, EventTypeHeader),
+		ContentType: Header(m, HeaderContentType),
+		Source:      Header(m, HeaderSource),
+		RunID:       Header(m, HeaderRunID),
+		TraceID:     Header(m, HeaderTraceID),
+		ProducedAt:  m.Time,
+	}
+	if env.EventType == "" {
+		env.EventType = eventType
+	}
+	if env.EventType != eventType {
+		return env, fmt.Errorf("expected %s, got %s", eventType, env.EventType)
+	}
+
+	version := Header(m, HeaderSchemaVersion)
+	if version == "" {
+		env.SchemaVersion = 1
+		env.ContentType = ContentTypeJSON
+		return env, nil
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 {
+		return env, fmt.Errorf("invalid schema version %q", version)
+	}
+	env.SchemaVersion = n
+	if env.ContentType == "" {
+		env.ContentType = ContentTypeJSON
+	}
+	if t, err := time.Parse(time.RFC3339Nano, Header(m, HeaderProducedAt)); err == nil {
+		env.ProducedAt = t
+	}
+	return env, nil
+}
+
+// Upcaster rewrites a JSON document of one schema version as the next.
+type Upcaster func(doc map[string]any) error
+
+// Registry maps content types to codecs and knows the current version of
+// each event type and how to upcast older versions to it.
+type Registry struct {
+	codecs    map[string]Codec
+	current   map[string]int
+	upcasters map[Schema]Upcaster
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		codecs:    make(map[string]Codec),
+		current:   make(map[string]int),
+		upcasters: make(map[Schema]Upcaster),
+	}
+}
+
+func (r *Registry) RegisterCodec(c Codec) {
+	r.codecs[c.ContentType()] = c
+}
+
+// RegisterEventType sets the version of an event type that is written and
+// that older versions are upcast to.
+func (r *Registry) RegisterEventType(eventType string, version int) {
+	r.current[eventType] = version
+}
+
+// RegisterUpcaster sets how documents of an event type at version from are
+// rewritten as version from+1.
+func (r *Registry) RegisterUpcaster(eventType string, from int, u Upcaster) {
+	r.upcasters[Schema{EventType: eventType, Version: from}] = u
+}
+
+// Codec finds a codec by name, such as "json" or "avro".
+func (r *Registry) Codec(name string) (Codec, bool) {
+	for _, c := range r.codecs {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Encode builds a message carrying v at its event type's current version,
+// in env's content type.
+func (r *Registry) Encode(env Envelope, v any) (kafka.Message, error) {
+	version, ok := r.current[env.EventType]
+	if !ok {
+		return kafka.Message{}, fmt.Errorf("unknown event type %q", env.EventType)
+	}
+	env.SchemaVersion = version
+	if env.ContentType == "" {
+		env.ContentType = ContentTypeJSON
+	}
+	codec, ok := r.codecs[env.ContentType]
+	if !ok {
+		return kafka.Message{}, fmt.Errorf("unknown content type %q", env.ContentType)
+	}
+
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	value, err := codec.FromJSON(Schema{EventType: env.EventType, Version: version}, doc)
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("failed to encode %s: %w", env.EventType, err)
+	}
+	return kafka.Message{Value: value, Headers: env.Headers()}, nil
+}
+
+// Document returns a message's payload as a JSON document at its event
+// type's current version. Messages that can't be read, including ones newer
+// than this registry knows, are poison.
+func (r *Registry) Document(m kafka.Message, eventType string) (Envelope, []byte, error) {
+	env, err := EnvelopeOf(m, eventType)
+	if err != nil {
+		return env, nil, Poison(err)
+	}
+	current, ok := r.current[eventType]
+	if !ok {
+		return env, nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+	if env.SchemaVersion > current {
+		return env, nil, Poison(fmt.Errorf("%s version %d is newer than the supported version %d", eventType, env.SchemaVersion, current))
+	}
+	codec, ok := r.codecs[env.ContentType]
+	if !ok {
+		return env, nil, Poison(fmt.Errorf("unknown content type %q", env.ContentType))
+	}
+
+	doc, err := codec.ToJSON(Schema{EventType: eventType, Version: env.SchemaVersion}, m.Value)
+	if err != nil {
+		return env, nil, Poison(fmt.Errorf("failed to decode %s: %w", eventType, err))
+	}
+	if env.SchemaVersion == current {
+		return env, doc, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return env, nil, Poison(fmt.Errorf("failed to decode %s: %w", eventType, err))
+	}
+	for version := env.SchemaVersion; version < current; version++ {
+		upcast, ok := r.upcasters[Schema{EventType: eventType, Version: version}]
+		if !ok {
+			return env, nil, Poison(fmt.Errorf("no upcaster for %s v%d", eventType, version))
+		}
+		if err := upcast(fields); err != nil {
+			return env, nil, Poison(fmt.Errorf("failed to upcast %s v%d: %w", eventType, version, err))
+		}
+	}
+	doc, err = json.Marshal(fields)
+	return env, doc, err
+}
+
+// Decode reads a message's payload into v; see Document.
+func (r *Registry) Decode(m kafka.Message, eventType string, v any) (Envelope, error) {
+	env, doc, err := r.Document(m, eventType)
+	if err != nil {
+		return env, err
+	}
+	if err := json.Unmarshal(doc, v); err != nil {
+		return env, Poison(fmt.Errorf("json unmarshal error: %w", err))
+	}
+	return env, nil
+}
+
+// DefaultRegistry has the JSON and Avro codecs and the payload schemas
+// published by this service.
+var DefaultRegistry = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	schemas, err := fs.Sub(schemaFiles, "schemas")
+	if err != nil {
+		panic(err)
+	}
+	avro, err := NewAvroCodec(schemas)
+	if err != nil {
+		panic(err)
+	}
+
+	r := NewRegistry()
+	r.RegisterCodec(JSONCodec{})
+	r.RegisterCodec(avro)
+
+	r.RegisterEventType(EventListingObserved, ListingSchemaVersion)
+	// Version 2 moved metadata into the envelope; the payload is unchanged.
+	r.RegisterUpcaster(EventListingObserved, 1, func(doc map[string]any) error { return nil })
+	return r
+}
+
+type runIDKey struct{}
+
+// WithRunID tags messages written with ctx with a producer run ID.
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, runID)
+}
+
+func RunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// NewID returns a random 16-byte hex ID for runs and traces.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("kafka: failed to read random ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,185 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/lifecycle"
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/pricewatch"
+	"github.com/segmentio/kafka-go"
+)
+
+// PriceEventWriter publishes PriceChanged events keyed by VIN, with the
+// event type in the EventTypeHeader.
+type PriceEventWriter struct {
+	writer *kafka.Writer
+}
+
+func NewPriceEventWriter(brokers []string, topic string) *PriceEventWriter {
+	return &PriceEventWriter{
+		writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers:  brokers,
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+			Async:    false,
+		}),
+	}
+}
+
+func (p *PriceEventWriter) PublishPriceChanged(ctx context.Context, ev pricewatch.PriceChanged) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(ev.VIN),
+		Value: b,
+		Time:  time.Now(),
+		Headers: []kafka.Header{
+			{Key: EventTypeHeader, Value: []byte(pricewatch.EventType)},
+		},
+	})
+}
+
+func (p *PriceEventWriter) Close() error {
+	return p.writer.Close()
+}
+
+// EventTypeHeader carries the event type on event topics.
+const EventTypeHeader = "event-type"
+
+// Listing lifecycle event types published by the Consumer.
+const (
+	EventListingCreated   = "ListingCreated"
+	EventListingGoodValue = "ListingGoodValue"
+	EventListingSold      = "ListingSold"
+)
+
+// ListingEvent is a change in a stored listing's lifecycle.
+type ListingEvent struct {
+	Type       string                      `json:"type"`
+	VIN        string                      `json:"vin"`
+	OccurredAt time.Time                   `json:"occurred_at"`
+	Listing    marketcheck.EnrichedListing `json:"listing"`
+	// PreviousValuation is set on ListingGoodValue.
+	PreviousValuation *marketcheck.Valuation `json:"previous_valuation,omitempty"`
+	// Sale is set on ListingSold.
+	Sale *lifecycle.Sold `json:"sale,omitempty"`
+}
+
+// ListingEventWriter publishes ListingEvents keyed by VIN.
+type ListingEventWriter struct {
+	writer *kafka.Writer
+}
+
+func NewListingEventWriter(brokers []string, topic string) *ListingEventWriter {
+	return &ListingEventWriter{
+		writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers:  brokers,
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+			Async:    false,
+		}),
+	}
+}
+
+func (w *ListingEventWriter) PublishListingEvent(ctx context.Context, ev ListingEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	return w.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(ev.VIN),
+		Value: b,
+		Time:  time.Now(),
+		Headers: []kafka.Header{
+			{Key: EventTypeHeader, Value: []byte(ev.Type)},
+		},
+	})
+}
+
+func (w *ListingEventWriter) PublishListingSold(ctx context.Context, s lifecycle.Sold) error {
+	return w.PublishListingEvent(ctx, ListingEvent{
+		Type:       EventListingSold,
+		VIN:        s.VIN,
+		OccurredAt: s.DetectedAt,
+		Listing:    s.Listing,
+		Sale:       &s,
+	})
+}
+
+func (w *ListingEventWriter) Close() error {
+	return w.writer.Close()
+}
+
+// EventHandler receives raw messages from an event topic along with the
+// type from their header.
+type EventHandler interface {
+	HandleEvent(ctx context.Context, eventType string, key, value []byte) error
+}
+
+// EventReader feeds an event topic to a handler in its own consumer group.
+type EventReader struct {
+	reader  *kafka.Reader
+	handler EventHandler
+}
+
+func NewEventReader(brokers []string, groupId string, topic string, handler EventHandler) *EventReader {
+	return &EventReader{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			GroupID: groupId,
+			Topic:   topic,
+		}),
+		handler: handler,
+	}
+}
+
+func (r *EventReader) Run(ctx context.Context) error {
+	for {
+		m, err := r.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Println("fetch message error: ", err)
+			continue
+		}
+
+		eventType := ""
+		for _, h := range m.Headers {
+			if h.Key == EventTypeHeader {
+				eventType = string(h.Value)
+			}
+		}
+		// Offsets commit cumulatively, so a failed event is retried here
+		// rather than skipped; handlers drop events they can never handle.
+		backoff := time.Second
+		for {
+			err := r.handler.HandleEvent(ctx, eventType, m.Key, m.Value)
+			if err == nil {
+				break
+			}
+			log.Printf("error handling %s event from %s, retrying in %s: %v", eventType, m.Topic, backoff, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+		}
+
+		if err := r.reader.CommitMessages(ctx, m); err != nil {
+			log.Println("commit error: ", err)
+		}
+	}
+}
+
+func (r *EventReader) Close() error {
+	return r.reader.Close()
+}
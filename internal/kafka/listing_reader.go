@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/vin"
+	"github.com/segmentio/kafka-go"
+)
+
+// ListingHandler is called for each listing a ListingReader reads.
+type ListingHandler interface {
+	HandleListing(ctx context.Context, l marketcheck.EnrichedListing) error
+}
+
+// ListingReader feeds listings to a handler in its own consumer group, so
+// side consumers such as the saved-search matcher don't hold up, or get
+// held up by, the main Consumer. Listings with invalid VINs are skipped;
+// the main Consumer quarantines them.
+type ListingReader struct {
+	reader  MessageReader
+	handler ListingHandler
+}
+
+func NewListingReader(brokers []string, groupId string, topic string, handler ListingHandler) *ListingReader {
+	return NewListingReaderFrom(kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		GroupID: groupId,
+		Topic:   topic,
+	}), handler)
+}
+
+// NewListingReaderFrom reads from reader, such as a MemoryBus subscription.
+func NewListingReaderFrom(reader MessageReader, handler ListingHandler) *ListingReader {
+	return &ListingReader{reader: reader, handler: handler}
+}
+
+func (r *ListingReader) Run(ctx context.Context) error {
+	for {
+		m, err := r.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			log.Println("fetch message error: ", err)
+			continue
+		}
+
+		var listing marketcheck.EnrichedListing
+		if _, err := DefaultRegistry.Decode(m, EventListingObserved, &listing); err != nil {
+			log.Println("error decoding listing: ", err)
+		} else if parsed, err := vin.Parse(listing.Listing.VIN); err == nil {
+			listing.Listing.VIN = parsed.Value
+			if err := r.handler.HandleListing(ctx, listing); err != nil {
+				log.Printf("error handling listing %s: %v", parsed.Value, err)
+			}
+		}
+
+		if err := r.reader.CommitMessages(ctx, m); err != nil {
+			log.Println("commit error: ", err)
+		}
+	}
+}
+
+func (r *ListingReader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,361 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/vin"
+	"github.com/segmentio/kafka-go"
+)
+
+// BatchStore writes a batch of listings. SaveBatch stores one price per VIN
+// and the listings in a single transaction.
+type BatchStore interface {
+	GetHistories(ctx context.Context, vins []string) (map[string][]marketcheck.PricePoint, error)
+	SaveBatch(ctx context.Context, points map[string]marketcheck.PricePoint, listings []*marketcheck.EnrichedListing) error
+}
+
+type PoolOptions struct {
+	// Workers is how many batches are processed at once. Messages are
+	// assigned to workers by a hash of their key, the VIN, normalized, so
+	// each VIN's messages are processed one at a time and in order.
+	Workers int
+	// BatchSize caps the listings a worker writes in one transaction.
+	BatchSize int
+	// BatchWait is how long a worker waits for a batch to fill.
+	BatchWait time.Duration
+	// CommitInterval is how often processed offsets are committed.
+	CommitInterval time.Duration
+}
+
+func DefaultPoolOptions() PoolOptions {
+	return PoolOptions{
+		Workers:        8,
+		BatchSize:      100,
+		BatchWait:      50 * time.Millisecond,
+		CommitInterval: time.Second,
+	}
+}
+
+// runPool fans messages out to workers and commits each partition's offsets
+// up to the first message not yet processed. On shutdown it stops fetching,
+// lets workers finish, and commits what they processed.
+func (c *Consumer) runPool(ctx context.Context) error {
+	opts := c.pool
+	opts.BatchSize = max(opts.BatchSize, 1)
+	if opts.CommitInterval <= 0 {
+		opts.CommitInterval = time.Second
+	}
+
+	offsets := newOffsetTracker()
+	queues := make([]chan kafka.Message, opts.Workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, opts.BatchSize)
+		w := &worker{consumer: c, opts: opts, offsets: offsets}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx, queues[i])
+		}()
+	}
+
+	commitCtx, stopCommits := context.WithCancel(context.Background())
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		c.commitLoop(commitCtx, offsets, opts.CommitInterval)
+	}()
+
+	err := c.fetch(ctx, func(m kafka.Message) error {
+		offsets.add(m)
+		queue := queues[shard(vinKey(m), len(queues))]
+		select {
+		case queue <- m:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	stopCommits()
+	<-committed
+	return err
+}
+
+// commitLoop commits processed offsets every interval, and once more when
+// ctx is done.
+func (c *Consumer) commitLoop(ctx context.Context, offsets *offsetTracker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			c.commit(finalCtx, offsets)
+			cancel()
+			return
+		case <-ticker.C:
+			c.commit(ctx, offsets)
+		}
+	}
+}
+
+func (c *Consumer) commit(ctx context.Context, offsets *offsetTracker) {
+	msgs := offsets.committable()
+	if len(msgs) == 0 {
+		return
+	}
+	if err := c.reader.CommitMessages(ctx, msgs...); err != nil {
+		log.Println("commit error: ", err)
+	}
+}
+
+// vinKey is a message's key normalized as a VIN, so that keys differing
+// only in case or spacing land on the same worker and in different batches.
+func vinKey(m kafka.Message) string {
+	return vin.Normalize(string(m.Key))
+}
+
+func shard(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+type worker struct {
+	consumer *Consumer
+	opts     PoolOptions
+	offsets  *offsetTracker
+}
+
+// run collects messages into batches until queue is closed. A batch ends
+// when it is full, BatchWait passes, or a key already in it comes up again,
+// so that a VIN appears at most once per batch.
+func (w *worker) run(ctx context.Context, queue <-chan kafka.Message) {
+	for m := range queue {
+		batch := []kafka.Message{m}
+		keys := map[string]bool{vinKey(m): true}
+		wait := time.NewTimer(w.opts.BatchWait)
+
+	collect:
+		for len(batch) < w.opts.BatchSize {
+			select {
+			case next, ok := <-queue:
+				if !ok {
+					break collect
+				}
+				if keys[vinKey(next)] {
+					w.flush(ctx, batch)
+					batch, keys = batch[:0], map[string]bool{}
+				}
+				batch = append(batch, next)
+				keys[vinKey(next)] = true
+			case <-wait.C:
+				break collect
+			}
+		}
+		wait.Stop()
+		w.flush(ctx, batch)
+	}
+}
+
+// flush processes a batch and marks its messages done. If the batch still
+// can't be written after batchAttempts tries, its messages are processed one
+// by one, so a single bad message is retried or dead-lettered on its own.
+// Messages are left undone when ctx is done, so they are not committed.
+func (w *worker) flush(ctx context.Context, batch []kafka.Message) {
+	if ctx.Err() != nil {
+		return
+	}
+	c := w.consumer
+
+	var msgs, later []kafka.Message
+	var listings []marketcheck.EnrichedListing
+	vins := make(map[string]bool, len(batch))
+	for _, m := range batch {
+		listing, ok, err := c.decode(ctx, m)
+		switch {
+		case err != nil:
+			if c.settle(ctx, m) != nil {
+				return
+			}
+			w.offsets.done(m)
+		case !ok:
+			w.offsets.done(m)
+		case vins[listing.Listing.VIN]:
+			// Keyed differently from its VIN; process it after the batch.
+			later = append(later, m)
+		default:
+			vins[listing.Listing.VIN] = true
+			msgs = append(msgs, m)
+			listings = append(listings, listing)
+		}
+	}
+
+	if len(listings) > 0 {
+		if err := c.processListings(ctx, msgs, listings); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("error processing batch of %d listings, processing them one by one: %v", len(listings), err)
+			later = append(msgs, later...)
+		} else {
+			for _, m := range msgs {
+				w.offsets.done(m)
+			}
+		}
+	}
+	for _, m := range later {
+		if c.settle(ctx, m) != nil {
+			return
+		}
+		w.offsets.done(m)
+	}
+}
+
+// batchAttempts is how many times a batch's transaction is tried before
+// its messages are processed one by one.
+const batchAttempts = 3
+
+// processListings is processMessage for a batch of listings with distinct
+// VINs, decoded from msgs. Each listing is evaluated against its stored
+// history plus its new price, then prices and listings are written in one
+// transaction, retried on its own so that price changes aren't detected
+// and listings valued again for a transient failure.
+func (c *Consumer) processListings(ctx context.Context, msgs []kafka.Message, listings []marketcheck.EnrichedListing) error {
+	points := make(map[string]marketcheck.PricePoint, len(listings))
+	vins := make([]string, len(listings))
+	for i, l := range listings {
+		vins[i] = l.Listing.VIN
+		points[l.Listing.VIN] = pricePoint(l, observedAt(msgs[i]))
+	}
+	histories, err := c.batchStore.GetHistories(ctx, vins)
+	if err != nil {
+		return fmt.Errorf("error getting price histories: %w", err)
+	}
+
+	previous := make([]*marketcheck.EnrichedListing, len(listings))
+	saves := make([]*marketcheck.EnrichedListing, len(listings))
+	for i := range listings {
+		v := listings[i].Listing.VIN
+		previous[i] = c.evaluate(ctx, &listings[i], withPoint(histories[v], points[v]))
+		saves[i] = &listings[i]
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = c.batchStore.SaveBatch(ctx, points, saves)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil || attempt >= batchAttempts {
+			return fmt.Errorf("error saving batch: %w", err)
+		}
+		delay := c.retry.delay(attempt)
+		log.Printf("error saving batch of %d listings (attempt %d, retrying in %s): %v", len(saves), attempt, delay, err)
+		if !sleepCtx(ctx, delay) {
+			return ctx.Err()
+		}
+	}
+
+	for i, l := range listings {
+		if c.events != nil {
+			c.publishListingEvents(ctx, previous[i], l)
+		}
+		logValuation(l)
+	}
+	return nil
+}
+
+// withPoint is history, oldest first, with p added as the database would
+// store it: replacing any point with the same date.
+func withPoint(history []marketcheck.PricePoint, p marketcheck.PricePoint) []marketcheck.PricePoint {
+	// price_history.date holds microseconds and no zone.
+	p.Date = p.Date.UTC().Truncate(time.Microsecond)
+	out := make([]marketcheck.PricePoint, 0, len(history)+1)
+	for _, h := range history {
+		if !h.Date.Equal(p.Date) {
+			out = append(out, h)
+		}
+	}
+	out = append(out, p)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	return out
+}
+
+// offsetTracker follows fetched messages per partition so that offsets are
+// only committed once every earlier message in the partition is done.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	// pending are fetched messages not yet committable, in offset order.
+	pending []kafka.Message
+	done    map[int64]bool
+	// commit is the latest message whose offset, and every earlier one, is
+	// done but not yet committed.
+	commit *kafka.Message
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+func (t *offsetTracker) add(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[m.Partition]
+	// A reader that goes back to an earlier offset, as after a rebalance,
+	// redelivers everything after it; track the partition afresh.
+	if !ok || (len(p.pending) > 0 && m.Offset <= p.pending[len(p.pending)-1].Offset) {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[m.Partition] = p
+	}
+	p.pending = append(p.pending, m)
+}
+
+func (t *offsetTracker) done(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[m.Partition]
+	if !ok {
+		return
+	}
+	p.done[m.Offset] = true
+	for len(p.pending) > 0 && p.done[p.pending[0].Offset] {
+		next := p.pending[0]
+		delete(p.done, next.Offset)
+		p.commit = &next
+		p.pending = p.pending[1:]
+	}
+}
+
+// committable returns, for each partition, the latest message that can be
+// committed since the last call.
+func (t *offsetTracker) committable() []kafka.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var msgs []kafka.Message
+	for _, p := range t.partitions {
+		if p.commit != nil {
+			msgs = append(msgs, *p.commit)
+			p.commit = nil
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,176 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/pricewatch"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeBatchStore fails the first failures SaveBatch calls and writes
+// nothing for them.
+type fakeBatchStore struct {
+	failures int
+	calls    int
+	prices   map[string]map[time.Time]int
+	listings map[string]bool
+}
+
+func newFakeBatchStore(failures int) *fakeBatchStore {
+	return &fakeBatchStore{
+		failures: failures,
+		prices:   make(map[string]map[time.Time]int),
+		listings: make(map[string]bool),
+	}
+}
+
+func (s *fakeBatchStore) GetHistories(ctx context.Context, vins []string) (map[string][]marketcheck.PricePoint, error) {
+	out := make(map[string][]marketcheck.PricePoint)
+	for _, v := range vins {
+		for date, price := range s.prices[v] {
+			out[v] = append(out[v], marketcheck.PricePoint{Price: price, Date: date})
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeBatchStore) SaveBatch(ctx context.Context, points map[string]marketcheck.PricePoint, listings []*marketcheck.EnrichedListing) error {
+	s.calls++
+	if s.calls <= s.failures {
+		return errors.New("connection reset")
+	}
+	for v, p := range points {
+		if s.prices[v] == nil {
+			s.prices[v] = make(map[time.Time]int)
+		}
+		s.prices[v][p.Date.UTC()] = p.Price
+	}
+	for _, l := range listings {
+		s.listings[l.Listing.VIN] = true
+	}
+	return nil
+}
+
+type countingWatcher struct {
+	observed map[string]int
+	lastLen  int
+}
+
+func (w *countingWatcher) Observe(ctx context.Context, l marketcheck.EnrichedListing, history []marketcheck.PricePoint) (*pricewatch.PriceChanged, error) {
+	w.observed[l.Listing.VIN]++
+	w.lastLen = len(history)
+	return nil, nil
+}
+
+func TestFlushRetriesTransactionWithoutReevaluating(t *testing.T) {
+	store := newFakeBatchStore(2)
+	watcher := &countingWatcher{observed: map[string]int{}}
+	c := NewConsumerFrom(nil, newFakePriceStore(), &flakyListingRepo{})
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	c.SetPriceWatcher(watcher)
+	c.SetWorkerPool(store, PoolOptions{Workers: 1, BatchSize: 10})
+
+	m := testListingMessage(t, 20000)
+	m.Partition, m.Offset = 0, 7
+	offsets := newOffsetTracker()
+	offsets.add(m)
+	w := &worker{consumer: c, opts: c.pool, offsets: offsets}
+	w.flush(context.Background(), []kafka.Message{m})
+
+	if store.calls != 3 {
+		t.Fatalf("SaveBatch calls = %d, want 3", store.calls)
+	}
+	if n := watcher.observed[testVIN]; n != 1 {
+		t.Fatalf("price watch ran %d times, want 1", n)
+	}
+	if watcher.lastLen != 1 {
+		t.Fatalf("price watch saw %d history points, want the new one", watcher.lastLen)
+	}
+	if len(store.prices[testVIN]) != 1 || !store.listings[testVIN] {
+		t.Fatalf("batch not written: prices %v, listings %v", store.prices, store.listings)
+	}
+	if got := offsets.committable(); len(got) != 1 || got[0].Offset != 7 {
+		t.Fatalf("committable = %v, want offset 7", got)
+	}
+}
+
+func TestShardUsesNormalizedVIN(t *testing.T) {
+	a := kafka.Message{Key: []byte(testVIN)}
+	b := kafka.Message{Key: []byte(" 1hgcm82633a004352 ")}
+	if vinKey(a) != vinKey(b) {
+		t.Fatalf("vinKey(%q) = %q, vinKey(%q) = %q", a.Key, vinKey(a), b.Key, vinKey(b))
+	}
+	for n := 1; n <= 16; n++ {
+		if shard(vinKey(a), n) != shard(vinKey(b), n) {
+			t.Fatalf("keys for one VIN land on different shards of %d", n)
+		}
+	}
+}
+
+func TestWithPoint(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	history := []marketcheck.PricePoint{{Price: 21000, Date: day(1)}, {Price: 20500, Date: day(3)}}
+
+	got := withPoint(history, marketcheck.PricePoint{Price: 20000, Date: day(2)})
+	if len(got) != 3 || got[1].Price != 20000 || !got[2].Date.Equal(day(3)) {
+		t.Fatalf("withPoint inserted out of order: %v", got)
+	}
+
+	got = withPoint(history, marketcheck.PricePoint{Price: 19900, Date: day(3).Add(300 * time.Nanosecond)})
+	if len(got) != 2 || got[1].Price != 19900 {
+		t.Fatalf("withPoint didn't replace the point with the same stored date: %v", got)
+	}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	msg := func(partition int, offset int64) kafka.Message {
+		return kafka.Message{Partition: partition, Offset: offset}
+	}
+	offsets := func(msgs []kafka.Message) map[int]int64 {
+		out := make(map[int]int64)
+		for _, m := range msgs {
+			out[m.Partition] = m.Offset
+		}
+		return out
+	}
+
+	tr := newOffsetTracker()
+	for _, m := range []kafka.Message{msg(0, 1), msg(0, 2), msg(0, 3), msg(1, 10), msg(1, 11)} {
+		tr.add(m)
+	}
+
+	// Done out of order: nothing is committable until offset 1 is done.
+	tr.done(msg(0, 2))
+	tr.done(msg(0, 3))
+	if got := tr.committable(); len(got) != 0 {
+		t.Fatalf("committable = %v before the first message is done", got)
+	}
+	tr.done(msg(0, 1))
+	tr.done(msg(1, 10))
+	if got := offsets(tr.committable()); len(got) != 2 || got[0] != 3 || got[1] != 10 {
+		t.Fatalf("committable = %v, want partition 0 at 3 and 1 at 10", got)
+	}
+	if got := tr.committable(); len(got) != 0 {
+		t.Fatalf("committable = %v again with nothing new done", got)
+	}
+
+	// A rebalance rewinds partition 1; the redelivered offsets start afresh
+	// and the old pending offset 11 no longer holds them back.
+	tr.add(msg(1, 5))
+	tr.add(msg(1, 6))
+	tr.done(msg(1, 6))
+	tr.done(msg(1, 5))
+	if got := offsets(tr.committable()); len(got) != 1 || got[1] != 6 {
+		t.Fatalf("committable = %v after rewind, want partition 1 at 6", got)
+	}
+
+	// Done for an unknown partition is ignored.
+	tr.done(msg(7, 1))
+	if got := tr.committable(); len(got) != 0 {
+		t.Fatalf("committable = %v for an unknown partition", got)
+	}
+}
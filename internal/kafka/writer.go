@@ -2,11 +2,14 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/outbox"
+	"github.com/omerahmer/motor_metrics/internal/vin"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -15,33 +18,104 @@ type Writer interface {
 	Close() error
 }
 
+// KafkaWriter publishes listings as ListingObserved messages keyed by VIN,
+// enveloped by DefaultRegistry. Messages are partitioned by a hash of the
+// normalized VIN, so each VIN's messages stay in order on one partition,
+// which the consumer's worker pool relies on. The run ID comes from the context passed to
+// Write; see WithRunID.
 type KafkaWriter struct {
-	writer *kafka.Writer
+	writer      *kafka.Writer
+	contentType string
+	source      string
 }
 
-func NewKafkaWriter(brokers []string, topic string) Writer {
+func NewKafkaWriter(brokers []string, topic string) *KafkaWriter {
 	return &KafkaWriter{
 		writer: kafka.NewWriter(kafka.WriterConfig{
 			Brokers:  brokers,
 			Topic:    topic,
-			Balancer: &kafka.LeastBytes{},
+			Balancer: &kafka.Hash{},
 			Async:    false,
 		}),
+		contentType: ContentTypeJSON,
 	}
 }
 
+// SetCodec picks the payload format by codec name, "json" or "avro".
+func (k *KafkaWriter) SetCodec(name string) error {
+	codec, ok := DefaultRegistry.Codec(name)
+	if !ok {
+		return fmt.Errorf("unknown codec %q", name)
+	}
+	k.contentType = codec.ContentType()
+	return nil
+}
+
+// SetSource sets the source header, such as the listing source.
+func (k *KafkaWriter) SetSource(source string) {
+	k.source = source
+}
+
 func (k *KafkaWriter) Write(ctx context.Context, listing marketcheck.EnrichedListing) error {
-	b, err := json.Marshal(listing)
+	m, err := listingMessage(ctx, k.contentType, k.source, listing)
+	if err != nil {
+		log.Println("Failed to encode listing:", err)
+		return err
+	}
+	return k.writer.WriteMessages(ctx, m)
+}
+
+// listingMessage envelopes a listing as a ListingObserved message keyed by
+// VIN, with a new trace ID and the run ID from ctx.
+func listingMessage(ctx context.Context, contentType, source string, listing marketcheck.EnrichedListing) (kafka.Message, error) {
+	now := time.Now()
+	m, err := DefaultRegistry.Encode(Envelope{
+		EventType:   EventListingObserved,
+		ContentType: contentType,
+		Source:      source,
+		RunID:       RunID(ctx),
+		ProducedAt:  now,
+		TraceID:     NewID(),
+	}, listing)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	m.Key = []byte(vin.Normalize(listing.Listing.VIN))
+	m.Time = now
+	return m, nil
+}
+
+// PublishOutbox publishes outbox messages as ListingObserved messages keyed
+// by VIN, each with its outbox ID in the outbox-id header. A message is
+// produced at its outbox row's created_at rather than when it is relayed, so
+// a message relayed twice dates its price the same way both times.
+func (k *KafkaWriter) PublishOutbox(ctx context.Context, msgs []outbox.Message) error {
+	out, err := outboxMessages(k.contentType, msgs)
 	if err != nil {
-		log.Println("Failed to marshal listing:", err)
 		return err
 	}
+	return k.writer.WriteMessages(ctx, out...)
+}
 
-	return k.writer.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(listing.Listing.VIN),
-		Value: b,
-		Time:  time.Now(),
-	})
+func outboxMessages(contentType string, msgs []outbox.Message) ([]kafka.Message, error) {
+	out := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		m, err := DefaultRegistry.Encode(Envelope{
+			EventType:   EventListingObserved,
+			ContentType: contentType,
+			Source:      msg.Source,
+			ProducedAt:  msg.CreatedAt,
+			TraceID:     msg.TraceID,
+		}, msg.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode outbox message %d: %w", msg.ID, err)
+		}
+		m.Key = []byte(vin.Normalize(msg.VIN))
+		m.Time = msg.CreatedAt
+		m.Headers = append(m.Headers, kafka.Header{Key: HeaderOutboxID, Value: []byte(strconv.FormatInt(msg.ID, 10))})
+		out[i] = m
+	}
+	return out, nil
 }
 
 func (k *KafkaWriter) Close() error {
@@ -0,0 +1,39 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/outbox"
+)
+
+// Messages are partitioned by key, so every spelling of a VIN must produce
+// the same key for its messages to stay in order.
+func TestMessagesKeyedByNormalizedVIN(t *testing.T) {
+	var listing marketcheck.EnrichedListing
+	listing.Listing.VIN = " 1hgcm82633a004352"
+	m, err := listingMessage(context.Background(), ContentTypeJSON, "test", listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(m.Key) != testVIN {
+		t.Errorf("listing message key = %q, want %q", m.Key, testVIN)
+	}
+
+	payload, err := json.Marshal(listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := outboxMessages(ContentTypeJSON, []outbox.Message{
+		{ID: 1, VIN: "1hgcm82633a004352 ", Payload: payload, Source: "api_search", CreatedAt: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out[0].Key) != testVIN {
+		t.Errorf("outbox message key = %q, want %q", out[0].Key, testVIN)
+	}
+}
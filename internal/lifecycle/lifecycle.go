@@ -0,0 +1,152 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+// Listing statuses. MarketCheck doesn't say why a listing went away, so a
+// listing that stops appearing in sweeps is presumed sold.
+const (
+	StatusActive = "active"
+	StatusSold   = "sold"
+)
+
+// Sold is a listing presumed sold. SoldAt is when it was last seen, and
+// FirstSeenAt when it was first stored.
+type Sold struct {
+	VIN          string    `json:"vin"`
+	Make         string    `json:"make"`
+	Model        string    `json:"model"`
+	Year         int       `json:"year"`
+	Trim         string    `json:"trim,omitempty"`
+	DealerID     int       `json:"dealer_id,omitempty"`
+	DealerName   string    `json:"dealer_name,omitempty"`
+	FinalPrice   int       `json:"final_price"`
+	FirstSeenAt  time.Time `json:"first_seen_at"`
+	SoldAt       time.Time `json:"sold_at"`
+	DetectedAt   time.Time `json:"detected_at"`
+	DaysOnMarket float64   `json:"days_on_market"`
+
+	// Listing is the listing as last stored, for ListingSold events.
+	Listing marketcheck.EnrichedListing `json:"-"`
+}
+
+// DaysOnMarket is the days from first seen to sold, to a tenth of a day.
+func DaysOnMarket(firstSeen, soldAt time.Time) float64 {
+	return math.Round(soldAt.Sub(firstSeen).Hours()/24*10) / 10
+}
+
+// TimeToSale summarizes days on market for sold listings of a model or at
+// a dealer.
+type TimeToSale struct {
+	Make          string  `json:"make,omitempty"`
+	Model         string  `json:"model,omitempty"`
+	DealerID      int     `json:"dealer_id,omitempty"`
+	DealerName    string  `json:"dealer_name,omitempty"`
+	Sold          int     `json:"sold"`
+	AvgDays       float64 `json:"avg_days"`
+	MedianDays    float64 `json:"median_days"`
+	P25Days       float64 `json:"p25_days"`
+	P75Days       float64 `json:"p75_days"`
+	AvgFinalPrice int     `json:"avg_final_price"`
+}
+
+// Store marks active listings unseen since cutoff as sold. It only marks a
+// listing when another listing of the same make and model in the same zip
+// has been seen since cutoff, so a stalled producer or market sweep doesn't
+// sell off its whole inventory. Sold listings stay pending until their
+// ListingSold event is published.
+type Store interface {
+	MarkListingsSold(ctx context.Context, cutoff, now time.Time) ([]Sold, error)
+	PendingSoldListings(ctx context.Context, limit int) ([]Sold, error)
+	MarkSoldPublished(ctx context.Context, vin string, soldAt time.Time) error
+}
+
+type Publisher interface {
+	PublishListingSold(ctx context.Context, s Sold) error
+}
+
+// Tracker retires listings that sweeps have stopped returning.
+type Tracker struct {
+	store       Store
+	publisher   Publisher
+	delistAfter time.Duration
+}
+
+func NewTracker(store Store, publisher Publisher, delistAfter time.Duration) *Tracker {
+	return &Tracker{
+		store:       store,
+		publisher:   publisher,
+		delistAfter: delistAfter,
+	}
+}
+
+// publishBatch is how many sold listings RunOnce publishes per query.
+const publishBatch = 100
+
+// RunOnce marks stale listings sold and publishes every sold listing not yet
+// published, including ones whose publish failed on an earlier run,
+// returning how many were marked.
+func (t *Tracker) RunOnce(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	sold, err := t.store.MarkListingsSold(ctx, now.Add(-t.delistAfter), now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark sold listings: %w", err)
+	}
+
+	if t.publisher != nil {
+		if err := t.publishPending(ctx); err != nil {
+			return len(sold), err
+		}
+	}
+	return len(sold), nil
+}
+
+// publishPending publishes pending sold listings in order, stopping at the
+// first failure so they are retried on the next run.
+func (t *Tracker) publishPending(ctx context.Context) error {
+	for {
+		pending, err := t.store.PendingSoldListings(ctx, publishBatch)
+		if err != nil {
+			return fmt.Errorf("failed to load unpublished sold listings: %w", err)
+		}
+		for _, s := range pending {
+			if err := t.publisher.PublishListingSold(ctx, s); err != nil {
+				return fmt.Errorf("failed to publish sold listing %s: %w", s.VIN, err)
+			}
+			if err := t.store.MarkSoldPublished(ctx, s.VIN, s.SoldAt); err != nil {
+				return fmt.Errorf("failed to mark sold listing %s published: %w", s.VIN, err)
+			}
+		}
+		if len(pending) < publishBatch {
+			return nil
+		}
+	}
+}
+
+// Run checks immediately and then every interval until ctx is done.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := t.RunOnce(ctx)
+		if err != nil {
+			log.Printf("listing lifecycle check failed: %v", err)
+		} else {
+			log.Printf("listing lifecycle check: %d listings sold", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
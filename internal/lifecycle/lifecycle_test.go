@@ -0,0 +1,98 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	marked    []Sold
+	pending   []Sold
+	published map[string]bool
+}
+
+func (f *fakeStore) MarkListingsSold(ctx context.Context, cutoff, now time.Time) ([]Sold, error) {
+	marked := f.marked
+	f.pending = append(f.pending, marked...)
+	f.marked = nil
+	return marked, nil
+}
+
+func (f *fakeStore) PendingSoldListings(ctx context.Context, limit int) ([]Sold, error) {
+	var out []Sold
+	for _, s := range f.pending {
+		if !f.published[s.VIN] && len(out) < limit {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeStore) MarkSoldPublished(ctx context.Context, vin string, soldAt time.Time) error {
+	f.published[vin] = true
+	return nil
+}
+
+type fakePublisher struct {
+	fail bool
+	sent []string
+}
+
+func (p *fakePublisher) PublishListingSold(ctx context.Context, s Sold) error {
+	if p.fail {
+		return errors.New("broker down")
+	}
+	p.sent = append(p.sent, s.VIN)
+	return nil
+}
+
+func TestRunOnceRetriesFailedPublishes(t *testing.T) {
+	store := &fakeStore{
+		marked:    []Sold{{VIN: "A"}, {VIN: "B"}},
+		published: map[string]bool{},
+	}
+	pub := &fakePublisher{fail: true}
+	tracker := NewTracker(store, pub, 72*time.Hour)
+
+	n, err := tracker.RunOnce(context.Background())
+	if err == nil {
+		t.Fatal("RunOnce() with a failing publisher returned nil error")
+	}
+	if n != 2 {
+		t.Fatalf("RunOnce() marked %d, want 2", n)
+	}
+	if len(store.published) != 0 {
+		t.Fatalf("listings marked published after a failed publish: %v", store.published)
+	}
+
+	pub.fail = false
+	n, err = tracker.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce() = %v", err)
+	}
+	if n != 0 {
+		t.Fatalf("RunOnce() marked %d on the second run, want 0", n)
+	}
+	if len(pub.sent) != 2 || !store.published["A"] || !store.published["B"] {
+		t.Fatalf("second run sent %v, published %v; want both", pub.sent, store.published)
+	}
+}
+
+func TestDaysOnMarket(t *testing.T) {
+	first := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		soldAt time.Time
+		want   float64
+	}{
+		{first, 0},
+		{first.Add(36 * time.Hour), 1.5},
+		{first.Add(10*24*time.Hour + 2*time.Hour), 10.1},
+	}
+	for _, tt := range tests {
+		if got := DaysOnMarket(first, tt.soldAt); got != tt.want {
+			t.Errorf("DaysOnMarket(%v) = %v, want %v", tt.soldAt.Sub(first), got, tt.want)
+		}
+	}
+}
@@ -2,12 +2,9 @@ package marketcheck
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
-	"sort"
-	"strings"
 	"time"
 )
 
@@ -15,8 +12,22 @@ type Client struct {
 	apiKey  string
 	http    *http.Client
 	baseUrl string
+	retry   RetryPolicy
+	quota   QuotaGate
 }
 
+// QuotaGate is consulted before every billable MarketCheck call, including
+// retries.
+type QuotaGate interface {
+	Reserve(ctx context.Context, endpoint string) error
+}
+
+const (
+	EndpointSearch  = "search"
+	EndpointListing = "listing"
+	EndpointDecode  = "decode"
+)
+
 func NewClient(apiKey string) *Client {
 	return NewClientWithURL(apiKey, "")
 }
@@ -34,9 +45,14 @@ func NewClientWithURL(apiKey, baseUrl string) *Client {
 			Timeout: 10 * time.Second,
 		},
 		baseUrl: baseUrl,
+		retry:   DefaultRetryPolicy(),
 	}
 }
 
+func (c *Client) SetQuota(q QuotaGate) {
+	c.quota = q
+}
+
 func (c *Client) FetchListingByID(ctx context.Context, id string) (*Listing, error) {
 	listingEndpoint := fmt.Sprintf("%s/listing/car/%s", c.baseUrl, id)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listingEndpoint, nil)
@@ -48,18 +64,18 @@ func (c *Client) FetchListingByID(ctx context.Context, id string) (*Listing, err
 	q.Set("api_key", c.apiKey)
 	req.URL.RawQuery = q.Encode()
 
-	res, err := c.http.Do(req)
+	res, err := c.do(req, EndpointListing)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	if err := checkResponse(res, EndpointListing); err != nil {
+		return nil, err
 	}
 
 	var listing Listing
-	if err := json.NewDecoder(res.Body).Decode(&listing); err != nil {
+	if err := decodeResponse(res, EndpointListing, &listing); err != nil {
 		return nil, err
 	}
 
@@ -67,10 +83,19 @@ func (c *Client) FetchListingByID(ctx context.Context, id string) (*Listing, err
 }
 
 func (c *Client) FetchActiveListings(ctx context.Context, rows int) ([]Listing, error) {
-	return c.FetchActiveListingsWithFilters(ctx, rows, "", "", "", 0)
+	return c.FetchActiveListingsWithFilters(ctx, rows, SearchParams{})
+}
+
+func (c *Client) FetchActiveListingsWithFilters(ctx context.Context, rows int, params SearchParams) ([]Listing, error) {
+	return CollectListings(ctx, c, rows, params)
 }
 
-func (c *Client) FetchActiveListingsWithFilters(ctx context.Context, rows int, make, model, zip string, radius int) ([]Listing, error) {
+func (c *Client) FetchActiveListingsPage(ctx context.Context, start, rows int, params SearchParams) (*SearchPage, error) {
+	params = params.Normalize()
+	if err := params.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+
 	endpoint := fmt.Sprintf("%s/search/car/active", c.baseUrl)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
@@ -79,39 +104,28 @@ func (c *Client) FetchActiveListingsWithFilters(ctx context.Context, rows int, m
 
 	q := req.URL.Query()
 	q.Set("api_key", c.apiKey)
+	q.Set("start", fmt.Sprintf("%d", start))
 	q.Set("rows", fmt.Sprintf("%d", rows))
-	if make != "" {
-		q.Set("make", make)
-	}
-	if model != "" {
-		q.Set("model", model)
-	}
-	if zip != "" {
-		q.Set("zip", zip)
-	}
-	if radius > 0 {
-		q.Set("radius", fmt.Sprintf("%d", radius))
-	}
+	params.Encode(q)
 	req.URL.RawQuery = q.Encode()
 
-	res, err := c.http.Do(req)
+	res, err := c.do(req, EndpointSearch)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	if err := checkResponse(res, EndpointSearch); err != nil {
+		return nil, err
 	}
 
-	var listings struct {
-		Listings []Listing `json:"listings"`
-	}
-	if err := json.NewDecoder(res.Body).Decode(&listings); err != nil {
+	var page SearchPage
+	if err := decodeResponse(res, EndpointSearch, &page); err != nil {
 		return nil, err
 	}
+	page.Start = start
 
-	return listings.Listings, nil
+	return &page, nil
 }
 
 func (c *Client) FetchBuild(ctx context.Context, vin string) (*Build, error) {
@@ -126,74 +140,20 @@ func (c *Client) FetchBuild(ctx context.Context, vin string) (*Build, error) {
 	q.Set("api_key", c.apiKey)
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req, EndpointDecode)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	if err := checkResponse(resp, EndpointDecode); err != nil {
+		return nil, err
 	}
 
 	var build Build
-	if err := json.NewDecoder(resp.Body).Decode(&build); err != nil {
+	if err := decodeResponse(resp, EndpointDecode, &build); err != nil {
 		return nil, err
 	}
 
 	return &build, nil
 }
-
-func (c *Client) FetchModelsForMake(ctx context.Context, makeParam string) ([]string, error) {
-	makeParam = strings.TrimSpace(makeParam)
-	if makeParam == "" {
-		return nil, fmt.Errorf("make parameter cannot be empty")
-	}
-
-	nhtsaURL := fmt.Sprintf("https://vpic.nhtsa.dot.gov/api/vehicles/GetModelsForMake/%s?format=json", makeParam)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, nhtsaURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := c.http.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %s from NHTSA API", res.Status)
-	}
-
-	var response struct {
-		Count   int    `json:"Count"`
-		Message string `json:"Message"`
-		Results []struct {
-			MakeID    int    `json:"Make_ID"`
-			MakeName  string `json:"Make_Name"`
-			ModelID   int    `json:"Model_ID"`
-			ModelName string `json:"Model_Name"`
-		} `json:"Results"`
-	}
-
-	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode NHTSA API response: %w", err)
-	}
-
-	if response.Count == 0 {
-		return nil, fmt.Errorf("no models found for make: %s", makeParam)
-	}
-
-	models := make([]string, 0, len(response.Results))
-	modelSet := make(map[string]bool)
-	for _, result := range response.Results {
-		if result.ModelName != "" && !modelSet[result.ModelName] {
-			models = append(models, result.ModelName)
-			modelSet[result.ModelName] = true
-		}
-	}
-	sort.Strings(models)
-
-	return models, nil
-}
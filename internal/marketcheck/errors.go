@@ -0,0 +1,106 @@
+package marketcheck
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound       = errors.New("marketcheck: not found")
+	ErrUnauthorized   = errors.New("marketcheck: unauthorized")
+	ErrRateLimited    = errors.New("marketcheck: rate limited")
+	ErrInvalidRequest = errors.New("marketcheck: invalid request")
+	ErrUpstream       = errors.New("marketcheck: upstream error")
+	ErrDecode         = errors.New("marketcheck: undecodable response")
+)
+
+const maxSnippetBytes = 512
+
+// StatusError is returned for any non-2xx response. It matches one of the
+// sentinel errors above via errors.Is; RetryAfter is only set for 429s.
+type StatusError struct {
+	Endpoint   string
+	StatusCode int
+	Status     string
+	Body       string
+	RetryAfter time.Duration
+	kind       error
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("%s: unexpected status %s", e.Endpoint, e.Status)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.kind
+}
+
+type DecodeError struct {
+	Endpoint string
+	Snippet  string
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: failed to decode response: %v (body: %q)", e.Endpoint, e.Err, e.Snippet)
+}
+
+func (e *DecodeError) Unwrap() []error {
+	return []error{ErrDecode, e.Err}
+}
+
+func classifyStatus(code int) error {
+	switch {
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrUnauthorized
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity:
+		return ErrInvalidRequest
+	}
+	return ErrUpstream
+}
+
+func checkResponse(res *http.Response, endpoint string) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxSnippetBytes))
+	statusErr := &StatusError{
+		Endpoint:   endpoint,
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Body:       strings.TrimSpace(string(body)),
+		kind:       classifyStatus(res.StatusCode),
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		statusErr.RetryAfter = ParseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	}
+	return statusErr
+}
+
+func decodeResponse(res *http.Response, endpoint string, v any) error {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("%s: failed to read response: %w", endpoint, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		snippet := body
+		if len(snippet) > maxSnippetBytes {
+			snippet = snippet[:maxSnippetBytes]
+		}
+		return &DecodeError{Endpoint: endpoint, Snippet: string(snippet), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package marketcheck
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ModeLive   = "live"
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// fixture is one recorded request/response pair. The api_key query
+// parameter is never written to disk.
+type fixture struct {
+	Method string            `json:"method"`
+	URL    string            `json:"url"`
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   string            `json:"body"`
+}
+
+var fixtureHeaders = []string{"Content-Type", "Retry-After"}
+
+// NewFixtureTransport returns the RoundTripper for mode, or nil for live
+// traffic.
+func NewFixtureTransport(mode, dir string) (http.RoundTripper, error) {
+	switch mode {
+	case "", ModeLive:
+		return nil, nil
+	case ModeRecord:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create fixtures dir: %w", err)
+		}
+		return &RecordingTransport{Dir: dir}, nil
+	case ModeReplay:
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("fixtures dir: %w", err)
+		}
+		return &ReplayTransport{Dir: dir}, nil
+	}
+	return nil, fmt.Errorf("unknown marketcheck mode %q", mode)
+}
+
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.http.Transport = rt
+}
+
+// scrubbedURL drops api_key and re-encodes the query so parameter order
+// doesn't affect the fixture key.
+func scrubbedURL(req *http.Request) string {
+	q := req.URL.Query()
+	q.Del("api_key")
+	u := req.URL.Path
+	if encoded := q.Encode(); encoded != "" {
+		u += "?" + encoded
+	}
+	return u
+}
+
+func fixtureName(req *http.Request) string {
+	u := scrubbedURL(req)
+	sum := sha256.Sum256([]byte(req.Method + " " + u))
+	slug := strings.Trim(strings.NewReplacer("/", "_", ".", "_").Replace(req.URL.Path), "_")
+	if len(slug) > 60 {
+		slug = slug[:60]
+	}
+	return fmt.Sprintf("%s-%s.json", slug, hex.EncodeToString(sum[:8]))
+}
+
+type RecordingTransport struct {
+	Dir  string
+	Next http.RoundTripper
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	res, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	f := fixture{
+		Method: req.Method,
+		URL:    scrubbedURL(req),
+		Status: res.StatusCode,
+		Header: make(map[string]string),
+		Body:   string(body),
+	}
+	for _, h := range fixtureHeaders {
+		if v := res.Header.Get(h); v != "" {
+			f.Header[h] = v
+		}
+	}
+	if err := writeFixture(filepath.Join(t.Dir, fixtureName(req)), f); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func writeFixture(path string, f fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fixture-*")
+	if err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReplayTransport serves recorded fixtures. A request with no fixture gets a
+// 404 naming the missing file rather than a transport error, so it isn't
+// retried.
+type ReplayTransport struct {
+	Dir string
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	name := fixtureName(req)
+	data, err := os.ReadFile(filepath.Join(t.Dir, name))
+	if os.IsNotExist(err) {
+		return replayResponse(req, fixture{
+			Status: http.StatusNotFound,
+			Header: map[string]string{"X-Fixture-Missing": name},
+			Body:   fmt.Sprintf("no fixture %s for %s %s", name, req.Method, scrubbedURL(req)),
+		}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", name, err)
+	}
+	return replayResponse(req, f), nil
+}
+
+func replayResponse(req *http.Request, f fixture) *http.Response {
+	header := make(http.Header)
+	for k, v := range f.Header {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(f.Body)),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}
+}
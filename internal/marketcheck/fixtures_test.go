@@ -0,0 +1,181 @@
+package marketcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const secretKey = "sk-do-not-record"
+
+// recordThenReplay records a client's calls against a server, then replays
+// them against a client with a different key and no server.
+func recordThenReplay(t *testing.T, call func(c *Client) (any, error)) (recorded, replayed any, dir string) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Query().Get("api_key") != secretKey {
+			t.Errorf("server got api_key %q", r.URL.Query().Get("api_key"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/listing/car/"):
+			w.Write([]byte(`{"id":"abc","vin":"1HGCM82633A004352","price":18500}`))
+		case r.URL.Path == "/search/car/active":
+			w.Write([]byte(`{"num_found":1,"listings":[{"id":"abc","vin":"1HGCM82633A004352","price":18500}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir = t.TempDir()
+	rec, err := NewFixtureTransport(ModeRecord, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClientWithURL(secretKey, srv.URL)
+	c.SetTransport(rec)
+	if recorded, err = call(c); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	made := calls.Load()
+
+	replay, err := NewFixtureTransport(ModeReplay, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = NewClientWithURL("another-key", srv.URL)
+	c.SetTransport(replay)
+	if replayed, err = call(c); err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	if calls.Load() != made {
+		t.Errorf("replay reached the server")
+	}
+	return recorded, replayed, dir
+}
+
+func TestFixturesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(c *Client) (any, error)
+	}{
+		{"listing", func(c *Client) (any, error) {
+			l, err := c.FetchListingByID(context.Background(), "abc")
+			if err != nil {
+				return nil, err
+			}
+			return l.Price, nil
+		}},
+		{"search", func(c *Client) (any, error) {
+			p, err := c.FetchActiveListingsPage(context.Background(), 0, 10, SearchParams{Make: "honda", Model: "accord"})
+			if err != nil {
+				return nil, err
+			}
+			return len(p.Listings), nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded, replayed, dir := recordThenReplay(t, tt.call)
+			if recorded != replayed {
+				t.Errorf("replayed %v, recorded %v", replayed, recorded)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("recorded %d files, want 1", len(entries))
+			}
+			for _, e := range entries {
+				if strings.Contains(e.Name(), secretKey) {
+					t.Errorf("fixture name %q contains the API key", e.Name())
+				}
+				data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.Contains(string(data), secretKey) || strings.Contains(string(data), "api_key") {
+					t.Errorf("fixture %s contains the API key:\n%s", e.Name(), data)
+				}
+			}
+		})
+	}
+}
+
+func TestFixtureNameIgnoresKeyAndQueryOrder(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"/search/car/active?make=honda&api_key=one", "/search/car/active?api_key=two&make=honda", true},
+		{"/search/car/active?make=honda&model=accord", "/search/car/active?model=accord&make=honda", true},
+		{"/search/car/active?make=honda", "/search/car/active?make=ford", false},
+		{"/listing/car/abc", "/listing/car/abd", false},
+	}
+	for _, tt := range tests {
+		a := httptest.NewRequest(http.MethodGet, tt.a, nil)
+		b := httptest.NewRequest(http.MethodGet, tt.b, nil)
+		if got := fixtureName(a) == fixtureName(b); got != tt.same {
+			t.Errorf("fixtureName(%q) == fixtureName(%q) is %v, want %v", tt.a, tt.b, got, tt.same)
+		}
+		if strings.Contains(scrubbedURL(a), "api_key") {
+			t.Errorf("scrubbedURL(%q) = %q keeps api_key", tt.a, scrubbedURL(a))
+		}
+	}
+}
+
+func TestReplayMissIsNotRetried(t *testing.T) {
+	replay, err := NewFixtureTransport(ModeReplay, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClientWithURL("key", "http://marketcheck.invalid")
+	c.SetTransport(replay)
+
+	_, err = c.FetchListingByID(context.Background(), "missing")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("err = %v, want a 404 StatusError", err)
+	}
+	if !strings.Contains(statusErr.Body, "no fixture") {
+		t.Errorf("body = %q, want it to name the missing fixture", statusErr.Body)
+	}
+}
+
+func TestNewFixtureTransport(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		mode    string
+		dir     string
+		wantNil bool
+		wantErr bool
+	}{
+		{"", dir, true, false},
+		{ModeLive, dir, true, false},
+		{ModeRecord, filepath.Join(dir, "new"), false, false},
+		{ModeReplay, dir, false, false},
+		{ModeReplay, filepath.Join(dir, "absent"), false, true},
+		{"playback", dir, false, true},
+	}
+	for _, tt := range tests {
+		rt, err := NewFixtureTransport(tt.mode, tt.dir)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewFixtureTransport(%q) error = %v, want error %v", tt.mode, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (rt == nil) != tt.wantNil {
+			t.Errorf("NewFixtureTransport(%q) = %v, want nil %v", tt.mode, rt, tt.wantNil)
+		}
+	}
+}
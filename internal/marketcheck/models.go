@@ -8,24 +8,51 @@ import (
 type PricePoint struct {
 	Price int       `json:"price"`
 	Date  time.Time `json:"date"`
+	// Miles is the odometer reading the price was asked at, 0 if unknown.
+	// It is stored with the price for depreciation fitting and isn't part
+	// of listings sent or served.
+	Miles int `json:"-"`
 }
 
+// UnmarshalJSON reads dates as Unix seconds, as MarketCheck sends them, or
+// as the RFC 3339 strings PricePoint marshals to.
 func (p *PricePoint) UnmarshalJSON(data []byte) error {
 	var tmp struct {
-		Price int   `json:"price"`
-		Date  int64 `json:"date"`
+		Price int             `json:"price"`
+		Date  json.RawMessage `json:"date"`
 	}
 	if err := json.Unmarshal(data, &tmp); err != nil {
 		return err
 	}
 	p.Price = tmp.Price
-	p.Date = time.Unix(tmp.Date, 0)
+	p.Date = time.Time{}
+	if len(tmp.Date) == 0 || string(tmp.Date) == "null" {
+		return nil
+	}
+	if tmp.Date[0] == '"' {
+		return json.Unmarshal(tmp.Date, &p.Date)
+	}
+	var unix int64
+	if err := json.Unmarshal(tmp.Date, &unix); err != nil {
+		return err
+	}
+	p.Date = time.Unix(unix, 0)
 	return nil
 }
 
+// Valuation compares a listing's price with the market. Score is the
+// fraction below the expected price (negative when above it). The remaining
+// fields are set by the comparables engine in internal/valuation.
 type Valuation struct {
-	IsGoodValue bool    `json:"is_good_value"`
-	Score       float64 `json:"score"`
+	IsGoodValue   bool    `json:"is_good_value"`
+	Score         float64 `json:"score"`
+	ExpectedPrice int     `json:"expected_price,omitempty"`
+	PriceLow      int     `json:"price_low,omitempty"`
+	PriceHigh     int     `json:"price_high,omitempty"`
+	Percentile    float64 `json:"percentile,omitempty"`
+	DealRating    string  `json:"deal_rating,omitempty"`
+	Comparables   int     `json:"comparables,omitempty"`
+	Method        string  `json:"method,omitempty"`
 }
 
 type Listing struct {
@@ -163,9 +190,36 @@ type Build struct {
 	PowertrainType string `json:"powertrain_type"`
 }
 
+// Recall is an NHTSA recall campaign for the listing's model year.
+type Recall struct {
+	Campaign    string    `json:"campaign"`
+	Component   string    `json:"component"`
+	Summary     string    `json:"summary"`
+	Consequence string    `json:"consequence"`
+	Remedy      string    `json:"remedy"`
+	ReportDate  time.Time `json:"report_date"`
+	ParkIt      bool      `json:"park_it"`
+	ParkOutside bool      `json:"park_outside"`
+	OverTheAir  bool      `json:"over_the_air"`
+}
+
+// Safety summarizes NHTSA recalls and owner complaints for a make, model and
+// model year.
+type Safety struct {
+	Recalls        []Recall  `json:"recalls"`
+	RecallCount    int       `json:"recall_count"`
+	ComplaintCount int       `json:"complaint_count"`
+	CrashCount     int       `json:"crash_count"`
+	FireCount      int       `json:"fire_count"`
+	InjuryCount    int       `json:"injury_count"`
+	DeathCount     int       `json:"death_count"`
+	FetchedAt      time.Time `json:"fetched_at"`
+}
+
 type EnrichedListing struct {
 	Listing      Listing      `json:"listing"`
 	Build        Build        `json:"build"`
 	PriceHistory []PricePoint `json:"price_history"`
 	Valuation    Valuation    `json:"valuation"`
+	Safety       *Safety      `json:"safety,omitempty"`
 }
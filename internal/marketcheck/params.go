@@ -0,0 +1,265 @@
+package marketcheck
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SearchParams struct {
+	Make       string `json:"make,omitempty"`
+	Model      string `json:"model,omitempty"`
+	Trim       string `json:"trim,omitempty"`
+	Zip        string `json:"zip,omitempty"`
+	Radius     int    `json:"radius,omitempty"`
+	YearMin    int    `json:"year_min,omitempty"`
+	YearMax    int    `json:"year_max,omitempty"`
+	PriceMin   int    `json:"price_min,omitempty"`
+	PriceMax   int    `json:"price_max,omitempty"`
+	MilesMin   int    `json:"miles_min,omitempty"`
+	MilesMax   int    `json:"miles_max,omitempty"`
+	BodyType   string `json:"body_type,omitempty"`
+	Drivetrain string `json:"drivetrain,omitempty"`
+	FuelType   string `json:"fuel_type,omitempty"`
+	SellerType string `json:"seller_type,omitempty"`
+	CarType    string `json:"car_type,omitempty"`
+	SortBy     string `json:"sort_by,omitempty"`
+	SortOrder  string `json:"sort_order,omitempty"`
+}
+
+var (
+	validSellerTypes = map[string]bool{"dealer": true, "private": true}
+	validCarTypes    = map[string]bool{"new": true, "used": true, "certified": true}
+	validDrivetrains = map[string]bool{"4WD": true, "AWD": true, "FWD": true, "RWD": true}
+	validSortFields  = map[string]bool{"price": true, "miles": true, "year": true, "dom": true, "dist": true}
+	validSortOrders  = map[string]bool{"asc": true, "desc": true}
+)
+
+// Normalize trims every string facet and lower/upper-cases the enumerated
+// ones so that equivalent requests encode identically.
+func (p SearchParams) Normalize() SearchParams {
+	p.Make = strings.TrimSpace(p.Make)
+	p.Model = strings.TrimSpace(p.Model)
+	p.Trim = strings.TrimSpace(p.Trim)
+	p.Zip = strings.TrimSpace(p.Zip)
+	p.BodyType = strings.TrimSpace(p.BodyType)
+	p.FuelType = strings.TrimSpace(p.FuelType)
+	p.Drivetrain = strings.ToUpper(strings.TrimSpace(p.Drivetrain))
+	p.SellerType = strings.ToLower(strings.TrimSpace(p.SellerType))
+	p.CarType = strings.ToLower(strings.TrimSpace(p.CarType))
+	p.SortBy = strings.ToLower(strings.TrimSpace(p.SortBy))
+	p.SortOrder = strings.ToLower(strings.TrimSpace(p.SortOrder))
+	return p
+}
+
+func (p SearchParams) Validate() error {
+	maxYear := time.Now().Year() + 2
+
+	if p.Radius < 0 {
+		return fmt.Errorf("radius must not be negative")
+	}
+	if p.Radius > 0 && p.Zip == "" {
+		return fmt.Errorf("radius requires a zip")
+	}
+	if p.Zip != "" {
+		if _, err := strconv.Atoi(p.Zip); err != nil || len(p.Zip) != 5 {
+			return fmt.Errorf("invalid zip %q", p.Zip)
+		}
+	}
+	if err := validateRange("year", p.YearMin, p.YearMax); err != nil {
+		return err
+	}
+	if (p.YearMin != 0 && p.YearMin < 1900) || p.YearMin > maxYear || (p.YearMax != 0 && p.YearMax < 1900) || p.YearMax > maxYear {
+		return fmt.Errorf("year range must be between 1900 and %d", maxYear)
+	}
+	if err := validateRange("price", p.PriceMin, p.PriceMax); err != nil {
+		return err
+	}
+	if err := validateRange("miles", p.MilesMin, p.MilesMax); err != nil {
+		return err
+	}
+	if p.Drivetrain != "" && !validDrivetrains[p.Drivetrain] {
+		return fmt.Errorf("invalid drivetrain %q", p.Drivetrain)
+	}
+	if p.SellerType != "" && !validSellerTypes[p.SellerType] {
+		return fmt.Errorf("invalid seller_type %q", p.SellerType)
+	}
+	if p.CarType != "" && !validCarTypes[p.CarType] {
+		return fmt.Errorf("invalid car_type %q", p.CarType)
+	}
+	if p.SortBy != "" && !validSortFields[p.SortBy] {
+		return fmt.Errorf("invalid sort_by %q", p.SortBy)
+	}
+	if p.SortOrder != "" && !validSortOrders[p.SortOrder] {
+		return fmt.Errorf("invalid sort_order %q", p.SortOrder)
+	}
+	if p.SortOrder != "" && p.SortBy == "" {
+		return fmt.Errorf("sort_order requires sort_by")
+	}
+	return nil
+}
+
+func validateRange(name string, lo, hi int) error {
+	if lo < 0 || hi < 0 {
+		return fmt.Errorf("%s range must not be negative", name)
+	}
+	if hi > 0 && lo > hi {
+		return fmt.Errorf("%s min %d is greater than max %d", name, lo, hi)
+	}
+	return nil
+}
+
+// Encode writes the set facets onto q using MarketCheck's query parameter
+// names. Open-ended ranges are closed with 0 or the given ceiling since
+// MarketCheck expects both bounds, e.g. year_range=2019-2027.
+func (p SearchParams) Encode(q url.Values) {
+	setString := func(key, val string) {
+		if val != "" {
+			q.Set(key, val)
+		}
+	}
+	setRange := func(key string, lo, hi, ceiling int) {
+		if lo == 0 && hi == 0 {
+			return
+		}
+		if hi == 0 {
+			hi = ceiling
+		}
+		q.Set(key, fmt.Sprintf("%d-%d", lo, hi))
+	}
+
+	setString("make", p.Make)
+	setString("model", p.Model)
+	setString("trim", p.Trim)
+	setString("zip", p.Zip)
+	if p.Radius > 0 {
+		q.Set("radius", strconv.Itoa(p.Radius))
+	}
+	setRange("year_range", p.YearMin, p.YearMax, time.Now().Year()+2)
+	setRange("price_range", p.PriceMin, p.PriceMax, 10000000)
+	setRange("miles_range", p.MilesMin, p.MilesMax, 1000000)
+	setString("body_type", p.BodyType)
+	setString("drivetrain", p.Drivetrain)
+	setString("fuel_type", p.FuelType)
+	setString("seller_type", p.SellerType)
+	setString("car_type", p.CarType)
+	setString("sort_by", p.SortBy)
+	setString("sort_order", p.SortOrder)
+}
+
+// DecodeSearchParams is the inverse of Encode, for servers that accept
+// MarketCheck-style queries.
+func DecodeSearchParams(q url.Values) (SearchParams, error) {
+	p := SearchParams{
+		Make:       q.Get("make"),
+		Model:      q.Get("model"),
+		Trim:       q.Get("trim"),
+		Zip:        q.Get("zip"),
+		BodyType:   q.Get("body_type"),
+		Drivetrain: q.Get("drivetrain"),
+		FuelType:   q.Get("fuel_type"),
+		SellerType: q.Get("seller_type"),
+		CarType:    q.Get("car_type"),
+		SortBy:     q.Get("sort_by"),
+		SortOrder:  q.Get("sort_order"),
+	}
+	var err error
+	if v := q.Get("radius"); v != "" {
+		if p.Radius, err = strconv.Atoi(v); err != nil {
+			return p, fmt.Errorf("invalid radius %q", v)
+		}
+	}
+	if p.YearMin, p.YearMax, err = decodeRange(q.Get("year_range")); err != nil {
+		return p, fmt.Errorf("invalid year_range: %w", err)
+	}
+	if p.PriceMin, p.PriceMax, err = decodeRange(q.Get("price_range")); err != nil {
+		return p, fmt.Errorf("invalid price_range: %w", err)
+	}
+	if p.MilesMin, p.MilesMax, err = decodeRange(q.Get("miles_range")); err != nil {
+		return p, fmt.Errorf("invalid miles_range: %w", err)
+	}
+	return p.Normalize(), nil
+}
+
+func decodeRange(v string) (int, int, error) {
+	if v == "" {
+		return 0, 0, nil
+	}
+	loStr, hiStr, ok := strings.Cut(v, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not lo-hi", v)
+	}
+	var lo, hi int
+	var err error
+	if loStr != "" {
+		if lo, err = strconv.Atoi(loStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	if hiStr != "" {
+		if hi, err = strconv.Atoi(hiStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	return lo, hi, nil
+}
+
+// Matches applies every facet except zip/radius to l, for sources that
+// filter locally.
+func (p SearchParams) Matches(l Listing) bool {
+	b := l.Build
+	if !equalFold(p.Make, b.Make) || !equalFold(p.Model, b.Model) || !equalFold(p.Trim, b.Trim) {
+		return false
+	}
+	if !equalFold(p.BodyType, b.BodyType) || !equalFold(p.Drivetrain, b.Drivetrain) || !equalFold(p.FuelType, b.FuelType) {
+		return false
+	}
+	if !equalFold(p.SellerType, l.SellerType) || !equalFold(p.CarType, l.InventoryType) {
+		return false
+	}
+	return inRange(b.Year, p.YearMin, p.YearMax) &&
+		inRange(l.Price, p.PriceMin, p.PriceMax) &&
+		inRange(l.Miles, p.MilesMin, p.MilesMax)
+}
+
+func equalFold(want, got string) bool {
+	return want == "" || strings.EqualFold(want, strings.TrimSpace(got))
+}
+
+func inRange(v, lo, hi int) bool {
+	if lo > 0 && v < lo {
+		return false
+	}
+	if hi > 0 && v > hi {
+		return false
+	}
+	return true
+}
+
+// Sort orders listings in place by the params' sort facet. Distance sorting
+// is left to the caller.
+func (p SearchParams) Sort(listings []Listing) {
+	var key func(Listing) int
+	switch p.SortBy {
+	case "price":
+		key = func(l Listing) int { return l.Price }
+	case "miles":
+		key = func(l Listing) int { return l.Miles }
+	case "year":
+		key = func(l Listing) int { return l.Build.Year }
+	case "dom":
+		key = func(l Listing) int { return l.DOM }
+	default:
+		return
+	}
+	desc := p.SortOrder == "desc"
+	sort.SliceStable(listings, func(i, j int) bool {
+		if desc {
+			return key(listings[i]) > key(listings[j])
+		}
+		return key(listings[i]) < key(listings[j])
+	})
+}
@@ -0,0 +1,183 @@
+package marketcheck
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides whether a request should be attempted again. attempt is
+// the number of attempts already made; res is nil when err is a transport
+// error.
+type RetryPolicy interface {
+	Retry(req *http.Request, res *http.Response, err error, attempt int) (time.Duration, bool)
+}
+
+type BackoffPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter is the fraction of each delay that is randomised, 0 to 1.
+	Jitter float64
+	// RetryableStatus classifies upstream status codes. Nil uses
+	// IsRetryableStatus.
+	RetryableStatus func(code int) bool
+	// RetryNonIdempotent allows retrying POST/PATCH after a response other
+	// than 429, which MarketCheck sends before doing any work.
+	RetryNonIdempotent bool
+}
+
+func DefaultRetryPolicy() *BackoffPolicy {
+	return &BackoffPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.5,
+	}
+}
+
+type noRetry struct{}
+
+func (noRetry) Retry(*http.Request, *http.Response, error, int) (time.Duration, bool) {
+	return 0, false
+}
+
+var NoRetry RetryPolicy = noRetry{}
+
+func IsRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func (p *BackoffPolicy) Retry(req *http.Request, res *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if req.Context().Err() != nil {
+		return 0, false
+	}
+
+	retryAfter := time.Duration(0)
+	if res != nil {
+		classify := p.RetryableStatus
+		if classify == nil {
+			classify = IsRetryableStatus
+		}
+		if !classify(res.StatusCode) {
+			return 0, false
+		}
+		if !isIdempotent(req.Method) && !p.RetryNonIdempotent && res.StatusCode != http.StatusTooManyRequests {
+			return 0, false
+		}
+		retryAfter = ParseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	} else if err != nil && !isIdempotent(req.Method) && !p.RetryNonIdempotent {
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+	if retryAfter > 0 {
+		if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+			return 0, false
+		}
+		delay = max(delay, retryAfter)
+	}
+	return delay, true
+}
+
+func (p *BackoffPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d = d*(1-p.Jitter) + d*p.Jitter*rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// ParseRetryAfter accepts either delta-seconds or an HTTP date and returns
+// zero when the header is absent or unparseable.
+func ParseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (c *Client) SetRetryPolicy(p RetryPolicy) {
+	if p == nil {
+		p = NoRetry
+	}
+	c.retry = p
+}
+
+func (c *Client) do(req *http.Request, endpoint string) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if c.quota != nil && endpoint != "" {
+			if err := c.quota.Reserve(req.Context(), endpoint); err != nil {
+				return nil, err
+			}
+		}
+		res, err := c.http.Do(req)
+		if err == nil && res.StatusCode < 300 {
+			return res, nil
+		}
+		delay, retry := c.retry.Retry(req, res, err, attempt)
+		if !retry {
+			return res, err
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
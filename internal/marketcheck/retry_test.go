@@ -0,0 +1,173 @@
+package marketcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer answers with statuses in turn, then 200 with a listing.
+func flakyServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(statuses) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte(`{"id":"abc","vin":"1HGCM82633A004352"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func testClient(url string, p *BackoffPolicy) *Client {
+	c := NewClientWithURL("key", url)
+	c.SetRetryPolicy(p)
+	return c
+}
+
+func fastPolicy() *BackoffPolicy {
+	return &BackoffPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Second}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	srv, calls := flakyServer(t, "1", http.StatusTooManyRequests)
+	c := testClient(srv.URL, fastPolicy())
+
+	start := time.Now()
+	if _, err := c.FetchListingByID(context.Background(), "abc"); err != nil {
+		t.Fatalf("FetchListingByID: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("calls = %d, want 2", calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %v, want at least the 1s Retry-After", elapsed)
+	}
+}
+
+func TestRetryAfterBeyondMaxDelayGivesUp(t *testing.T) {
+	srv, calls := flakyServer(t, "120", http.StatusTooManyRequests)
+	c := testClient(srv.URL, fastPolicy())
+
+	_, err := c.FetchListingByID(context.Background(), "abc")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || !errors.Is(err, ErrRateLimited) || statusErr.RetryAfter != 120*time.Second {
+		t.Fatalf("FetchListingByID = %v, want a rate-limited StatusError carrying Retry-After", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestRetryBacksOffOn5xx(t *testing.T) {
+	srv, calls := flakyServer(t, "", http.StatusServiceUnavailable, http.StatusBadGateway)
+	c := testClient(srv.URL, fastPolicy())
+
+	if _, err := c.FetchListingByID(context.Background(), "abc"); err != nil {
+		t.Fatalf("FetchListingByID: %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("calls = %d, want 3", calls.Load())
+	}
+}
+
+func TestRetryStopsAtMaxAttempts(t *testing.T) {
+	srv, calls := flakyServer(t, "", 500, 500, 500, 500, 500)
+	c := testClient(srv.URL, fastPolicy())
+
+	_, err := c.FetchListingByID(context.Background(), "abc")
+	if !errors.Is(err, ErrUpstream) {
+		t.Fatalf("FetchListingByID = %v, want ErrUpstream", err)
+	}
+	if calls.Load() != 4 {
+		t.Fatalf("calls = %d, want MaxAttempts (4)", calls.Load())
+	}
+}
+
+func TestNoRetryOn4xx(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusBadRequest, ErrInvalidRequest},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusUnprocessableEntity, ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv, calls := flakyServer(t, "", tt.status)
+			c := testClient(srv.URL, fastPolicy())
+
+			if _, err := c.FetchListingByID(context.Background(), "abc"); !errors.Is(err, tt.want) {
+				t.Fatalf("FetchListingByID = %v, want %v", err, tt.want)
+			}
+			if calls.Load() != 1 {
+				t.Fatalf("calls = %d, want 1", calls.Load())
+			}
+		})
+	}
+}
+
+func TestRetryGivesUpWhenContextIsCancelled(t *testing.T) {
+	srv, calls := flakyServer(t, "", 503, 503, 503, 503)
+	c := testClient(srv.URL, &BackoffPolicy{MaxAttempts: 4, BaseDelay: 10 * time.Second, MaxDelay: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.FetchListingByID(ctx, "abc")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("FetchListingByID = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("gave up after %v, want promptly after cancellation", elapsed)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestRetryPOSTOnlyOn429(t *testing.T) {
+	p := fastPolicy()
+	post := httptest.NewRequest(http.MethodPost, "/", nil)
+	if _, ok := p.Retry(post, &http.Response{StatusCode: 503, Header: http.Header{}}, nil, 1); ok {
+		t.Error("retried a POST after 503")
+	}
+	if _, ok := p.Retry(post, &http.Response{StatusCode: 429, Header: http.Header{}}, nil, 1); !ok {
+		t.Error("didn't retry a POST after 429")
+	}
+	if _, ok := p.Retry(post, nil, errors.New("connection reset"), 1); ok {
+		t.Error("retried a POST after a transport error")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{"-3", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := ParseRetryAfter(tt.v, now); got != tt.want {
+			t.Errorf("ParseRetryAfter(%q) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package marketcheck
+
+import (
+	"context"
+	"fmt"
+)
+
+// MarketCheck caps rows at 50 per search request.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 50
+)
+
+type SearchPage struct {
+	Listings []Listing `json:"listings"`
+	NumFound int       `json:"num_found"`
+	Start    int       `json:"-"`
+}
+
+// PageOptions controls how a SearchIterator walks the result set. Zero values
+// mean the default page size, no page cap and no listing cap.
+type PageOptions struct {
+	PageSize int
+	MaxPages int
+	Limit    int
+	Start    int
+}
+
+type SearchIterator struct {
+	source PageFetcher
+	params SearchParams
+	opts   PageOptions
+
+	start    int
+	pages    int
+	fetched  int
+	numFound int
+	page     *SearchPage
+	done     bool
+	err      error
+}
+
+func (c *Client) NewSearchIterator(params SearchParams, opts PageOptions) *SearchIterator {
+	return NewSearchIterator(c, params, opts)
+}
+
+func NewSearchIterator(source PageFetcher, params SearchParams, opts PageOptions) *SearchIterator {
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultPageSize
+	}
+	if opts.PageSize > MaxPageSize {
+		opts.PageSize = MaxPageSize
+	}
+	if opts.Start < 0 {
+		opts.Start = 0
+	}
+	return &SearchIterator{
+		source: source,
+		params: params,
+		opts:   opts,
+		start:  opts.Start,
+	}
+}
+
+// Next fetches the next page and reports whether one is available. It stops
+// once num_found is exhausted, a short page comes back, a cap is reached, or
+// ctx is cancelled.
+func (it *SearchIterator) Next(ctx context.Context) bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+	if it.opts.MaxPages > 0 && it.pages >= it.opts.MaxPages {
+		it.done = true
+		return false
+	}
+	if it.pages > 0 && it.start >= it.numFound {
+		it.done = true
+		return false
+	}
+
+	rows := it.opts.PageSize
+	if it.opts.Limit > 0 {
+		remaining := it.opts.Limit - it.fetched
+		if remaining <= 0 {
+			it.done = true
+			return false
+		}
+		rows = min(rows, remaining)
+	}
+
+	page, err := it.source.FetchActiveListingsPage(ctx, it.start, rows, it.params)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.pages++
+	it.numFound = page.NumFound
+	it.page = page
+	if len(page.Listings) == 0 {
+		it.done = true
+		return false
+	}
+	if len(page.Listings) < rows {
+		it.done = true
+	}
+
+	it.start += len(page.Listings)
+	it.fetched += len(page.Listings)
+	return true
+}
+
+func (it *SearchIterator) Page() *SearchPage {
+	return it.page
+}
+
+func (it *SearchIterator) NumFound() int {
+	return it.numFound
+}
+
+func (it *SearchIterator) Pages() int {
+	return it.pages
+}
+
+func (it *SearchIterator) Err() error {
+	return it.err
+}
+
+// CollectListings drains up to rows listings from source. rows must be
+// positive: draining a whole result set costs a call per page.
+func CollectListings(ctx context.Context, source PageFetcher, rows int, params SearchParams) ([]Listing, error) {
+	if rows <= 0 {
+		return nil, fmt.Errorf("%w: rows must be positive, got %d", ErrInvalidRequest, rows)
+	}
+	it := NewSearchIterator(source, params, PageOptions{
+		PageSize: min(rows, MaxPageSize),
+		Limit:    rows,
+	})
+
+	var listings []Listing
+	for it.Next(ctx) {
+		listings = append(listings, it.Page().Listings...)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(listings) > rows {
+		listings = listings[:rows]
+	}
+	return listings, nil
+}
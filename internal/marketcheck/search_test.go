@@ -0,0 +1,62 @@
+package marketcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// fakePages serves total listings in pages of at most the requested rows.
+type fakePages struct {
+	total int
+	calls int
+}
+
+func (f *fakePages) FetchActiveListingsPage(ctx context.Context, start, rows int, params SearchParams) (*SearchPage, error) {
+	f.calls++
+	page := &SearchPage{NumFound: f.total, Start: start}
+	for i := start; i < min(start+rows, f.total); i++ {
+		page.Listings = append(page.Listings, Listing{ID: fmt.Sprint(i)})
+	}
+	return page, nil
+}
+
+func TestCollectListings(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		rows      int
+		wantLen   int
+		wantCalls int
+	}{
+		{"one page", 200, 20, 20, 1},
+		{"several pages", 200, 120, 120, 3},
+		{"fewer than asked", 30, 120, 30, 1},
+		{"nothing found", 0, 50, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &fakePages{total: tt.total}
+			got, err := CollectListings(context.Background(), src, tt.rows, SearchParams{})
+			if err != nil {
+				t.Fatalf("CollectListings: %v", err)
+			}
+			if len(got) != tt.wantLen || src.calls != tt.wantCalls {
+				t.Fatalf("got %d listings in %d calls, want %d in %d", len(got), src.calls, tt.wantLen, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCollectListingsRejectsNonPositiveRows(t *testing.T) {
+	for _, rows := range []int{0, -1} {
+		src := &fakePages{total: 200}
+		if _, err := CollectListings(context.Background(), src, rows, SearchParams{}); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("CollectListings(rows=%d) = %v, want ErrInvalidRequest", rows, err)
+		}
+		if src.calls != 0 {
+			t.Errorf("CollectListings(rows=%d) made %d calls", rows, src.calls)
+		}
+	}
+}
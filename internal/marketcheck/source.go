@@ -0,0 +1,17 @@
+package marketcheck
+
+import "context"
+
+type PageFetcher interface {
+	FetchActiveListingsPage(ctx context.Context, start, rows int, params SearchParams) (*SearchPage, error)
+}
+
+// ListingSource is anything the producer and API can pull listings from.
+// Client implements it against the MarketCheck API.
+type ListingSource interface {
+	PageFetcher
+	FetchListingByID(ctx context.Context, id string) (*Listing, error)
+	FetchBuild(ctx context.Context, vin string) (*Build, error)
+}
+
+var _ ListingSource = (*Client)(nil)
@@ -1,5 +1,7 @@
 package marketcheck
 
+// ComputeValuation scores a price against the listing's own price history.
+// It is the fallback when there aren't enough comparable listings.
 func ComputeValuation(history []PricePoint, currentPrice int) Valuation {
 	if len(history) == 0 {
 		return Valuation{IsGoodValue: false, Score: 0}
@@ -16,5 +18,6 @@ func ComputeValuation(history []PricePoint, currentPrice int) Valuation {
 	return Valuation{
 		IsGoodValue: score > 0.05,
 		Score:       score,
+		Method:      "history",
 	}
 }
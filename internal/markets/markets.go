@@ -0,0 +1,171 @@
+package markets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Market sources.
+const (
+	SourceConfig = "config"
+	SourceFile   = "file"
+	SourceTable  = "table"
+)
+
+var ErrInvalid = errors.New("invalid market")
+
+// Market is one segment the producer sweeps. MaxPages overrides
+// SEARCH_MAX_PAGES and Schedule, a cron expression, overrides
+// INGEST_SCHEDULE when set.
+type Market struct {
+	Name     string `yaml:"name" json:"name"`
+	Make     string `yaml:"make" json:"make"`
+	Model    string `yaml:"model" json:"model,omitempty"`
+	Zip      string `yaml:"zip" json:"zip,omitempty"`
+	Radius   int    `yaml:"radius" json:"radius,omitempty"`
+	YearMin  int    `yaml:"year_min" json:"year_min,omitempty"`
+	YearMax  int    `yaml:"year_max" json:"year_max,omitempty"`
+	MaxPages int    `yaml:"max_pages" json:"max_pages,omitempty"`
+	Schedule string `yaml:"schedule" json:"schedule,omitempty"`
+}
+
+func (m Market) Params() marketcheck.SearchParams {
+	return marketcheck.SearchParams{
+		Make:    m.Make,
+		Model:   m.Model,
+		Zip:     m.Zip,
+		Radius:  m.Radius,
+		YearMin: m.YearMin,
+		YearMax: m.YearMax,
+	}.Normalize()
+}
+
+func (m Market) Validate() error {
+	if strings.TrimSpace(m.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if strings.TrimSpace(m.Make) == "" {
+		return fmt.Errorf("%w %q: make is required", ErrInvalid, m.Name)
+	}
+	if err := m.Params().Validate(); err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalid, m.Name, err)
+	}
+	if m.Schedule != "" {
+		if _, err := cron.ParseStandard(m.Schedule); err != nil {
+			return fmt.Errorf("%w %q: invalid schedule: %v", ErrInvalid, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks every market and that names are unique.
+func Validate(markets []Market) error {
+	seen := make(map[string]bool, len(markets))
+	for _, m := range markets {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+		if seen[m.Name] {
+			return fmt.Errorf("%w: duplicate name %q", ErrInvalid, m.Name)
+		}
+		seen[m.Name] = true
+	}
+	return nil
+}
+
+// Source lists the markets to sweep. It is consulted on every sweep, so
+// changes apply without a restart.
+type Source interface {
+	Markets(ctx context.Context) ([]Market, error)
+}
+
+// Static is a fixed list of markets.
+type Static []Market
+
+func (s Static) Markets(ctx context.Context) ([]Market, error) {
+	return s, nil
+}
+
+// File reads markets from a YAML file of the form
+//
+//	markets:
+//	  - name: socal-f150
+//	    make: ford
+//	    model: f-150
+//	    zip: "92617"
+//	    radius: 100
+//	    year_min: 2018
+type File struct {
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Markets(ctx context.Context) ([]Market, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Markets []Market `yaml:"markets"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", f.path, err)
+	}
+	if err := Validate(doc.Markets); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.path, err)
+	}
+	return doc.Markets, nil
+}
+
+// Store lists the enabled markets in the tracked_markets table.
+type Store interface {
+	ListTrackedMarkets(ctx context.Context) ([]Market, error)
+}
+
+// Table reads markets from a Store.
+type Table struct {
+	store Store
+}
+
+func NewTable(store Store) *Table {
+	return &Table{store: store}
+}
+
+func (t *Table) Markets(ctx context.Context) ([]Market, error) {
+	markets, err := t.store.ListTrackedMarkets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(markets); err != nil {
+		return nil, err
+	}
+	return markets, nil
+}
+
+// Sweep is the outcome of sweeping one market. RunID is sent with every
+// listing the sweep publishes.
+type Sweep struct {
+	Market     string    `json:"market"`
+	RunID      string    `json:"run_id,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Pages      int       `json:"pages"`
+	Found      int       `json:"found"`
+	Sent       int       `json:"sent"`
+	// Duplicates were already seen on an earlier page of the same sweep,
+	// which happens when listings shift between pages mid-sweep.
+	Duplicates int    `json:"duplicates"`
+	Failed     int    `json:"failed"`
+	Error      string `json:"error,omitempty"`
+}
@@ -0,0 +1,81 @@
+// Package netguard keeps outbound webhooks, which are sent from inside the
+// deployment to URLs users register, away from internal services.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNotPublic is returned for URLs whose host isn't publicly routable.
+var ErrNotPublic = errors.New("host is not public")
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Public reports whether addr is a publicly routable unicast address.
+func Public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// CheckURL resolves a URL's host and rejects it unless every address it
+// resolves to is public.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q", rawURL)
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: %q", ErrNotPublic, host)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("host %q does not resolve", host)
+	}
+	for _, addr := range addrs {
+		if !Public(addr) {
+			return fmt.Errorf("%w: %q resolves to %s", ErrNotPublic, host, addr)
+		}
+	}
+	return nil
+}
+
+// refusePrivate is a net.Dialer Control hook that refuses non-public
+// addresses, so a host that resolves differently when a request is sent
+// than when its URL was checked is still refused.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !Public(ap.Addr()) {
+		return fmt.Errorf("refusing to connect to non-public address %s", ap.Addr())
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client for outbound webhooks. Unless
+// allowPrivate is set it only connects to public addresses, and it never
+// uses a proxy, which would connect on its behalf.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
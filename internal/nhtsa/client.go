@@ -0,0 +1,289 @@
+package nhtsa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	DefaultBaseURL       = "https://vpic.nhtsa.dot.gov/api"
+	DefaultSafetyBaseURL = "https://api.nhtsa.gov"
+)
+
+var ErrInvalidRequest = errors.New("invalid nhtsa request")
+
+// StatusError is a non-2xx response from an NHTSA API.
+type StatusError struct {
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("nhtsa %s: status %d: %s", e.Path, e.StatusCode, e.Body)
+}
+
+type Make struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	VehicleType string `json:"vehicle_type,omitempty"`
+}
+
+type Model struct {
+	ID          int    `json:"id"`
+	MakeID      int    `json:"make_id"`
+	MakeName    string `json:"make_name"`
+	Name        string `json:"name"`
+	VehicleType string `json:"vehicle_type,omitempty"`
+}
+
+type VehicleType struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Client is a vPIC client. vPIC is free and keyless but asks callers to be
+// gentle, so requests are paced by a limiter and 5xx/429 responses are
+// retried a few times.
+type Client struct {
+	http        *http.Client
+	baseURL     string
+	safetyURL   string
+	limiter     *rate.Limiter
+	maxAttempts int
+}
+
+func NewClient(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		http:        &http.Client{Timeout: 30 * time.Second},
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		safetyURL:   DefaultSafetyBaseURL,
+		limiter:     rate.NewLimiter(5, 1),
+		maxAttempts: 3,
+	}
+}
+
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.http.Transport = rt
+}
+
+// SetSafetyURL overrides the base URL of the recalls and complaints APIs,
+// which are served from a different host than vPIC.
+func (c *Client) SetSafetyURL(baseURL string) {
+	if baseURL != "" {
+		c.safetyURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+func (c *Client) SetRateLimit(rps float64) {
+	c.limiter = rate.NewLimiter(rate.Limit(rps), 1)
+}
+
+// envelope is the wrapper vPIC puts around every JSON response.
+type envelope struct {
+	Count   int             `json:"Count"`
+	Message string          `json:"Message"`
+	Results json.RawMessage `json:"Results"`
+}
+
+func (c *Client) get(ctx context.Context, path string, results any) error {
+	return c.fetch(ctx, c.baseURL+path+"?format=json", path, results)
+}
+
+// fetch decodes the Results array of u into results. The recalls and
+// complaints APIs use lower-case envelope keys, which encoding/json matches
+// case-insensitively.
+func (c *Client) fetch(ctx context.Context, u, path string, results any) error {
+	var lastErr error
+	for attempt := 1; attempt <= c.maxAttempts; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+
+		retry, err := c.doOnce(req, path, results)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt == c.maxAttempts {
+			break
+		}
+
+		delay := time.Duration(attempt) * time.Second
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return lastErr
+}
+
+func (c *Client) doOnce(req *http.Request, path string, results any) (bool, error) {
+	res, err := c.http.Do(req)
+	if err != nil {
+		return req.Context().Err() == nil, fmt.Errorf("nhtsa %s: %w", path, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+		return retry, &StatusError{Path: path, StatusCode: res.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	var env envelope
+	if err := json.NewDecoder(res.Body).Decode(&env); err != nil {
+		return false, fmt.Errorf("nhtsa %s: failed to decode response: %w", path, err)
+	}
+	if len(env.Results) == 0 || string(env.Results) == "null" {
+		return false, nil
+	}
+	if err := json.Unmarshal(env.Results, results); err != nil {
+		return false, fmt.Errorf("nhtsa %s: failed to decode results: %w", path, err)
+	}
+	return false, nil
+}
+
+func (c *Client) GetAllMakes(ctx context.Context) ([]Make, error) {
+	var results []struct {
+		MakeID   int    `json:"Make_ID"`
+		MakeName string `json:"Make_Name"`
+	}
+	if err := c.get(ctx, "/vehicles/GetAllMakes", &results); err != nil {
+		return nil, err
+	}
+	makes := make([]Make, 0, len(results))
+	for _, r := range results {
+		makes = append(makes, Make{ID: r.MakeID, Name: strings.TrimSpace(r.MakeName)})
+	}
+	return makes, nil
+}
+
+// GetMakesForVehicleType accepts a full or partial vPIC vehicle type name,
+// e.g. "car" or "Multipurpose Passenger Vehicle (MPV)".
+func (c *Client) GetMakesForVehicleType(ctx context.Context, vehicleType string) ([]Make, error) {
+	vehicleType = strings.TrimSpace(vehicleType)
+	if vehicleType == "" {
+		return nil, fmt.Errorf("%w: vehicle type cannot be empty", ErrInvalidRequest)
+	}
+	var results []struct {
+		MakeID          int    `json:"MakeId"`
+		MakeName        string `json:"MakeName"`
+		VehicleTypeName string `json:"VehicleTypeName"`
+	}
+	if err := c.get(ctx, "/vehicles/GetMakesForVehicleType/"+url.PathEscape(vehicleType), &results); err != nil {
+		return nil, err
+	}
+	makes := make([]Make, 0, len(results))
+	for _, r := range results {
+		makes = append(makes, Make{ID: r.MakeID, Name: strings.TrimSpace(r.MakeName), VehicleType: strings.TrimSpace(r.VehicleTypeName)})
+	}
+	return makes, nil
+}
+
+func (c *Client) GetModelsForMake(ctx context.Context, makeName string) ([]Model, error) {
+	makeName = strings.TrimSpace(makeName)
+	if makeName == "" {
+		return nil, fmt.Errorf("%w: make cannot be empty", ErrInvalidRequest)
+	}
+	return c.getModels(ctx, "/vehicles/GetModelsForMake/"+url.PathEscape(makeName), "")
+}
+
+// GetModelsForMakeYear narrows a make's models by model year, vehicle type or
+// both. vPIC requires at least one of them; a zero year or empty type is
+// left out of the path.
+func (c *Client) GetModelsForMakeYear(ctx context.Context, makeName string, year int, vehicleType string) ([]Model, error) {
+	makeName = strings.TrimSpace(makeName)
+	vehicleType = strings.TrimSpace(vehicleType)
+	if makeName == "" {
+		return nil, fmt.Errorf("%w: make cannot be empty", ErrInvalidRequest)
+	}
+	if year == 0 && vehicleType == "" {
+		return nil, fmt.Errorf("%w: model year or vehicle type is required", ErrInvalidRequest)
+	}
+
+	path := "/vehicles/GetModelsForMakeYear/make/" + url.PathEscape(makeName)
+	if year > 0 {
+		path += fmt.Sprintf("/modelyear/%d", year)
+	}
+	if vehicleType != "" {
+		path += "/vehicletype/" + url.PathEscape(vehicleType)
+	}
+	return c.getModels(ctx, path, vehicleType)
+}
+
+func (c *Client) getModels(ctx context.Context, path, vehicleType string) ([]Model, error) {
+	var results []struct {
+		MakeID          int    `json:"Make_ID"`
+		MakeName        string `json:"Make_Name"`
+		ModelID         int    `json:"Model_ID"`
+		ModelName       string `json:"Model_Name"`
+		VehicleTypeName string `json:"VehicleTypeName"`
+	}
+	if err := c.get(ctx, path, &results); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, 0, len(results))
+	seen := make(map[int]bool, len(results))
+	for _, r := range results {
+		name := strings.TrimSpace(r.ModelName)
+		if name == "" || seen[r.ModelID] {
+			continue
+		}
+		seen[r.ModelID] = true
+		vt := strings.TrimSpace(r.VehicleTypeName)
+		if vt == "" {
+			vt = vehicleType
+		}
+		models = append(models, Model{
+			ID:          r.ModelID,
+			MakeID:      r.MakeID,
+			MakeName:    strings.TrimSpace(r.MakeName),
+			Name:        name,
+			VehicleType: vt,
+		})
+	}
+	return models, nil
+}
+
+func (c *Client) GetVehicleTypesForMake(ctx context.Context, makeName string) ([]VehicleType, error) {
+	makeName = strings.TrimSpace(makeName)
+	if makeName == "" {
+		return nil, fmt.Errorf("%w: make cannot be empty", ErrInvalidRequest)
+	}
+	var results []struct {
+		VehicleTypeID   int    `json:"VehicleTypeId"`
+		VehicleTypeName string `json:"VehicleTypeName"`
+	}
+	if err := c.get(ctx, "/vehicles/GetVehicleTypesForMake/"+url.PathEscape(makeName), &results); err != nil {
+		return nil, err
+	}
+	types := make([]VehicleType, 0, len(results))
+	seen := make(map[int]bool, len(results))
+	for _, r := range results {
+		if seen[r.VehicleTypeID] {
+			continue
+		}
+		seen[r.VehicleTypeID] = true
+		types = append(types, VehicleType{ID: r.VehicleTypeID, Name: strings.TrimSpace(r.VehicleTypeName)})
+	}
+	return types, nil
+}
@@ -0,0 +1,159 @@
+package nhtsa
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c := NewClient(srv.URL + "/")
+	c.SetRateLimit(1000)
+	return c
+}
+
+func TestGetMakesForVehicleType(t *testing.T) {
+	var gotPath, gotFormat string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotFormat = r.URL.EscapedPath(), r.URL.Query().Get("format")
+		w.Write([]byte(`{"Count": 2, "Message": "ok", "Results": [
+			{"MakeId": 474, "MakeName": "HONDA ", "VehicleTypeName": "Passenger Car"},
+			{"MakeId": 448, "MakeName": "TOYOTA", "VehicleTypeName": " Passenger Car"}
+		]}`))
+	})
+
+	makes, err := c.GetMakesForVehicleType(context.Background(), " passenger car ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/vehicles/GetMakesForVehicleType/passenger%20car" || gotFormat != "json" {
+		t.Fatalf("request = %s?format=%s", gotPath, gotFormat)
+	}
+	want := []Make{{ID: 474, Name: "HONDA", VehicleType: "Passenger Car"}, {ID: 448, Name: "TOYOTA", VehicleType: "Passenger Car"}}
+	if len(makes) != len(want) || makes[0] != want[0] || makes[1] != want[1] {
+		t.Fatalf("makes = %+v, want %+v", makes, want)
+	}
+}
+
+func TestGetModelsForMakeYear(t *testing.T) {
+	var gotPath string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		w.Write([]byte(`{"Count": 4, "Results": [
+			{"Make_ID": 474, "Make_Name": "HONDA", "Model_ID": 1861, "Model_Name": "Accord"},
+			{"Make_ID": 474, "Make_Name": "HONDA", "Model_ID": 1861, "Model_Name": "Accord"},
+			{"Make_ID": 474, "Make_Name": "HONDA", "Model_ID": 1863, "Model_Name": "Civic", "VehicleTypeName": "Passenger Car"},
+			{"Make_ID": 474, "Make_Name": "HONDA", "Model_ID": 9999, "Model_Name": " "}
+		]}`))
+	})
+
+	models, err := c.GetModelsForMakeYear(context.Background(), "Honda", 2020, "Passenger Car")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/vehicles/GetModelsForMakeYear/make/Honda/modelyear/2020/vehicletype/Passenger%20Car" {
+		t.Fatalf("path = %s", gotPath)
+	}
+	if len(models) != 2 {
+		t.Fatalf("models = %+v, want duplicates and blank names dropped", models)
+	}
+	if m := models[0]; m.ID != 1861 || m.MakeID != 474 || m.Name != "Accord" || m.VehicleType != "Passenger Car" {
+		t.Fatalf("models[0] = %+v, want the requested vehicle type filled in", m)
+	}
+
+	if _, err := c.GetModelsForMakeYear(context.Background(), "Honda", 0, "Truck"); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/vehicles/GetModelsForMakeYear/make/Honda/vehicletype/Truck" {
+		t.Fatalf("path without a year = %s", gotPath)
+	}
+}
+
+func TestInvalidRequestsSkipTheNetwork(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"empty vehicle type", func() error { _, err := c.GetMakesForVehicleType(ctx, " "); return err }},
+		{"empty make", func() error { _, err := c.GetModelsForMake(ctx, ""); return err }},
+		{"no year or type", func() error { _, err := c.GetModelsForMakeYear(ctx, "Honda", 0, ""); return err }},
+		{"empty make for types", func() error { _, err := c.GetVehicleTypesForMake(ctx, ""); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, ErrInvalidRequest) {
+				t.Fatalf("err = %v, want ErrInvalidRequest", err)
+			}
+		})
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("server called %d times", n)
+	}
+}
+
+func TestNullResults(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Count": 0, "Message": "none", "Results": null}`))
+	})
+	makes, err := c.GetAllMakes(context.Background())
+	if err != nil || len(makes) != 0 {
+		t.Fatalf("GetAllMakes = %+v, %v", makes, err)
+	}
+}
+
+func TestRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"Results": [{"VehicleTypeId": 2, "VehicleTypeName": "Passenger Car"}, {"VehicleTypeId": 2, "VehicleTypeName": "Passenger Car"}]}`))
+	})
+
+	types, err := c.GetVehicleTypesForMake(context.Background(), "Honda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 || len(types) != 1 || types[0] != (VehicleType{ID: 2, Name: "Passenger Car"}) {
+		t.Fatalf("after %d calls types = %+v", calls.Load(), types)
+	}
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "no such make", http.StatusNotFound)
+	})
+
+	_, err := c.GetModelsForMake(context.Background(), "Nope")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || statusErr.Body != "no such make" {
+		t.Fatalf("err = %v, want a 404 StatusError", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("server called %d times, want 1", calls.Load())
+	}
+}
+
+func TestMalformedResponse(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Results": {"not": "an array"}}`))
+	})
+	if _, err := c.GetAllMakes(context.Background()); err == nil {
+		t.Fatal("object Results accepted")
+	}
+}
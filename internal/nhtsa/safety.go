@@ -0,0 +1,119 @@
+package nhtsa
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recall is one recall campaign from the NHTSA recalls API.
+type Recall struct {
+	Campaign    string
+	Component   string
+	Summary     string
+	Consequence string
+	Remedy      string
+	ReportDate  time.Time
+	ParkIt      bool
+	ParkOutside bool
+	OverTheAir  bool
+}
+
+// Complaint is the subset of an NHTSA owner complaint we aggregate.
+type Complaint struct {
+	ODINumber int
+	Crash     bool
+	Fire      bool
+	Injuries  int
+	Deaths    int
+}
+
+func vehicleQuery(makeName, model string, year int) (url.Values, error) {
+	makeName = strings.TrimSpace(makeName)
+	model = strings.TrimSpace(model)
+	if makeName == "" || model == "" || year <= 0 {
+		return nil, fmt.Errorf("%w: make, model and model year are required", ErrInvalidRequest)
+	}
+	q := url.Values{}
+	q.Set("make", makeName)
+	q.Set("model", model)
+	q.Set("modelYear", strconv.Itoa(year))
+	return q, nil
+}
+
+// RecallsByVehicle lists recall campaigns for a make/model/year. NHTSA has
+// no public per-VIN lookup, so every campaign for the model year is
+// returned.
+func (c *Client) RecallsByVehicle(ctx context.Context, makeName, model string, year int) ([]Recall, error) {
+	q, err := vehicleQuery(makeName, model, year)
+	if err != nil {
+		return nil, err
+	}
+	path := "/recalls/recallsByVehicle"
+	var results []struct {
+		Campaign    string `json:"NHTSACampaignNumber"`
+		Component   string `json:"Component"`
+		Summary     string `json:"Summary"`
+		Consequence string `json:"Consequence"`
+		Remedy      string `json:"Remedy"`
+		ReportDate  string `json:"ReportReceivedDate"`
+		ParkIt      bool   `json:"parkIt"`
+		ParkOutside bool   `json:"parkOutSide"`
+		OverTheAir  bool   `json:"overTheAirUpdate"`
+	}
+	if err := c.fetch(ctx, c.safetyURL+path+"?"+q.Encode(), path, &results); err != nil {
+		return nil, err
+	}
+
+	recalls := make([]Recall, 0, len(results))
+	seen := make(map[string]bool, len(results))
+	for _, r := range results {
+		if r.Campaign == "" || seen[r.Campaign] {
+			continue
+		}
+		seen[r.Campaign] = true
+		reported, err := time.Parse("02/01/2006", r.ReportDate)
+		if err != nil {
+			reported, _ = time.Parse(time.RFC3339, r.ReportDate)
+		}
+		recalls = append(recalls, Recall{
+			Campaign:    r.Campaign,
+			Component:   strings.TrimSpace(r.Component),
+			Summary:     strings.TrimSpace(r.Summary),
+			Consequence: strings.TrimSpace(r.Consequence),
+			Remedy:      strings.TrimSpace(r.Remedy),
+			ReportDate:  reported,
+			ParkIt:      r.ParkIt,
+			ParkOutside: r.ParkOutside,
+			OverTheAir:  r.OverTheAir,
+		})
+	}
+	return recalls, nil
+}
+
+func (c *Client) ComplaintsByVehicle(ctx context.Context, makeName, model string, year int) ([]Complaint, error) {
+	q, err := vehicleQuery(makeName, model, year)
+	if err != nil {
+		return nil, err
+	}
+	path := "/complaints/complaintsByVehicle"
+	var results []struct {
+		ODINumber int  `json:"odiNumber"`
+		Crash     bool `json:"crash"`
+		Fire      bool `json:"fire"`
+		Injuries  int  `json:"numberOfInjuries"`
+		Deaths    int  `json:"numberOfDeaths"`
+	}
+	if err := c.fetch(ctx, c.safetyURL+path+"?"+q.Encode(), path, &results); err != nil {
+		return nil, err
+	}
+
+	complaints := make([]Complaint, 0, len(results))
+	for _, r := range results {
+		complaints = append(complaints, Complaint(r))
+	}
+	return complaints, nil
+}
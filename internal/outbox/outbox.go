@@ -0,0 +1,164 @@
+// Package outbox relays listing observations queued in the database, in the
+// same transaction as the listing upserts that produced them, to the
+// listings-raw topic, so that listings saved outside the producer reach the
+// consumer too.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Message is a queued listing observation.
+type Message struct {
+	ID  int64
+	VIN string
+	// Payload is the EnrichedListing JSON.
+	Payload   json.RawMessage
+	Source    string
+	TraceID   string
+	CreatedAt time.Time
+}
+
+// Store holds the outbox. PendingOutbox returns unpublished messages in the
+// order they were queued. The lease lets one relay at a time publish, so
+// messages go out in order and no two relays publish the same one.
+type Store interface {
+	AcquireLease(ctx context.Context, job, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, job, holder string) error
+	PendingOutbox(ctx context.Context, limit int) ([]Message, error)
+	MarkOutboxPublished(ctx context.Context, ids []int64) error
+	PruneOutbox(ctx context.Context, before time.Time) (int, error)
+}
+
+// Publisher publishes messages, returning once every one is acknowledged.
+type Publisher interface {
+	PublishOutbox(ctx context.Context, msgs []Message) error
+}
+
+// LeaseJob is the job_leases entry the relay holds.
+const LeaseJob = "outbox-relay"
+
+type Options struct {
+	BatchSize int
+	// LeaseTTL is how long the relay's lease lasts without renewal. Each
+	// batch must be published well within it.
+	LeaseTTL time.Duration
+	Holder   string
+	// Retention is how long published messages are kept; 0 keeps them.
+	Retention time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		BatchSize: 100,
+		LeaseTTL:  time.Minute,
+		Retention: 7 * 24 * time.Hour,
+	}
+}
+
+// Relay publishes the outbox at least once: a message is marked published
+// only after it is acknowledged, so a relay that dies, or fails to mark a
+// batch, publishes that batch again. A duplicate carries the same outbox-id
+// and is produced at the same created_at, which the consumer uses as the
+// observation date, so it upserts the same price_history row and detects
+// the same price event, already recorded under (vin, occurred_at, kind).
+// Listing events and saved-search alerts only fire when the stored listing
+// or the price a search last matched changes, so a duplicate doesn't fire
+// them again.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	opts      Options
+	pruned    time.Time
+}
+
+func NewRelay(store Store, publisher Publisher, opts Options) *Relay {
+	return &Relay{store: store, publisher: publisher, opts: opts}
+}
+
+// Run relays pending messages, polling every interval when idle, and gives
+// up the lease when ctx is done.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) error {
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.store.ReleaseLease(releaseCtx, LeaseJob, r.opts.Holder); err != nil {
+			log.Printf("outbox: failed to release lease: %v", err)
+		}
+	}()
+
+	for {
+		n, err := r.RelayPending(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox: relay run failed: %v", err)
+		}
+		if err == nil && n == r.opts.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// RelayPending publishes one batch of pending messages, if this relay holds
+// the lease, and marks them published.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	ok, err := r.store.AcquireLease(ctx, LeaseJob, r.opts.Holder, r.opts.LeaseTTL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	if !ok {
+		return 0, nil
+	}
+
+	msgs, err := r.store.PendingOutbox(ctx, r.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(msgs) == 0 {
+		r.prune(ctx)
+		return 0, nil
+	}
+
+	// Give up well before the lease runs out, so another relay never
+	// publishes the batch at the same time.
+	publishCtx, cancel := context.WithTimeout(ctx, r.opts.LeaseTTL/2)
+	err = r.publisher.PublishOutbox(publishCtx, msgs)
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish %d messages: %w", len(msgs), err)
+	}
+
+	ids := make([]int64, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	if err := r.store.MarkOutboxPublished(ctx, ids); err != nil {
+		return 0, fmt.Errorf("failed to mark %d messages published: %w", len(ids), err)
+	}
+	return len(msgs), nil
+}
+
+// prune deletes messages published longer than Retention ago, at most hourly.
+func (r *Relay) prune(ctx context.Context) {
+	if r.opts.Retention <= 0 || time.Since(r.pruned) < time.Hour {
+		return
+	}
+	r.pruned = time.Now()
+	n, err := r.store.PruneOutbox(ctx, time.Now().Add(-r.opts.Retention))
+	if err != nil {
+		log.Printf("outbox: failed to prune published messages: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("outbox: pruned %d published messages", n)
+	}
+}
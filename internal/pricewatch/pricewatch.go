@@ -0,0 +1,286 @@
+package pricewatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+type Kind string
+
+const (
+	KindDrop     Kind = "drop"
+	KindIncrease Kind = "increase"
+	// KindRelisted is a listing seen again after it was presumed sold (see
+	// internal/lifecycle), whether or not its price changed.
+	KindRelisted Kind = "relisted"
+)
+
+// EventType names PriceChanged on the wire.
+const EventType = "PriceChanged"
+
+// PriceChanged is emitted when a listing's price moves past the thresholds
+// or it comes back after being removed.
+type PriceChanged struct {
+	VIN      string `json:"vin"`
+	Kind     Kind   `json:"kind"`
+	OldPrice int    `json:"old_price"`
+	NewPrice int    `json:"new_price"`
+	// Change is NewPrice - OldPrice, negative for a drop.
+	Change        int     `json:"change"`
+	ChangePercent float64 `json:"change_percent"`
+	// ConsecutiveDrops counts the price cuts in a row ending with this one.
+	ConsecutiveDrops int       `json:"consecutive_drops"`
+	PreviousSeenAt   time.Time `json:"previous_seen_at"`
+	OccurredAt       time.Time `json:"occurred_at"`
+	Make             string    `json:"make,omitempty"`
+	Model            string    `json:"model,omitempty"`
+	Year             int       `json:"year,omitempty"`
+	Trim             string    `json:"trim,omitempty"`
+	Miles            int       `json:"miles,omitempty"`
+}
+
+type Thresholds struct {
+	// MinAmount and MinPercent must both be met for a price change to count;
+	// zero disables either.
+	MinAmount  int
+	MinPercent float64
+	// RelistAfter is how long a listing that was presumed sold must have
+	// gone unseen before reappearing counts as a relisting; zero disables
+	// relist detection.
+	RelistAfter time.Duration
+}
+
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		MinAmount:   250,
+		MinPercent:  1,
+		RelistAfter: 7 * 24 * time.Hour,
+	}
+}
+
+// Detect compares the newest point in history, which must be sorted oldest
+// first, with the one before it. sold reports whether the listing was
+// presumed sold before this observation; a gap in observations alone, such
+// as after a producer outage, isn't a relisting. It returns nil when nothing
+// noteworthy happened.
+func Detect(l marketcheck.EnrichedListing, history []marketcheck.PricePoint, sold bool, t Thresholds) *PriceChanged {
+	if len(history) < 2 {
+		return nil
+	}
+	cur, prev := history[len(history)-1], history[len(history)-2]
+	if cur.Price <= 0 {
+		return nil
+	}
+
+	relisted := sold && t.RelistAfter > 0 && cur.Date.Sub(prev.Date) >= t.RelistAfter
+
+	change, percent := 0, 0.0
+	if prev.Price > 0 {
+		change = cur.Price - prev.Price
+		percent = 100 * float64(change) / float64(prev.Price)
+	}
+	significant := change != 0 &&
+		abs(change) >= t.MinAmount &&
+		math.Abs(percent) >= t.MinPercent
+
+	if !relisted && !significant {
+		return nil
+	}
+
+	kind := KindIncrease
+	switch {
+	case relisted:
+		kind = KindRelisted
+	case change < 0:
+		kind = KindDrop
+	}
+
+	return &PriceChanged{
+		VIN:              l.Listing.VIN,
+		Kind:             kind,
+		OldPrice:         prev.Price,
+		NewPrice:         cur.Price,
+		Change:           change,
+		ChangePercent:    math.Round(percent*100) / 100,
+		ConsecutiveDrops: consecutiveDrops(history),
+		PreviousSeenAt:   prev.Date,
+		OccurredAt:       cur.Date,
+		Make:             l.Build.Make,
+		Model:            l.Build.Model,
+		Year:             l.Build.Year,
+		Trim:             l.Build.Trim,
+		Miles:            l.Listing.Miles,
+	}
+}
+
+// consecutiveDrops counts the run of price cuts ending at the newest point,
+// ignoring observations where the price didn't move.
+func consecutiveDrops(history []marketcheck.PricePoint) int {
+	drops := 0
+	last := history[len(history)-1].Price
+	for i := len(history) - 2; i >= 0; i-- {
+		p := history[i].Price
+		if p <= 0 || p == last {
+			continue
+		}
+		if p < last {
+			break
+		}
+		drops++
+		last = p
+	}
+	return drops
+}
+
+// Store records events and tracks which have been published.
+// RecordPriceEvent stores an event unless it is already stored, such as
+// when a message is redelivered, and returns its ID and whether it has been
+// published. ListingSold reports whether a listing is presumed sold.
+type Store interface {
+	RecordPriceEvent(ctx context.Context, ev PriceChanged) (int64, bool, error)
+	MarkPriceEventPublished(ctx context.Context, id int64) error
+	PendingPriceEvents(ctx context.Context, before time.Time, limit int) ([]PendingEvent, error)
+	ListingSold(ctx context.Context, vin string) (bool, error)
+}
+
+// PendingEvent is a recorded event that hasn't been published.
+type PendingEvent struct {
+	ID    int64
+	Event PriceChanged
+}
+
+type Publisher interface {
+	PublishPriceChanged(ctx context.Context, ev PriceChanged) error
+}
+
+// Watcher detects price changes as the consumer stores prices, records
+// them and publishes each one. An event is only marked published once the
+// publish succeeds: a redelivered message publishes it again, and Run
+// publishes events whose message won't be redelivered. A consumer can see
+// the same event twice, and webhooks dedupe it by its content.
+type Watcher struct {
+	store      Store
+	publisher  Publisher
+	thresholds Thresholds
+}
+
+func NewWatcher(store Store, publisher Publisher, thresholds Thresholds) *Watcher {
+	return &Watcher{
+		store:      store,
+		publisher:  publisher,
+		thresholds: thresholds,
+	}
+}
+
+// Observe returns the event it detected, or nil once the event has been
+// published.
+func (w *Watcher) Observe(ctx context.Context, l marketcheck.EnrichedListing, history []marketcheck.PricePoint) (*PriceChanged, error) {
+	sold, err := w.wasSold(ctx, l.Listing.VIN, history)
+	if err != nil {
+		return nil, err
+	}
+	ev := Detect(l, history, sold, w.thresholds)
+	if ev == nil {
+		return nil, nil
+	}
+
+	id, published, err := w.store.RecordPriceEvent(ctx, *ev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record price event: %w", err)
+	}
+	if published {
+		return nil, nil
+	}
+	if err := w.publish(ctx, id, *ev); err != nil {
+		return ev, err
+	}
+	return ev, nil
+}
+
+// wasSold only asks the store when the gap since the previous observation
+// is long enough for a relisting.
+func (w *Watcher) wasSold(ctx context.Context, vin string, history []marketcheck.PricePoint) (bool, error) {
+	if w.thresholds.RelistAfter <= 0 || len(history) < 2 {
+		return false, nil
+	}
+	if history[len(history)-1].Date.Sub(history[len(history)-2].Date) < w.thresholds.RelistAfter {
+		return false, nil
+	}
+	sold, err := w.store.ListingSold(ctx, vin)
+	if err != nil {
+		return false, fmt.Errorf("failed to check listing status: %w", err)
+	}
+	return sold, nil
+}
+
+func (w *Watcher) publish(ctx context.Context, id int64, ev PriceChanged) error {
+	if w.publisher == nil {
+		return nil
+	}
+	if err := w.publisher.PublishPriceChanged(ctx, ev); err != nil {
+		return fmt.Errorf("failed to publish price event: %w", err)
+	}
+	if err := w.store.MarkPriceEventPublished(ctx, id); err != nil {
+		return fmt.Errorf("failed to mark price event published: %w", err)
+	}
+	return nil
+}
+
+// pendingGrace leaves events alone while the consumer that recorded them
+// may still be publishing them.
+const pendingGrace = time.Minute
+
+// PublishPending publishes one batch of recorded events that were never
+// published, returning how many it published.
+func (w *Watcher) PublishPending(ctx context.Context, limit int) (int, error) {
+	if w.publisher == nil {
+		return 0, nil
+	}
+	pending, err := w.store.PendingPriceEvents(ctx, time.Now().Add(-pendingGrace), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pending price events: %w", err)
+	}
+	for i, p := range pending {
+		if err := w.publish(ctx, p.ID, p.Event); err != nil {
+			return i, err
+		}
+	}
+	return len(pending), nil
+}
+
+// Run publishes pending events every interval until ctx is done.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) error {
+	const batch = 100
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := w.PublishPending(ctx, batch)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("price events: publishing pending events failed: %v", err)
+		}
+		if n > 0 {
+			log.Printf("price events: published %d pending events", n)
+		}
+		if err == nil && n == batch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,182 @@
+package pricewatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+var day0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func points(prices ...int) []marketcheck.PricePoint {
+	history := make([]marketcheck.PricePoint, len(prices))
+	for i, p := range prices {
+		history[i] = marketcheck.PricePoint{Price: p, Date: day0.AddDate(0, 0, i)}
+	}
+	return history
+}
+
+func TestDetect(t *testing.T) {
+	thresholds := Thresholds{MinAmount: 250, MinPercent: 1, RelistAfter: 7 * 24 * time.Hour}
+	gap := func(history []marketcheck.PricePoint, days int) []marketcheck.PricePoint {
+		history[len(history)-1].Date = history[len(history)-2].Date.AddDate(0, 0, days)
+		return history
+	}
+
+	tests := []struct {
+		name    string
+		history []marketcheck.PricePoint
+		sold    bool
+		want    Kind
+		drops   int
+	}{
+		{"single point", points(20000), false, "", 0},
+		{"unchanged", points(20000, 20000), false, "", 0},
+		{"drop", points(20000, 19500), false, KindDrop, 1},
+		{"increase", points(20000, 20500), false, KindIncrease, 0},
+		{"below amount", points(20000, 19900), false, "", 0},
+		{"below percent", points(100000, 99700), false, "", 0},
+		{"consecutive drops skip flat points", points(21000, 20500, 20500, 20000), false, KindDrop, 2},
+		{"drop after increase", points(20000, 21000, 20500), false, KindDrop, 1},
+		{"zero price ignored", points(20000, 0), false, "", 0},
+		{"gap without sale is not a relist", gap(points(20000, 20000), 30), false, "", 0},
+		{"gap without sale still reports a drop", gap(points(20000, 19000), 30), false, KindDrop, 1},
+		{"sold and back after gap", gap(points(20000, 20000), 30), true, KindRelisted, 0},
+		{"sold but back too soon", gap(points(20000, 20000), 3), true, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := marketcheck.EnrichedListing{Listing: marketcheck.Listing{VIN: "1HGCM82633A004352"}}
+			ev := Detect(l, tt.history, tt.sold, thresholds)
+			if tt.want == "" {
+				if ev != nil {
+					t.Fatalf("got %+v, want nil", ev)
+				}
+				return
+			}
+			if ev == nil || ev.Kind != tt.want || ev.ConsecutiveDrops != tt.drops {
+				t.Fatalf("got %+v, want %s with %d drops", ev, tt.want, tt.drops)
+			}
+		})
+	}
+}
+
+type fakeStore struct {
+	events    map[time.Time]int64
+	published map[int64]bool
+	sold      bool
+	soldCalls int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{events: make(map[time.Time]int64), published: make(map[int64]bool)}
+}
+
+func (s *fakeStore) RecordPriceEvent(ctx context.Context, ev PriceChanged) (int64, bool, error) {
+	id, ok := s.events[ev.OccurredAt]
+	if !ok {
+		id = int64(len(s.events) + 1)
+		s.events[ev.OccurredAt] = id
+	}
+	return id, s.published[id], nil
+}
+
+func (s *fakeStore) MarkPriceEventPublished(ctx context.Context, id int64) error {
+	s.published[id] = true
+	return nil
+}
+
+func (s *fakeStore) PendingPriceEvents(ctx context.Context, before time.Time, limit int) ([]PendingEvent, error) {
+	var pending []PendingEvent
+	for at, id := range s.events {
+		if !s.published[id] {
+			pending = append(pending, PendingEvent{ID: id, Event: PriceChanged{OccurredAt: at}})
+		}
+	}
+	return pending, nil
+}
+
+func (s *fakeStore) ListingSold(ctx context.Context, vin string) (bool, error) {
+	s.soldCalls++
+	return s.sold, nil
+}
+
+type fakePublisher struct {
+	fail      bool
+	published int
+}
+
+func (p *fakePublisher) PublishPriceChanged(ctx context.Context, ev PriceChanged) error {
+	if p.fail {
+		return errors.New("broker unavailable")
+	}
+	p.published++
+	return nil
+}
+
+func TestObserveRepublishesAfterFailedPublish(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	pub := &fakePublisher{fail: true}
+	w := NewWatcher(store, pub, DefaultThresholds())
+	l := marketcheck.EnrichedListing{Listing: marketcheck.Listing{VIN: "1HGCM82633A004352"}}
+	history := points(20000, 19000)
+
+	if _, err := w.Observe(ctx, l, history); err == nil {
+		t.Fatal("expected publish error")
+	}
+
+	// The redelivered message publishes the recorded event.
+	pub.fail = false
+	ev, err := w.Observe(ctx, l, history)
+	if err != nil || ev == nil || pub.published != 1 {
+		t.Fatalf("redelivery: ev=%v err=%v published=%d", ev, err, pub.published)
+	}
+
+	// Once published, it isn't published again.
+	ev, err = w.Observe(ctx, l, history)
+	if err != nil || ev != nil || pub.published != 1 {
+		t.Fatalf("after publish: ev=%v err=%v published=%d", ev, err, pub.published)
+	}
+}
+
+func TestPublishPending(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	pub := &fakePublisher{fail: true}
+	w := NewWatcher(store, pub, DefaultThresholds())
+	l := marketcheck.EnrichedListing{Listing: marketcheck.Listing{VIN: "1HGCM82633A004352"}}
+	w.Observe(ctx, l, points(20000, 19000))
+
+	pub.fail = false
+	n, err := w.PublishPending(ctx, 10)
+	if err != nil || n != 1 || pub.published != 1 {
+		t.Fatalf("PublishPending = %d, %v; published %d", n, err, pub.published)
+	}
+	if n, _ := w.PublishPending(ctx, 10); n != 0 {
+		t.Fatalf("second PublishPending published %d", n)
+	}
+}
+
+func TestObserveOnlyChecksStatusAfterLongGap(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	store.sold = true
+	w := NewWatcher(store, nil, DefaultThresholds())
+	l := marketcheck.EnrichedListing{Listing: marketcheck.Listing{VIN: "1HGCM82633A004352"}}
+
+	w.Observe(ctx, l, points(20000, 20000))
+	if store.soldCalls != 0 {
+		t.Fatalf("status checked %d times for a day's gap", store.soldCalls)
+	}
+
+	history := points(20000, 20000)
+	history[1].Date = history[0].Date.AddDate(0, 1, 0)
+	ev, err := w.Observe(ctx, l, history)
+	if err != nil || ev == nil || ev.Kind != KindRelisted {
+		t.Fatalf("got %+v, %v; want relisted", ev, err)
+	}
+}
@@ -2,68 +2,216 @@ package producer
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/omerahmer/motor_metrics/internal/config"
 	"github.com/omerahmer/motor_metrics/internal/kafka"
 	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/markets"
+	"github.com/omerahmer/motor_metrics/internal/scheduler"
 )
 
+// SafetyLookup attaches NHTSA recall and complaint data to a build.
+type SafetyLookup interface {
+	ForBuild(ctx context.Context, b marketcheck.Build) (*marketcheck.Safety, error)
+}
+
+// SweepRecorder keeps per-market sweep results.
+type SweepRecorder interface {
+	RecordSweep(ctx context.Context, s markets.Sweep) error
+}
+
 type Producer struct {
-	cfg      *config.Config
-	client   *marketcheck.Client
-	writer   kafka.Writer
-	interval time.Duration
+	cfg       *config.Config
+	client    marketcheck.ListingSource
+	writer    kafka.Writer
+	safety    SafetyLookup
+	markets   markets.Source
+	recorder  SweepRecorder
+	scheduler *scheduler.Scheduler
+	reload    time.Duration
 }
 
-func New(cfg *config.Config, client *marketcheck.Client, writer kafka.Writer) *Producer {
+func New(cfg *config.Config, client marketcheck.ListingSource, writer kafka.Writer) *Producer {
 	return &Producer{
-		cfg:      cfg,
-		client:   client,
-		writer:   writer,
-		interval: time.Hour * 24,
+		cfg:    cfg,
+		client: client,
+		writer: writer,
+		reload: time.Minute,
 	}
 }
 
+func (p *Producer) SetSafety(s SafetyLookup) {
+	p.safety = s
+}
+
+// SetMarkets replaces the single market built from the SEARCH_* settings.
+func (p *Producer) SetMarkets(m markets.Source) {
+	p.markets = m
+}
+
+func (p *Producer) SetSweepRecorder(r SweepRecorder) {
+	p.recorder = r
+}
+
+// SetScheduler replaces the default scheduler, which runs every market on
+// start and then on schedule with no leases or history.
+func (p *Producer) SetScheduler(s *scheduler.Scheduler, reload time.Duration) {
+	p.scheduler = s
+	p.reload = reload
+}
+
+// DefaultMarket is the market described by the SEARCH_* settings.
+func DefaultMarket(cfg *config.Config) markets.Market {
+	m := markets.Market{
+		Name:  "default",
+		Make:  cfg.Make,
+		Model: cfg.Model,
+	}
+	if cfg.Zip != "" {
+		m.Zip = cfg.Zip
+		m.Radius = cfg.Radius
+	}
+	return m
+}
+
+// Run schedules a sweep job for each market and keeps the jobs in step with
+// the market source until ctx is done.
 func (p *Producer) Run(ctx context.Context) error {
-	ticker := time.NewTicker(p.interval)
+	sched := p.scheduler
+	if sched == nil {
+		sched = scheduler.New(nil, scheduler.Options{RunOnStart: true, Concurrency: 1})
+	}
+
+	ticker := time.NewTicker(p.reload)
 	defer ticker.Stop()
 
 	for {
+		p.syncJobs(ctx, sched)
+
 		select {
 		case <-ctx.Done():
+			sched.Wait()
 			return ctx.Err()
 		case <-ticker.C:
-			_ = p.ingestOnce(ctx)
 		}
 	}
 }
 
-func (p *Producer) ingestOnce(ctx context.Context) error {
-	listings, err := p.client.FetchActiveListings(ctx, 100)
+func (p *Producer) syncJobs(ctx context.Context, sched *scheduler.Scheduler) {
+	source := p.markets
+	if source == nil {
+		source = markets.Static{DefaultMarket(p.cfg)}
+	}
+	list, err := source.Markets(ctx)
 	if err != nil {
-		return err
+		log.Printf("producer: failed to load markets: %v", err)
+		return
 	}
 
-	for _, listing := range listings {
-		build, err := p.client.FetchBuild(ctx, listing.VIN)
-		if err != nil {
-			continue
+	jobs := make([]scheduler.Job, 0, len(list))
+	for _, m := range list {
+		spec := m.Schedule
+		if spec == "" {
+			spec = p.cfg.IngestSchedule
 		}
+		jobs = append(jobs, scheduler.Job{
+			Name:    "sweep:" + m.Name,
+			Spec:    spec,
+			Version: fmt.Sprintf("%+v", m),
+			Run: func(ctx context.Context) (map[string]int, error) {
+				return p.SweepMarket(ctx, m)
+			},
+		})
+	}
+	if err := sched.Set(ctx, jobs); err != nil {
+		log.Printf("producer: %v", err)
+	}
+}
 
-		priceSnapshot := marketcheck.PricePoint{
-			Price: listing.Price,
-			Date:  time.Now(),
+// SweepMarket sends every listing in a market to Kafka, logging and
+// recording the counts, which it also returns.
+func (p *Producer) SweepMarket(ctx context.Context, m markets.Market) (map[string]int, error) {
+	sweep, err := p.sweepMarket(ctx, m)
+	log.Printf("producer sweep %s (run %s): %d pages, %d found, %d sent, %d duplicates, %d failed",
+		m.Name, sweep.RunID, sweep.Pages, sweep.Found, sweep.Sent, sweep.Duplicates, sweep.Failed)
+	if p.recorder != nil {
+		if err := p.recorder.RecordSweep(ctx, sweep); err != nil {
+			log.Printf("producer: failed to record sweep of %s: %v", m.Name, err)
 		}
+	}
+	return map[string]int{
+		"pages":      sweep.Pages,
+		"found":      sweep.Found,
+		"sent":       sweep.Sent,
+		"duplicates": sweep.Duplicates,
+		"failed":     sweep.Failed,
+	}, err
+}
 
-		enriched := marketcheck.EnrichedListing{
-			Listing:      listing,
-			Build:        *build,
-			PriceHistory: []marketcheck.PricePoint{priceSnapshot},
-			Valuation:    marketcheck.Valuation{},
+func (p *Producer) sweepMarket(ctx context.Context, m markets.Market) (markets.Sweep, error) {
+	sweep := markets.Sweep{Market: m.Name, RunID: kafka.NewID(), StartedAt: time.Now().UTC()}
+	ctx = kafka.WithRunID(ctx, sweep.RunID)
+	seen := make(map[string]bool)
+
+	maxPages := p.cfg.SearchMaxPages
+	if m.MaxPages > 0 {
+		maxPages = m.MaxPages
+	}
+	it := marketcheck.NewSearchIterator(p.client, m.Params(), marketcheck.PageOptions{
+		PageSize: p.cfg.SearchPageSize,
+		MaxPages: maxPages,
+	})
+
+	for it.Next(ctx) {
+		for _, listing := range it.Page().Listings {
+			if seen[listing.VIN] {
+				sweep.Duplicates++
+				continue
+			}
+			seen[listing.VIN] = true
+
+			build, err := p.client.FetchBuild(ctx, listing.VIN)
+			if err != nil {
+				sweep.Failed++
+				continue
+			}
+
+			priceSnapshot := marketcheck.PricePoint{
+				Price: listing.Price,
+				Date:  time.Now(),
+			}
+
+			enriched := marketcheck.EnrichedListing{
+				Listing:      listing,
+				Build:        *build,
+				PriceHistory: []marketcheck.PricePoint{priceSnapshot},
+				Valuation:    marketcheck.Valuation{},
+			}
+			if p.safety != nil {
+				if info, err := p.safety.ForBuild(ctx, *build); err == nil {
+					enriched.Safety = info
+				} else {
+					log.Printf("producer: no safety data for %s: %v", listing.VIN, err)
+				}
+			}
+
+			if err := p.writer.Write(ctx, enriched); err == nil {
+				sweep.Sent++
+			} else {
+				sweep.Failed++
+			}
 		}
+	}
 
-		_ = p.writer.Write(ctx, enriched)
+	sweep.Pages = it.Pages()
+	sweep.Found = it.NumFound()
+	sweep.FinishedAt = time.Now().UTC()
+	if err := it.Err(); err != nil {
+		sweep.Error = err.Error()
+		return sweep, err
 	}
-	return nil
+	return sweep, nil
 }
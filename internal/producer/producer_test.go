@@ -0,0 +1,40 @@
+package producer
+
+import (
+	"testing"
+
+	"github.com/omerahmer/motor_metrics/internal/config"
+)
+
+func TestDefaultMarket(t *testing.T) {
+	tests := []struct {
+		name       string
+		zip        string
+		radius     int
+		wantZip    string
+		wantRadius int
+	}{
+		{"leading zero zip", "02134", 50, "02134", 50},
+		{"plain zip", "92617", 100, "92617", 100},
+		{"no zip ignores radius", "", 100, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Make: "honda", Model: "civic", Zip: tt.zip, Radius: tt.radius}
+			m := DefaultMarket(cfg)
+			if m.Zip != tt.wantZip || m.Radius != tt.wantRadius {
+				t.Fatalf("DefaultMarket() zip %q radius %d, want %q and %d", m.Zip, m.Radius, tt.wantZip, tt.wantRadius)
+			}
+			if err := m.Validate(); err != nil {
+				t.Fatalf("DefaultMarket().Validate() = %v", err)
+			}
+		})
+	}
+}
+
+func TestDefaultMarketRejectsBadZip(t *testing.T) {
+	cfg := &config.Config{Make: "honda", Zip: "2134", Radius: 50}
+	if err := DefaultMarket(cfg).Validate(); err == nil {
+		t.Fatal("Validate() accepted a four-digit zip")
+	}
+}
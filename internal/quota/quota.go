@@ -0,0 +1,212 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("marketcheck quota exceeded")
+
+type Level int
+
+const (
+	LevelOK Level = iota
+	LevelSoft
+	LevelHard
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelSoft:
+		return "soft_limit"
+	case LevelHard:
+		return "hard_limit"
+	}
+	return "ok"
+}
+
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Budget is a soft/hard pair of call counts. Zero disables that threshold.
+type Budget struct {
+	Soft int `json:"soft"`
+	Hard int `json:"hard"`
+}
+
+func (b Budget) level(used int) Level {
+	if b.Hard > 0 && used >= b.Hard {
+		return LevelHard
+	}
+	if b.Soft > 0 && used >= b.Soft {
+		return LevelSoft
+	}
+	return LevelOK
+}
+
+type Limits struct {
+	Daily   Budget
+	Monthly Budget
+}
+
+// Store keeps call counts. ReserveAPICall must check both hard budgets and
+// record the call atomically, reporting false without recording anything
+// when either budget is already used up. A hard budget of 0 is unlimited.
+type Store interface {
+	ReserveAPICall(ctx context.Context, endpoint, day, month string, dailyHard, monthlyHard int) (bool, error)
+	GetAPIUsage(ctx context.Context, period, bucket string) (map[string]int, error)
+}
+
+type PeriodUsage struct {
+	Period    string         `json:"period"`
+	Bucket    string         `json:"bucket"`
+	Total     int            `json:"total"`
+	Endpoints map[string]int `json:"endpoints"`
+	Budget    Budget         `json:"budget"`
+	Status    string         `json:"status"`
+}
+
+type Usage struct {
+	Day   PeriodUsage `json:"day"`
+	Month PeriodUsage `json:"month"`
+	Level Level       `json:"-"`
+}
+
+type Manager struct {
+	store  Store
+	limits Limits
+	now    func() time.Time
+}
+
+func NewManager(store Store, limits Limits) *Manager {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Manager{
+		store:  store,
+		limits: limits,
+		now:    time.Now,
+	}
+}
+
+func buckets(t time.Time) (string, string) {
+	t = t.UTC()
+	return t.Format("2006-01-02"), t.Format("2006-01")
+}
+
+func (m *Manager) Usage(ctx context.Context) (*Usage, error) {
+	day, month := buckets(m.now())
+
+	dayUsage, err := m.periodUsage(ctx, PeriodDay, day, m.limits.Daily)
+	if err != nil {
+		return nil, err
+	}
+	monthUsage, err := m.periodUsage(ctx, PeriodMonth, month, m.limits.Monthly)
+	if err != nil {
+		return nil, err
+	}
+
+	level := max(m.limits.Daily.level(dayUsage.Total), m.limits.Monthly.level(monthUsage.Total))
+	return &Usage{Day: *dayUsage, Month: *monthUsage, Level: level}, nil
+}
+
+func (m *Manager) periodUsage(ctx context.Context, period, bucket string, budget Budget) (*PeriodUsage, error) {
+	endpoints, err := m.store.GetAPIUsage(ctx, period, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s usage: %w", period, err)
+	}
+	total := 0
+	for _, n := range endpoints {
+		total += n
+	}
+	return &PeriodUsage{
+		Period:    period,
+		Bucket:    bucket,
+		Total:     total,
+		Endpoints: endpoints,
+		Budget:    budget,
+		Status:    budget.level(total).String(),
+	}, nil
+}
+
+// Level reports the most severe budget state across periods. Store errors
+// are treated as LevelOK so that a database blip doesn't block the API.
+func (m *Manager) Level(ctx context.Context) Level {
+	usage, err := m.Usage(ctx)
+	if err != nil {
+		return LevelOK
+	}
+	return usage.Level
+}
+
+// Reserve records a billable call against endpoint, or returns
+// ErrQuotaExceeded if a hard budget has already been reached. The check and
+// the increment happen in one store call so concurrent sweeps can't overrun
+// the hard budget between them.
+func (m *Manager) Reserve(ctx context.Context, endpoint string) error {
+	day, month := buckets(m.now())
+	ok, err := m.store.ReserveAPICall(ctx, endpoint, day, month, m.limits.Daily.Hard, m.limits.Monthly.Hard)
+	if err != nil {
+		return fmt.Errorf("failed to record api call: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, endpoint)
+	}
+	return nil
+}
+
+type MemoryStore struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counts: make(map[string]map[string]int),
+	}
+}
+
+func (s *MemoryStore) ReserveAPICall(ctx context.Context, endpoint, day, month string, dailyHard, monthlyHard int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dailyHard > 0 && s.total(PeriodDay, day) >= dailyHard {
+		return false, nil
+	}
+	if monthlyHard > 0 && s.total(PeriodMonth, month) >= monthlyHard {
+		return false, nil
+	}
+	s.record(endpoint, PeriodDay, day)
+	s.record(endpoint, PeriodMonth, month)
+	return true, nil
+}
+
+func (s *MemoryStore) total(period, bucket string) int {
+	total := 0
+	for _, n := range s.counts[period+":"+bucket] {
+		total += n
+	}
+	return total
+}
+
+func (s *MemoryStore) record(endpoint, period, bucket string) {
+	key := period + ":" + bucket
+	if s.counts[key] == nil {
+		s.counts[key] = make(map[string]int)
+	}
+	s.counts[key][endpoint]++
+}
+
+func (s *MemoryStore) GetAPIUsage(ctx context.Context, period, bucket string) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := make(map[string]int)
+	for endpoint, n := range s.counts[period+":"+bucket] {
+		usage[endpoint] = n
+	}
+	return usage, nil
+}
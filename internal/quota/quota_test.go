@@ -0,0 +1,97 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestManager(limits Limits, now time.Time) *Manager {
+	m := NewManager(NewMemoryStore(), limits)
+	m.now = func() time.Time { return now }
+	return m
+}
+
+func TestReserveStopsAtHardBudget(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(Limits{Daily: Budget{Soft: 2, Hard: 3}}, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	for i := 0; i < 3; i++ {
+		if err := m.Reserve(ctx, "search"); err != nil {
+			t.Fatalf("reserve %d: %v", i, err)
+		}
+	}
+	if err := m.Reserve(ctx, "search"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("err = %v, want ErrQuotaExceeded", err)
+	}
+
+	usage, err := m.Usage(ctx)
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.Day.Total != 3 || usage.Month.Total != 3 || usage.Level != LevelHard {
+		t.Fatalf("usage = day %d month %d level %v, want 3/3 hard", usage.Day.Total, usage.Month.Total, usage.Level)
+	}
+}
+
+func TestReserveMonthlyBudgetSpansDays(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m := newTestManager(Limits{Daily: Budget{Hard: 2}, Monthly: Budget{Hard: 3}}, now)
+
+	for i := 0; i < 2; i++ {
+		if err := m.Reserve(ctx, "search"); err != nil {
+			t.Fatalf("reserve %d: %v", i, err)
+		}
+	}
+	if err := m.Reserve(ctx, "search"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("daily cap: err = %v, want ErrQuotaExceeded", err)
+	}
+
+	m.now = func() time.Time { return now.Add(24 * time.Hour) }
+	if err := m.Reserve(ctx, "build"); err != nil {
+		t.Fatalf("next day: %v", err)
+	}
+	if err := m.Reserve(ctx, "build"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("monthly cap: err = %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestReserveConcurrentNeverExceedsHard(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(Limits{Monthly: Budget{Hard: 50}}, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m.Reserve(ctx, "search") == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 50 {
+		t.Fatalf("reserved %d calls, want 50", reserved)
+	}
+}
+
+func TestZeroBudgetIsUnlimited(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(Limits{}, time.Now())
+	for i := 0; i < 100; i++ {
+		if err := m.Reserve(ctx, "search"); err != nil {
+			t.Fatalf("reserve %d: %v", i, err)
+		}
+	}
+	if level := m.Level(ctx); level != LevelOK {
+		t.Fatalf("level = %v, want ok", level)
+	}
+}
@@ -2,24 +2,134 @@ package repository
 
 import (
 	"context"
+	"time"
 
+	"github.com/omerahmer/motor_metrics/internal/analytics"
+	"github.com/omerahmer/motor_metrics/internal/catalog"
+	"github.com/omerahmer/motor_metrics/internal/lifecycle"
 	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/markets"
+	"github.com/omerahmer/motor_metrics/internal/nhtsa"
+	"github.com/omerahmer/motor_metrics/internal/outbox"
+	"github.com/omerahmer/motor_metrics/internal/pricewatch"
+	"github.com/omerahmer/motor_metrics/internal/savedsearch"
+	"github.com/omerahmer/motor_metrics/internal/scheduler"
+	"github.com/omerahmer/motor_metrics/internal/valuation"
+	"github.com/omerahmer/motor_metrics/internal/webhooks"
 )
 
 type PriceRepository interface {
 	AddPrice(ctx context.Context, vin string, point marketcheck.PricePoint) error
 	GetHistory(ctx context.Context, vin string) ([]marketcheck.PricePoint, error)
+	GetHistories(ctx context.Context, vins []string) (map[string][]marketcheck.PricePoint, error)
 	Close() error
 }
 
 type ListingRepository interface {
 	SaveListing(ctx context.Context, listing *marketcheck.EnrichedListing) error
+	SaveListings(ctx context.Context, listings []*marketcheck.EnrichedListing) error
+	SaveBatch(ctx context.Context, points map[string]marketcheck.PricePoint, listings []*marketcheck.EnrichedListing) error
 	GetListingByVIN(ctx context.Context, vin string) (*marketcheck.EnrichedListing, error)
 	GetListings(ctx context.Context, filters ListingFilters) ([]*marketcheck.EnrichedListing, error)
 	GetModelsForMake(ctx context.Context, make string) ([]string, error)
 	Close() error
 }
 
+type QuotaRepository interface {
+	ReserveAPICall(ctx context.Context, endpoint, day, month string, dailyHard, monthlyHard int) (bool, error)
+	GetAPIUsage(ctx context.Context, period, bucket string) (map[string]int, error)
+}
+
+type VINQuarantine interface {
+	QuarantineVIN(ctx context.Context, rawVIN, source, reason string, payload []byte) error
+}
+
+type CatalogRepository interface {
+	UpsertMakes(ctx context.Context, makes []catalog.MakeRecord) error
+	UpsertModels(ctx context.Context, models []nhtsa.Model) error
+	GetCatalogMakes(ctx context.Context, vehicleType string) ([]string, error)
+	GetCatalogModels(ctx context.Context, make string) ([]string, error)
+	GetListingMakes(ctx context.Context) ([]string, error)
+}
+
+type SafetyRepository interface {
+	GetSafety(ctx context.Context, make, model string, year int) (*marketcheck.Safety, error)
+	SaveSafety(ctx context.Context, make, model string, year int, safety *marketcheck.Safety) error
+}
+
+type ComparablesRepository interface {
+	FindComparables(ctx context.Context, make, model string, yearMin, yearMax, limit int) ([]valuation.Comparable, error)
+}
+
+type DepreciationRepository interface {
+	DepreciationObservations(ctx context.Context) ([]analytics.Observation, error)
+	SaveDepreciationCurves(ctx context.Context, curves []analytics.Curve) error
+	GetDepreciationCurves(ctx context.Context, make, model string) ([]analytics.Curve, error)
+}
+
+type PriceEventRepository interface {
+	RecordPriceEvent(ctx context.Context, ev pricewatch.PriceChanged) (int64, bool, error)
+	MarkPriceEventPublished(ctx context.Context, id int64) error
+	PendingPriceEvents(ctx context.Context, before time.Time, limit int) ([]pricewatch.PendingEvent, error)
+	ListingSold(ctx context.Context, vin string) (bool, error)
+	GetPriceEvents(ctx context.Context, filters PriceEventFilters) ([]pricewatch.PriceChanged, error)
+}
+
+type SavedSearchRepository interface {
+	CreateSavedSearch(ctx context.Context, s *savedsearch.SavedSearch) error
+	GetSavedSearch(ctx context.Context, id int64) (*savedsearch.SavedSearch, error)
+	ListSavedSearches(ctx context.Context) ([]savedsearch.SavedSearch, error)
+	UpdateSavedSearch(ctx context.Context, s *savedsearch.SavedSearch) (bool, error)
+	DeleteSavedSearch(ctx context.Context, id int64) (bool, error)
+	GetSearchMatch(ctx context.Context, searchID int64, vin string) (int, bool, error)
+	SaveSearchMatch(ctx context.Context, searchID int64, vin string, price int, notified bool) error
+	LocateZip(ctx context.Context, zip string) (float64, float64, bool, error)
+}
+
+type LifecycleRepository interface {
+	MarkListingsSold(ctx context.Context, cutoff, now time.Time) ([]lifecycle.Sold, error)
+	PendingSoldListings(ctx context.Context, limit int) ([]lifecycle.Sold, error)
+	MarkSoldPublished(ctx context.Context, vin string, soldAt time.Time) error
+	GetSoldListings(ctx context.Context, filters SoldFilters) ([]lifecycle.Sold, error)
+	GetTimeToSale(ctx context.Context, filters SoldFilters) ([]lifecycle.TimeToSale, error)
+}
+
+type MarketRepository interface {
+	ListTrackedMarkets(ctx context.Context) ([]markets.Market, error)
+	RecordSweep(ctx context.Context, s markets.Sweep) error
+	GetMarketSweeps(ctx context.Context, market string, limit int) ([]markets.Sweep, error)
+}
+
+type JobRepository interface {
+	AcquireLease(ctx context.Context, job, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, job, holder string) error
+	StartJobRun(ctx context.Context, job, holder string, scheduledFor time.Time) (int64, bool, error)
+	FinishJobRun(ctx context.Context, id int64, status string, counts map[string]int, errMsg string) error
+	LastJobRun(ctx context.Context, job string) (time.Time, bool, error)
+	GetJobRuns(ctx context.Context, filters JobRunFilters) ([]scheduler.Run, error)
+}
+
+type OutboxRepository interface {
+	SaveListingsWithOutbox(ctx context.Context, listings []*marketcheck.EnrichedListing, source, traceID string) error
+	PendingOutbox(ctx context.Context, limit int) ([]outbox.Message, error)
+	MarkOutboxPublished(ctx context.Context, ids []int64) error
+	PruneOutbox(ctx context.Context, before time.Time) (int, error)
+}
+
+type WebhookRepository interface {
+	CreateWebhookSubscription(ctx context.Context, s *webhooks.Subscription) error
+	GetWebhookSubscription(ctx context.Context, id int64) (*webhooks.Subscription, error)
+	ListWebhookSubscriptions(ctx context.Context) ([]webhooks.Subscription, error)
+	UpdateWebhookSubscription(ctx context.Context, s *webhooks.Subscription) (bool, error)
+	DeleteWebhookSubscription(ctx context.Context, id int64) (bool, error)
+	EnqueueEvent(ctx context.Context, ev webhooks.Event, payload []byte) (int, error)
+	ClaimDeliveries(ctx context.Context, limit, perSubscription int, lease time.Duration) ([]webhooks.Claim, error)
+	RecordAttempt(ctx context.Context, deliveryID int64, a webhooks.Attempt, status string, nextAttemptAt time.Time) error
+	GetWebhookDeliveries(ctx context.Context, filters WebhookDeliveryFilters) ([]webhooks.Delivery, error)
+	GetWebhookDelivery(ctx context.Context, id int64) (*webhooks.Delivery, error)
+	ReplayWebhookDeliveries(ctx context.Context, filters WebhookDeliveryFilters, ids ...int64) (int, error)
+}
+
 type ListingFilters struct {
 	Make   string
 	Model  string
@@ -27,4 +137,38 @@ type ListingFilters struct {
 	Radius int
 	Limit  int
 	Offset int
+	// ActiveOnly leaves out listings that have been marked sold.
+	ActiveOnly bool
+}
+
+type PriceEventFilters struct {
+	VIN   string
+	Kind  string
+	Make  string
+	Model string
+	Since time.Time
+	Limit int
+}
+
+type WebhookDeliveryFilters struct {
+	SubscriptionID int64
+	Status         string
+	EventType      string
+	Limit          int
+}
+
+type SoldFilters struct {
+	Make     string
+	Model    string
+	DealerID int
+	Since    time.Time
+	// GroupBy is "model" or "dealer", for GetTimeToSale.
+	GroupBy string
+	Limit   int
+}
+
+type JobRunFilters struct {
+	Job    string
+	Status string
+	Limit  int
 }
@@ -5,10 +5,24 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/omerahmer/motor_metrics/internal/analytics"
+	"github.com/omerahmer/motor_metrics/internal/catalog"
+	"github.com/omerahmer/motor_metrics/internal/lifecycle"
 	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/markets"
+	"github.com/omerahmer/motor_metrics/internal/nhtsa"
+	"github.com/omerahmer/motor_metrics/internal/outbox"
+	"github.com/omerahmer/motor_metrics/internal/pricewatch"
+	"github.com/omerahmer/motor_metrics/internal/savedsearch"
+	"github.com/omerahmer/motor_metrics/internal/scheduler"
+	"github.com/omerahmer/motor_metrics/internal/valuation"
+	"github.com/omerahmer/motor_metrics/internal/vin"
+	"github.com/omerahmer/motor_metrics/internal/webhooks"
 )
 
 type PostgresRepository struct {
@@ -79,6 +93,284 @@ func (r *PostgresRepository) initSchema(ctx context.Context) error {
 		BEFORE UPDATE ON listings
 		FOR EACH ROW
 		EXECUTE FUNCTION update_updated_at_column();
+
+	CREATE TABLE IF NOT EXISTS api_quota_usage (
+		endpoint VARCHAR(32) NOT NULL,
+		period VARCHAR(8) NOT NULL,
+		bucket VARCHAR(10) NOT NULL,
+		calls INTEGER NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (endpoint, period, bucket)
+	);
+
+	CREATE TABLE IF NOT EXISTS quarantined_vins (
+		id SERIAL PRIMARY KEY,
+		raw_vin VARCHAR(64) NOT NULL,
+		source VARCHAR(32) NOT NULL,
+		reason TEXT NOT NULL,
+		payload JSONB,
+		occurrences INTEGER NOT NULL DEFAULT 1,
+		first_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(raw_vin, source)
+	);
+
+	CREATE TABLE IF NOT EXISTS makes (
+		id INTEGER PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		vehicle_types TEXT[] NOT NULL DEFAULT '{}',
+		synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_makes_name ON makes(LOWER(name));
+
+	CREATE TABLE IF NOT EXISTS models (
+		id INTEGER PRIMARY KEY,
+		make_id INTEGER NOT NULL REFERENCES makes(id),
+		name VARCHAR(100) NOT NULL,
+		vehicle_types TEXT[] NOT NULL DEFAULT '{}',
+		synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_models_make_id ON models(make_id);
+
+	CREATE TABLE IF NOT EXISTS vehicle_safety (
+		make VARCHAR(100) NOT NULL,
+		model VARCHAR(100) NOT NULL,
+		model_year INTEGER NOT NULL,
+		complaint_count INTEGER NOT NULL DEFAULT 0,
+		crash_count INTEGER NOT NULL DEFAULT 0,
+		fire_count INTEGER NOT NULL DEFAULT 0,
+		injury_count INTEGER NOT NULL DEFAULT 0,
+		death_count INTEGER NOT NULL DEFAULT 0,
+		fetched_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (make, model, model_year)
+	);
+
+	CREATE TABLE IF NOT EXISTS vehicle_recalls (
+		make VARCHAR(100) NOT NULL,
+		model VARCHAR(100) NOT NULL,
+		model_year INTEGER NOT NULL,
+		campaign VARCHAR(32) NOT NULL,
+		component TEXT,
+		summary TEXT,
+		consequence TEXT,
+		remedy TEXT,
+		report_date DATE,
+		park_it BOOLEAN NOT NULL DEFAULT FALSE,
+		park_outside BOOLEAN NOT NULL DEFAULT FALSE,
+		over_the_air BOOLEAN NOT NULL DEFAULT FALSE,
+		PRIMARY KEY (make, model, model_year, campaign),
+		FOREIGN KEY (make, model, model_year) REFERENCES vehicle_safety(make, model, model_year) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS depreciation_curves (
+		make VARCHAR(100) NOT NULL,
+		model VARCHAR(100) NOT NULL,
+		trim VARCHAR(100) NOT NULL DEFAULT '',
+		intercept DOUBLE PRECISION NOT NULL,
+		age_coef DOUBLE PRECISION NOT NULL,
+		miles_coef DOUBLE PRECISION NOT NULL,
+		sigma DOUBLE PRECISION NOT NULL,
+		r_squared DOUBLE PRECISION NOT NULL,
+		observations INTEGER NOT NULL,
+		min_age DOUBLE PRECISION NOT NULL,
+		max_age DOUBLE PRECISION NOT NULL,
+		fitted_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (make, model, trim)
+	);
+
+	CREATE TABLE IF NOT EXISTS price_events (
+		id BIGSERIAL PRIMARY KEY,
+		vin VARCHAR(17) NOT NULL,
+		kind VARCHAR(16) NOT NULL,
+		old_price INTEGER NOT NULL,
+		new_price INTEGER NOT NULL,
+		change INTEGER NOT NULL,
+		change_percent DOUBLE PRECISION NOT NULL,
+		consecutive_drops INTEGER NOT NULL DEFAULT 0,
+		previous_seen_at TIMESTAMP NOT NULL,
+		occurred_at TIMESTAMP NOT NULL,
+		make VARCHAR(100),
+		model VARCHAR(100),
+		year INTEGER,
+		trim VARCHAR(100),
+		miles INTEGER,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		UNIQUE(vin, occurred_at, kind)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_price_events_vin ON price_events(vin);
+	CREATE INDEX IF NOT EXISTS idx_price_events_occurred_at ON price_events(occurred_at);
+
+	CREATE TABLE IF NOT EXISTS saved_searches (
+		id BIGSERIAL PRIMARY KEY,
+		name VARCHAR(200) NOT NULL,
+		search JSONB NOT NULL,
+		latitude DOUBLE PRECISION,
+		longitude DOUBLE PRECISION,
+		notify_new BOOLEAN NOT NULL DEFAULT TRUE,
+		notify_drops BOOLEAN NOT NULL DEFAULT TRUE,
+		min_drop_amount INTEGER NOT NULL DEFAULT 0,
+		min_drop_percent DOUBLE PRECISION NOT NULL DEFAULT 0,
+		webhook_url TEXT,
+		email VARCHAR(320),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS saved_search_matches (
+		search_id BIGINT NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+		vin VARCHAR(17) NOT NULL,
+		price INTEGER NOT NULL,
+		first_matched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_notified_at TIMESTAMP,
+		PRIMARY KEY (search_id, vin)
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id BIGSERIAL PRIMARY KEY,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		event_types TEXT[] NOT NULL DEFAULT '{}',
+		description TEXT,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		subscription_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+		event_id VARCHAR(64) NOT NULL,
+		event_type VARCHAR(64) NOT NULL,
+		payload JSONB NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_status_code INTEGER,
+		last_error TEXT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		delivered_at TIMESTAMP,
+		UNIQUE(subscription_id, event_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, created_at);
+
+	CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+		id BIGSERIAL PRIMARY KEY,
+		delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+		attempt INTEGER NOT NULL,
+		status_code INTEGER,
+		error TEXT,
+		duration_ms INTEGER NOT NULL,
+		attempted_at TIMESTAMP NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery ON webhook_delivery_attempts(delivery_id);
+
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active';
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS sold_at TIMESTAMP;
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS final_price INTEGER;
+
+	UPDATE listings SET last_seen_at = COALESCE(updated_at, created_at, CURRENT_TIMESTAMP) WHERE last_seen_at IS NULL;
+
+	CREATE INDEX IF NOT EXISTS idx_listings_status_last_seen ON listings(status, last_seen_at);
+	CREATE INDEX IF NOT EXISTS idx_listings_sold_at ON listings(sold_at) WHERE status = 'sold';
+
+	CREATE TABLE IF NOT EXISTS tracked_markets (
+		name VARCHAR(100) PRIMARY KEY,
+		make VARCHAR(100) NOT NULL,
+		model VARCHAR(100),
+		zip VARCHAR(10),
+		radius INTEGER,
+		year_min INTEGER,
+		year_max INTEGER,
+		max_pages INTEGER,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS market_sweeps (
+		id BIGSERIAL PRIMARY KEY,
+		market VARCHAR(100) NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP NOT NULL,
+		pages INTEGER NOT NULL,
+		found INTEGER NOT NULL,
+		sent INTEGER NOT NULL,
+		duplicates INTEGER NOT NULL,
+		failed INTEGER NOT NULL,
+		error TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_market_sweeps_market ON market_sweeps(market, started_at);
+
+	ALTER TABLE tracked_markets ADD COLUMN IF NOT EXISTS schedule VARCHAR(100);
+
+	CREATE TABLE IF NOT EXISTS job_leases (
+		job VARCHAR(200) PRIMARY KEY,
+		holder VARCHAR(200) NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS job_runs (
+		id BIGSERIAL PRIMARY KEY,
+		job VARCHAR(200) NOT NULL,
+		holder VARCHAR(200) NOT NULL,
+		scheduled_for TIMESTAMP NOT NULL,
+		started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		finished_at TIMESTAMP,
+		status VARCHAR(16) NOT NULL,
+		counts JSONB,
+		error TEXT,
+		UNIQUE(job, scheduled_for)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_job_runs_started ON job_runs(started_at);
+
+	ALTER TABLE market_sweeps ADD COLUMN IF NOT EXISTS run_id VARCHAR(64);
+
+	CREATE TABLE IF NOT EXISTS listing_outbox (
+		id BIGSERIAL PRIMARY KEY,
+		vin VARCHAR(17) NOT NULL,
+		payload JSONB NOT NULL,
+		source VARCHAR(50) NOT NULL,
+		trace_id VARCHAR(64),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		published_at TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_listing_outbox_pending ON listing_outbox(id) WHERE published_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_listing_outbox_published ON listing_outbox(published_at);
+
+	CREATE TABLE IF NOT EXISTS api_quota_counters (
+		month VARCHAR(7) PRIMARY KEY,
+		month_calls INTEGER NOT NULL DEFAULT 0,
+		day VARCHAR(10) NOT NULL,
+		day_calls INTEGER NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- The default only backfills events recorded before the column existed;
+	-- new events start unpublished.
+	ALTER TABLE price_events ADD COLUMN IF NOT EXISTS published_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+	ALTER TABLE price_events ALTER COLUMN published_at DROP DEFAULT;
+	CREATE INDEX IF NOT EXISTS idx_price_events_unpublished ON price_events(created_at) WHERE published_at IS NULL;
+
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS sold_detected_at TIMESTAMP;
+	UPDATE listings SET sold_detected_at = COALESCE(updated_at, sold_at) WHERE status = 'sold' AND sold_detected_at IS NULL;
+	-- As with price_events.published_at, only listings sold before the
+	-- column existed count as published.
+	ALTER TABLE listings ADD COLUMN IF NOT EXISTS sold_published_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+	ALTER TABLE listings ALTER COLUMN sold_published_at DROP DEFAULT;
+	CREATE INDEX IF NOT EXISTS idx_listings_sold_unpublished ON listings(sold_detected_at) WHERE status = 'sold' AND sold_published_at IS NULL;
+
+	ALTER TABLE price_history ADD COLUMN IF NOT EXISTS miles INTEGER;
 	`
 
 	_, err := r.db.ExecContext(ctx, schema)
@@ -87,11 +379,11 @@ func (r *PostgresRepository) initSchema(ctx context.Context) error {
 
 func (r *PostgresRepository) AddPrice(ctx context.Context, vin string, point marketcheck.PricePoint) error {
 	query := `
-		INSERT INTO price_history (vin, price, date)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (vin, date) DO UPDATE SET price = EXCLUDED.price
+		INSERT INTO price_history (vin, price, date, miles)
+		VALUES ($1, $2, $3, NULLIF($4, 0))
+		ON CONFLICT (vin, date) DO UPDATE SET price = EXCLUDED.price, miles = EXCLUDED.miles
 	`
-	_, err := r.db.ExecContext(ctx, query, vin, point.Price, point.Date)
+	_, err := r.db.ExecContext(ctx, query, vin, point.Price, point.Date, point.Miles)
 	return err
 }
 
@@ -119,33 +411,222 @@ func (r *PostgresRepository) GetHistory(ctx context.Context, vin string) ([]mark
 	return points, rows.Err()
 }
 
+// GetHistories returns the price history of each VIN, oldest first.
+func (r *PostgresRepository) GetHistories(ctx context.Context, vins []string) (map[string][]marketcheck.PricePoint, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT vin, price, date
+		FROM price_history
+		WHERE vin = ANY($1)
+		ORDER BY vin, date ASC
+	`, pq.Array(vins))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	histories := make(map[string][]marketcheck.PricePoint, len(vins))
+	for rows.Next() {
+		var v string
+		var point marketcheck.PricePoint
+		if err := rows.Scan(&v, &point.Price, &point.Date); err != nil {
+			return nil, err
+		}
+		histories[v] = append(histories[v], point)
+	}
+	return histories, rows.Err()
+}
+
+// SaveBatch adds a price per VIN and saves the listings in one transaction,
+// so a batch is either written whole or not at all.
+func (r *PostgresRepository) SaveBatch(ctx context.Context, points map[string]marketcheck.PricePoint, listings []*marketcheck.EnrichedListing) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := addPrices(ctx, tx, points); err != nil {
+		return err
+	}
+	if err := saveListings(ctx, tx, listings); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addPrices(ctx context.Context, tx *sql.Tx, points map[string]marketcheck.PricePoint) error {
+	vins := make([]string, 0, len(points))
+	for v := range points {
+		vins = append(vins, v)
+	}
+	// A fixed order keeps concurrent batches from deadlocking.
+	sort.Strings(vins)
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO price_history (vin, price, date, miles)
+		VALUES ($1, $2, $3, NULLIF($4, 0))
+		ON CONFLICT (vin, date) DO UPDATE SET price = EXCLUDED.price, miles = EXCLUDED.miles
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, v := range vins {
+		p := points[v]
+		if _, err := stmt.ExecContext(ctx, v, p.Price, p.Date, p.Miles); err != nil {
+			return fmt.Errorf("failed to add price for %s: %w", v, err)
+		}
+	}
+	return nil
+}
+
 func (r *PostgresRepository) SaveListing(ctx context.Context, listing *marketcheck.EnrichedListing) error {
 	listingJSON, err := json.Marshal(listing.Listing)
 	if err != nil {
 		return fmt.Errorf("failed to marshal listing: %w", err)
 	}
 
+	parsed, err := vin.Parse(listing.Listing.VIN)
+	if err != nil {
+		if qErr := r.QuarantineVIN(ctx, listing.Listing.VIN, "repository", err.Error(), listingJSON); qErr != nil {
+			return fmt.Errorf("failed to quarantine invalid vin %q: %w", listing.Listing.VIN, qErr)
+		}
+		return fmt.Errorf("refusing to save listing: %w", err)
+	}
+	listing.Listing.VIN = parsed.Value
+
+	args, err := listingArgs(listing)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, saveListingQuery, args...)
+	return err
+}
+
+// SaveListings saves listings in one transaction. Unlike SaveListing it
+// doesn't quarantine invalid VINs; it fails and saves nothing.
+func (r *PostgresRepository) SaveListings(ctx context.Context, listings []*marketcheck.EnrichedListing) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := saveListings(ctx, tx, listings); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveListings(ctx context.Context, tx *sql.Tx, listings []*marketcheck.EnrichedListing) error {
+	stmt, err := tx.PrepareContext(ctx, saveListingQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, listing := range listings {
+		parsed, err := vin.Parse(listing.Listing.VIN)
+		if err != nil {
+			return fmt.Errorf("refusing to save listing: %w", err)
+		}
+		listing.Listing.VIN = parsed.Value
+
+		args, err := listingArgs(listing)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return fmt.Errorf("failed to save listing %s: %w", listing.Listing.VIN, err)
+		}
+	}
+	return nil
+}
+
+// SaveListingsWithOutbox saves listings like SaveListings and, in the same
+// transaction, queues each in the outbox for the relay to publish.
+func (r *PostgresRepository) SaveListingsWithOutbox(ctx context.Context, listings []*marketcheck.EnrichedListing, source, traceID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	save, err := tx.PrepareContext(ctx, saveListingQuery)
+	if err != nil {
+		return err
+	}
+	defer save.Close()
+
+	queue, err := tx.PrepareContext(ctx, `
+		INSERT INTO listing_outbox (vin, payload, source, trace_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+	`)
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+
+	for _, listing := range listings {
+		parsed, err := vin.Parse(listing.Listing.VIN)
+		if err != nil {
+			return fmt.Errorf("refusing to save listing: %w", err)
+		}
+		listing.Listing.VIN = parsed.Value
+
+		args, err := listingArgs(listing)
+		if err != nil {
+			return err
+		}
+		if _, err := save.ExecContext(ctx, args...); err != nil {
+			return fmt.Errorf("failed to save listing %s: %w", listing.Listing.VIN, err)
+		}
+
+		payload, err := json.Marshal(listing)
+		if err != nil {
+			return fmt.Errorf("failed to marshal listing: %w", err)
+		}
+		if _, err := queue.ExecContext(ctx, listing.Listing.VIN, payload, source, traceID); err != nil {
+			return fmt.Errorf("failed to queue listing %s: %w", listing.Listing.VIN, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Seeing a listing again makes it active, even if it had been marked sold.
+const saveListingQuery = `
+	INSERT INTO listings (vin, listing_data, build_data, valuation_data, last_seen_at)
+	VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+	ON CONFLICT (vin) DO UPDATE SET
+		listing_data = EXCLUDED.listing_data,
+		build_data = EXCLUDED.build_data,
+		valuation_data = EXCLUDED.valuation_data,
+		last_seen_at = CURRENT_TIMESTAMP,
+		status = 'active',
+		sold_at = NULL,
+		final_price = NULL,
+		sold_detected_at = NULL,
+		sold_published_at = NULL,
+		updated_at = CURRENT_TIMESTAMP
+`
+
+func listingArgs(listing *marketcheck.EnrichedListing) ([]any, error) {
+	listingJSON, err := json.Marshal(listing.Listing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal listing: %w", err)
+	}
+
 	buildJSON, err := json.Marshal(listing.Build)
 	if err != nil {
-		return fmt.Errorf("failed to marshal build: %w", err)
+		return nil, fmt.Errorf("failed to marshal build: %w", err)
 	}
 
 	valuationJSON, err := json.Marshal(listing.Valuation)
 	if err != nil {
-		return fmt.Errorf("failed to marshal valuation: %w", err)
+		return nil, fmt.Errorf("failed to marshal valuation: %w", err)
 	}
-
-	query := `
-		INSERT INTO listings (vin, listing_data, build_data, valuation_data)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (vin) DO UPDATE SET
-			listing_data = EXCLUDED.listing_data,
-			build_data = EXCLUDED.build_data,
-			valuation_data = EXCLUDED.valuation_data,
-			updated_at = CURRENT_TIMESTAMP
-	`
-	_, err = r.db.ExecContext(ctx, query, listing.Listing.VIN, listingJSON, buildJSON, valuationJSON)
-	return err
+	return []any{listing.Listing.VIN, listingJSON, buildJSON, valuationJSON}, nil
 }
 
 func (r *PostgresRepository) GetListingByVIN(ctx context.Context, vin string) (*marketcheck.EnrichedListing, error) {
@@ -207,7 +688,11 @@ func (r *PostgresRepository) GetListings(ctx context.Context, filters ListingFil
 		argPos++
 	}
 
-	query += " ORDER BY updated_at DESC"
+	if filters.ActiveOnly {
+		query += " AND status = 'active'"
+	}
+
+	query += " ORDER BY updated_at DESC, vin"
 
 	if filters.Limit > 0 {
 		query += fmt.Sprintf(" LIMIT $%d", argPos)
@@ -287,6 +772,1561 @@ func (r *PostgresRepository) GetModelsForMake(ctx context.Context, make string)
 	return models, rows.Err()
 }
 
+// ReserveAPICall checks and bumps the month's counter row under its row lock,
+// so concurrent callers can't both pass a hard budget. The per-endpoint
+// breakdown is only written when the reservation succeeds, in the same
+// statement.
+func (r *PostgresRepository) ReserveAPICall(ctx context.Context, endpoint, day, month string, dailyHard, monthlyHard int) (bool, error) {
+	query := `
+		WITH reserved AS (
+			INSERT INTO api_quota_counters AS c (month, month_calls, day, day_calls)
+			VALUES ($2, 1, $1, 1)
+			ON CONFLICT (month) DO UPDATE SET
+				month_calls = c.month_calls + 1,
+				day = EXCLUDED.day,
+				day_calls = CASE WHEN c.day = EXCLUDED.day THEN c.day_calls + 1 ELSE 1 END,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE ($4 <= 0 OR c.month_calls < $4)
+				AND ($3 <= 0 OR c.day <> EXCLUDED.day OR c.day_calls < $3)
+			RETURNING month_calls
+		), by_endpoint AS (
+			INSERT INTO api_quota_usage (endpoint, period, bucket, calls)
+			SELECT $5, p.period, p.bucket, 1
+			FROM reserved, (VALUES ('day', $1), ('month', $2)) AS p(period, bucket)
+			ON CONFLICT (endpoint, period, bucket) DO UPDATE SET
+				calls = api_quota_usage.calls + 1,
+				updated_at = CURRENT_TIMESTAMP
+		)
+		SELECT month_calls FROM reserved
+	`
+	var used int
+	err := r.db.QueryRowContext(ctx, query, day, month, dailyHard, monthlyHard, endpoint).Scan(&used)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *PostgresRepository) GetAPIUsage(ctx context.Context, period, bucket string) (map[string]int, error) {
+	query := `
+		SELECT endpoint, calls
+		FROM api_quota_usage
+		WHERE period = $1 AND bucket = $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, period, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make(map[string]int)
+	for rows.Next() {
+		var endpoint string
+		var calls int
+		if err := rows.Scan(&endpoint, &calls); err != nil {
+			return nil, err
+		}
+		usage[endpoint] = calls
+	}
+	return usage, rows.Err()
+}
+
+func (r *PostgresRepository) QuarantineVIN(ctx context.Context, rawVIN, source, reason string, payload []byte) error {
+	if len(rawVIN) > 64 {
+		rawVIN = rawVIN[:64]
+	}
+	var payloadArg interface{}
+	if len(payload) > 0 {
+		payloadArg = payload
+	}
+	query := `
+		INSERT INTO quarantined_vins (raw_vin, source, reason, payload)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (raw_vin, source) DO UPDATE SET
+			reason = EXCLUDED.reason,
+			payload = COALESCE(EXCLUDED.payload, quarantined_vins.payload),
+			occurrences = quarantined_vins.occurrences + 1,
+			last_seen_at = CURRENT_TIMESTAMP
+	`
+	_, err := r.db.ExecContext(ctx, query, rawVIN, source, reason, payloadArg)
+	return err
+}
+
+func (r *PostgresRepository) UpsertMakes(ctx context.Context, makes []catalog.MakeRecord) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO makes (id, name, vehicle_types, synced_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			vehicle_types = EXCLUDED.vehicle_types,
+			synced_at = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, m := range makes {
+		if _, err := stmt.ExecContext(ctx, m.ID, m.Name, pq.Array(m.VehicleTypes)); err != nil {
+			return fmt.Errorf("failed to upsert make %s: %w", m.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// UpsertModels merges rows for the same model under different vehicle types
+// into one row.
+func (r *PostgresRepository) UpsertModels(ctx context.Context, models []nhtsa.Model) error {
+	type row struct {
+		model nhtsa.Model
+		types []string
+	}
+	var order []int
+	merged := make(map[int]*row)
+	for _, m := range models {
+		rw, ok := merged[m.ID]
+		if !ok {
+			rw = &row{model: m}
+			merged[m.ID] = rw
+			order = append(order, m.ID)
+		}
+		if m.VehicleType != "" {
+			rw.types = append(rw.types, m.VehicleType)
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO models (id, make_id, name, vehicle_types, synced_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET
+			make_id = EXCLUDED.make_id,
+			name = EXCLUDED.name,
+			vehicle_types = EXCLUDED.vehicle_types,
+			synced_at = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, id := range order {
+		rw := merged[id]
+		if _, err := stmt.ExecContext(ctx, id, rw.model.MakeID, rw.model.Name, pq.Array(rw.types)); err != nil {
+			return fmt.Errorf("failed to upsert model %s: %w", rw.model.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetCatalogMakes lists synced makes that have at least one model,
+// optionally narrowed to a vehicle type (matched as a substring, so "truck"
+// and "mpv" work).
+func (r *PostgresRepository) GetCatalogMakes(ctx context.Context, vehicleType string) ([]string, error) {
+	query := `
+		SELECT ma.name
+		FROM makes ma
+		WHERE EXISTS (SELECT 1 FROM models mo WHERE mo.make_id = ma.id)
+		AND ($1 = '' OR EXISTS (
+			SELECT 1 FROM unnest(ma.vehicle_types) vt WHERE vt ILIKE '%' || $1 || '%'
+		))
+		ORDER BY ma.name ASC
+	`
+	return r.queryStrings(ctx, query, vehicleType)
+}
+
+func (r *PostgresRepository) GetCatalogModels(ctx context.Context, make string) ([]string, error) {
+	query := `
+		SELECT DISTINCT mo.name
+		FROM models mo
+		JOIN makes ma ON ma.id = mo.make_id
+		WHERE LOWER(ma.name) = LOWER($1)
+		ORDER BY mo.name ASC
+	`
+	return r.queryStrings(ctx, query, make)
+}
+
+// GetListingMakes is the fallback for /api/makes before the first catalog
+// sync.
+func (r *PostgresRepository) GetListingMakes(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT DISTINCT build_data->>'make' as make
+		FROM listings
+		WHERE build_data->>'make' IS NOT NULL
+		AND build_data->>'make' != ''
+		ORDER BY make ASC
+	`
+	return r.queryStrings(ctx, query)
+}
+
+func (r *PostgresRepository) queryStrings(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// GetSafety returns the stored safety data for a model year, or nil if it
+// has never been fetched. make and model are expected lower-cased.
+func (r *PostgresRepository) GetSafety(ctx context.Context, make, model string, year int) (*marketcheck.Safety, error) {
+	safety := &marketcheck.Safety{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT complaint_count, crash_count, fire_count, injury_count, death_count, fetched_at
+		FROM vehicle_safety
+		WHERE make = $1 AND model = $2 AND model_year = $3
+	`, make, model, year).Scan(&safety.ComplaintCount, &safety.CrashCount, &safety.FireCount,
+		&safety.InjuryCount, &safety.DeathCount, &safety.FetchedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT campaign, COALESCE(component, ''), COALESCE(summary, ''), COALESCE(consequence, ''),
+			COALESCE(remedy, ''), report_date, park_it, park_outside, over_the_air
+		FROM vehicle_recalls
+		WHERE make = $1 AND model = $2 AND model_year = $3
+		ORDER BY report_date DESC NULLS LAST, campaign ASC
+	`, make, model, year)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	safety.Recalls = []marketcheck.Recall{}
+	for rows.Next() {
+		var rec marketcheck.Recall
+		var reported sql.NullTime
+		if err := rows.Scan(&rec.Campaign, &rec.Component, &rec.Summary, &rec.Consequence,
+			&rec.Remedy, &reported, &rec.ParkIt, &rec.ParkOutside, &rec.OverTheAir); err != nil {
+			return nil, err
+		}
+		rec.ReportDate = reported.Time
+		safety.Recalls = append(safety.Recalls, rec)
+	}
+	safety.RecallCount = len(safety.Recalls)
+	return safety, rows.Err()
+}
+
+// SaveSafety replaces the stored safety data for a model year.
+func (r *PostgresRepository) SaveSafety(ctx context.Context, make, model string, year int, safety *marketcheck.Safety) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO vehicle_safety (make, model, model_year, complaint_count, crash_count, fire_count, injury_count, death_count, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (make, model, model_year) DO UPDATE SET
+			complaint_count = EXCLUDED.complaint_count,
+			crash_count = EXCLUDED.crash_count,
+			fire_count = EXCLUDED.fire_count,
+			injury_count = EXCLUDED.injury_count,
+			death_count = EXCLUDED.death_count,
+			fetched_at = EXCLUDED.fetched_at
+	`, make, model, year, safety.ComplaintCount, safety.CrashCount, safety.FireCount,
+		safety.InjuryCount, safety.DeathCount, safety.FetchedAt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM vehicle_recalls WHERE make = $1 AND model = $2 AND model_year = $3
+	`, make, model, year); err != nil {
+		return err
+	}
+
+	for _, rec := range safety.Recalls {
+		var reported interface{}
+		if !rec.ReportDate.IsZero() {
+			reported = rec.ReportDate
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO vehicle_recalls (make, model, model_year, campaign, component, summary, consequence, remedy, report_date, park_it, park_outside, over_the_air)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`, make, model, year, rec.Campaign, rec.Component, rec.Summary, rec.Consequence,
+			rec.Remedy, reported, rec.ParkIt, rec.ParkOutside, rec.OverTheAir)
+		if err != nil {
+			return fmt.Errorf("failed to insert recall %s: %w", rec.Campaign, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// FindComparables returns stored listings of a make and model, matched
+// exactly but for case, within a span of model years, newest first.
+func (r *PostgresRepository) FindComparables(ctx context.Context, make, model string, yearMin, yearMax, limit int) ([]valuation.Comparable, error) {
+	query := `
+		SELECT vin,
+			COALESCE((listing_data->>'price')::int, 0),
+			COALESCE((listing_data->>'miles')::int, 0),
+			COALESCE((build_data->>'year')::int, 0),
+			COALESCE(build_data->>'trim', ''),
+			COALESCE(NULLIF(listing_data->'car_location'->>'latitude', ''), NULLIF(listing_data->'dealer'->>'latitude', ''), ''),
+			COALESCE(NULLIF(listing_data->'car_location'->>'longitude', ''), NULLIF(listing_data->'dealer'->>'longitude', ''), '')
+		FROM listings
+		WHERE lower(build_data->>'make') = lower($1)
+		AND lower(build_data->>'model') = lower($2)
+		AND (build_data->>'year')::int BETWEEN $3 AND $4
+		AND (listing_data->>'price')::int > 0
+		ORDER BY updated_at DESC
+		LIMIT $5
+	`
+	rows, err := r.db.QueryContext(ctx, query, make, model, yearMin, yearMax, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comps []valuation.Comparable
+	for rows.Next() {
+		var c valuation.Comparable
+		var lat, lon string
+		if err := rows.Scan(&c.VIN, &c.Price, &c.Miles, &c.Year, &c.Trim, &lat, &lon); err != nil {
+			return nil, err
+		}
+		c.Latitude, _ = strconv.ParseFloat(lat, 64)
+		c.Longitude, _ = strconv.ParseFloat(lon, 64)
+		comps = append(comps, c)
+	}
+	return comps, rows.Err()
+}
+
+// DepreciationObservations returns each distinct asking price a listing has
+// had, with the date it was first seen, the mileage it was asked at and the
+// listing's build. Prices stored before mileage was recorded with them are
+// only used if they are the listing's latest, which the listing's current
+// mileage belongs to.
+func (r *PostgresRepository) DepreciationObservations(ctx context.Context) ([]analytics.Observation, error) {
+	query := `
+		SELECT DISTINCT ON (ph.vin, ph.price)
+			l.build_data->>'make',
+			l.build_data->>'model',
+			COALESCE(l.build_data->>'trim', ''),
+			(l.build_data->>'year')::int,
+			COALESCE(ph.miles, (l.listing_data->>'miles')::int, 0),
+			ph.price,
+			ph.date
+		FROM price_history ph
+		JOIN listings l ON l.vin = ph.vin
+		WHERE ph.price > 0
+		AND COALESCE(l.build_data->>'make', '') <> ''
+		AND COALESCE(l.build_data->>'model', '') <> ''
+		AND COALESCE((l.build_data->>'year')::int, 0) > 0
+		AND (ph.miles IS NOT NULL OR ph.date = (SELECT MAX(date) FROM price_history WHERE vin = ph.vin))
+		ORDER BY ph.vin, ph.price, ph.date ASC
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var obs []analytics.Observation
+	for rows.Next() {
+		var o analytics.Observation
+		if err := rows.Scan(&o.Make, &o.Model, &o.Trim, &o.Year, &o.Miles, &o.Price, &o.Date); err != nil {
+			return nil, err
+		}
+		obs = append(obs, o)
+	}
+	return obs, rows.Err()
+}
+
+// SaveDepreciationCurves replaces the stored curves with curves in one
+// transaction, deleting those for segments that were not fitted this time.
+func (r *PostgresRepository) SaveDepreciationCurves(ctx context.Context, curves []analytics.Curve) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO depreciation_curves (make, model, trim, intercept, age_coef, miles_coef, sigma, r_squared, observations, min_age, max_age, fitted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (make, model, trim) DO UPDATE SET
+			intercept = EXCLUDED.intercept,
+			age_coef = EXCLUDED.age_coef,
+			miles_coef = EXCLUDED.miles_coef,
+			sigma = EXCLUDED.sigma,
+			r_squared = EXCLUDED.r_squared,
+			observations = EXCLUDED.observations,
+			min_age = EXCLUDED.min_age,
+			max_age = EXCLUDED.max_age,
+			fitted_at = EXCLUDED.fitted_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range curves {
+		if _, err := stmt.ExecContext(ctx, c.Make, c.Model, c.Trim, c.Intercept, c.AgeCoef, c.MilesCoef,
+			c.Sigma, c.R2, c.Observations, c.MinAge, c.MaxAge, c.FittedAt); err != nil {
+			return fmt.Errorf("failed to save curve for %s %s %q: %w", c.Make, c.Model, c.Trim, err)
+		}
+	}
+
+	makes := make([]string, len(curves))
+	models := make([]string, len(curves))
+	trims := make([]string, len(curves))
+	for i, c := range curves {
+		makes[i], models[i], trims[i] = c.Make, c.Model, c.Trim
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM depreciation_curves
+		WHERE (make, model, trim) NOT IN (
+			SELECT * FROM unnest($1::text[], $2::text[], $3::text[])
+		)
+	`, pq.Array(makes), pq.Array(models), pq.Array(trims)); err != nil {
+		return fmt.Errorf("failed to delete stale curves: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetDepreciationCurves returns the fitted curves for a make and model, the
+// all-trims curve first.
+func (r *PostgresRepository) GetDepreciationCurves(ctx context.Context, make, model string) ([]analytics.Curve, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT make, model, trim, intercept, age_coef, miles_coef, sigma, r_squared, observations, min_age, max_age, fitted_at
+		FROM depreciation_curves
+		WHERE make = LOWER($1) AND model = LOWER($2)
+		ORDER BY trim ASC
+	`, make, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var curves []analytics.Curve
+	for rows.Next() {
+		var c analytics.Curve
+		if err := rows.Scan(&c.Make, &c.Model, &c.Trim, &c.Intercept, &c.AgeCoef, &c.MilesCoef,
+			&c.Sigma, &c.R2, &c.Observations, &c.MinAge, &c.MaxAge, &c.FittedAt); err != nil {
+			return nil, err
+		}
+		curves = append(curves, c)
+	}
+	return curves, rows.Err()
+}
+
+// RecordPriceEvent stores a price event unless the same event is already
+// stored, returning its ID and whether it has been published.
+func (r *PostgresRepository) RecordPriceEvent(ctx context.Context, ev pricewatch.PriceChanged) (int64, bool, error) {
+	query := `
+		INSERT INTO price_events (vin, kind, old_price, new_price, change, change_percent, consecutive_drops,
+			previous_seen_at, occurred_at, make, model, year, trim, miles)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (vin, occurred_at, kind) DO UPDATE SET vin = price_events.vin
+		RETURNING id, published_at IS NOT NULL
+	`
+	var id int64
+	var published bool
+	err := r.db.QueryRowContext(ctx, query, ev.VIN, string(ev.Kind), ev.OldPrice, ev.NewPrice, ev.Change,
+		ev.ChangePercent, ev.ConsecutiveDrops, ev.PreviousSeenAt, ev.OccurredAt,
+		ev.Make, ev.Model, ev.Year, ev.Trim, ev.Miles).Scan(&id, &published)
+	return id, published, err
+}
+
+func (r *PostgresRepository) MarkPriceEventPublished(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE price_events SET published_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND published_at IS NULL
+	`, id)
+	return err
+}
+
+// PendingPriceEvents returns unpublished events recorded before before,
+// oldest first.
+func (r *PostgresRepository) PendingPriceEvents(ctx context.Context, before time.Time, limit int) ([]pricewatch.PendingEvent, error) {
+	query := `
+		SELECT id, vin, kind, old_price, new_price, change, change_percent, consecutive_drops,
+			previous_seen_at, occurred_at, COALESCE(make, ''), COALESCE(model, ''), COALESCE(year, 0),
+			COALESCE(trim, ''), COALESCE(miles, 0)
+		FROM price_events
+		WHERE published_at IS NULL AND created_at < $1
+		ORDER BY created_at ASC, id ASC
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []pricewatch.PendingEvent
+	for rows.Next() {
+		var p pricewatch.PendingEvent
+		var kind string
+		ev := &p.Event
+		if err := rows.Scan(&p.ID, &ev.VIN, &kind, &ev.OldPrice, &ev.NewPrice, &ev.Change, &ev.ChangePercent,
+			&ev.ConsecutiveDrops, &ev.PreviousSeenAt, &ev.OccurredAt, &ev.Make, &ev.Model, &ev.Year,
+			&ev.Trim, &ev.Miles); err != nil {
+			return nil, err
+		}
+		ev.Kind = pricewatch.Kind(kind)
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// ListingSold reports whether a stored listing is presumed sold.
+func (r *PostgresRepository) ListingSold(ctx context.Context, vin string) (bool, error) {
+	var sold bool
+	err := r.db.QueryRowContext(ctx, `SELECT status = 'sold' FROM listings WHERE vin = $1`, vin).Scan(&sold)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return sold, err
+}
+
+// GetPriceEvents returns price events matching filters, newest first.
+func (r *PostgresRepository) GetPriceEvents(ctx context.Context, filters PriceEventFilters) ([]pricewatch.PriceChanged, error) {
+	query := `
+		SELECT vin, kind, old_price, new_price, change, change_percent, consecutive_drops,
+			previous_seen_at, occurred_at, COALESCE(make, ''), COALESCE(model, ''), COALESCE(year, 0),
+			COALESCE(trim, ''), COALESCE(miles, 0)
+		FROM price_events
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	argPos := 1
+
+	if filters.VIN != "" {
+		query += fmt.Sprintf(" AND vin = $%d", argPos)
+		args = append(args, filters.VIN)
+		argPos++
+	}
+	if filters.Kind != "" {
+		query += fmt.Sprintf(" AND kind = $%d", argPos)
+		args = append(args, filters.Kind)
+		argPos++
+	}
+	if filters.Make != "" {
+		query += fmt.Sprintf(" AND make ILIKE $%d", argPos)
+		args = append(args, filters.Make)
+		argPos++
+	}
+	if filters.Model != "" {
+		query += fmt.Sprintf(" AND model ILIKE $%d", argPos)
+		args = append(args, filters.Model)
+		argPos++
+	}
+	if !filters.Since.IsZero() {
+		query += fmt.Sprintf(" AND occurred_at >= $%d", argPos)
+		args = append(args, filters.Since)
+		argPos++
+	}
+
+	query += " ORDER BY occurred_at DESC, id DESC"
+	if filters.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", argPos)
+		args = append(args, filters.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []pricewatch.PriceChanged{}
+	for rows.Next() {
+		var ev pricewatch.PriceChanged
+		var kind string
+		if err := rows.Scan(&ev.VIN, &kind, &ev.OldPrice, &ev.NewPrice, &ev.Change, &ev.ChangePercent,
+			&ev.ConsecutiveDrops, &ev.PreviousSeenAt, &ev.OccurredAt, &ev.Make, &ev.Model, &ev.Year,
+			&ev.Trim, &ev.Miles); err != nil {
+			return nil, err
+		}
+		ev.Kind = pricewatch.Kind(kind)
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+const savedSearchColumns = `id, name, search, COALESCE(latitude, 0), COALESCE(longitude, 0), notify_new, notify_drops,
+	min_drop_amount, min_drop_percent, COALESCE(webhook_url, ''), COALESCE(email, ''), created_at, updated_at`
+
+func scanSavedSearch(row interface{ Scan(...interface{}) error }) (savedsearch.SavedSearch, error) {
+	var s savedsearch.SavedSearch
+	var searchJSON []byte
+	err := row.Scan(&s.ID, &s.Name, &searchJSON, &s.Latitude, &s.Longitude, &s.NotifyNew, &s.NotifyDrops,
+		&s.MinDropAmount, &s.MinDropPercent, &s.WebhookURL, &s.Email, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(searchJSON, &s.Search); err != nil {
+		return s, fmt.Errorf("failed to unmarshal saved search %d: %w", s.ID, err)
+	}
+	return s, nil
+}
+
+// CreateSavedSearch inserts s and sets its ID and timestamps.
+func (r *PostgresRepository) CreateSavedSearch(ctx context.Context, s *savedsearch.SavedSearch) error {
+	searchJSON, err := json.Marshal(s.Search)
+	if err != nil {
+		return fmt.Errorf("failed to marshal search: %w", err)
+	}
+	query := `
+		INSERT INTO saved_searches (name, search, latitude, longitude, notify_new, notify_drops,
+			min_drop_amount, min_drop_percent, webhook_url, email)
+		VALUES ($1, $2, NULLIF($3::float8, 0), NULLIF($4::float8, 0), $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''))
+		RETURNING id, created_at, updated_at
+	`
+	return r.db.QueryRowContext(ctx, query, s.Name, searchJSON, s.Latitude, s.Longitude, s.NotifyNew, s.NotifyDrops,
+		s.MinDropAmount, s.MinDropPercent, s.WebhookURL, s.Email).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// GetSavedSearch returns the saved search with id, or nil if there is none.
+func (r *PostgresRepository) GetSavedSearch(ctx context.Context, id int64) (*savedsearch.SavedSearch, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+savedSearchColumns+` FROM saved_searches WHERE id = $1`, id)
+	s, err := scanSavedSearch(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *PostgresRepository) ListSavedSearches(ctx context.Context) ([]savedsearch.SavedSearch, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+savedSearchColumns+` FROM saved_searches ORDER BY id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []savedsearch.SavedSearch{}
+	for rows.Next() {
+		s, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, s)
+	}
+	return searches, rows.Err()
+}
+
+// UpdateSavedSearch replaces the saved search with s.ID, reporting false if
+// there is none. Existing matches are kept.
+func (r *PostgresRepository) UpdateSavedSearch(ctx context.Context, s *savedsearch.SavedSearch) (bool, error) {
+	searchJSON, err := json.Marshal(s.Search)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal search: %w", err)
+	}
+	query := `
+		UPDATE saved_searches SET
+			name = $2,
+			search = $3,
+			latitude = NULLIF($4::float8, 0),
+			longitude = NULLIF($5::float8, 0),
+			notify_new = $6,
+			notify_drops = $7,
+			min_drop_amount = $8,
+			min_drop_percent = $9,
+			webhook_url = NULLIF($10, ''),
+			email = NULLIF($11, ''),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING created_at, updated_at
+	`
+	err = r.db.QueryRowContext(ctx, query, s.ID, s.Name, searchJSON, s.Latitude, s.Longitude, s.NotifyNew, s.NotifyDrops,
+		s.MinDropAmount, s.MinDropPercent, s.WebhookURL, s.Email).Scan(&s.CreatedAt, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *PostgresRepository) DeleteSavedSearch(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM saved_searches WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetSearchMatch returns the price a listing had when it last matched a
+// saved search.
+func (r *PostgresRepository) GetSearchMatch(ctx context.Context, searchID int64, vin string) (int, bool, error) {
+	var price int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT price FROM saved_search_matches WHERE search_id = $1 AND vin = $2
+	`, searchID, vin).Scan(&price)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return price, true, nil
+}
+
+func (r *PostgresRepository) SaveSearchMatch(ctx context.Context, searchID int64, vin string, price int, notified bool) error {
+	query := `
+		INSERT INTO saved_search_matches (search_id, vin, price, last_notified_at)
+		VALUES ($1, $2, $3, CASE WHEN $4::boolean THEN CURRENT_TIMESTAMP END)
+		ON CONFLICT (search_id, vin) DO UPDATE SET
+			price = EXCLUDED.price,
+			updated_at = CURRENT_TIMESTAMP,
+			last_notified_at = COALESCE(EXCLUDED.last_notified_at, saved_search_matches.last_notified_at)
+	`
+	_, err := r.db.ExecContext(ctx, query, searchID, vin, price, notified)
+	return err
+}
+
+// LocateZip averages the coordinates of stored listings in a zip code.
+func (r *PostgresRepository) LocateZip(ctx context.Context, zip string) (float64, float64, bool, error) {
+	var lat, lon sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT AVG(NULLIF(listing_data->'dealer'->>'latitude', '')::float8),
+			AVG(NULLIF(listing_data->'dealer'->>'longitude', '')::float8)
+		FROM listings
+		WHERE listing_data->'dealer'->>'zip' = $1
+	`, zip).Scan(&lat, &lon)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if !lat.Valid || !lon.Valid {
+		return 0, 0, false, nil
+	}
+	return lat.Float64, lon.Float64, true, nil
+}
+
+const webhookSubscriptionColumns = `id, url, event_types, COALESCE(description, ''), active, created_at, updated_at`
+
+func scanWebhookSubscription(row interface{ Scan(...interface{}) error }) (webhooks.Subscription, error) {
+	var s webhooks.Subscription
+	err := row.Scan(&s.ID, &s.URL, pq.Array(&s.EventTypes), &s.Description, &s.Active, &s.CreatedAt, &s.UpdatedAt)
+	if s.EventTypes == nil {
+		s.EventTypes = []string{}
+	}
+	return s, err
+}
+
+func (r *PostgresRepository) CreateWebhookSubscription(ctx context.Context, s *webhooks.Subscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (url, secret, event_types, description, active)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		RETURNING id, created_at, updated_at
+	`
+	return r.db.QueryRowContext(ctx, query, s.URL, s.Secret, pq.Array(s.EventTypes), s.Description, s.Active).
+		Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// GetWebhookSubscription returns a subscription without its secret, or nil
+// if there is none.
+func (r *PostgresRepository) GetWebhookSubscription(ctx context.Context, id int64) (*webhooks.Subscription, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions WHERE id = $1`, id)
+	s, err := scanWebhookSubscription(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *PostgresRepository) ListWebhookSubscriptions(ctx context.Context) ([]webhooks.Subscription, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions ORDER BY id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []webhooks.Subscription{}
+	for rows.Next() {
+		s, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// UpdateWebhookSubscription changes everything but the secret, reporting
+// false if there is no subscription with s.ID.
+func (r *PostgresRepository) UpdateWebhookSubscription(ctx context.Context, s *webhooks.Subscription) (bool, error) {
+	query := `
+		UPDATE webhook_subscriptions SET
+			url = $2,
+			event_types = $3,
+			description = NULLIF($4, ''),
+			active = $5,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING created_at, updated_at
+	`
+	err := r.db.QueryRowContext(ctx, query, s.ID, s.URL, pq.Array(s.EventTypes), s.Description, s.Active).
+		Scan(&s.CreatedAt, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *PostgresRepository) DeleteWebhookSubscription(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// EnqueueEvent creates a pending delivery of payload for each active
+// subscription that wants ev, skipping subscriptions that already have it.
+func (r *PostgresRepository) EnqueueEvent(ctx context.Context, ev webhooks.Event, payload []byte) (int, error) {
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT id, $1::text, $2::text, $3::jsonb
+		FROM webhook_subscriptions
+		WHERE active AND (cardinality(event_types) = 0 OR $2::text = ANY(event_types))
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query, ev.ID, ev.Type, payload)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// ClaimDeliveries leases up to limit due deliveries, the oldest
+// perSubscription of each subscription's, by pushing their next attempt past
+// the lease, skipping rows another dispatcher has locked.
+func (r *PostgresRepository) ClaimDeliveries(ctx context.Context, limit, perSubscription int, lease time.Duration) ([]webhooks.Claim, error) {
+	query := `
+		WITH ranked AS (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY subscription_id ORDER BY next_attempt_at, id) AS n
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+		), due AS (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN ranked ON ranked.id = d.id
+			WHERE ranked.n <= $3 AND d.status = 'pending' AND d.next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY d.next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_deliveries d
+			SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+			FROM due
+			WHERE d.id = due.id
+			RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts
+		)
+		SELECT c.id, c.subscription_id, c.event_id, c.event_type, c.payload, c.attempts, s.url, s.secret, s.active
+		FROM claimed c
+		JOIN webhook_subscriptions s ON s.id = c.subscription_id
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds(), perSubscription)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claims []webhooks.Claim
+	for rows.Next() {
+		var c webhooks.Claim
+		var payload []byte
+		if err := rows.Scan(&c.ID, &c.SubscriptionID, &c.EventID, &c.EventType, &payload, &c.Attempts,
+			&c.URL, &c.Secret, &c.Active); err != nil {
+			return nil, err
+		}
+		c.Payload = payload
+		c.Status = webhooks.StatusPending
+		claims = append(claims, c)
+	}
+	return claims, rows.Err()
+}
+
+// RecordAttempt logs an attempt and moves the delivery to status. A zero
+// nextAttemptAt leaves the next attempt time alone.
+func (r *PostgresRepository) RecordAttempt(ctx context.Context, deliveryID int64, a webhooks.Attempt, status string, nextAttemptAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, ''), $5, $6)
+	`, deliveryID, a.Attempt, a.StatusCode, a.Error, a.DurationMS, a.AttemptedAt)
+	if err != nil {
+		return err
+	}
+
+	var next interface{}
+	if !nextAttemptAt.IsZero() {
+		next = nextAttemptAt
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET
+			status = $2::text,
+			attempts = $3,
+			next_attempt_at = COALESCE($4::timestamp, next_attempt_at),
+			last_status_code = NULLIF($5, 0),
+			last_error = NULLIF($6, ''),
+			delivered_at = CASE WHEN $2::text = 'succeeded' THEN CURRENT_TIMESTAMP ELSE delivered_at END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, deliveryID, status, a.Attempt, next, a.StatusCode, a.Error)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	COALESCE(last_status_code, 0), COALESCE(last_error, ''), created_at, updated_at, delivered_at`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (webhooks.Delivery, error) {
+	var d webhooks.Delivery
+	var payload []byte
+	var delivered sql.NullTime
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.UpdatedAt, &delivered)
+	d.Payload = payload
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return d, err
+}
+
+// GetWebhookDeliveries returns deliveries matching filters, newest first.
+func (r *PostgresRepository) GetWebhookDeliveries(ctx context.Context, filters WebhookDeliveryFilters) ([]webhooks.Delivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE 1=1`
+	args := []interface{}{}
+	argPos := 1
+
+	if filters.SubscriptionID > 0 {
+		query += fmt.Sprintf(" AND subscription_id = $%d", argPos)
+		args = append(args, filters.SubscriptionID)
+		argPos++
+	}
+	if filters.Status != "" {
+		query += fmt.Sprintf(" AND status = $%d", argPos)
+		args = append(args, filters.Status)
+		argPos++
+	}
+	if filters.EventType != "" {
+		query += fmt.Sprintf(" AND event_type = $%d", argPos)
+		args = append(args, filters.EventType)
+		argPos++
+	}
+
+	query += " ORDER BY created_at DESC, id DESC"
+	if filters.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", argPos)
+		args = append(args, filters.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []webhooks.Delivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetWebhookDelivery returns a delivery with its attempt log, or nil.
+func (r *PostgresRepository) GetWebhookDelivery(ctx context.Context, id int64) (*webhooks.Delivery, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id)
+	d, err := scanWebhookDelivery(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT attempt, COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, attempted_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY attempted_at ASC, id ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	d.AttemptLog = []webhooks.Attempt{}
+	for rows.Next() {
+		var a webhooks.Attempt
+		if err := rows.Scan(&a.Attempt, &a.StatusCode, &a.Error, &a.DurationMS, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	return &d, rows.Err()
+}
+
+// ReplayWebhookDeliveries requeues deliveries for immediate sending with a
+// fresh set of attempts; earlier attempts stay in the log. It returns how
+// many were requeued.
+func (r *PostgresRepository) ReplayWebhookDeliveries(ctx context.Context, filters WebhookDeliveryFilters, ids ...int64) (int, error) {
+	query := `
+		UPDATE webhook_deliveries SET
+			status = 'pending',
+			attempts = 0,
+			next_attempt_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	argPos := 1
+
+	if len(ids) > 0 {
+		query += fmt.Sprintf(" AND id = ANY($%d)", argPos)
+		args = append(args, pq.Array(ids))
+		argPos++
+	}
+	if filters.SubscriptionID > 0 {
+		query += fmt.Sprintf(" AND subscription_id = $%d", argPos)
+		args = append(args, filters.SubscriptionID)
+		argPos++
+	}
+	if filters.Status != "" {
+		query += fmt.Sprintf(" AND status = $%d", argPos)
+		args = append(args, filters.Status)
+		argPos++
+	}
+	if filters.EventType != "" {
+		query += fmt.Sprintf(" AND event_type = $%d", argPos)
+		args = append(args, filters.EventType)
+	}
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// MarkListingsSold marks active listings unseen since cutoff as sold, as of
+// when they were last seen. A listing is only marked when another listing
+// of the same make and model in the same zip has been seen since cutoff,
+// that is when the market it was swept in is still being swept.
+func (r *PostgresRepository) MarkListingsSold(ctx context.Context, cutoff, now time.Time) ([]lifecycle.Sold, error) {
+	query := `
+		WITH stale AS (
+			SELECT l.id FROM listings l
+			WHERE l.status = 'active' AND l.last_seen_at < $1
+				AND EXISTS (
+					SELECT 1 FROM listings o
+					WHERE o.build_data->>'make' = l.build_data->>'make'
+						AND o.build_data->>'model' = l.build_data->>'model'
+						AND ` + listingZipExpr("o") + ` = ` + listingZipExpr("l") + `
+						AND o.last_seen_at >= $1
+				)
+			FOR UPDATE OF l SKIP LOCKED
+		)
+		UPDATE listings l SET
+			status = 'sold',
+			sold_at = l.last_seen_at,
+			sold_detected_at = $2,
+			sold_published_at = NULL,
+			final_price = COALESCE(
+				NULLIF((l.listing_data->>'price')::int, 0),
+				(SELECT price FROM price_history WHERE vin = l.vin ORDER BY date DESC LIMIT 1)
+			)
+		FROM stale
+		WHERE l.id = stale.id
+		RETURNING ` + soldColumns
+	rows, err := r.db.QueryContext(ctx, query, cutoff, now)
+	if err != nil {
+		return nil, err
+	}
+	return scanSoldListings(rows)
+}
+
+// PendingSoldListings returns listings marked sold whose ListingSold event
+// hasn't been published, oldest first.
+func (r *PostgresRepository) PendingSoldListings(ctx context.Context, limit int) ([]lifecycle.Sold, error) {
+	query := `
+		SELECT ` + soldColumns + `
+		FROM listings l
+		WHERE l.status = 'sold' AND l.sold_published_at IS NULL
+		ORDER BY l.sold_detected_at
+		LIMIT $1
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanSoldListings(rows)
+}
+
+// MarkSoldPublished records that the ListingSold event for vin's sale at
+// soldAt was published. A listing relisted or sold again since is left
+// alone.
+func (r *PostgresRepository) MarkSoldPublished(ctx context.Context, vin string, soldAt time.Time) error {
+	query := `
+		UPDATE listings SET sold_published_at = CURRENT_TIMESTAMP
+		WHERE vin = $1 AND status = 'sold' AND sold_at = $2 AND sold_published_at IS NULL
+	`
+	_, err := r.db.ExecContext(ctx, query, vin, soldAt)
+	return err
+}
+
+// listingZipExpr is where a listing in alias is, preferring the car's
+// location over the dealer's.
+func listingZipExpr(alias string) string {
+	return fmt.Sprintf("COALESCE(NULLIF(%[1]s.listing_data->'car_location'->>'zip', ''), %[1]s.listing_data->'dealer'->>'zip')", alias)
+}
+
+const soldColumns = `l.listing_data, l.build_data, l.valuation_data, l.created_at, l.sold_at,
+	COALESCE(l.sold_detected_at, l.sold_at), COALESCE(l.final_price, 0)`
+
+func scanSoldListings(rows *sql.Rows) ([]lifecycle.Sold, error) {
+	defer rows.Close()
+
+	var sold []lifecycle.Sold
+	for rows.Next() {
+		var listingJSON, buildJSON, valuationJSON []byte
+		var s lifecycle.Sold
+		if err := rows.Scan(&listingJSON, &buildJSON, &valuationJSON, &s.FirstSeenAt, &s.SoldAt, &s.DetectedAt, &s.FinalPrice); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(listingJSON, &s.Listing.Listing); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal listing: %w", err)
+		}
+		if err := json.Unmarshal(buildJSON, &s.Listing.Build); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal build: %w", err)
+		}
+		if valuationJSON != nil {
+			json.Unmarshal(valuationJSON, &s.Listing.Valuation)
+		}
+		s.Listing.PriceHistory = []marketcheck.PricePoint{}
+
+		l := s.Listing.Listing
+		s.VIN = l.VIN
+		s.Make, s.Model, s.Year, s.Trim = s.Listing.Build.Make, s.Listing.Build.Model, s.Listing.Build.Year, s.Listing.Build.Trim
+		s.DealerID, s.DealerName = l.Dealer.ID, l.Dealer.Name
+		s.DaysOnMarket = lifecycle.DaysOnMarket(s.FirstSeenAt, s.SoldAt)
+		sold = append(sold, s)
+	}
+	return sold, rows.Err()
+}
+
+// soldFilterClause appends the SoldFilters conditions to a query over sold
+// listings.
+func soldFilterClause(query string, filters SoldFilters) (string, []interface{}) {
+	args := []interface{}{}
+	argPos := 1
+
+	if filters.Make != "" {
+		query += fmt.Sprintf(" AND build_data->>'make' ILIKE $%d", argPos)
+		args = append(args, filters.Make)
+		argPos++
+	}
+	if filters.Model != "" {
+		query += fmt.Sprintf(" AND build_data->>'model' ILIKE $%d", argPos)
+		args = append(args, filters.Model)
+		argPos++
+	}
+	if filters.DealerID > 0 {
+		query += fmt.Sprintf(" AND listing_data->'dealer'->>'id' = $%d", argPos)
+		args = append(args, strconv.Itoa(filters.DealerID))
+		argPos++
+	}
+	if !filters.Since.IsZero() {
+		query += fmt.Sprintf(" AND sold_at >= $%d", argPos)
+		args = append(args, filters.Since)
+	}
+	return query, args
+}
+
+// GetSoldListings returns sold listings matching filters, most recently
+// sold first.
+func (r *PostgresRepository) GetSoldListings(ctx context.Context, filters SoldFilters) ([]lifecycle.Sold, error) {
+	query, args := soldFilterClause(`
+		SELECT vin, build_data->>'make', build_data->>'model', COALESCE((build_data->>'year')::int, 0),
+			COALESCE(build_data->>'trim', ''), COALESCE((listing_data->'dealer'->>'id')::int, 0),
+			COALESCE(listing_data->'dealer'->>'name', ''), COALESCE(final_price, 0), created_at, sold_at, COALESCE(sold_detected_at, sold_at)
+		FROM listings
+		WHERE status = 'sold'
+	`, filters)
+	query += " ORDER BY sold_at DESC"
+	if filters.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, filters.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sold := []lifecycle.Sold{}
+	for rows.Next() {
+		var s lifecycle.Sold
+		if err := rows.Scan(&s.VIN, &s.Make, &s.Model, &s.Year, &s.Trim, &s.DealerID, &s.DealerName,
+			&s.FinalPrice, &s.FirstSeenAt, &s.SoldAt, &s.DetectedAt); err != nil {
+			return nil, err
+		}
+		s.DaysOnMarket = lifecycle.DaysOnMarket(s.FirstSeenAt, s.SoldAt)
+		sold = append(sold, s)
+	}
+	return sold, rows.Err()
+}
+
+// GetTimeToSale summarizes days on market for sold listings matching
+// filters, grouped by make and model or, with GroupBy "dealer", by dealer.
+// Groups with the most sales come first.
+func (r *PostgresRepository) GetTimeToSale(ctx context.Context, filters SoldFilters) ([]lifecycle.TimeToSale, error) {
+	groupCols := `build_data->>'make', build_data->>'model', 0, ''`
+	groupBy := "1, 2"
+	if filters.GroupBy == "dealer" {
+		groupCols = `'', '', COALESCE((listing_data->'dealer'->>'id')::int, 0), COALESCE(listing_data->'dealer'->>'name', '')`
+		groupBy = "3, 4"
+	}
+
+	query, args := soldFilterClause(`
+		SELECT `+groupCols+`,
+			COUNT(*),
+			ROUND(AVG(days)::numeric, 1)::float8,
+			ROUND((percentile_cont(0.5) WITHIN GROUP (ORDER BY days))::numeric, 1)::float8,
+			ROUND((percentile_cont(0.25) WITHIN GROUP (ORDER BY days))::numeric, 1)::float8,
+			ROUND((percentile_cont(0.75) WITHIN GROUP (ORDER BY days))::numeric, 1)::float8,
+			COALESCE(ROUND(AVG(NULLIF(final_price, 0))), 0)::int
+		FROM (
+			SELECT *, EXTRACT(EPOCH FROM sold_at - created_at) / 86400 AS days
+			FROM listings
+			WHERE status = 'sold'
+	`, filters)
+	query += `
+		) sold
+		GROUP BY ` + groupBy + `
+		ORDER BY COUNT(*) DESC`
+	if filters.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, filters.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []lifecycle.TimeToSale{}
+	for rows.Next() {
+		var t lifecycle.TimeToSale
+		if err := rows.Scan(&t.Make, &t.Model, &t.DealerID, &t.DealerName, &t.Sold,
+			&t.AvgDays, &t.MedianDays, &t.P25Days, &t.P75Days, &t.AvgFinalPrice); err != nil {
+			return nil, err
+		}
+		stats = append(stats, t)
+	}
+	return stats, rows.Err()
+}
+
+// ListTrackedMarkets returns the enabled rows of tracked_markets.
+func (r *PostgresRepository) ListTrackedMarkets(ctx context.Context) ([]markets.Market, error) {
+	query := `
+		SELECT name, make, COALESCE(model, ''), COALESCE(zip, ''), COALESCE(radius, 0),
+			COALESCE(year_min, 0), COALESCE(year_max, 0), COALESCE(max_pages, 0), COALESCE(schedule, '')
+		FROM tracked_markets
+		WHERE enabled
+		ORDER BY name ASC
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []markets.Market
+	for rows.Next() {
+		var m markets.Market
+		if err := rows.Scan(&m.Name, &m.Make, &m.Model, &m.Zip, &m.Radius, &m.YearMin, &m.YearMax, &m.MaxPages, &m.Schedule); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+func (r *PostgresRepository) RecordSweep(ctx context.Context, s markets.Sweep) error {
+	query := `
+		INSERT INTO market_sweeps (market, run_id, started_at, finished_at, pages, found, sent, duplicates, failed, error)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''))
+	`
+	_, err := r.db.ExecContext(ctx, query, s.Market, s.RunID, s.StartedAt, s.FinishedAt, s.Pages, s.Found, s.Sent,
+		s.Duplicates, s.Failed, s.Error)
+	return err
+}
+
+// GetMarketSweeps returns a market's sweeps, newest first, or with an empty
+// market the latest sweep of every market.
+func (r *PostgresRepository) GetMarketSweeps(ctx context.Context, market string, limit int) ([]markets.Sweep, error) {
+	query := `
+		SELECT DISTINCT ON (market) market, COALESCE(run_id, ''), started_at, finished_at, pages, found, sent, duplicates, failed, COALESCE(error, '')
+		FROM market_sweeps
+		ORDER BY market ASC, started_at DESC
+	`
+	args := []interface{}{}
+	if market != "" {
+		query = `
+			SELECT market, COALESCE(run_id, ''), started_at, finished_at, pages, found, sent, duplicates, failed, COALESCE(error, '')
+			FROM market_sweeps
+			WHERE market = $1
+			ORDER BY started_at DESC
+		`
+		args = append(args, market)
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sweeps := []markets.Sweep{}
+	for rows.Next() {
+		var s markets.Sweep
+		if err := rows.Scan(&s.Market, &s.RunID, &s.StartedAt, &s.FinishedAt, &s.Pages, &s.Found, &s.Sent,
+			&s.Duplicates, &s.Failed, &s.Error); err != nil {
+			return nil, err
+		}
+		sweeps = append(sweeps, s)
+	}
+	return sweeps, rows.Err()
+}
+
+// PendingOutbox returns up to limit unpublished outbox messages, oldest
+// first.
+func (r *PostgresRepository) PendingOutbox(ctx context.Context, limit int) ([]outbox.Message, error) {
+	query := `
+		SELECT id, vin, payload, source, COALESCE(trace_id, ''), created_at
+		FROM listing_outbox
+		WHERE published_at IS NULL
+		ORDER BY id ASC
+		LIMIT $1
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []outbox.Message
+	for rows.Next() {
+		var m outbox.Message
+		var payload []byte
+		if err := rows.Scan(&m.ID, &m.VIN, &payload, &m.Source, &m.TraceID, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.Payload = payload
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+func (r *PostgresRepository) MarkOutboxPublished(ctx context.Context, ids []int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE listing_outbox SET published_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($1) AND published_at IS NULL
+	`, pq.Array(ids))
+	return err
+}
+
+// PruneOutbox deletes outbox messages published before before.
+func (r *PostgresRepository) PruneOutbox(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM listing_outbox WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// AcquireLease takes or renews a job's lease, reporting false while another
+// holder's lease is unexpired.
+func (r *PostgresRepository) AcquireLease(ctx context.Context, job, holder string, ttl time.Duration) (bool, error) {
+	query := `
+		INSERT INTO job_leases (job, holder, expires_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3))
+		ON CONFLICT (job) DO UPDATE SET
+			holder = EXCLUDED.holder,
+			expires_at = EXCLUDED.expires_at
+		WHERE job_leases.holder = EXCLUDED.holder OR job_leases.expires_at < CURRENT_TIMESTAMP
+	`
+	res, err := r.db.ExecContext(ctx, query, job, holder, ttl.Seconds())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *PostgresRepository) ReleaseLease(ctx context.Context, job, holder string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM job_leases WHERE job = $1 AND holder = $2`, job, holder)
+	return err
+}
+
+// StartJobRun records a run as started, reporting false if the job already
+// has a run for scheduledFor. The caller holds the job's lease, so any run
+// of the job still marked running was abandoned.
+func (r *PostgresRepository) StartJobRun(ctx context.Context, job, holder string, scheduledFor time.Time) (int64, bool, error) {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE job_runs SET status = 'abandoned', finished_at = CURRENT_TIMESTAMP
+		WHERE job = $1 AND status = 'running'
+	`, job)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var id int64
+	err = r.db.QueryRowContext(ctx, `
+		INSERT INTO job_runs (job, holder, scheduled_for, status)
+		VALUES ($1, $2, $3, 'running')
+		ON CONFLICT (job, scheduled_for) DO NOTHING
+		RETURNING id
+	`, job, holder, scheduledFor.UTC()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+func (r *PostgresRepository) FinishJobRun(ctx context.Context, id int64, status string, counts map[string]int, errMsg string) error {
+	countsJSON, err := json.Marshal(counts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal counts: %w", err)
+	}
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE job_runs SET
+			status = $2,
+			finished_at = CURRENT_TIMESTAMP,
+			counts = $3,
+			error = NULLIF($4, '')
+		WHERE id = $1
+	`, id, status, countsJSON, errMsg)
+	return err
+}
+
+func (r *PostgresRepository) LastJobRun(ctx context.Context, job string) (time.Time, bool, error) {
+	var last sql.NullTime
+	err := r.db.QueryRowContext(ctx, `SELECT MAX(scheduled_for) FROM job_runs WHERE job = $1`, job).Scan(&last)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	// scheduled_for is stored in UTC.
+	return last.Time.UTC(), last.Valid, nil
+}
+
+// GetJobRuns returns job runs matching filters, newest first.
+func (r *PostgresRepository) GetJobRuns(ctx context.Context, filters JobRunFilters) ([]scheduler.Run, error) {
+	query := `
+		SELECT id, job, holder, scheduled_for, started_at, finished_at, status, counts, COALESCE(error, '')
+		FROM job_runs
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	argPos := 1
+
+	if filters.Job != "" {
+		query += fmt.Sprintf(" AND job = $%d", argPos)
+		args = append(args, filters.Job)
+		argPos++
+	}
+	if filters.Status != "" {
+		query += fmt.Sprintf(" AND status = $%d", argPos)
+		args = append(args, filters.Status)
+		argPos++
+	}
+
+	query += " ORDER BY started_at DESC, id DESC"
+	if filters.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", argPos)
+		args = append(args, filters.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []scheduler.Run{}
+	for rows.Next() {
+		var run scheduler.Run
+		var finished sql.NullTime
+		var countsJSON []byte
+		if err := rows.Scan(&run.ID, &run.Job, &run.Holder, &run.ScheduledFor, &run.StartedAt, &finished,
+			&run.Status, &countsJSON, &run.Error); err != nil {
+			return nil, err
+		}
+		if finished.Valid {
+			run.FinishedAt = &finished.Time
+		}
+		if countsJSON != nil {
+			if err := json.Unmarshal(countsJSON, &run.Counts); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal counts: %w", err)
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
 func (r *PostgresRepository) Close() error {
 	return r.db.Close()
 }
@@ -0,0 +1,253 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/nhtsa"
+)
+
+// Source is the part of the NHTSA client the service needs.
+type Source interface {
+	RecallsByVehicle(ctx context.Context, makeName, model string, year int) ([]nhtsa.Recall, error)
+	ComplaintsByVehicle(ctx context.Context, makeName, model string, year int) ([]nhtsa.Complaint, error)
+}
+
+// Store persists safety data per model year. GetSafety returns nil when
+// nothing has been stored.
+type Store interface {
+	GetSafety(ctx context.Context, makeName, model string, year int) (*marketcheck.Safety, error)
+	SaveSafety(ctx context.Context, makeName, model string, year int, s *marketcheck.Safety) error
+}
+
+type key struct {
+	make  string
+	model string
+	year  int
+}
+
+func newKey(makeName, model string, year int) key {
+	return key{
+		make:  strings.ToLower(strings.TrimSpace(makeName)),
+		model: strings.ToLower(strings.TrimSpace(model)),
+		year:  year,
+	}
+}
+
+// ErrUnavailable is returned while lookups for a model year back off after
+// NHTSA failed and there is no data to serve.
+var ErrUnavailable = errors.New("safety data temporarily unavailable")
+
+// Backoff after a failed fetch, doubling per consecutive failure.
+const (
+	minBackoff     = time.Minute
+	maxBackoff     = time.Hour
+	refreshTimeout = 30 * time.Second
+)
+
+// Service looks up recalls and complaint counts by model year. Recall and
+// complaint data changes slowly, so results are kept in memory and in the
+// store for ttl before NHTSA is asked again. Stale data is served at once
+// and refreshed in the background, and after a failed fetch NHTSA isn't
+// asked about that model year again until a backoff passes.
+type Service struct {
+	source Source
+	store  Store
+	ttl    time.Duration
+
+	mu         sync.Mutex
+	cache      map[key]*marketcheck.Safety
+	refreshing map[key]bool
+	failures   map[key]failure
+}
+
+type failure struct {
+	count int
+	until time.Time
+}
+
+func NewService(source Source, store Store, ttl time.Duration) *Service {
+	return &Service{
+		source:     source,
+		store:      store,
+		ttl:        ttl,
+		cache:      make(map[key]*marketcheck.Safety),
+		refreshing: make(map[key]bool),
+		failures:   make(map[key]failure),
+	}
+}
+
+func (s *Service) fresh(safety *marketcheck.Safety) bool {
+	return safety != nil && time.Since(safety.FetchedAt) < s.ttl
+}
+
+// Lookup returns safety data for a model year, fetching it from NHTSA only
+// when none has been stored.
+func (s *Service) Lookup(ctx context.Context, makeName, model string, year int) (*marketcheck.Safety, error) {
+	k := newKey(makeName, model, year)
+	if k.make == "" || k.model == "" || k.year <= 0 {
+		return nil, fmt.Errorf("%w: make, model and model year are required", nhtsa.ErrInvalidRequest)
+	}
+
+	if safety := s.cached(ctx, k); safety != nil {
+		if !s.fresh(safety) {
+			s.refresh(k)
+		}
+		return safety, nil
+	}
+
+	s.mu.Lock()
+	until := s.failures[k].until
+	s.mu.Unlock()
+	if time.Now().Before(until) {
+		return nil, fmt.Errorf("%w for %d %s %s until %s", ErrUnavailable, k.year, k.make, k.model, until.Format(time.RFC3339))
+	}
+	return s.fetchAndStore(ctx, k)
+}
+
+// Cached returns the safety data held for a model year without waiting on
+// NHTSA, or nil if there is none yet. Missing or stale data is fetched in
+// the background for later calls.
+func (s *Service) Cached(ctx context.Context, makeName, model string, year int) *marketcheck.Safety {
+	k := newKey(makeName, model, year)
+	if k.make == "" || k.model == "" || k.year <= 0 {
+		return nil
+	}
+	safety := s.cached(ctx, k)
+	if !s.fresh(safety) {
+		s.refresh(k)
+	}
+	return safety
+}
+
+// ForBuild looks up safety data for a decoded build.
+func (s *Service) ForBuild(ctx context.Context, b marketcheck.Build) (*marketcheck.Safety, error) {
+	return s.Lookup(ctx, b.Make, b.Model, b.Year)
+}
+
+// cached returns the newest of the in-memory and stored data, fresh or not.
+func (s *Service) cached(ctx context.Context, k key) *marketcheck.Safety {
+	s.mu.Lock()
+	cached := s.cache[k]
+	s.mu.Unlock()
+	if s.fresh(cached) {
+		return cached
+	}
+
+	stored, err := s.store.GetSafety(ctx, k.make, k.model, k.year)
+	if err != nil {
+		log.Printf("safety: failed to read stored data for %d %s %s: %v", k.year, k.make, k.model, err)
+	}
+	if stored != nil && (cached == nil || stored.FetchedAt.After(cached.FetchedAt)) {
+		s.remember(k, stored)
+		return stored
+	}
+	return cached
+}
+
+// refresh fetches a model year in the background, unless a fetch is already
+// running or backing off.
+func (s *Service) refresh(k key) {
+	s.mu.Lock()
+	if s.refreshing[k] || time.Now().Before(s.failures[k].until) {
+		s.mu.Unlock()
+		return
+	}
+	s.refreshing[k] = true
+	s.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		if _, err := s.fetchAndStore(ctx, k); err != nil {
+			log.Printf("safety: failed to refresh %d %s %s: %v", k.year, k.make, k.model, err)
+		}
+		s.mu.Lock()
+		delete(s.refreshing, k)
+		s.mu.Unlock()
+	}()
+}
+
+func (s *Service) fetchAndStore(ctx context.Context, k key) (*marketcheck.Safety, error) {
+	fetched, err := s.fetch(ctx, k)
+	if err != nil {
+		// A caller giving up says nothing about NHTSA.
+		if ctx.Err() == nil {
+			s.failed(k)
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	delete(s.failures, k)
+	s.mu.Unlock()
+	if err := s.store.SaveSafety(ctx, k.make, k.model, k.year, fetched); err != nil {
+		log.Printf("safety: failed to store data for %d %s %s: %v", k.year, k.make, k.model, err)
+	}
+	s.remember(k, fetched)
+	return fetched, nil
+}
+
+func (s *Service) failed(k key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.failures[k]
+	f.count++
+	backoff := minBackoff << min(f.count-1, 6)
+	f.until = time.Now().Add(min(backoff, maxBackoff))
+	s.failures[k] = f
+}
+
+func (s *Service) remember(k key, safety *marketcheck.Safety) {
+	s.mu.Lock()
+	s.cache[k] = safety
+	s.mu.Unlock()
+}
+
+func (s *Service) fetch(ctx context.Context, k key) (*marketcheck.Safety, error) {
+	recalls, err := s.source.RecallsByVehicle(ctx, k.make, k.model, k.year)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recalls: %w", err)
+	}
+	complaints, err := s.source.ComplaintsByVehicle(ctx, k.make, k.model, k.year)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch complaints: %w", err)
+	}
+
+	safety := &marketcheck.Safety{
+		Recalls:        make([]marketcheck.Recall, 0, len(recalls)),
+		RecallCount:    len(recalls),
+		ComplaintCount: len(complaints),
+		FetchedAt:      time.Now().UTC(),
+	}
+	for _, r := range recalls {
+		safety.Recalls = append(safety.Recalls, marketcheck.Recall{
+			Campaign:    r.Campaign,
+			Component:   r.Component,
+			Summary:     r.Summary,
+			Consequence: r.Consequence,
+			Remedy:      r.Remedy,
+			ReportDate:  r.ReportDate,
+			ParkIt:      r.ParkIt,
+			ParkOutside: r.ParkOutside,
+			OverTheAir:  r.OverTheAir,
+		})
+	}
+	for _, c := range complaints {
+		if c.Crash {
+			safety.CrashCount++
+		}
+		if c.Fire {
+			safety.FireCount++
+		}
+		safety.InjuryCount += c.Injuries
+		safety.DeathCount += c.Deaths
+	}
+	return safety, nil
+}
@@ -0,0 +1,162 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/nhtsa"
+)
+
+type fakeSource struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+	block chan struct{}
+}
+
+func (f *fakeSource) RecallsByVehicle(ctx context.Context, makeName, model string, year int) ([]nhtsa.Recall, error) {
+	f.mu.Lock()
+	f.calls++
+	err, block := f.err, f.block
+	f.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []nhtsa.Recall{{Campaign: "24V001000"}}, nil
+}
+
+func (f *fakeSource) ComplaintsByVehicle(ctx context.Context, makeName, model string, year int) ([]nhtsa.Complaint, error) {
+	return nil, nil
+}
+
+func (f *fakeSource) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+type fakeStore struct {
+	mu     sync.Mutex
+	stored *marketcheck.Safety
+}
+
+func (f *fakeStore) GetSafety(ctx context.Context, makeName, model string, year int) (*marketcheck.Safety, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stored, nil
+}
+
+func (f *fakeStore) SaveSafety(ctx context.Context, makeName, model string, year int, s *marketcheck.Safety) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stored = s
+	return nil
+}
+
+func (f *fakeStore) get() *marketcheck.Safety {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stored
+}
+
+// eventually polls cond until it holds or a second passes.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLookupServesStaleAndRefreshes(t *testing.T) {
+	stale := &marketcheck.Safety{RecallCount: 7, FetchedAt: time.Now().Add(-2 * time.Hour)}
+	source := &fakeSource{block: make(chan struct{})}
+	store := &fakeStore{stored: stale}
+	svc := NewService(source, store, time.Hour)
+
+	got, err := svc.Lookup(context.Background(), "Honda", "Civic", 2020)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if got != stale {
+		t.Fatalf("Lookup = %+v, want the stale stored data", got)
+	}
+
+	// A second lookup while the refresh runs doesn't start another.
+	if _, err := svc.Lookup(context.Background(), "Honda", "Civic", 2020); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	close(source.block)
+	eventually(t, func() bool { return store.get() != stale })
+	if n := source.count(); n != 1 {
+		t.Errorf("NHTSA called %d times, want 1", n)
+	}
+
+	got, err = svc.Lookup(context.Background(), "Honda", "Civic", 2020)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if got.RecallCount != 1 {
+		t.Errorf("RecallCount = %d after refresh, want 1", got.RecallCount)
+	}
+}
+
+func TestLookupBacksOffAfterFailure(t *testing.T) {
+	source := &fakeSource{err: errors.New("nhtsa down")}
+	svc := NewService(source, &fakeStore{}, time.Hour)
+
+	if _, err := svc.Lookup(context.Background(), "Honda", "Civic", 2020); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("first Lookup error = %v, want the fetch error", err)
+	}
+	for range 3 {
+		if _, err := svc.Lookup(context.Background(), "Honda", "Civic", 2020); !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("Lookup error = %v, want ErrUnavailable", err)
+		}
+	}
+	if svc.Cached(context.Background(), "Honda", "Civic", 2020) != nil {
+		t.Error("Cached returned data with nothing stored")
+	}
+	if n := source.count(); n != 1 {
+		t.Errorf("NHTSA called %d times while backing off, want 1", n)
+	}
+
+	svc.mu.Lock()
+	f := svc.failures[newKey("Honda", "Civic", 2020)]
+	svc.mu.Unlock()
+	if f.count != 1 || time.Until(f.until) <= 0 || time.Until(f.until) > minBackoff {
+		t.Errorf("failure = %+v, want one failure backing off for up to %s", f, minBackoff)
+	}
+}
+
+func TestCachedDoesNotWait(t *testing.T) {
+	source := &fakeSource{block: make(chan struct{})}
+	store := &fakeStore{}
+	svc := NewService(source, store, time.Hour)
+
+	done := make(chan *marketcheck.Safety)
+	go func() { done <- svc.Cached(context.Background(), "Honda", "Civic", 2020) }()
+	select {
+	case got := <-done:
+		if got != nil {
+			t.Errorf("Cached = %+v, want nil before anything is fetched", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Cached waited on NHTSA")
+	}
+
+	close(source.block)
+	eventually(t, func() bool { return store.get() != nil })
+	if got := svc.Cached(context.Background(), "Honda", "Civic", 2020); got == nil || got.RecallCount != 1 {
+		t.Errorf("Cached = %+v after the background fetch, want 1 recall", got)
+	}
+}
@@ -0,0 +1,18 @@
+package savedsearch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/omerahmer/motor_metrics/internal/netguard"
+)
+
+// CheckWebhookHost resolves a webhook URL's host and rejects it unless every
+// address it resolves to is public. Alert webhooks are POSTed from inside
+// the deployment, so by default they may only go to public addresses.
+func CheckWebhookHost(ctx context.Context, rawURL string) error {
+	if err := netguard.CheckURL(ctx, rawURL); err != nil {
+		return fmt.Errorf("%w: webhook_url: %v", ErrInvalid, err)
+	}
+	return nil
+}
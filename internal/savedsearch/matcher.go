@@ -0,0 +1,129 @@
+package savedsearch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+// Store lists saved searches and remembers the price each listing had when
+// it last matched a search. GetSearchMatch reports false for a listing that
+// has never matched.
+type Store interface {
+	ListSavedSearches(ctx context.Context) ([]SavedSearch, error)
+	GetSearchMatch(ctx context.Context, searchID int64, vin string) (int, bool, error)
+	SaveSearchMatch(ctx context.Context, searchID int64, vin string, price int, notified bool) error
+}
+
+// Matcher evaluates listings from the stream against every saved search.
+// Searches are reloaded from the store every refresh interval.
+type Matcher struct {
+	store     Store
+	notifiers []Notifier
+	refresh   time.Duration
+
+	mu       sync.Mutex
+	searches []SavedSearch
+	loadedAt time.Time
+}
+
+func NewMatcher(store Store, refresh time.Duration) *Matcher {
+	return &Matcher{store: store, refresh: refresh}
+}
+
+// AddNotifier registers a notifier; each alert goes to all of them, and each
+// skips searches without its kind of address.
+func (m *Matcher) AddNotifier(n Notifier) {
+	m.notifiers = append(m.notifiers, n)
+}
+
+func (m *Matcher) load(ctx context.Context) ([]SavedSearch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.searches != nil && time.Since(m.loadedAt) < m.refresh {
+		return m.searches, nil
+	}
+	searches, err := m.store.ListSavedSearches(ctx)
+	if err != nil {
+		if m.searches != nil {
+			log.Printf("saved searches: reload failed, using cached list: %v", err)
+			return m.searches, nil
+		}
+		return nil, err
+	}
+	if searches == nil {
+		searches = []SavedSearch{}
+	}
+	m.searches, m.loadedAt = searches, time.Now()
+	return searches, nil
+}
+
+// HandleListing alerts on new matches and qualifying price drops.
+func (m *Matcher) HandleListing(ctx context.Context, l marketcheck.EnrichedListing) error {
+	searches, err := m.load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load saved searches: %w", err)
+	}
+
+	for _, s := range searches {
+		if !s.Matches(l) {
+			continue
+		}
+
+		previous, seen, err := m.store.GetSearchMatch(ctx, s.ID, l.Listing.VIN)
+		if err != nil {
+			log.Printf("saved search %d: failed to read match for %s: %v", s.ID, l.Listing.VIN, err)
+			continue
+		}
+
+		var alert *Alert
+		switch {
+		case !seen && s.NotifyNew:
+			a := newAlert(AlertNewMatch, s, l, 0)
+			alert = &a
+		case seen && s.DropQualifies(previous, l.Listing.Price):
+			a := newAlert(AlertPriceDrop, s, l, previous)
+			alert = &a
+		case seen && l.Listing.Price <= previous:
+			// Keep the reference price until the cut adds up to enough
+			// to alert on.
+			continue
+		}
+
+		if alert != nil {
+			m.notify(ctx, s, *alert)
+		}
+		if err := m.store.SaveSearchMatch(ctx, s.ID, l.Listing.VIN, l.Listing.Price, alert != nil); err != nil {
+			log.Printf("saved search %d: failed to record match for %s: %v", s.ID, l.Listing.VIN, err)
+		}
+	}
+	return nil
+}
+
+func (m *Matcher) notify(ctx context.Context, s SavedSearch, a Alert) {
+	for _, n := range m.notifiers {
+		if err := n.Notify(ctx, s, a); err != nil {
+			log.Printf("saved search %d: %s alert for %s failed: %v", s.ID, a.Kind, a.VIN, err)
+		}
+	}
+}
+
+// Baseline records the listings that already match s without alerting, so
+// that a new search only alerts on listings that appear afterwards.
+func Baseline(ctx context.Context, store Store, s SavedSearch, listings []*marketcheck.EnrichedListing) (int, error) {
+	n := 0
+	for _, l := range listings {
+		if l == nil || !s.Matches(*l) {
+			continue
+		}
+		if err := store.SaveSearchMatch(ctx, s.ID, l.Listing.VIN, l.Listing.Price, false); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
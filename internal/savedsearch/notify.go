@@ -0,0 +1,229 @@
+package savedsearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/netguard"
+)
+
+type AlertKind string
+
+const (
+	AlertNewMatch  AlertKind = "new_match"
+	AlertPriceDrop AlertKind = "price_drop"
+)
+
+// Alert is what notifiers send: the search, what happened, and a summary
+// of the listing.
+type Alert struct {
+	Kind          AlertKind `json:"kind"`
+	SearchID      int64     `json:"search_id"`
+	SearchName    string    `json:"search_name"`
+	VIN           string    `json:"vin"`
+	Heading       string    `json:"heading"`
+	Year          int       `json:"year"`
+	Make          string    `json:"make"`
+	Model         string    `json:"model"`
+	Trim          string    `json:"trim,omitempty"`
+	Price         int       `json:"price"`
+	PreviousPrice int       `json:"previous_price,omitempty"`
+	Miles         int       `json:"miles"`
+	URL           string    `json:"url,omitempty"`
+	Dealer        string    `json:"dealer,omitempty"`
+	City          string    `json:"city,omitempty"`
+	State         string    `json:"state,omitempty"`
+	OccurredAt    time.Time `json:"occurred_at"`
+}
+
+func newAlert(kind AlertKind, s SavedSearch, l marketcheck.EnrichedListing, previousPrice int) Alert {
+	return Alert{
+		Kind:          kind,
+		SearchID:      s.ID,
+		SearchName:    s.Name,
+		VIN:           l.Listing.VIN,
+		Heading:       l.Listing.Heading,
+		Year:          l.Build.Year,
+		Make:          l.Build.Make,
+		Model:         l.Build.Model,
+		Trim:          l.Build.Trim,
+		Price:         l.Listing.Price,
+		PreviousPrice: previousPrice,
+		Miles:         l.Listing.Miles,
+		URL:           l.Listing.VDPURL,
+		Dealer:        l.Listing.Dealer.Name,
+		City:          l.Listing.Dealer.City,
+		State:         l.Listing.Dealer.State,
+		OccurredAt:    time.Now().UTC(),
+	}
+}
+
+// Subject is a one-line summary, used as the email subject.
+func (a Alert) Subject() string {
+	car := strings.TrimSpace(fmt.Sprintf("%d %s %s %s", a.Year, a.Make, a.Model, a.Trim))
+	if a.Kind == AlertPriceDrop {
+		return fmt.Sprintf("[%s] %s dropped $%d to $%d", a.SearchName, car, a.PreviousPrice-a.Price, a.Price)
+	}
+	return fmt.Sprintf("[%s] New match: %s for $%d", a.SearchName, car, a.Price)
+}
+
+// Notifier delivers an alert for a saved search.
+type Notifier interface {
+	Notify(ctx context.Context, s SavedSearch, a Alert) error
+}
+
+// WebhookNotifier POSTs the alert as JSON to the search's webhook URL.
+// Unless allowPrivate is set it refuses to connect to loopback, private and
+// link-local addresses.
+type WebhookNotifier struct {
+	http *http.Client
+}
+
+func NewWebhookNotifier(timeout time.Duration, allowPrivate bool) *WebhookNotifier {
+	return &WebhookNotifier{http: netguard.NewClient(timeout, allowPrivate)}
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, s SavedSearch, a Alert) error {
+	if s.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "motor-metrics-alerts")
+
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %d", s.WebhookURL, resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPNotifier emails the alert to the search's address. Auth is only used
+// when a username is set, so a local stand-in server needs no credentials.
+type SMTPNotifier struct {
+	addr    string
+	host    string
+	from    string
+	auth    smtp.Auth
+	timeout time.Duration
+}
+
+func NewSMTPNotifier(addr, from, username, password string, timeout time.Duration) *SMTPNotifier {
+	host := addr
+	if i := strings.LastIndex(addr, ":"); i >= 0 {
+		host = addr[:i]
+	}
+	n := &SMTPNotifier{addr: addr, host: host, from: from, timeout: timeout}
+	if username != "" {
+		n.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return n
+}
+
+// Notify sends the alert within n.timeout, and gives up as soon as ctx is
+// done.
+func (n *SMTPNotifier) Notify(ctx context.Context, s SavedSearch, a Alert) error {
+	if s.Email == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		return err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(s.Email); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(s, a)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (n *SMTPNotifier) message(s SavedSearch, a Alert) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", s.Email)
+	// The subject carries the search name and listing text; Q-encoding
+	// keeps any CR/LF or non-ASCII in them out of the header syntax.
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", a.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", a.OccurredAt.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(&b, "%s\r\n\r\n", a.Heading)
+	if a.Kind == AlertPriceDrop {
+		fmt.Fprintf(&b, "Price: $%d (was $%d)\r\n", a.Price, a.PreviousPrice)
+	} else {
+		fmt.Fprintf(&b, "Price: $%d\r\n", a.Price)
+	}
+	fmt.Fprintf(&b, "Miles: %d\r\n", a.Miles)
+	fmt.Fprintf(&b, "VIN: %s\r\n", a.VIN)
+	if a.Dealer != "" {
+		fmt.Fprintf(&b, "Dealer: %s, %s %s\r\n", a.Dealer, a.City, a.State)
+	}
+	if a.URL != "" {
+		fmt.Fprintf(&b, "%s\r\n", a.URL)
+	}
+	return []byte(b.String())
+}
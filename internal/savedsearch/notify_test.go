@@ -0,0 +1,92 @@
+package savedsearch
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMTPMessageEncodesSubject(t *testing.T) {
+	n := NewSMTPNotifier("localhost:25", "alerts@example.com", "", "", time.Second)
+	a := Alert{Kind: AlertNewMatch, SearchName: "x\r\nBcc: victim@example.com", Year: 2019, Make: "Citroën", Model: "C4", Price: 9000}
+
+	msg := string(n.message(SavedSearch{Email: "me@example.com"}, a))
+	headers, _, _ := strings.Cut(msg, "\r\n\r\n")
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Fatalf("subject injected a header: %q", headers)
+		}
+		if strings.HasPrefix(line, "Subject: ") && !strings.HasPrefix(line, "Subject: =?utf-8?q?") {
+			t.Errorf("subject not encoded: %q", line)
+		}
+	}
+}
+
+func TestSMTPNotifyHonorsContext(t *testing.T) {
+	// A server that accepts connections and never greets.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	n := NewSMTPNotifier(ln.Addr().String(), "alerts@example.com", "", "", time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := n.Notify(ctx, SavedSearch{Email: "me@example.com"}, Alert{}); err == nil {
+		t.Fatal("Notify() succeeded against a silent server")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Notify() took %v after ctx expired", elapsed)
+	}
+}
+
+func TestWebhookNotifierRefusesPrivateAddresses(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits++ }))
+	defer srv.Close()
+	s := SavedSearch{WebhookURL: srv.URL}
+
+	if err := NewWebhookNotifier(time.Second, false).Notify(context.Background(), s, Alert{}); err == nil {
+		t.Fatal("Notify() to a loopback address succeeded")
+	}
+	if err := NewWebhookNotifier(time.Second, true).Notify(context.Background(), s, Alert{}); err != nil {
+		t.Fatalf("Notify() with private addresses allowed: %v", err)
+	}
+	if hits != 1 {
+		t.Fatalf("server got %d requests, want 1", hits)
+	}
+}
+
+func TestCheckWebhookHost(t *testing.T) {
+	for _, u := range []string{
+		"http://localhost:8091/alerts",
+		"http://127.0.0.1/alerts",
+		"http://10.0.0.5/alerts",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/alerts",
+		"http://100.64.0.1/alerts",
+	} {
+		if err := CheckWebhookHost(context.Background(), u); err == nil {
+			t.Errorf("CheckWebhookHost(%q) = nil, want error", u)
+		}
+	}
+	if err := CheckWebhookHost(context.Background(), "https://93.184.216.34/alerts"); err != nil {
+		t.Errorf("CheckWebhookHost(public IP) = %v", err)
+	}
+}
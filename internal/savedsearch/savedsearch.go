@@ -0,0 +1,166 @@
+package savedsearch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+var ErrInvalid = errors.New("invalid saved search")
+
+// Column sizes in saved_searches.
+const (
+	MaxNameLength  = 200
+	MaxEmailLength = 320
+)
+
+// SavedSearch is a stored /api/search query plus when and where to alert.
+type SavedSearch struct {
+	ID     int64                    `json:"id"`
+	Name   string                   `json:"name"`
+	Search marketcheck.SearchParams `json:"search"`
+	// Latitude and Longitude are the center of a zip/radius search, taken
+	// from stored listings in that zip when the search is saved. Without
+	// them a radius search only matches listings in the zip itself.
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+
+	// NotifyNew alerts when a listing first matches.
+	NotifyNew bool `json:"notify_new"`
+	// NotifyDrops alerts when a matching listing's price falls by at least
+	// MinDropAmount dollars and MinDropPercent percent.
+	NotifyDrops    bool    `json:"notify_drops"`
+	MinDropAmount  int     `json:"min_drop_amount"`
+	MinDropPercent float64 `json:"min_drop_percent"`
+
+	WebhookURL string `json:"webhook_url,omitempty"`
+	Email      string `json:"email,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Normalize trims the search and contact fields.
+func (s SavedSearch) Normalize() SavedSearch {
+	s.Name = strings.TrimSpace(s.Name)
+	s.Search = s.Search.Normalize()
+	// Sorting means nothing to a matcher.
+	s.Search.SortBy, s.Search.SortOrder = "", ""
+	s.WebhookURL = strings.TrimSpace(s.WebhookURL)
+	s.Email = strings.TrimSpace(s.Email)
+	return s
+}
+
+func (s SavedSearch) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if utf8.RuneCountInString(s.Name) > MaxNameLength {
+		return fmt.Errorf("%w: name must be at most %d characters", ErrInvalid, MaxNameLength)
+	}
+	// The name ends up in email subjects.
+	if strings.IndexFunc(s.Name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: name must not contain control characters", ErrInvalid)
+	}
+	if err := s.Search.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if s.Search.Make == "" {
+		return fmt.Errorf("%w: search.make is required", ErrInvalid)
+	}
+	if !s.NotifyNew && !s.NotifyDrops {
+		return fmt.Errorf("%w: enable notify_new or notify_drops", ErrInvalid)
+	}
+	if s.MinDropAmount < 0 || s.MinDropPercent < 0 {
+		return fmt.Errorf("%w: drop thresholds must not be negative", ErrInvalid)
+	}
+	if s.WebhookURL == "" && s.Email == "" {
+		return fmt.Errorf("%w: webhook_url or email is required", ErrInvalid)
+	}
+	if s.WebhookURL != "" {
+		u, err := url.Parse(s.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: invalid webhook_url %q", ErrInvalid, s.WebhookURL)
+		}
+	}
+	if s.Email != "" {
+		// Only a bare address: it is used as the SMTP recipient and the To
+		// header as is.
+		addr, err := mail.ParseAddress(s.Email)
+		if err != nil || addr.Address != s.Email || len(s.Email) > MaxEmailLength {
+			return fmt.Errorf("%w: invalid email %q", ErrInvalid, s.Email)
+		}
+	}
+	return nil
+}
+
+// Matches applies the search to a listing, including zip and radius.
+func (s SavedSearch) Matches(l marketcheck.EnrichedListing) bool {
+	listing := l.Listing
+	if listing.Build.Make == "" {
+		listing.Build = l.Build
+	}
+	if !s.Search.Matches(listing) {
+		return false
+	}
+
+	if s.Search.Zip == "" {
+		return true
+	}
+	zip := listing.Dealer.Zip
+	if listing.CarLocation.Zip != "" {
+		zip = listing.CarLocation.Zip
+	}
+	if s.Search.Radius == 0 || (s.Latitude == 0 && s.Longitude == 0) {
+		return zip == s.Search.Zip
+	}
+
+	lat, lon := listingLocation(listing)
+	if lat == 0 && lon == 0 {
+		return zip == s.Search.Zip
+	}
+	return distanceMiles(s.Latitude, s.Longitude, lat, lon) <= float64(s.Search.Radius)
+}
+
+// DropQualifies reports whether a fall from oldPrice to newPrice is big
+// enough to alert on.
+func (s SavedSearch) DropQualifies(oldPrice, newPrice int) bool {
+	if !s.NotifyDrops || oldPrice <= 0 || newPrice <= 0 || newPrice >= oldPrice {
+		return false
+	}
+	drop := oldPrice - newPrice
+	percent := 100 * float64(drop) / float64(oldPrice)
+	return drop >= s.MinDropAmount && percent >= s.MinDropPercent
+}
+
+func listingLocation(l marketcheck.Listing) (float64, float64) {
+	lat, lon := parseCoord(l.CarLocation.Latitude), parseCoord(l.CarLocation.Longitude)
+	if lat == 0 && lon == 0 {
+		lat, lon = parseCoord(l.Dealer.Latitude), parseCoord(l.Dealer.Longitude)
+	}
+	return lat, lon
+}
+
+func parseCoord(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return v
+}
+
+func distanceMiles(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 3958.8
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
@@ -0,0 +1,136 @@
+package savedsearch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+func validSearch() SavedSearch {
+	return SavedSearch{
+		Name:        "cheap civics",
+		Search:      marketcheck.SearchParams{Make: "Honda", Model: "Civic", PriceMax: 20000},
+		NotifyNew:   true,
+		NotifyDrops: true,
+		WebhookURL:  "https://hooks.example.com/alerts",
+		Email:       "me@example.com",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*SavedSearch)
+		ok     bool
+	}{
+		{"valid", func(*SavedSearch) {}, true},
+		{"missing name", func(s *SavedSearch) { s.Name = "" }, false},
+		{"name at limit", func(s *SavedSearch) { s.Name = strings.Repeat("é", MaxNameLength) }, true},
+		{"name too long", func(s *SavedSearch) { s.Name = strings.Repeat("a", MaxNameLength+1) }, false},
+		{"CRLF in name", func(s *SavedSearch) { s.Name = "x\r\nBcc: victim@example.com" }, false},
+		{"tab in name", func(s *SavedSearch) { s.Name = "a\tb" }, false},
+		{"missing make", func(s *SavedSearch) { s.Search.Make = "" }, false},
+		{"nothing to notify", func(s *SavedSearch) { s.NotifyNew, s.NotifyDrops = false, false }, false},
+		{"negative drop", func(s *SavedSearch) { s.MinDropAmount = -1 }, false},
+		{"no destination", func(s *SavedSearch) { s.WebhookURL, s.Email = "", "" }, false},
+		{"ftp webhook", func(s *SavedSearch) { s.WebhookURL = "ftp://example.com/x" }, false},
+		{"display-name email", func(s *SavedSearch) { s.Email = "Me <me@example.com>" }, false},
+		{"email with header", func(s *SavedSearch) { s.Email = "me@example.com\r\nBcc: x@example.com" }, false},
+		{"email too long", func(s *SavedSearch) { s.Email = strings.Repeat("a", MaxEmailLength) + "@example.com" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validSearch()
+			tt.modify(&s)
+			err := s.Validate()
+			if tt.ok && err != nil {
+				t.Fatalf("Validate() = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Validate() = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func listingAt(zip, lat, lon string) marketcheck.EnrichedListing {
+	return marketcheck.EnrichedListing{
+		Listing: marketcheck.Listing{
+			VIN:    "1HGCV1F30KA000001",
+			Price:  18000,
+			Miles:  30000,
+			Dealer: marketcheck.Dealer{Zip: zip, Latitude: lat, Longitude: lon},
+		},
+		Build: marketcheck.Build{Year: 2019, Make: "Honda", Model: "Civic"},
+	}
+}
+
+func TestMatches(t *testing.T) {
+	// Irvine, CA; Santa Ana is ~8 miles away and Los Angeles ~40.
+	irvine := listingAt("92617", "33.6405", "-117.8443")
+	santaAna := listingAt("92701", "33.7455", "-117.8677")
+	losAngeles := listingAt("90012", "34.0522", "-118.2437")
+	noCoords := listingAt("92701", "", "")
+
+	tests := []struct {
+		name    string
+		modify  func(*SavedSearch)
+		listing marketcheck.EnrichedListing
+		want    bool
+	}{
+		{"no zip", func(*SavedSearch) {}, losAngeles, true},
+		{"over price", func(s *SavedSearch) { s.Search.PriceMax = 15000 }, irvine, false},
+		{"other model", func(s *SavedSearch) { s.Search.Model = "Accord" }, irvine, false},
+		{"zip only, same zip", func(s *SavedSearch) { s.Search.Zip = "92617" }, irvine, true},
+		{"zip only, other zip", func(s *SavedSearch) { s.Search.Zip = "92617" }, santaAna, false},
+		{"radius without center", func(s *SavedSearch) { s.Search.Zip, s.Search.Radius = "92617", 25 }, santaAna, false},
+		{"inside radius", withCenter(25), santaAna, true},
+		{"outside radius", withCenter(25), losAngeles, false},
+		{"listing without coordinates", withCenter(25), noCoords, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validSearch()
+			tt.modify(&s)
+			if got := s.Matches(tt.listing); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func withCenter(radius int) func(*SavedSearch) {
+	return func(s *SavedSearch) {
+		s.Search.Zip, s.Search.Radius = "92617", radius
+		s.Latitude, s.Longitude = 33.6405, -117.8443
+	}
+}
+
+func TestDropQualifies(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    int
+		percent   float64
+		old, next int
+		want      bool
+	}{
+		{"any drop", 0, 0, 20000, 19999, true},
+		{"increase", 0, 0, 20000, 20500, false},
+		{"unchanged", 0, 0, 20000, 20000, false},
+		{"below amount", 500, 0, 20000, 19600, false},
+		{"meets amount", 500, 0, 20000, 19500, true},
+		{"below percent", 0, 5, 20000, 19500, false},
+		{"meets both", 500, 2.5, 20000, 19500, true},
+		{"no old price", 0, 0, 0, 19500, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := SavedSearch{NotifyDrops: true, MinDropAmount: tt.amount, MinDropPercent: tt.percent}
+			if got := s.DropQualifies(tt.old, tt.next); got != tt.want {
+				t.Errorf("DropQualifies(%d, %d) = %v, want %v", tt.old, tt.next, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Job run statuses.
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	// StatusAbandoned marks a run whose holder went away without finishing
+	// it; it is set by the next holder of the job's lease.
+	StatusAbandoned = "abandoned"
+)
+
+// Job is a named task run on a cron schedule. Run returns counts to keep in
+// the job's history.
+type Job struct {
+	Name string
+	// Spec is a standard five-field cron expression or a descriptor such as
+	// "@daily" or "@every 6h".
+	Spec string
+	// Version identifies what Run does; Set swaps in a job whose Spec or
+	// Version changed.
+	Version string
+	Run     func(ctx context.Context) (map[string]int, error)
+}
+
+// Parse parses a job schedule.
+func Parse(spec string) (cron.Schedule, error) {
+	return cron.ParseStandard(spec)
+}
+
+// Run is one recorded run of a job.
+type Run struct {
+	ID           int64          `json:"id"`
+	Job          string         `json:"job"`
+	Holder       string         `json:"holder"`
+	ScheduledFor time.Time      `json:"scheduled_for"`
+	StartedAt    time.Time      `json:"started_at"`
+	FinishedAt   *time.Time     `json:"finished_at,omitempty"`
+	Status       string         `json:"status"`
+	Counts       map[string]int `json:"counts,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// Store holds job leases and history. A lease lets one holder at a time run
+// a job; StartJobRun reports false if the job already has a run for
+// scheduledFor, so replicas don't repeat each other's runs.
+type Store interface {
+	AcquireLease(ctx context.Context, job, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, job, holder string) error
+	StartJobRun(ctx context.Context, job, holder string, scheduledFor time.Time) (int64, bool, error)
+	FinishJobRun(ctx context.Context, id int64, status string, counts map[string]int, errMsg string) error
+	// LastJobRun returns the latest time the job was scheduled for and
+	// started, if it ever was.
+	LastJobRun(ctx context.Context, job string) (time.Time, bool, error)
+}
+
+type Options struct {
+	// RunOnStart runs each job as soon as it is added, unless CatchUp
+	// already did. Every restart of every replica then runs every job.
+	RunOnStart bool
+	// CatchUp runs a job once when it is added if a scheduled time passed
+	// since its last run, or it has never run. Without a Store there is no
+	// last run, so every job runs once when it is added.
+	CatchUp bool
+	// Jitter delays each run by a random amount up to Jitter.
+	Jitter time.Duration
+	// LeaseTTL is how long a lease lasts without renewal; leases are
+	// renewed while a job runs.
+	LeaseTTL time.Duration
+	// Concurrency caps how many jobs run at once.
+	Concurrency int
+	// Holder identifies this process in leases and history.
+	Holder string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		RunOnStart:  false,
+		CatchUp:     true,
+		Jitter:      time.Minute,
+		LeaseTTL:    10 * time.Minute,
+		Concurrency: 1,
+		Holder:      DefaultHolder(),
+	}
+}
+
+// DefaultHolder is the host name and process ID.
+func DefaultHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Scheduler runs jobs on their schedules. Without a Store there are no
+// leases or history, which is only right for a single process, and
+// catching up runs every job once at start.
+type Scheduler struct {
+	store Store
+	opts  Options
+	sem   chan struct{}
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	wg      sync.WaitGroup
+}
+
+type entry struct {
+	mu       sync.Mutex
+	job      Job
+	schedule cron.Schedule
+	changed  chan struct{}
+	stop     context.CancelFunc
+}
+
+func (e *entry) current() (Job, cron.Schedule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.job, e.schedule
+}
+
+func New(store Store, opts Options) *Scheduler {
+	return &Scheduler{
+		store:   store,
+		opts:    opts,
+		sem:     make(chan struct{}, max(opts.Concurrency, 1)),
+		entries: make(map[string]*entry),
+	}
+}
+
+// Set makes jobs the scheduled set: new jobs start, changed jobs take their
+// new schedule and Run from their next run, and missing jobs stop. A run in
+// progress always finishes. Jobs with invalid schedules are skipped and
+// reported in the error.
+func (s *Scheduler) Set(ctx context.Context, jobs []Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var invalid []string
+	keep := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		schedule, err := Parse(job.Spec)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %v", job.Name, err))
+			continue
+		}
+		keep[job.Name] = true
+
+		if e, ok := s.entries[job.Name]; ok {
+			e.mu.Lock()
+			changed := e.job.Spec != job.Spec || e.job.Version != job.Version
+			e.job, e.schedule = job, schedule
+			e.mu.Unlock()
+			if changed {
+				log.Printf("scheduler: %s updated (%s)", job.Name, job.Spec)
+				select {
+				case e.changed <- struct{}{}:
+				default:
+				}
+			}
+			continue
+		}
+
+		stopCtx, stop := context.WithCancel(ctx)
+		e := &entry{job: job, schedule: schedule, changed: make(chan struct{}, 1), stop: stop}
+		s.entries[job.Name] = e
+		log.Printf("scheduler: %s scheduled (%s)", job.Name, job.Spec)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.loop(ctx, stopCtx, e)
+		}()
+	}
+
+	for name, e := range s.entries {
+		if !keep[name] {
+			log.Printf("scheduler: %s removed", name)
+			e.stop()
+			delete(s.entries, name)
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid schedules: %v", invalid)
+	}
+	return nil
+}
+
+// Wait blocks until every job has stopped, which happens once the context
+// given to Set is done and in-progress runs finish.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// loop runs a job until stopCtx is done. Runs use ctx, so removing a job
+// doesn't interrupt a run, but a run not yet started when it is removed
+// doesn't start.
+func (s *Scheduler) loop(ctx, stopCtx context.Context, e *entry) {
+	s.startup(ctx, stopCtx, e)
+
+	for {
+		job, schedule := e.current()
+		next := schedule.Next(time.Now())
+		timer := time.NewTimer(time.Until(next) + s.jitter())
+		select {
+		case <-stopCtx.Done():
+			timer.Stop()
+			return
+		case <-e.changed:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+		s.runJob(ctx, stopCtx, job, next)
+	}
+}
+
+// startup runs a job once when it is added if it missed a scheduled time
+// since its last run (CatchUp) or RunOnStart is set.
+func (s *Scheduler) startup(ctx, stopCtx context.Context, e *entry) {
+	job, schedule := e.current()
+	now := time.Now()
+
+	if s.opts.CatchUp {
+		var last time.Time
+		var ran bool
+		var err error
+		if s.store != nil {
+			last, ran, err = s.store.LastJobRun(ctx, job.Name)
+		}
+		if err != nil {
+			log.Printf("scheduler: failed to check last run of %s: %v", job.Name, err)
+		} else if !ran || missed(schedule, last, now) {
+			scheduledFor, ok := previous(schedule, now)
+			if !ok {
+				scheduledFor = now.Truncate(time.Minute)
+			}
+			log.Printf("scheduler: %s missed its run at %s, catching up", job.Name, scheduledFor.Format(time.RFC3339))
+			s.sleep(stopCtx, s.jitter())
+			s.runJob(ctx, stopCtx, job, scheduledFor)
+			return
+		}
+	}
+
+	if s.opts.RunOnStart {
+		s.sleep(stopCtx, s.jitter())
+		s.runJob(ctx, stopCtx, job, now.Truncate(time.Minute))
+	}
+}
+
+// missed reports whether a scheduled time passed after last and by now.
+// last, as stored, is in UTC; the schedule is evaluated in now's location,
+// as the run loop does, so that "@daily" means the same midnight in both.
+func missed(schedule cron.Schedule, last, now time.Time) bool {
+	return !schedule.Next(last.In(now.Location())).After(now)
+}
+
+// previous finds the latest scheduled time at or before now, looking back
+// up to a year.
+func previous(schedule cron.Schedule, now time.Time) (time.Time, bool) {
+	for _, window := range []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour, 366 * 24 * time.Hour} {
+		t := schedule.Next(now.Add(-window))
+		if t.After(now) {
+			continue
+		}
+		for {
+			n := schedule.Next(t)
+			if n.After(now) {
+				return t, true
+			}
+			t = n
+		}
+	}
+	return time.Time{}, false
+}
+
+// runJob runs job once a concurrency slot is free, unless stopCtx is done
+// first because the job was removed or the scheduler is shutting down.
+func (s *Scheduler) runJob(ctx, stopCtx context.Context, job Job, scheduledFor time.Time) {
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-stopCtx.Done():
+		return
+	}
+	if stopCtx.Err() != nil {
+		return
+	}
+
+	if s.store == nil {
+		counts, err := job.Run(ctx)
+		logRun(job.Name, counts, err)
+		return
+	}
+
+	ok, err := s.store.AcquireLease(ctx, job.Name, s.opts.Holder, s.opts.LeaseTTL)
+	if err != nil {
+		log.Printf("scheduler: failed to acquire lease for %s: %v", job.Name, err)
+		return
+	}
+	if !ok {
+		log.Printf("scheduler: %s is running elsewhere, skipping", job.Name)
+		return
+	}
+	// Release with a fresh context so shutdown still frees the lease.
+	defer func() {
+		if err := s.store.ReleaseLease(context.Background(), job.Name, s.opts.Holder); err != nil {
+			log.Printf("scheduler: failed to release lease for %s: %v", job.Name, err)
+		}
+	}()
+
+	id, started, err := s.store.StartJobRun(ctx, job.Name, s.opts.Holder, scheduledFor)
+	if err != nil {
+		log.Printf("scheduler: failed to record start of %s: %v", job.Name, err)
+		return
+	}
+	if !started {
+		log.Printf("scheduler: %s already ran for %s, skipping", job.Name, scheduledFor.Format(time.RFC3339))
+		return
+	}
+
+	renewCtx, stopRenew := context.WithCancel(ctx)
+	go s.renew(renewCtx, job.Name)
+	counts, runErr := job.Run(ctx)
+	stopRenew()
+	logRun(job.Name, counts, runErr)
+
+	status, msg := StatusSucceeded, ""
+	if runErr != nil {
+		status, msg = StatusFailed, runErr.Error()
+	}
+	if err := s.store.FinishJobRun(context.Background(), id, status, counts, msg); err != nil {
+		log.Printf("scheduler: failed to record end of %s: %v", job.Name, err)
+	}
+}
+
+// renew keeps the lease alive while a job runs.
+func (s *Scheduler) renew(ctx context.Context, job string) {
+	ticker := time.NewTicker(max(s.opts.LeaseTTL/3, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := s.store.AcquireLease(ctx, job, s.opts.Holder, s.opts.LeaseTTL)
+			switch {
+			case ctx.Err() != nil:
+			case err != nil:
+				log.Printf("scheduler: failed to renew lease for %s: %v", job, err)
+			case !ok:
+				log.Printf("scheduler: lost lease for %s", job)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) jitter() time.Duration {
+	if s.opts.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(s.opts.Jitter)))
+}
+
+func (s *Scheduler) sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+func logRun(name string, counts map[string]int, err error) {
+	if err != nil {
+		log.Printf("scheduler: %s failed: %v %v", name, err, counts)
+		return
+	}
+	log.Printf("scheduler: %s finished %v", name, counts)
+}
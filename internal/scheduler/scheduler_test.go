@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore grants every lease and records started runs.
+type fakeStore struct {
+	mu      sync.Mutex
+	last    time.Time
+	ran     bool
+	started []time.Time
+}
+
+func (f *fakeStore) AcquireLease(ctx context.Context, job, holder string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeStore) ReleaseLease(ctx context.Context, job, holder string) error {
+	return nil
+}
+
+func (f *fakeStore) StartJobRun(ctx context.Context, job, holder string, scheduledFor time.Time) (int64, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.started {
+		if t.Equal(scheduledFor) {
+			return 0, false, nil
+		}
+	}
+	f.started = append(f.started, scheduledFor)
+	return int64(len(f.started)), true, nil
+}
+
+func (f *fakeStore) FinishJobRun(ctx context.Context, id int64, status string, counts map[string]int, errMsg string) error {
+	return nil
+}
+
+func (f *fakeStore) LastJobRun(ctx context.Context, job string) (time.Time, bool, error) {
+	return f.last, f.ran, nil
+}
+
+func newEntry(t *testing.T, spec string, runs *int) *entry {
+	t.Helper()
+	schedule, err := Parse(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := Job{Name: "sweep", Spec: spec, Run: func(ctx context.Context) (map[string]int, error) {
+		*runs++
+		return nil, nil
+	}}
+	return &entry{job: job, schedule: schedule, changed: make(chan struct{}, 1), stop: func() {}}
+}
+
+func TestStartupCatchUp(t *testing.T) {
+	const spec = "0 * * * *"
+	schedule, _ := Parse(spec)
+	missed, _ := previous(schedule, time.Now())
+
+	tests := []struct {
+		name       string
+		last       time.Time
+		ran        bool
+		runOnStart bool
+		wantRuns   int
+	}{
+		{"never ran", time.Time{}, false, false, 1},
+		{"missed a run", missed.Add(-time.Hour), true, false, 1},
+		{"ran on schedule", missed, true, false, 0},
+		{"ran on schedule, run on start", missed, true, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{last: tt.last, ran: tt.ran}
+			s := New(store, Options{CatchUp: true, RunOnStart: tt.runOnStart, LeaseTTL: time.Minute, Holder: "test"})
+			runs := 0
+			s.startup(context.Background(), context.Background(), newEntry(t, spec, &runs))
+
+			if runs != tt.wantRuns {
+				t.Fatalf("runs = %d, want %d", runs, tt.wantRuns)
+			}
+			if tt.wantRuns == 1 && !tt.runOnStart && !store.started[0].Equal(missed) {
+				t.Fatalf("caught up for %v, want the missed run at %v", store.started[0], missed)
+			}
+		})
+	}
+}
+
+func TestStartupCatchUpWithoutStore(t *testing.T) {
+	s := New(nil, Options{CatchUp: true})
+	runs := 0
+	s.startup(context.Background(), context.Background(), newEntry(t, "@every 6h", &runs))
+	if runs != 1 {
+		t.Fatalf("runs = %d, want 1", runs)
+	}
+}
+
+func TestMissedComparesInOneLocation(t *testing.T) {
+	schedule, err := Parse("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hours start on the half hour in UTC here, so evaluating the schedule
+	// in UTC would find a run at 10:30 that never happened.
+	zone := time.FixedZone("IST", 5*3600+1800)
+	last := time.Date(2024, 3, 6, 10, 0, 0, 0, zone).UTC()
+
+	tests := []struct {
+		now  time.Time
+		want bool
+	}{
+		{time.Date(2024, 3, 6, 10, 40, 0, 0, zone), false},
+		{time.Date(2024, 3, 6, 11, 0, 0, 0, zone), true},
+		{time.Date(2024, 3, 6, 12, 5, 0, 0, zone), true},
+	}
+	for _, tt := range tests {
+		if got := missed(schedule, last, tt.now); got != tt.want {
+			t.Errorf("missed(last %v, now %v) = %v, want %v", last, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestRemovedJobWaitingForSlotDoesNotRun(t *testing.T) {
+	s := New(nil, Options{Concurrency: 1})
+	s.sem <- struct{}{}
+
+	runs := 0
+	job := Job{Name: "sweep", Run: func(ctx context.Context) (map[string]int, error) {
+		runs++
+		return nil, nil
+	}}
+	stopCtx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.runJob(context.Background(), stopCtx, job, time.Now())
+	}()
+	stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runJob kept waiting for a slot after the job was removed")
+	}
+	<-s.sem
+
+	if runs != 0 {
+		t.Fatalf("runs = %d, want 0", runs)
+	}
+}
+
+func TestPrevious(t *testing.T) {
+	now := time.Date(2024, 3, 6, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"0 * * * *", time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", now},
+		{"0 3 * * *", time.Date(2024, 3, 6, 3, 0, 0, 0, time.UTC)},
+		{"0 6 * * 1", time.Date(2024, 3, 4, 6, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := previous(schedule, now)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("previous(%q) = %v, %v; want %v", tt.spec, got, ok, tt.want)
+		}
+	}
+}
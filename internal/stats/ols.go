@@ -0,0 +1,169 @@
+package stats
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrSingular = errors.New("regression design matrix is singular")
+
+// Fit is an ordinary least squares fit of a target on a small set of
+// features (plus an intercept), with what's needed for a prediction
+// interval.
+type Fit struct {
+	Coef  []float64
+	Sigma float64
+	DOF   int
+	R2    float64
+
+	xtxInv [][]float64
+}
+
+// OLS solves the normal equations for rows of features xs and targets ys.
+// Each row of xs must already include the leading 1 for the intercept.
+func OLS(xs [][]float64, ys []float64) (*Fit, error) {
+	n := len(xs)
+	if n == 0 {
+		return nil, ErrSingular
+	}
+	k := len(xs[0])
+	if n <= k {
+		return nil, ErrSingular
+	}
+
+	xtx := make([][]float64, k)
+	for i := range xtx {
+		xtx[i] = make([]float64, k)
+	}
+	xty := make([]float64, k)
+	for r, row := range xs {
+		for i := 0; i < k; i++ {
+			xty[i] += row[i] * ys[r]
+			for j := 0; j < k; j++ {
+				xtx[i][j] += row[i] * row[j]
+			}
+		}
+	}
+
+	inv, err := invert(xtx)
+	if err != nil {
+		return nil, err
+	}
+	coef := make([]float64, k)
+	for i := 0; i < k; i++ {
+		for j := 0; j < k; j++ {
+			coef[i] += inv[i][j] * xty[j]
+		}
+	}
+
+	var mean float64
+	for _, y := range ys {
+		mean += y
+	}
+	mean /= float64(n)
+
+	var sse, sst float64
+	for r, row := range xs {
+		res := ys[r] - dot(coef, row)
+		sse += res * res
+		sst += (ys[r] - mean) * (ys[r] - mean)
+	}
+	r2 := 0.0
+	if sst > 0 {
+		r2 = 1 - sse/sst
+	}
+	dof := n - k
+	return &Fit{
+		Coef:   coef,
+		Sigma:  math.Sqrt(sse / float64(dof)),
+		DOF:    dof,
+		R2:     r2,
+		xtxInv: inv,
+	}, nil
+}
+
+func (f *Fit) Predict(x []float64) float64 {
+	return dot(f.Coef, x)
+}
+
+// PredictionSE is the standard error of a new observation at x, which is
+// what the interval around a single predicted value should use.
+func (f *Fit) PredictionSE(x []float64) float64 {
+	var q float64
+	for i := range x {
+		for j := range x {
+			q += x[i] * f.xtxInv[i][j] * x[j]
+		}
+	}
+	return f.Sigma * math.Sqrt(1+q)
+}
+
+func dot(a, b []float64) float64 {
+	var s float64
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+// invert uses Gauss-Jordan elimination with partial pivoting. The matrices
+// here are at most 3x3.
+func invert(m [][]float64) ([][]float64, error) {
+	k := len(m)
+	a := make([][]float64, k)
+	for i := range m {
+		a[i] = make([]float64, 2*k)
+		copy(a[i], m[i])
+		a[i][k+i] = 1
+	}
+
+	for col := 0; col < k; col++ {
+		pivot := col
+		for r := col + 1; r < k; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-9 {
+			return nil, ErrSingular
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		p := a[col][col]
+		for j := range a[col] {
+			a[col][j] /= p
+		}
+		for r := 0; r < k; r++ {
+			if r == col {
+				continue
+			}
+			factor := a[r][col]
+			for j := range a[r] {
+				a[r][j] -= factor * a[col][j]
+			}
+		}
+	}
+
+	inv := make([][]float64, k)
+	for i := range a {
+		inv[i] = a[i][k:]
+	}
+	return inv, nil
+}
+
+// TCritical90 approximates the two-sided 90% Student-t critical value for
+// dof degrees of freedom, falling back to the normal value for large dof.
+func TCritical90(dof int) float64 {
+	table := []float64{6.314, 2.920, 2.353, 2.132, 2.015, 1.943, 1.895, 1.860, 1.833, 1.812,
+		1.796, 1.782, 1.771, 1.761, 1.753, 1.746, 1.740, 1.734, 1.729, 1.725}
+	if dof <= 0 {
+		return table[0]
+	}
+	if dof <= len(table) {
+		return table[dof-1]
+	}
+	if dof < 60 {
+		return 1.68
+	}
+	return 1.645
+}
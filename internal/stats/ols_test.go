@@ -0,0 +1,129 @@
+package stats
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestOLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		xs      [][]float64
+		ys      []float64
+		coef    []float64
+		r2      float64
+		sigma   float64
+		wantErr error
+	}{
+		{
+			name: "exact line",
+			xs:   [][]float64{{1, 0}, {1, 1}, {1, 2}, {1, 3}},
+			ys:   []float64{2, 5, 8, 11},
+			coef: []float64{2, 3},
+			r2:   1,
+		},
+		{
+			// Residuals are +1, -1, -1, +1 around y = 1 + 2x.
+			name:  "noisy line",
+			xs:    [][]float64{{1, 0}, {1, 1}, {1, 2}, {1, 3}},
+			ys:    []float64{2, 2, 4, 8},
+			coef:  []float64{1, 2},
+			r2:    1 - 4.0/24,
+			sigma: math.Sqrt(4.0 / 2),
+		},
+		{
+			name: "two features",
+			xs:   [][]float64{{1, 0, 0}, {1, 1, 0}, {1, 0, 1}, {1, 1, 1}, {1, 2, 1}},
+			ys:   []float64{10, 13, 8, 11, 14},
+			coef: []float64{10, 3, -2},
+			r2:   1,
+		},
+		{
+			name:    "collinear features",
+			xs:      [][]float64{{1, 1, 2}, {1, 2, 4}, {1, 3, 6}, {1, 4, 8}},
+			ys:      []float64{1, 2, 3, 4},
+			wantErr: ErrSingular,
+		},
+		{
+			name:    "too few rows",
+			xs:      [][]float64{{1, 0}, {1, 1}},
+			ys:      []float64{1, 2},
+			wantErr: ErrSingular,
+		},
+		{
+			name:    "no rows",
+			wantErr: ErrSingular,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fit, err := OLS(tt.xs, tt.ys)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("OLS() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OLS() error = %v", err)
+			}
+			for i := range tt.coef {
+				if !near(fit.Coef[i], tt.coef[i]) {
+					t.Fatalf("Coef = %v, want %v", fit.Coef, tt.coef)
+				}
+			}
+			if !near(fit.R2, tt.r2) || !near(fit.Sigma, tt.sigma) {
+				t.Fatalf("R2 = %v, Sigma = %v; want %v, %v", fit.R2, fit.Sigma, tt.r2, tt.sigma)
+			}
+			if fit.DOF != len(tt.xs)-len(tt.xs[0]) {
+				t.Fatalf("DOF = %d", fit.DOF)
+			}
+		})
+	}
+}
+
+func TestPrediction(t *testing.T) {
+	xs := [][]float64{{1, 0}, {1, 1}, {1, 2}, {1, 3}}
+	fit, err := OLS(xs, []float64{2, 2, 4, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fit.Predict([]float64{1, 5}); !near(got, 11) {
+		t.Fatalf("Predict(5) = %v, want 11", got)
+	}
+
+	// The interval is narrowest at the mean of x and widens away from it.
+	center := fit.PredictionSE([]float64{1, 1.5})
+	far := fit.PredictionSE([]float64{1, 10})
+	if center <= fit.Sigma || far <= center {
+		t.Fatalf("PredictionSE center %v, far %v, sigma %v", center, far, fit.Sigma)
+	}
+	// se = sigma * sqrt(1 + 1/n) at the mean of x.
+	if want := fit.Sigma * math.Sqrt(1+1.0/4); !near(center, want) {
+		t.Fatalf("PredictionSE at mean = %v, want %v", center, want)
+	}
+}
+
+func TestTCritical90(t *testing.T) {
+	tests := []struct {
+		dof  int
+		want float64
+	}{
+		{0, 6.314},
+		{1, 6.314},
+		{2, 2.920},
+		{20, 1.725},
+		{40, 1.68},
+		{1000, 1.645},
+	}
+	for _, tt := range tests {
+		if got := TCritical90(tt.dof); got != tt.want {
+			t.Errorf("TCritical90(%d) = %v, want %v", tt.dof, got, tt.want)
+		}
+	}
+}
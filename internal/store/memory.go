@@ -8,13 +8,15 @@ import (
 )
 
 type MemoryStore struct {
-	mu     sync.RWMutex
-	prices map[string][]marketcheck.PricePoint
+	mu       sync.RWMutex
+	prices   map[string][]marketcheck.PricePoint
+	listings map[string]marketcheck.EnrichedListing
 }
 
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		prices: make(map[string][]marketcheck.PricePoint),
+		prices:   make(map[string][]marketcheck.PricePoint),
+		listings: make(map[string]marketcheck.EnrichedListing),
 	}
 }
 
@@ -31,6 +33,23 @@ func (s *MemoryStore) GetHistory(ctx context.Context, vin string) ([]marketcheck
 	return append([]marketcheck.PricePoint{}, s.prices[vin]...), nil
 }
 
+func (s *MemoryStore) SaveListing(ctx context.Context, listing *marketcheck.EnrichedListing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listings[listing.Listing.VIN] = *listing
+	return nil
+}
+
+func (s *MemoryStore) GetListingByVIN(ctx context.Context, vin string) (*marketcheck.EnrichedListing, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	listing, ok := s.listings[vin]
+	if !ok {
+		return nil, nil
+	}
+	return &listing, nil
+}
+
 func (s *MemoryStore) Close() error {
 	return nil
 }
@@ -0,0 +1,336 @@
+package valuation
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/stats"
+)
+
+const (
+	RatingGreat      = "great"
+	RatingGood       = "good"
+	RatingFair       = "fair"
+	RatingHigh       = "high"
+	RatingOverpriced = "overpriced"
+
+	MethodRegression = "regression"
+	MethodMedian     = "median"
+)
+
+// Comparable is a stored listing reduced to what the price model uses.
+// Latitude and Longitude are zero when the listing had no location.
+type Comparable struct {
+	VIN       string
+	Price     int
+	Miles     int
+	Year      int
+	Trim      string
+	Latitude  float64
+	Longitude float64
+}
+
+// Store finds stored listings of a make and model across a span of model
+// years.
+type Store interface {
+	FindComparables(ctx context.Context, make, model string, yearMin, yearMax, limit int) ([]Comparable, error)
+}
+
+type Options struct {
+	// MinComparables is how many similar listings a pass needs before its
+	// estimate is trusted.
+	MinComparables int
+	// MileageBand is the +/- mileage window of the tightest pass.
+	MileageBand int
+	// RadiusMiles limits the first passes to nearby listings; 0 disables it.
+	RadiusMiles float64
+	// CohortTTL is how long a make/model/year cohort is reused from memory,
+	// so a search page doesn't query once per listing.
+	CohortTTL time.Duration
+	MaxCohort int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MinComparables: 5,
+		MileageBand:    25000,
+		RadiusMiles:    250,
+		CohortTTL:      5 * time.Minute,
+		MaxCohort:      1000,
+	}
+}
+
+// pass is one widening step of the comparable search.
+type pass struct {
+	sameTrim  bool
+	yearSpan  int
+	bandScale int
+	regional  bool
+}
+
+var passes = []pass{
+	{sameTrim: true, yearSpan: 1, bandScale: 1, regional: true},
+	{sameTrim: false, yearSpan: 1, bandScale: 1, regional: true},
+	{sameTrim: false, yearSpan: 1, bandScale: 2, regional: false},
+	{sameTrim: false, yearSpan: 2, bandScale: 4, regional: false},
+}
+
+type cohort struct {
+	comps     []Comparable
+	expiresAt time.Time
+}
+
+// Engine values listings against comparable stored listings: same make and
+// model, near the same year, trim, mileage and region, widening the search
+// until there are enough of them. Price is regressed on miles and model year
+// to get an expected price and prediction interval; small samples fall back
+// to the median, and too few comparables to the listing's own history.
+type Engine struct {
+	store Store
+	opts  Options
+
+	mu      sync.Mutex
+	cohorts map[string]cohort
+}
+
+func NewEngine(store Store, opts Options) *Engine {
+	return &Engine{
+		store:   store,
+		opts:    opts,
+		cohorts: make(map[string]cohort),
+	}
+}
+
+func (e *Engine) Value(ctx context.Context, l marketcheck.Listing, b marketcheck.Build, history []marketcheck.PricePoint) (marketcheck.Valuation, error) {
+	if l.Price <= 0 || b.Make == "" || b.Model == "" || b.Year == 0 {
+		return marketcheck.ComputeValuation(history, l.Price), nil
+	}
+
+	all, err := e.cohort(ctx, b.Make, b.Model, b.Year)
+	if err != nil {
+		return marketcheck.ComputeValuation(history, l.Price), err
+	}
+
+	lat, lon := listingLocation(l)
+	var comps []Comparable
+	for _, p := range passes {
+		comps = e.filter(all, l, b, lat, lon, p)
+		if len(comps) >= e.opts.MinComparables {
+			break
+		}
+	}
+	if len(comps) < e.opts.MinComparables {
+		v := marketcheck.ComputeValuation(history, l.Price)
+		v.Comparables = len(comps)
+		return v, nil
+	}
+
+	return e.estimate(l, b, comps), nil
+}
+
+func (e *Engine) cohort(ctx context.Context, makeName, model string, year int) ([]Comparable, error) {
+	key := strings.ToLower(makeName) + "|" + strings.ToLower(model) + "|" + strconv.Itoa(year)
+
+	e.mu.Lock()
+	c, ok := e.cohorts[key]
+	e.mu.Unlock()
+	if ok && time.Now().Before(c.expiresAt) {
+		return c.comps, nil
+	}
+
+	span := passes[len(passes)-1].yearSpan
+	comps, err := e.store.FindComparables(ctx, makeName, model, year-span, year+span, e.opts.MaxCohort)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	now := time.Now()
+	for k, c := range e.cohorts {
+		if now.After(c.expiresAt) {
+			delete(e.cohorts, k)
+		}
+	}
+	e.cohorts[key] = cohort{comps: comps, expiresAt: now.Add(e.opts.CohortTTL)}
+	e.mu.Unlock()
+	return comps, nil
+}
+
+func (e *Engine) filter(all []Comparable, l marketcheck.Listing, b marketcheck.Build, lat, lon float64, p pass) []Comparable {
+	band := e.opts.MileageBand * p.bandScale
+	regional := p.regional && e.opts.RadiusMiles > 0 && (lat != 0 || lon != 0)
+
+	var out []Comparable
+	for _, c := range all {
+		if c.VIN == l.VIN || c.Price <= 0 {
+			continue
+		}
+		if abs(c.Year-b.Year) > p.yearSpan {
+			continue
+		}
+		if p.sameTrim && b.Trim != "" && !strings.EqualFold(c.Trim, b.Trim) {
+			continue
+		}
+		if band > 0 && abs(c.Miles-l.Miles) > band {
+			continue
+		}
+		// Comparables without a location can't be ruled out by region.
+		if regional && (c.Latitude != 0 || c.Longitude != 0) &&
+			distanceMiles(lat, lon, c.Latitude, c.Longitude) > e.opts.RadiusMiles {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (e *Engine) estimate(l marketcheck.Listing, b marketcheck.Build, comps []Comparable) marketcheck.Valuation {
+	prices := make([]float64, len(comps))
+	for i, c := range comps {
+		prices[i] = float64(c.Price)
+	}
+	sort.Float64s(prices)
+
+	method := MethodMedian
+	expected := quantile(prices, 0.5)
+	low, high := quantile(prices, 0.1), quantile(prices, 0.9)
+
+	if f, x0, ok := regress(comps, l, b); ok {
+		predicted := f.Predict(x0)
+		// Extrapolating far outside the sample is worse than the median.
+		if predicted >= prices[0]*0.5 && predicted <= prices[len(prices)-1]*1.5 {
+			half := stats.TCritical90(f.DOF) * f.PredictionSE(x0)
+			method = MethodRegression
+			expected = predicted
+			low, high = math.Max(predicted-half, 0), predicted+half
+		}
+	}
+
+	below, equal := 0, 0
+	for _, p := range prices {
+		switch {
+		case p < float64(l.Price):
+			below++
+		case p == float64(l.Price):
+			equal++
+		}
+	}
+	percentile := 100 * (float64(below) + 0.5*float64(equal)) / float64(len(prices))
+
+	price := float64(l.Price)
+	rating := rate(price, expected, low, high)
+	return marketcheck.Valuation{
+		IsGoodValue:   rating == RatingGreat || rating == RatingGood,
+		Score:         (expected - price) / expected,
+		ExpectedPrice: int(math.Round(expected)),
+		PriceLow:      int(math.Round(low)),
+		PriceHigh:     int(math.Round(high)),
+		Percentile:    math.Round(percentile*10) / 10,
+		DealRating:    rating,
+		Comparables:   len(comps),
+		Method:        method,
+	}
+}
+
+// regress fits price on miles (in 10k) and model year, dropping a feature
+// that doesn't vary across the comparables. It needs a few more rows than
+// coefficients to be worth trusting.
+func regress(comps []Comparable, l marketcheck.Listing, b marketcheck.Build) (*stats.Fit, []float64, bool) {
+	milesVary, yearsVary := false, false
+	for _, c := range comps[1:] {
+		milesVary = milesVary || c.Miles != comps[0].Miles
+		yearsVary = yearsVary || c.Year != comps[0].Year
+	}
+
+	features := func(miles, year int) []float64 {
+		x := []float64{1}
+		if milesVary {
+			x = append(x, float64(miles)/10000)
+		}
+		if yearsVary {
+			x = append(x, float64(year-b.Year))
+		}
+		return x
+	}
+
+	x0 := features(l.Miles, b.Year)
+	if len(x0) == 1 || len(comps) < len(x0)+5 {
+		return nil, nil, false
+	}
+
+	xs := make([][]float64, len(comps))
+	ys := make([]float64, len(comps))
+	for i, c := range comps {
+		xs[i] = features(c.Miles, c.Year)
+		ys[i] = float64(c.Price)
+	}
+	f, err := stats.OLS(xs, ys)
+	if err != nil {
+		return nil, nil, false
+	}
+	return f, x0, true
+}
+
+func rate(price, expected, low, high float64) string {
+	switch {
+	case price <= low:
+		return RatingGreat
+	case price < expected*0.97:
+		return RatingGood
+	case price <= expected*1.03:
+		return RatingFair
+	case price <= high:
+		return RatingHigh
+	}
+	return RatingOverpriced
+}
+
+// quantile linearly interpolates a sorted slice.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(i)
+	return sorted[i] + frac*(sorted[i+1]-sorted[i])
+}
+
+func listingLocation(l marketcheck.Listing) (float64, float64) {
+	lat, lon := parseCoord(l.CarLocation.Latitude), parseCoord(l.CarLocation.Longitude)
+	if lat == 0 && lon == 0 {
+		lat, lon = parseCoord(l.Dealer.Latitude), parseCoord(l.Dealer.Longitude)
+	}
+	return lat, lon
+}
+
+func parseCoord(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return v
+}
+
+func distanceMiles(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 3958.8
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,172 @@
+package valuation
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+type fakeStore struct {
+	comps []Comparable
+	err   error
+	calls int
+}
+
+func (s *fakeStore) FindComparables(ctx context.Context, make, model string, yearMin, yearMax, limit int) ([]Comparable, error) {
+	s.calls++
+	return s.comps, s.err
+}
+
+var testBuild = marketcheck.Build{Make: "Honda", Model: "Accord", Trim: "EX", Year: 2020}
+
+// flatComps are comparables at the listing's mileage and year, so the engine
+// uses the median rather than a regression.
+func flatComps(trim string, prices ...int) []Comparable {
+	comps := make([]Comparable, len(prices))
+	for i, p := range prices {
+		comps[i] = Comparable{VIN: trim + strconv.Itoa(i), Price: p, Miles: 30000, Year: 2020, Trim: trim}
+	}
+	return comps
+}
+
+func testListing(price int) marketcheck.Listing {
+	return marketcheck.Listing{VIN: "LISTING", Price: price, Miles: 30000, Build: testBuild}
+}
+
+var history = []marketcheck.PricePoint{{Price: 24000}, {Price: 22000}}
+
+func TestValueFallsBackToHistory(t *testing.T) {
+	tests := []struct {
+		name  string
+		comps []Comparable
+		build marketcheck.Build
+		want  int
+	}{
+		{"too few comparables", flatComps("EX", 20000, 21000, 22000), testBuild, 3},
+		{"own listing is not a comparable", append(flatComps("EX", 20000, 21000, 22000, 23000), Comparable{VIN: "LISTING", Price: 23000, Year: 2020, Miles: 30000}), testBuild, 4},
+		{"no build", flatComps("EX", 20000, 21000, 22000, 23000, 24000), marketcheck.Build{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine(&fakeStore{comps: tt.comps}, DefaultOptions())
+			v, err := e.Value(context.Background(), testListing(21000), tt.build, history)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Method != "history" || v.Comparables != tt.want || v.DealRating != "" {
+				t.Fatalf("valuation = %+v, want a history fallback over %d comparables", v, tt.want)
+			}
+			if !v.IsGoodValue || math.Abs(v.Score-(23000.0-21000)/23000) > 1e-9 {
+				t.Fatalf("history score = %+v", v)
+			}
+		})
+	}
+}
+
+func TestValueStoreError(t *testing.T) {
+	e := NewEngine(&fakeStore{err: errors.New("db down")}, DefaultOptions())
+	v, err := e.Value(context.Background(), testListing(21000), testBuild, history)
+	if err == nil || v.Method != "history" {
+		t.Fatalf("Value = %+v, %v, want the history fallback and the error", v, err)
+	}
+}
+
+func TestValueDealRatings(t *testing.T) {
+	// Median 22,500; 10th and 90th percentiles 18,900 and 26,100.
+	comps := flatComps("EX", 18000, 19000, 20000, 21000, 22000, 23000, 24000, 25000, 26000, 27000)
+	e := NewEngine(&fakeStore{comps: comps}, DefaultOptions())
+
+	tests := []struct {
+		price int
+		want  string
+	}{
+		{18000, RatingGreat},
+		{18900, RatingGreat},
+		{21000, RatingGood},
+		{21900, RatingFair},
+		{22500, RatingFair},
+		{23175, RatingFair},
+		{23200, RatingHigh},
+		{26100, RatingHigh},
+		{26200, RatingOverpriced},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want+"/"+strconv.Itoa(tt.price), func(t *testing.T) {
+			v, err := e.Value(context.Background(), testListing(tt.price), testBuild, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.DealRating != tt.want {
+				t.Fatalf("rating at %d = %s, want %s", tt.price, v.DealRating, tt.want)
+			}
+			good := tt.want == RatingGreat || tt.want == RatingGood
+			if v.IsGoodValue != good || v.Method != MethodMedian || v.Comparables != len(comps) {
+				t.Fatalf("valuation = %+v", v)
+			}
+			if v.ExpectedPrice != 22500 || v.PriceLow != 18900 || v.PriceHigh != 26100 {
+				t.Fatalf("range = %d [%d, %d]", v.ExpectedPrice, v.PriceLow, v.PriceHigh)
+			}
+		})
+	}
+
+	v, _ := e.Value(context.Background(), testListing(22000), testBuild, nil)
+	if v.Percentile != 45 {
+		t.Fatalf("percentile of 22,000 = %.1f, want 45", v.Percentile)
+	}
+}
+
+func TestValuePrefersSameTrim(t *testing.T) {
+	other := flatComps("LX", 15000, 15000, 15000, 15000, 15000)
+
+	e := NewEngine(&fakeStore{comps: append(flatComps("EX", 25000, 25000, 25000, 25000, 25000), other...)}, DefaultOptions())
+	v, err := e.Value(context.Background(), testListing(25000), testBuild, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Comparables != 5 || v.ExpectedPrice != 25000 {
+		t.Fatalf("with enough same-trim comparables = %+v", v)
+	}
+
+	e = NewEngine(&fakeStore{comps: append(flatComps("EX", 25000, 25000, 25000, 25000), other...)}, DefaultOptions())
+	v, err = e.Value(context.Background(), testListing(25000), testBuild, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Comparables != 9 || v.ExpectedPrice != 15000 {
+		t.Fatalf("after widening to all trims = %+v", v)
+	}
+}
+
+func TestValueRegression(t *testing.T) {
+	// Price drops $1,000 per 10,000 miles.
+	var comps []Comparable
+	for i, miles := range []int{10000, 14000, 18000, 22000, 26000, 34000, 38000, 42000, 46000, 50000} {
+		comps = append(comps, Comparable{VIN: strconv.Itoa(i), Price: 28000 - miles/10, Miles: miles, Year: 2020})
+	}
+	e := NewEngine(&fakeStore{comps: comps}, DefaultOptions())
+
+	v, err := e.Value(context.Background(), testListing(25000), testBuild, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Method != MethodRegression || v.ExpectedPrice != 25000 || v.DealRating != RatingFair {
+		t.Fatalf("valuation = %+v, want a regression estimate of 25,000", v)
+	}
+}
+
+func TestCohortIsCached(t *testing.T) {
+	store := &fakeStore{comps: flatComps("EX", 20000, 21000, 22000, 23000, 24000)}
+	e := NewEngine(store, DefaultOptions())
+	for range 3 {
+		if _, err := e.Value(context.Background(), testListing(21000), testBuild, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.calls != 1 {
+		t.Fatalf("store queried %d times, want 1", store.calls)
+	}
+}
@@ -0,0 +1,181 @@
+package vin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const Length = 17
+
+var (
+	ErrLength     = errors.New("vin must be 17 characters")
+	ErrCharacter  = errors.New("vin contains an invalid character")
+	ErrCheckDigit = errors.New("vin check digit mismatch")
+)
+
+type VIN struct {
+	Value      string `json:"vin"`
+	WMI        string `json:"wmi"`
+	VDS        string `json:"vds"`
+	VIS        string `json:"vis"`
+	ModelYear  int    `json:"model_year"`
+	Plant      string `json:"plant"`
+	Serial     string `json:"serial"`
+	CheckDigit string `json:"check_digit"`
+}
+
+var stripper = strings.NewReplacer(" ", "", "-", "", "\t", "", "\n", "", "\r", "")
+
+// Normalize upper-cases s and strips whitespace and dashes. It does not
+// validate.
+func Normalize(s string) string {
+	return strings.ToUpper(stripper.Replace(s))
+}
+
+// Validate checks an already-normalized VIN for length, the ISO 3779
+// character set (no I, O or Q) and the check digit.
+func Validate(v string) error {
+	if len(v) != Length {
+		return fmt.Errorf("%w: got %d", ErrLength, len(v))
+	}
+	for i := 0; i < Length; i++ {
+		if c := v[i]; c == 'I' || c == 'O' || c == 'Q' {
+			return fmt.Errorf("%w: %q at position %d is never used in a VIN", ErrCharacter, c, i+1)
+		}
+	}
+	return ValidateCheckDigit(v)
+}
+
+// Parse normalizes and validates s and splits it into its ISO 3779 sections.
+func Parse(s string) (*VIN, error) {
+	v := Normalize(s)
+	if err := Validate(v); err != nil {
+		return nil, err
+	}
+	year, _ := ModelYear(v)
+	return &VIN{
+		Value:      v,
+		WMI:        WMI(v),
+		VDS:        v[3:9],
+		VIS:        v[9:],
+		ModelYear:  year,
+		Plant:      v[10:11],
+		Serial:     v[11:],
+		CheckDigit: v[8:9],
+	}, nil
+}
+
+// WMI returns the world manufacturer identifier. Manufacturers building
+// fewer than 1,000 vehicles a year have a '9' in position 3 and the WMI
+// continues at positions 12-14.
+func WMI(v string) string {
+	if len(v) != Length {
+		return ""
+	}
+	if v[2] == '9' {
+		return v[:3] + v[11:14]
+	}
+	return v[:3]
+}
+
+var weights = [Length]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// transliterate returns the ISO 3779 numeric value of c. I, O and Q are not
+// allowed in a VIN and report false.
+func transliterate(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'H':
+		return int(c-'A') + 1, true
+	case c >= 'J' && c <= 'N':
+		return int(c-'J') + 1, true
+	case c == 'P':
+		return 7, true
+	case c == 'R':
+		return 9, true
+	case c >= 'S' && c <= 'Z':
+		return int(c-'S') + 2, true
+	}
+	return 0, false
+}
+
+// CheckDigit computes the expected position-9 character for an upper-case
+// 17-character VIN.
+func CheckDigit(v string) (byte, error) {
+	if len(v) != Length {
+		return 0, ErrLength
+	}
+	sum := 0
+	for i := 0; i < Length; i++ {
+		n, ok := transliterate(v[i])
+		if !ok {
+			return 0, fmt.Errorf("%w: %q at position %d", ErrCharacter, v[i], i+1)
+		}
+		sum += n * weights[i]
+	}
+	rem := sum % 11
+	if rem == 10 {
+		return 'X', nil
+	}
+	return byte('0' + rem), nil
+}
+
+func ValidateCheckDigit(v string) error {
+	want, err := CheckDigit(v)
+	if err != nil {
+		return err
+	}
+	if v[8] != want {
+		return fmt.Errorf("%w: got %q, want %q", ErrCheckDigit, v[8], want)
+	}
+	return nil
+}
+
+const yearCodes = "ABCDEFGHJKLMNPRSTVWXY123456789"
+
+// ModelYear decodes position 10. North American manufacturers (WMIs
+// starting 1-5) disambiguate the 30-year cycle with position 7, a letter for
+// 2010-2039 model years and a digit for 1980-2009. Other regions don't follow
+// that rule, so their VINs take the latest cycle that isn't more than a year
+// ahead of the current one.
+func ModelYear(v string) (int, bool) {
+	return modelYear(v, time.Now().Year())
+}
+
+func modelYear(v string, currentYear int) (int, bool) {
+	if len(v) != Length {
+		return 0, false
+	}
+	idx := strings.IndexByte(yearCodes, v[9])
+	if idx < 0 {
+		return 0, false
+	}
+	year := 1980 + idx
+	if NorthAmerican(v) {
+		if c := v[6]; c < '0' || c > '9' {
+			year += len(yearCodes)
+		}
+		return year, true
+	}
+	for year+len(yearCodes) <= currentYear+1 {
+		year += len(yearCodes)
+	}
+	return year, true
+}
+
+// NorthAmerican reports whether the WMI was assigned to the United States,
+// Canada or Mexico.
+func NorthAmerican(v string) bool {
+	return v != "" && v[0] >= '1' && v[0] <= '5'
+}
+
+// YearCode is the inverse of ModelYear for 1980-2039.
+func YearCode(year int) (byte, bool) {
+	if year < 1980 || year >= 1980+2*len(yearCodes) {
+		return 0, false
+	}
+	return yearCodes[(year-1980)%len(yearCodes)], true
+}
@@ -0,0 +1,93 @@
+package vin
+
+import (
+	"errors"
+	"testing"
+)
+
+// withCheckDigit fills in position 9 so tests can focus on other fields.
+func withCheckDigit(t *testing.T, v string) string {
+	t.Helper()
+	c, err := CheckDigit(v)
+	if err != nil {
+		t.Fatalf("CheckDigit(%q): %v", v, err)
+	}
+	b := []byte(v)
+	b[8] = c
+	return string(b)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		vin  string
+		want error
+	}{
+		{"valid", "1HGCM82633A004352", nil},
+		{"check digit X", "1M8GDM9AXKP042788", nil},
+		{"bad check digit", "1HGCM82643A004352", ErrCheckDigit},
+		{"too short", "1HGCM82633A00435", ErrLength},
+		{"letter O", "1HGCM82633AO04352", ErrCharacter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.vin)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Validate(%q) = %v, want %v", tt.vin, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNormalizes(t *testing.T) {
+	v, err := Parse(" 1hgcm826-33a004352\n")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if v.Value != "1HGCM82633A004352" || v.WMI != "1HG" || v.CheckDigit != "3" || v.Plant != "A" {
+		t.Fatalf("unexpected parse: %+v", v)
+	}
+}
+
+func TestWMISmallManufacturer(t *testing.T) {
+	if got := WMI("1G9AB123X5L123456"); got != "1G9123" {
+		t.Fatalf("WMI = %q, want 1G9123", got)
+	}
+}
+
+func TestModelYear(t *testing.T) {
+	tests := []struct {
+		name string
+		vin  string
+		want int
+	}{
+		{"north american digit in position 7", "1HGCM82603A004352", 2003},
+		{"north american letter in position 7", "5YJ3E1EA0KF317000", 2019},
+		{"north american 1980s", "1G1AB0760BA123456", 1981},
+		{"european letter in position 7 ignored", "WBA3A5C50CF256651", 2012},
+		{"european digit in position 7 still current cycle", "WBA5R1C07LF123456", 2020},
+		{"asian code ahead of current year takes the earlier cycle", "KNAFK4A60T5123456", 1996},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := withCheckDigit(t, tt.vin)
+			got, ok := modelYear(v, 2024)
+			if !ok || got != tt.want {
+				t.Fatalf("modelYear(%q) = %d, %v; want %d", v, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestYearCodeRoundTrip(t *testing.T) {
+	for year := 2010; year < 2040; year++ {
+		c, ok := YearCode(year)
+		if !ok {
+			t.Fatalf("YearCode(%d) not ok", year)
+		}
+		v := withCheckDigit(t, "1FTEW1EP0"+string(c)+"KD12345")
+		if got, _ := modelYear(v, 2024); got != year {
+			t.Fatalf("year %d round-tripped to %d", year, got)
+		}
+	}
+}
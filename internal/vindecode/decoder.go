@@ -0,0 +1,212 @@
+package vindecode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+	"github.com/omerahmer/motor_metrics/internal/vin"
+)
+
+var ErrUnknownWMI = errors.New("vin manufacturer not in vpic snapshot")
+
+// Snapshot is the on-disk form of the subset of NHTSA vPIC we need: the Wmi
+// table joined with Manufacturer/Make/VehicleType/Country, and VDS patterns
+// flattened from Wmi_VinSchema + Pattern + Element.
+type Snapshot struct {
+	Version  string       `json:"version"`
+	WMIs     []WMIRecord  `json:"wmis"`
+	Patterns []VDSPattern `json:"patterns"`
+}
+
+type WMIRecord struct {
+	WMI          string `json:"wmi"`
+	Manufacturer string `json:"manufacturer"`
+	Make         string `json:"make"`
+	VehicleType  string `json:"vehicle_type"`
+	Country      string `json:"country"`
+}
+
+// VDSPattern matches VIN positions 4-8 for a WMI, with '*' matching any
+// character. YearFrom/YearTo of 0 are open-ended.
+type VDSPattern struct {
+	WMI        string `json:"wmi"`
+	Pattern    string `json:"pattern"`
+	YearFrom   int    `json:"year_from"`
+	YearTo     int    `json:"year_to"`
+	Model      string `json:"model"`
+	Trim       string `json:"trim"`
+	BodyType   string `json:"body_type"`
+	Drivetrain string `json:"drivetrain"`
+	FuelType   string `json:"fuel_type"`
+	Doors      int    `json:"doors"`
+}
+
+type Result struct {
+	VIN          string
+	WMI          string
+	Manufacturer string
+	Year         int
+	Make         string
+	Model        string
+	Trim         string
+	BodyType     string
+	VehicleType  string
+	Drivetrain   string
+	FuelType     string
+	Doors        int
+	MadeIn       string
+}
+
+func (r *Result) Build() *marketcheck.Build {
+	return &marketcheck.Build{
+		Year:        r.Year,
+		Make:        r.Make,
+		Model:       r.Model,
+		Trim:        r.Trim,
+		BodyType:    r.BodyType,
+		VehicleType: r.VehicleType,
+		Drivetrain:  r.Drivetrain,
+		FuelType:    r.FuelType,
+		Doors:       r.Doors,
+		MadeIn:      r.MadeIn,
+	}
+}
+
+// Complete reports whether the decode is good enough to stand in for a
+// MarketCheck build.
+func (r *Result) Complete() bool {
+	return r.Year > 0 && r.Make != "" && r.Model != ""
+}
+
+type Decoder struct {
+	version  string
+	wmis     map[string]WMIRecord
+	patterns map[string][]VDSPattern
+}
+
+func Load(path string) (*Decoder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vpic snapshot: %w", err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse vpic snapshot: %w", err)
+	}
+	return New(snapshot), nil
+}
+
+func New(snapshot Snapshot) *Decoder {
+	d := &Decoder{
+		version:  snapshot.Version,
+		wmis:     make(map[string]WMIRecord, len(snapshot.WMIs)),
+		patterns: make(map[string][]VDSPattern),
+	}
+	for _, w := range snapshot.WMIs {
+		w.WMI = strings.ToUpper(w.WMI)
+		d.wmis[w.WMI] = w
+	}
+	for _, p := range snapshot.Patterns {
+		p.WMI = strings.ToUpper(p.WMI)
+		p.Pattern = strings.ToUpper(p.Pattern)
+		d.patterns[p.WMI] = append(d.patterns[p.WMI], p)
+	}
+	return d
+}
+
+func (d *Decoder) Version() string {
+	return d.version
+}
+
+func (d *Decoder) Decode(v string) (*Result, error) {
+	parsed, err := vin.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	v = parsed.Value
+
+	wmi, ok := d.lookupWMI(parsed)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownWMI, parsed.WMI)
+	}
+
+	res := &Result{
+		VIN:          v,
+		WMI:          wmi.WMI,
+		Manufacturer: wmi.Manufacturer,
+		Make:         wmi.Make,
+		VehicleType:  wmi.VehicleType,
+		MadeIn:       wmi.Country,
+	}
+	res.Year = parsed.ModelYear
+
+	if p, ok := d.matchPattern(wmi.WMI, v, res.Year); ok {
+		res.Model = p.Model
+		res.Trim = p.Trim
+		res.BodyType = p.BodyType
+		res.Drivetrain = p.Drivetrain
+		res.FuelType = p.FuelType
+		res.Doors = p.Doors
+	}
+	return res, nil
+}
+
+func (d *Decoder) DecodeBuild(v string) (*marketcheck.Build, error) {
+	res, err := d.Decode(v)
+	if err != nil {
+		return nil, err
+	}
+	return res.Build(), nil
+}
+
+// lookupWMI falls back to the three-character prefix for small
+// manufacturers whose six-character WMI isn't in the snapshot.
+func (d *Decoder) lookupWMI(v *vin.VIN) (WMIRecord, bool) {
+	if w, ok := d.wmis[v.WMI]; ok {
+		return w, true
+	}
+	w, ok := d.wmis[v.Value[:3]]
+	return w, ok
+}
+
+// matchPattern picks the most specific (fewest wildcards) pattern that
+// matches positions 4-8 and the model year.
+func (d *Decoder) matchPattern(wmi, v string, year int) (VDSPattern, bool) {
+	vds := v[3:8]
+	var best VDSPattern
+	bestScore := -1
+	for _, p := range d.patterns[wmi] {
+		if p.YearFrom > 0 && year < p.YearFrom {
+			continue
+		}
+		if p.YearTo > 0 && year > p.YearTo {
+			continue
+		}
+		score, ok := matchVDS(p.Pattern, vds)
+		if ok && score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+func matchVDS(pattern, vds string) (int, bool) {
+	if len(pattern) > len(vds) {
+		return 0, false
+	}
+	score := 0
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '*' {
+			continue
+		}
+		if pattern[i] != vds[i] {
+			return 0, false
+		}
+		score++
+	}
+	return score, true
+}
@@ -0,0 +1,71 @@
+package vindecode
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/omerahmer/motor_metrics/internal/vin"
+)
+
+func loadSnapshot(t *testing.T) *Decoder {
+	t.Helper()
+	d, err := Load("../../data/vpic.json")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return d
+}
+
+func withCheckDigit(t *testing.T, v string) string {
+	t.Helper()
+	c, err := vin.CheckDigit(v)
+	if err != nil {
+		t.Fatalf("CheckDigit(%q): %v", v, err)
+	}
+	b := []byte(v)
+	b[8] = c
+	return string(b)
+}
+
+func TestDecodeShippedSnapshot(t *testing.T) {
+	d := loadSnapshot(t)
+	tests := []struct {
+		vin      string
+		year     int
+		make     string
+		model    string
+		trim     string
+		complete bool
+	}{
+		{"1HGCV1F30KA000001", 2019, "Honda", "Accord", "Sport", true},
+		{"1HGCV1F70KA000001", 2019, "Honda", "Accord", "", true},
+		{"5YJ3E1EB0MF000001", 2021, "Tesla", "Model 3", "Long Range", true},
+		{"1FTEW1EP0GF000001", 2016, "Ford", "F-150", "", true},
+		{"WBA5R1C00LF000001", 2020, "BMW", "3 Series", "330i", true},
+		{"KNAFK4A60G5000001", 2016, "Kia", "Forte", "", true},
+		// Outside every pattern's model years: make only.
+		{"1HGCV1F30YA000001", 2030, "Honda", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.vin, func(t *testing.T) {
+			res, err := d.Decode(withCheckDigit(t, tt.vin))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if res.Year != tt.year || res.Make != tt.make || res.Model != tt.model || res.Trim != tt.trim {
+				t.Fatalf("got %d %s %s %q, want %d %s %s %q", res.Year, res.Make, res.Model, res.Trim, tt.year, tt.make, tt.model, tt.trim)
+			}
+			if res.Complete() != tt.complete {
+				t.Fatalf("Complete() = %v, want %v", res.Complete(), tt.complete)
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownWMI(t *testing.T) {
+	d := loadSnapshot(t)
+	_, err := d.Decode(withCheckDigit(t, "ZFF00000000000001"))
+	if !errors.Is(err, ErrUnknownWMI) {
+		t.Fatalf("err = %v, want ErrUnknownWMI", err)
+	}
+}
@@ -0,0 +1,56 @@
+package vindecode
+
+import (
+	"context"
+	"log"
+
+	"github.com/omerahmer/motor_metrics/internal/marketcheck"
+)
+
+const (
+	ModeOff      = "off"
+	ModePrimary  = "primary"
+	ModeFallback = "fallback"
+)
+
+// Source wraps a ListingSource so FetchBuild consults the local decoder.
+// In primary mode a complete local decode skips the upstream call entirely;
+// in fallback mode the local decode is only used when upstream fails.
+type Source struct {
+	marketcheck.ListingSource
+	decoder *Decoder
+	mode    string
+}
+
+func NewSource(upstream marketcheck.ListingSource, decoder *Decoder, mode string) *Source {
+	return &Source{
+		ListingSource: upstream,
+		decoder:       decoder,
+		mode:          mode,
+	}
+}
+
+func (s *Source) FetchBuild(ctx context.Context, vin string) (*marketcheck.Build, error) {
+	if s.mode == ModePrimary {
+		res, err := s.decoder.Decode(vin)
+		if err == nil && res.Complete() {
+			return res.Build(), nil
+		}
+		build, upstreamErr := s.ListingSource.FetchBuild(ctx, vin)
+		if upstreamErr != nil && err == nil && res.Make != "" {
+			return res.Build(), nil
+		}
+		return build, upstreamErr
+	}
+
+	build, err := s.ListingSource.FetchBuild(ctx, vin)
+	if err == nil {
+		return build, nil
+	}
+	res, decodeErr := s.decoder.Decode(vin)
+	if decodeErr != nil {
+		return nil, err
+	}
+	log.Printf("using local vpic decode for VIN %s after upstream error: %v", vin, err)
+	return res.Build(), nil
+}
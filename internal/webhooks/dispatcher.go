@@ -0,0 +1,260 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/omerahmer/motor_metrics/internal/kafka"
+	"github.com/omerahmer/motor_metrics/internal/netguard"
+	"github.com/omerahmer/motor_metrics/internal/pricewatch"
+)
+
+// fromKafka maps event-type headers on the Kafka event topics to webhook
+// event types.
+var fromKafka = map[string]string{
+	kafka.EventListingCreated:   EventListingCreated,
+	kafka.EventListingGoodValue: EventListingGoodValue,
+	kafka.EventListingSold:      EventListingSold,
+	pricewatch.EventType:        EventListingPriceChanged,
+}
+
+// Claim is a due delivery leased to this dispatcher, with where to send it.
+type Claim struct {
+	Delivery
+	URL    string
+	Secret string
+	Active bool
+}
+
+// Store queues deliveries and records attempts. EnqueueEvent creates a
+// delivery for every active subscription that wants the event, ignoring
+// ones it already has; ClaimDeliveries leases up to limit due deliveries,
+// at most perSubscription of them for any one subscription, so that
+// concurrent dispatchers don't send the same one.
+type Store interface {
+	EnqueueEvent(ctx context.Context, ev Event, payload []byte) (int, error)
+	ClaimDeliveries(ctx context.Context, limit, perSubscription int, lease time.Duration) ([]Claim, error)
+	RecordAttempt(ctx context.Context, deliveryID int64, a Attempt, status string, nextAttemptAt time.Time) error
+}
+
+type Options struct {
+	MaxAttempts int
+	// Retries back off exponentially from BaseBackoff up to MaxBackoff,
+	// with up to 20% jitter.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+	BatchSize   int
+	// PerSubscription caps the deliveries to one subscription in a batch.
+	// Each subscription's deliveries are sent in order, concurrently with
+	// other subscriptions', so a slow endpoint only holds up its own.
+	PerSubscription int
+	// Lease is the minimum time a claimed delivery is hidden from other
+	// dispatchers. The lease is stretched to cover PerSubscription sends
+	// that each run to Timeout.
+	Lease time.Duration
+	// AllowPrivate lets deliveries go to non-public addresses, such as a
+	// receiver on the same host. Off, they are refused when connecting.
+	AllowPrivate bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxAttempts:     8,
+		BaseBackoff:     30 * time.Second,
+		MaxBackoff:      6 * time.Hour,
+		Timeout:         10 * time.Second,
+		BatchSize:       50,
+		PerSubscription: 5,
+		Lease:           2 * time.Minute,
+	}
+}
+
+// Dispatcher turns Kafka events into deliveries and sends them.
+type Dispatcher struct {
+	store Store
+	http  *http.Client
+	opts  Options
+}
+
+func NewDispatcher(store Store, opts Options) (*Dispatcher, error) {
+	if opts.MaxAttempts < 1 {
+		return nil, fmt.Errorf("max attempts must be at least 1, got %d", opts.MaxAttempts)
+	}
+	opts.PerSubscription = max(opts.PerSubscription, 1)
+	return &Dispatcher{
+		store: store,
+		http:  netguard.NewClient(opts.Timeout, opts.AllowPrivate),
+		opts:  opts,
+	}, nil
+}
+
+// lease covers sending every delivery a subscription can have in a batch,
+// plus one more Timeout for recording the attempts.
+func (d *Dispatcher) lease() time.Duration {
+	return max(d.opts.Lease, time.Duration(d.opts.PerSubscription+1)*d.opts.Timeout)
+}
+
+// HandleEvent queues a Kafka event for its subscribers. Event IDs are a
+// hash of the message, so a redelivered message isn't queued twice.
+func (d *Dispatcher) HandleEvent(ctx context.Context, eventType string, key, value []byte) error {
+	webhookType, ok := fromKafka[eventType]
+	if !ok {
+		log.Printf("webhooks: ignoring event with unknown type %q", eventType)
+		return nil
+	}
+	if !json.Valid(value) {
+		log.Printf("webhooks: ignoring %s event for %s with invalid JSON", eventType, key)
+		return nil
+	}
+
+	sum := sha256.Sum256(append([]byte(eventType+"\x00"), value...))
+	ev := Event{
+		ID:        "evt_" + hex.EncodeToString(sum[:16]),
+		Type:      webhookType,
+		CreatedAt: time.Now().UTC(),
+		Data:      value,
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	n, err := d.store.EnqueueEvent(ctx, ev, payload)
+	if err != nil {
+		return fmt.Errorf("failed to queue %s: %w", ev.ID, err)
+	}
+	if n > 0 {
+		log.Printf("webhooks: queued %s %s for %d subscriptions", ev.Type, ev.ID, n)
+	}
+	return nil
+}
+
+// Run sends due deliveries, polling every interval when idle.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		n, err := d.DeliverDue(ctx)
+		if err != nil {
+			log.Printf("webhooks: delivery run failed: %v", err)
+		}
+		if err == nil && n == d.opts.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DeliverDue claims and sends one batch of due deliveries, one goroutine
+// per subscription. A send that could outlast the lease isn't started; the
+// delivery is sent once the lease runs out instead.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	lease := d.lease()
+	deadline := time.Now().Add(lease)
+	claims, err := d.store.ClaimDeliveries(ctx, d.opts.BatchSize, d.opts.PerSubscription, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	bySubscription := make(map[int64][]Claim)
+	for _, c := range claims {
+		bySubscription[c.SubscriptionID] = append(bySubscription[c.SubscriptionID], c)
+	}
+
+	var wg sync.WaitGroup
+	for _, subClaims := range bySubscription {
+		sort.Slice(subClaims, func(i, j int) bool { return subClaims[i].ID < subClaims[j].ID })
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, c := range subClaims {
+				if time.Until(deadline) < d.opts.Timeout || ctx.Err() != nil {
+					return
+				}
+				d.deliver(ctx, c)
+			}
+		}()
+	}
+	wg.Wait()
+	return len(claims), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, c Claim) {
+	attempt := Attempt{Attempt: c.Attempts + 1, AttemptedAt: time.Now().UTC()}
+
+	if c.Active {
+		var err error
+		attempt.StatusCode, err = d.send(ctx, c)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+	} else {
+		attempt.Error = "subscription is inactive"
+	}
+	attempt.DurationMS = int(time.Since(attempt.AttemptedAt).Milliseconds())
+
+	status, next := StatusSucceeded, time.Time{}
+	switch {
+	case attempt.Error == "":
+	case !c.Active || attempt.Attempt >= d.opts.MaxAttempts:
+		status = StatusDead
+		log.Printf("webhooks: delivery %d to %s is dead after %d attempts: %s", c.ID, c.URL, attempt.Attempt, attempt.Error)
+	default:
+		status, next = StatusPending, time.Now().Add(d.backoff(attempt.Attempt))
+	}
+
+	if err := d.store.RecordAttempt(ctx, c.ID, attempt, status, next); err != nil {
+		log.Printf("webhooks: failed to record attempt for delivery %d: %v", c.ID, err)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, c Claim) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(c.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "motor-metrics-webhooks")
+	req.Header.Set(HeaderEvent, c.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(c.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(c.Secret, ts, c.Payload))
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.opts.BaseBackoff
+	for i := 1; i < attempt && wait < d.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, d.opts.MaxBackoff)
+	return wait + time.Duration(rand.Int64N(int64(wait)/5+1))
+}
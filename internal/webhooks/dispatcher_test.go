@@ -0,0 +1,169 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedAttempt struct {
+	attempt Attempt
+	status  string
+}
+
+type fakeStore struct {
+	mu       sync.Mutex
+	claims   []Claim
+	lease    time.Duration
+	attempts map[int64]recordedAttempt
+}
+
+func (s *fakeStore) EnqueueEvent(ctx context.Context, ev Event, payload []byte) (int, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) ClaimDeliveries(ctx context.Context, limit, perSubscription int, lease time.Duration) ([]Claim, error) {
+	s.lease = lease
+	return s.claims, nil
+}
+
+func (s *fakeStore) RecordAttempt(ctx context.Context, deliveryID int64, a Attempt, status string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attempts == nil {
+		s.attempts = make(map[int64]recordedAttempt)
+	}
+	s.attempts[deliveryID] = recordedAttempt{attempt: a, status: status}
+	return nil
+}
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.Timeout = 500 * time.Millisecond
+	opts.Lease = 0
+	// Test receivers listen on loopback.
+	opts.AllowPrivate = true
+	return opts
+}
+
+func TestNewDispatcherRejectsZeroMaxAttempts(t *testing.T) {
+	opts := DefaultOptions()
+	for _, n := range []int{0, -1} {
+		opts.MaxAttempts = n
+		if _, err := NewDispatcher(&fakeStore{}, opts); err == nil {
+			t.Fatalf("MaxAttempts %d accepted", n)
+		}
+	}
+}
+
+func TestLeaseCoversPerSubscriptionSends(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Timeout = time.Minute
+	d, err := NewDispatcher(&fakeStore{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Duration(opts.PerSubscription+1) * opts.Timeout; d.lease() != want {
+		t.Fatalf("lease = %s, want %s", d.lease(), want)
+	}
+}
+
+func TestDeliverDueSlowSubscriberDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	var fastMu sync.Mutex
+	var fastIDs []string
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastMu.Lock()
+		fastIDs = append(fastIDs, r.Header.Get(HeaderDelivery))
+		fastMu.Unlock()
+	}))
+	defer fast.Close()
+
+	store := &fakeStore{claims: []Claim{
+		{Delivery: Delivery{ID: 1, SubscriptionID: 10}, URL: slow.URL, Active: true},
+		{Delivery: Delivery{ID: 3, SubscriptionID: 20}, URL: fast.URL, Active: true},
+		{Delivery: Delivery{ID: 2, SubscriptionID: 20}, URL: fast.URL, Active: true},
+	}}
+	d, err := NewDispatcher(store, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	n, err := d.DeliverDue(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("DeliverDue = %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("batch took %s", elapsed)
+	}
+
+	fastMu.Lock()
+	defer fastMu.Unlock()
+	if len(fastIDs) != 2 || fastIDs[0] != "2" || fastIDs[1] != "3" {
+		t.Fatalf("fast subscriber got deliveries %v, want [2 3] in order", fastIDs)
+	}
+	if store.attempts[2].status != StatusSucceeded || store.attempts[3].status != StatusSucceeded {
+		t.Fatalf("fast deliveries not succeeded: %+v", store.attempts)
+	}
+	if a := store.attempts[1]; a.status != StatusPending || a.attempt.Error == "" {
+		t.Fatalf("slow delivery = %+v, want pending with a timeout error", a)
+	}
+}
+
+func TestDeliverRetriesThenDies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.MaxAttempts = 3
+	store := &fakeStore{}
+	d, err := NewDispatcher(store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.deliver(context.Background(), Claim{Delivery: Delivery{ID: 1, Attempts: 0}, URL: srv.URL, Active: true})
+	if a := store.attempts[1]; a.status != StatusPending || a.attempt.StatusCode != http.StatusBadGateway {
+		t.Fatalf("first attempt = %+v, want pending 502", a)
+	}
+	d.deliver(context.Background(), Claim{Delivery: Delivery{ID: 1, Attempts: 2}, URL: srv.URL, Active: true})
+	if a := store.attempts[1]; a.status != StatusDead || a.attempt.Attempt != 3 {
+		t.Fatalf("last attempt = %+v, want dead on attempt 3", a)
+	}
+}
+
+func TestDeliverRefusesPrivateAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.AllowPrivate = false
+	store := &fakeStore{}
+	d, err := NewDispatcher(store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.deliver(context.Background(), Claim{Delivery: Delivery{ID: 1}, URL: srv.URL, Active: true})
+	if called {
+		t.Fatal("delivery reached a loopback receiver")
+	}
+	if a := store.attempts[1]; a.status != StatusPending || a.attempt.Error == "" {
+		t.Fatalf("attempt = %+v, want a pending failure", a)
+	}
+}
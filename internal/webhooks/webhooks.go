@@ -0,0 +1,157 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhook event types subscribers can ask for.
+const (
+	EventListingCreated      = "listing.created"
+	EventListingPriceChanged = "listing.price_changed"
+	EventListingGoodValue    = "listing.good_value"
+	EventListingSold         = "listing.sold"
+)
+
+var EventTypes = []string{
+	EventListingCreated,
+	EventListingPriceChanged,
+	EventListingGoodValue,
+	EventListingSold,
+}
+
+// Delivery statuses. A delivery is pending until it succeeds or runs out of
+// attempts, when it is dead until replayed.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+// Request headers on every delivery.
+const (
+	HeaderEvent     = "X-Motor-Metrics-Event"
+	HeaderDelivery  = "X-Motor-Metrics-Delivery"
+	HeaderTimestamp = "X-Motor-Metrics-Timestamp"
+	HeaderSignature = "X-Motor-Metrics-Signature"
+)
+
+var ErrInvalid = errors.New("invalid webhook subscription")
+
+// Subscription is a registered webhook endpoint. An empty EventTypes
+// subscribes to every event. Secret is only returned when the subscription
+// is created.
+type Subscription struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (s Subscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: invalid url %q", ErrInvalid, s.URL)
+	}
+	for _, t := range s.EventTypes {
+		if !validEventType(t) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalid, t)
+		}
+	}
+	return nil
+}
+
+func validEventType(t string) bool {
+	for _, known := range EventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for a payload sent at timestamp:
+// "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by the
+// subscription secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header in constant time and rejects timestamps
+// further than tolerance from now, for receivers written in Go.
+func Verify(secret, signature, timestamp string, body []byte, tolerance time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if tolerance > 0 {
+		age := time.Since(time.Unix(ts, 0))
+		if age > tolerance || age < -tolerance {
+			return false
+		}
+	}
+	expected := Sign(secret, ts, body)
+	return hmac.Equal([]byte(expected), []byte(strings.TrimSpace(signature)))
+}
+
+// Event is the body POSTed to subscribers. Data is the event as published
+// on the Kafka topic it came from.
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Delivery is one event queued for one subscription.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	AttemptLog     []Attempt       `json:"attempt_log,omitempty"`
+}
+
+// Attempt is one HTTP request made for a delivery.
+type Attempt struct {
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int       `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
@@ -0,0 +1,77 @@
+package webhooks
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Now().Unix()
+	sig := Sign("whsec_test", now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		timestamp string
+		body      []byte
+		want      bool
+	}{
+		{"valid", "whsec_test", sig, strconv.FormatInt(now, 10), body, true},
+		{"surrounding whitespace", "whsec_test", " " + sig + "\n", strconv.FormatInt(now, 10), body, true},
+		{"wrong secret", "whsec_other", sig, strconv.FormatInt(now, 10), body, false},
+		{"tampered body", "whsec_test", sig, strconv.FormatInt(now, 10), []byte(`{"id":"evt_2"}`), false},
+		{"timestamp not signed", "whsec_test", sig, strconv.FormatInt(now+1, 10), body, false},
+		{"bad timestamp", "whsec_test", sig, "yesterday", body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.signature, tt.timestamp, tt.body, 5*time.Minute); got != tt.want {
+				t.Fatalf("Verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTolerance(t *testing.T) {
+	body := []byte(`{}`)
+	old := time.Now().Add(-10 * time.Minute).Unix()
+	sig := Sign("s", old, body)
+	if Verify("s", sig, strconv.FormatInt(old, 10), body, 5*time.Minute) {
+		t.Fatal("stale signature accepted")
+	}
+	if !Verify("s", sig, strconv.FormatInt(old, 10), body, 0) {
+		t.Fatal("zero tolerance should skip the age check")
+	}
+}
+
+func TestSignKnownVector(t *testing.T) {
+	// HMAC-SHA256 of "1700000000.{}" keyed by "secret".
+	want := "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got := Sign("secret", 1700000000, []byte("{}")); got != want {
+		t.Fatalf("Sign = %q, want %q", got, want)
+	}
+}
+
+func TestSubscriptionValidate(t *testing.T) {
+	tests := []struct {
+		sub  Subscription
+		ok   bool
+		name string
+	}{
+		{Subscription{URL: "https://example.com/hook"}, true, "https"},
+		{Subscription{URL: "ftp://example.com/hook"}, false, "scheme"},
+		{Subscription{URL: "https:///hook"}, false, "no host"},
+		{Subscription{URL: "https://example.com", EventTypes: []string{EventListingSold}}, true, "known event"},
+		{Subscription{URL: "https://example.com", EventTypes: []string{"listing.deleted"}}, false, "unknown event"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sub.Validate(); (err == nil) != tt.ok {
+				t.Fatalf("Validate = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+-- MarketCheck call counters used for client-side quota budgeting
+
+CREATE TABLE IF NOT EXISTS api_quota_usage (
+    endpoint VARCHAR(32) NOT NULL,
+    period VARCHAR(8) NOT NULL,
+    bucket VARCHAR(10) NOT NULL,
+    calls INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (endpoint, period, bucket)
+);
@@ -0,0 +1,13 @@
+-- VINs that failed validation at an entry point, kept for inspection instead of being stored
+
+CREATE TABLE IF NOT EXISTS quarantined_vins (
+    id SERIAL PRIMARY KEY,
+    raw_vin VARCHAR(64) NOT NULL,
+    source VARCHAR(32) NOT NULL,
+    reason TEXT NOT NULL,
+    payload JSONB,
+    occurrences INTEGER NOT NULL DEFAULT 1,
+    first_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(raw_vin, source)
+);
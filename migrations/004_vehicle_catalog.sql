@@ -0,0 +1,20 @@
+-- Make/model catalog synced from NHTSA vPIC
+
+CREATE TABLE IF NOT EXISTS makes (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    vehicle_types TEXT[] NOT NULL DEFAULT '{}',
+    synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_makes_name ON makes(LOWER(name));
+
+CREATE TABLE IF NOT EXISTS models (
+    id INTEGER PRIMARY KEY,
+    make_id INTEGER NOT NULL REFERENCES makes(id),
+    name VARCHAR(100) NOT NULL,
+    vehicle_types TEXT[] NOT NULL DEFAULT '{}',
+    synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_models_make_id ON models(make_id);
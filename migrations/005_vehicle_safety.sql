@@ -0,0 +1,31 @@
+-- NHTSA recalls and complaint counts per make/model/model year
+
+CREATE TABLE IF NOT EXISTS vehicle_safety (
+    make VARCHAR(100) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    model_year INTEGER NOT NULL,
+    complaint_count INTEGER NOT NULL DEFAULT 0,
+    crash_count INTEGER NOT NULL DEFAULT 0,
+    fire_count INTEGER NOT NULL DEFAULT 0,
+    injury_count INTEGER NOT NULL DEFAULT 0,
+    death_count INTEGER NOT NULL DEFAULT 0,
+    fetched_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (make, model, model_year)
+);
+
+CREATE TABLE IF NOT EXISTS vehicle_recalls (
+    make VARCHAR(100) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    model_year INTEGER NOT NULL,
+    campaign VARCHAR(32) NOT NULL,
+    component TEXT,
+    summary TEXT,
+    consequence TEXT,
+    remedy TEXT,
+    report_date DATE,
+    park_it BOOLEAN NOT NULL DEFAULT FALSE,
+    park_outside BOOLEAN NOT NULL DEFAULT FALSE,
+    over_the_air BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (make, model, model_year, campaign),
+    FOREIGN KEY (make, model, model_year) REFERENCES vehicle_safety(make, model, model_year) ON DELETE CASCADE
+);
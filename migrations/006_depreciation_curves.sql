@@ -0,0 +1,17 @@
+-- Fitted depreciation curves per make/model/trim; trim is empty for the all-trims curve
+
+CREATE TABLE IF NOT EXISTS depreciation_curves (
+    make VARCHAR(100) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    trim VARCHAR(100) NOT NULL DEFAULT '',
+    intercept DOUBLE PRECISION NOT NULL,
+    age_coef DOUBLE PRECISION NOT NULL,
+    miles_coef DOUBLE PRECISION NOT NULL,
+    sigma DOUBLE PRECISION NOT NULL,
+    r_squared DOUBLE PRECISION NOT NULL,
+    observations INTEGER NOT NULL,
+    min_age DOUBLE PRECISION NOT NULL,
+    max_age DOUBLE PRECISION NOT NULL,
+    fitted_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (make, model, trim)
+);
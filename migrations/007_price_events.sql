@@ -0,0 +1,24 @@
+-- Price drops, increases and relistings detected by the consumer
+
+CREATE TABLE IF NOT EXISTS price_events (
+    id BIGSERIAL PRIMARY KEY,
+    vin VARCHAR(17) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    old_price INTEGER NOT NULL,
+    new_price INTEGER NOT NULL,
+    change INTEGER NOT NULL,
+    change_percent DOUBLE PRECISION NOT NULL,
+    consecutive_drops INTEGER NOT NULL DEFAULT 0,
+    previous_seen_at TIMESTAMP NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    make VARCHAR(100),
+    model VARCHAR(100),
+    year INTEGER,
+    trim VARCHAR(100),
+    miles INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE(vin, occurred_at, kind)
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_events_vin ON price_events(vin);
+CREATE INDEX IF NOT EXISTS idx_price_events_occurred_at ON price_events(occurred_at);
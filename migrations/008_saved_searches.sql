@@ -0,0 +1,27 @@
+-- Saved searches and the listings each has matched, for new-match and price-drop alerts
+
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(200) NOT NULL,
+    search JSONB NOT NULL,
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    notify_new BOOLEAN NOT NULL DEFAULT TRUE,
+    notify_drops BOOLEAN NOT NULL DEFAULT TRUE,
+    min_drop_amount INTEGER NOT NULL DEFAULT 0,
+    min_drop_percent DOUBLE PRECISION NOT NULL DEFAULT 0,
+    webhook_url TEXT,
+    email VARCHAR(320),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS saved_search_matches (
+    search_id BIGINT NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+    vin VARCHAR(17) NOT NULL,
+    price INTEGER NOT NULL,
+    first_matched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_notified_at TIMESTAMP,
+    PRIMARY KEY (search_id, vin)
+);
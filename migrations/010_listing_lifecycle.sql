@@ -0,0 +1,11 @@
+-- Listing lifecycle: when each listing was last seen, and when and for how much it was presumed sold
+
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active';
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS sold_at TIMESTAMP;
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS final_price INTEGER;
+
+UPDATE listings SET last_seen_at = COALESCE(updated_at, created_at, CURRENT_TIMESTAMP) WHERE last_seen_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_listings_status_last_seen ON listings(status, last_seen_at);
+CREATE INDEX IF NOT EXISTS idx_listings_sold_at ON listings(sold_at) WHERE status = 'sold';
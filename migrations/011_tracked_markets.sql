@@ -0,0 +1,29 @@
+-- Markets the producer sweeps when MARKETS_SOURCE=table, and per-market sweep results
+
+CREATE TABLE IF NOT EXISTS tracked_markets (
+    name VARCHAR(100) PRIMARY KEY,
+    make VARCHAR(100) NOT NULL,
+    model VARCHAR(100),
+    zip VARCHAR(10),
+    radius INTEGER,
+    year_min INTEGER,
+    year_max INTEGER,
+    max_pages INTEGER,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS market_sweeps (
+    id BIGSERIAL PRIMARY KEY,
+    market VARCHAR(100) NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    pages INTEGER NOT NULL,
+    found INTEGER NOT NULL,
+    sent INTEGER NOT NULL,
+    duplicates INTEGER NOT NULL,
+    failed INTEGER NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_market_sweeps_market ON market_sweeps(market, started_at);
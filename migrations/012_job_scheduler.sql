@@ -0,0 +1,24 @@
+-- Per-market sweep schedules, scheduler leases and job run history
+
+ALTER TABLE tracked_markets ADD COLUMN IF NOT EXISTS schedule VARCHAR(100);
+
+CREATE TABLE IF NOT EXISTS job_leases (
+    job VARCHAR(200) PRIMARY KEY,
+    holder VARCHAR(200) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS job_runs (
+    id BIGSERIAL PRIMARY KEY,
+    job VARCHAR(200) NOT NULL,
+    holder VARCHAR(200) NOT NULL,
+    scheduled_for TIMESTAMP NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP,
+    status VARCHAR(16) NOT NULL,
+    counts JSONB,
+    error TEXT,
+    UNIQUE(job, scheduled_for)
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_started ON job_runs(started_at);
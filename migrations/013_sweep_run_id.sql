@@ -0,0 +1,3 @@
+-- Producer run IDs on market sweeps, matching the ingest-run-id header of the listings they published
+
+ALTER TABLE market_sweeps ADD COLUMN IF NOT EXISTS run_id VARCHAR(64);
@@ -0,0 +1,15 @@
+-- Outbox of listing observations saved by the API, relayed to listings-raw
+-- by the producer's outbox relay; the API only writes rows
+
+CREATE TABLE IF NOT EXISTS listing_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    vin VARCHAR(17) NOT NULL,
+    payload JSONB NOT NULL,
+    source VARCHAR(50) NOT NULL,
+    trace_id VARCHAR(64),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_listing_outbox_pending ON listing_outbox(id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_listing_outbox_published ON listing_outbox(published_at);
@@ -0,0 +1,10 @@
+-- Running MarketCheck call totals per month, with the current day's count on
+-- the same row so both hard budgets are checked and bumped in one statement
+
+CREATE TABLE IF NOT EXISTS api_quota_counters (
+    month VARCHAR(7) PRIMARY KEY,
+    month_calls INTEGER NOT NULL DEFAULT 0,
+    day VARCHAR(10) NOT NULL,
+    day_calls INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,7 @@
+-- When each price event was published, so events whose publish failed are published later
+
+ALTER TABLE price_events ADD COLUMN IF NOT EXISTS published_at TIMESTAMP;
+
+UPDATE price_events SET published_at = created_at WHERE published_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_price_events_unpublished ON price_events(created_at) WHERE published_at IS NULL;
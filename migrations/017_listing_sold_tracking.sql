@@ -0,0 +1,9 @@
+-- When each listing was detected sold, and when its ListingSold event was published
+
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS sold_detected_at TIMESTAMP;
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS sold_published_at TIMESTAMP;
+
+UPDATE listings SET sold_detected_at = COALESCE(updated_at, sold_at) WHERE status = 'sold' AND sold_detected_at IS NULL;
+UPDATE listings SET sold_published_at = sold_detected_at WHERE status = 'sold' AND sold_published_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_listings_sold_unpublished ON listings(sold_detected_at) WHERE status = 'sold' AND sold_published_at IS NULL;
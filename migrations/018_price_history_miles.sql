@@ -0,0 +1,3 @@
+-- Mileage each price was asked at, for depreciation fitting
+
+ALTER TABLE price_history ADD COLUMN IF NOT EXISTS miles INTEGER;
@@ -1,5 +1,6 @@
 "use client";
 
+import { useState, useEffect } from "react";
 import Image from "next/image";
 import { X } from "lucide-react";
 
@@ -57,11 +58,33 @@ interface CarDetailModalProps {
     valuation: {
       is_good_value: boolean;
       score: number;
+      expected_price?: number;
+      price_low?: number;
+      price_high?: number;
+      percentile?: number;
+      deal_rating?: string;
+      comparables?: number;
     };
   };
   onClose: () => void;
 }
 
+interface PriceEvent {
+  kind: "drop" | "increase" | "relisted";
+  old_price: number;
+  new_price: number;
+  change: number;
+  consecutive_drops: number;
+  occurred_at: string;
+}
+
+const describeWhen = (iso: string) => {
+  const days = Math.floor((Date.now() - new Date(iso).getTime()) / 86400000);
+  if (days <= 0) return "today";
+  if (days === 1) return "yesterday";
+  return `${days} days ago`;
+};
+
 export default function CarDetailModal({ listing, onClose }: CarDetailModalProps) {
   const { listing: car, build, valuation } = listing;
   const images = car.media?.photo_links || car.media?.photo_links_cached || [];
@@ -69,6 +92,36 @@ export default function CarDetailModal({ listing, onClose }: CarDetailModalProps
   const features = car.extra?.features || [];
   const highValueFeatures = car.extra?.high_value_features || [];
   const optionsPackages = car.extra?.options_packages || [];
+  const [priceEvents, setPriceEvents] = useState<PriceEvent[]>([]);
+
+  useEffect(() => {
+    let cancelled = false;
+    const apiUrl = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
+
+    fetch(`${apiUrl}/api/listings/${encodeURIComponent(car.vin)}/price-events`)
+      .then(res => {
+        if (!res.ok) {
+          throw new Error(`HTTP error! status: ${res.status}`);
+        }
+        return res.json();
+      })
+      .then(data => {
+        if (!cancelled) {
+          setPriceEvents(data.events || []);
+        }
+      })
+      .catch(err => {
+        if (!cancelled) {
+          console.error("Error fetching price events:", err);
+        }
+      });
+
+    return () => {
+      cancelled = true;
+    };
+  }, [car.vin]);
+
+  const latestEvent = priceEvents[0];
 
   const formatPrice = (price: number) => {
     return new Intl.NumberFormat("en-US", {
@@ -139,6 +192,22 @@ export default function CarDetailModal({ listing, onClose }: CarDetailModalProps
                 </span>
               )}
             </div>
+            {latestEvent && (
+              <p className="text-sm font-semibold mt-2 text-slate-700">
+                {latestEvent.kind === "drop" && (
+                  <span className="text-green-600">
+                    Dropped {formatPrice(-latestEvent.change)} {describeWhen(latestEvent.occurred_at)}
+                    {latestEvent.consecutive_drops > 1 && <> ({latestEvent.consecutive_drops} cuts in a row)</>}
+                  </span>
+                )}
+                {latestEvent.kind === "increase" && (
+                  <>Raised {formatPrice(latestEvent.change)} {describeWhen(latestEvent.occurred_at)}</>
+                )}
+                {latestEvent.kind === "relisted" && (
+                  <>Relisted {describeWhen(latestEvent.occurred_at)}</>
+                )}
+              </p>
+            )}
             {car.msrp !== undefined && car.msrp > 0 && (
               <p className="text-slate-600 font-medium mt-2">
                 MSRP: {formatPrice(car.msrp)} • Savings: {formatPrice(car.msrp - car.price)}
@@ -149,6 +218,16 @@ export default function CarDetailModal({ listing, onClose }: CarDetailModalProps
                 Value Score: <span className="font-semibold">{(valuation.score * 100).toFixed(1)}%</span>
               </p>
             )}
+            {valuation.expected_price !== undefined && valuation.expected_price > 0 && (
+              <p className="text-sm text-slate-600 font-medium mt-2">
+                Market: <span className="font-semibold">{formatPrice(valuation.expected_price)}</span>
+                {valuation.price_low !== undefined && valuation.price_high !== undefined && (
+                  <> ({formatPrice(valuation.price_low)} – {formatPrice(valuation.price_high)})</>
+                )}
+                {valuation.deal_rating && <> • {valuation.deal_rating} deal</>}
+                {valuation.comparables !== undefined && <> • {valuation.comparables} comparables</>}
+              </p>
+            )}
           </div>
 
           {/* Key Information Grid */}
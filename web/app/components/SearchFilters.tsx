@@ -1,7 +1,6 @@
 "use client";
 
 import { useState, useEffect, startTransition } from "react";
-import makesData from "../../makes.json";
 
 interface SearchFiltersProps {
   onSearch: (filters: {
@@ -16,6 +15,7 @@ interface SearchFiltersProps {
 }
 
 export default function SearchFilters({ onSearch, loading }: SearchFiltersProps) {
+  const [makes, setMakes] = useState<string[]>([]);
   const [make, setMake] = useState("");
   const [model, setModel] = useState("");
   const [models, setModels] = useState<string[]>([]);
@@ -25,7 +25,35 @@ export default function SearchFilters({ onSearch, loading }: SearchFiltersProps)
   const [yearMin, setYearMin] = useState(2015);
   const [yearMax, setYearMax] = useState(2025);
   const currentYear = new Date().getFullYear();
-  const makes = makesData as string[];
+
+  useEffect(() => {
+    let cancelled = false;
+    const apiUrl = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
+
+    fetch(`${apiUrl}/api/makes`)
+      .then(res => {
+        if (!res.ok) {
+          throw new Error(`HTTP error! status: ${res.status}`);
+        }
+        return res.json();
+      })
+      .then(data => {
+        if (!cancelled) {
+          startTransition(() => {
+            setMakes(data.makes || []);
+          });
+        }
+      })
+      .catch(err => {
+        if (!cancelled) {
+          console.error("Error fetching makes:", err);
+        }
+      });
+
+    return () => {
+      cancelled = true;
+    };
+  }, []);
 
   useEffect(() => {
     if (!make) {